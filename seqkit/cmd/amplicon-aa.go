@@ -21,14 +21,9 @@
 package cmd
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
 	"io"
-	"os"
-	"regexp"
 	"runtime"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -38,9 +33,9 @@ import (
 	"github.com/shenwei356/bio/seqio/fai"
 	"github.com/shenwei356/bio/seqio/fastx"
 	"github.com/shenwei356/bwt"
-	"github.com/shenwei356/bwt/fmi"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
 	"github.com/twotwotwo/sorts/sortutil"
 )
 
@@ -51,14 +46,42 @@ var ampliconaaCmd = &cobra.Command{
 	Long: `extract amplicon (or specific region around it) via primer(s).
 
 Attentions:
-  1. Only one (the longest) matching location is returned for every primer pair.
-  2. Mismatch is allowed, but the mismatch location (5' or 3') is not controlled.
+  1. Only one (the longest) matching location is returned for every primer pair,
+     use "--report" to list all products.
+  2. Mismatch is allowed, and mismatches in the last N bases at the 3' end of
+     primers could be disallowed with "--no-mismatch-3end N", as PCR tolerates
+     5' mismatches far better than 3' ones.
      You can increase the value of "-j/--threads" to accelerate processing.
      You can switch "-M/--output-mismatches" to append total mismatches and
      mismatches of 5' end and 3' end.
   3. Degenerate bases/residues like "RYMM.." are also supported.
      But do not use degenerate bases/residues in regular expression, you need
      convert them to regular expression, e.g., change "N" or "X"  to ".".
+  4. The primer file (-p/--primer-file) is a tab-delimited file with 2 to 5
+     columns:
+       name, forward primer, reverse primer (optional),
+       max mismatches (optional), length of 3' end without mismatches (optional)
+     The 4th and 5th columns set the mismatch rule of a primer pair, which
+     overrides the values of "-m/--max-mismatch" and "--no-mismatch-3end".
+     An empty 5th column means 0, i.e., no limit at the 3' end.
+  5. The flag "--report" switches to an in-silico PCR report of primer pairs,
+     for validating primer sets like multiplex panels. Both primers of every
+     pair are needed. Instead of amplicon sequences, it outputs a table of
+     every product of every primer pair and template (on both strands unless
+     -P), in the columns:
+       seqID, primer, strand, start, end, size, mismatches,
+       mismatchPosF, mismatchPosR, offTarget
+     where start and end are 1-based locations on the searched strand, and
+     mismatchPosF/R are positions of mismatches in the forward/reverse
+     primers, counted from the 3' end of the primer (1 for the 3'-end base).
+     Products with any mismatch are marked as off-target.
+     Products longer than "--max-product-size" are ignored.
+     Besides, warnings are reported for:
+       a) primer pairs producing more than one product in a sequence,
+       b) primer pairs producing no products in all sequences,
+       c) primer-dimers and self-complementarity, where at least
+          "--min-dimer-len" bases at the 3' end of a primer are exactly
+          complementary to another primer or itself.
 
 Examples:
   0. no region given.
@@ -115,7 +138,7 @@ Examples:
 		seq.ValidateSeq = false
 		gtf.Threads = config.Threads
 		fai.MapWholeFile = false
-		Threads = config.Threads
+		lib.Threads = config.Threads
 		runtime.GOMAXPROCS(config.Threads)
 		bwt.CheckEndSymbol = false
 
@@ -132,38 +155,101 @@ Examples:
 		reverse0 := getFlagString(cmd, "reverse")
 		primerFile := getFlagString(cmd, "primer-file")
 		maxMismatch := getFlagNonNegativeInt(cmd, "max-mismatch")
+		noMismatch3End := getFlagNonNegativeInt(cmd, "no-mismatch-3end")
 		outputMismatches := getFlagBool(cmd, "output-mismatches")
 		strict := getFlagBool(cmd, "strict-mode")
 		onlyPositiveStrand := getFlagBool(cmd, "only-positive-strand")
 		outFmtBED := getFlagBool(cmd, "bed")
 		saveUnmatched := getFlagBool(cmd, "save-unmatched")
+		outFormat := getFlagOutFormat(cmd)
 
 		immediateOutput := getFlagBool(cmd, "immediate-output")
 
-		var list [][3]string
-		var primers [][3][]byte
+		report := getFlagBool(cmd, "report")
+		maxProductSize := getFlagNonNegativeInt(cmd, "max-product-size")
+		minDimerLen := getFlagPositiveInt(cmd, "min-dimer-len")
+		if report {
+			if region != "" {
+				checkError(fmt.Errorf("flag -r (--region) is not allowed with --report"))
+			}
+			if outFmtBED {
+				checkError(fmt.Errorf("flag --bed is not allowed with --report"))
+			}
+			if saveUnmatched {
+				checkError(fmt.Errorf("flag -u (--save-unmatched) is not allowed with --report"))
+			}
+		}
+
+		var list [][5]string
+		var primers []lib.Primer
 
 		if primerFile != "" {
-			list, err = loadPrimers(primerFile)
+			list, err = lib.LoadPrimers(primerFile)
 			checkError(err)
 		} else {
-			list = [][3]string{{".", forward0, reverse0}}
+			list = [][5]string{{".", forward0, reverse0}}
 		}
 
-		primers, err = parsePrimers(list)
+		primers, err = lib.ParsePrimers(list)
 		checkError(err)
 
 		if !config.Quiet {
 			log.Infof("%d primer pair loaded", len(primers))
 		}
 
-		var begin, end int
+		// unique names of primer pairs, for reporting
+		var pairNames []string
+		if report {
+			for _, primer := range primers {
+				if len(primer.F) == 0 || len(primer.R) == 0 {
+					checkError(fmt.Errorf("both forward and reverse primers needed for --report, primer pair: %s", primer.Name))
+				}
+			}
+
+			for _, d := range lib.FindPrimerDimers(primers, minDimerLen) {
+				if d.Self() {
+					log.Warningf("self-complementarity: %d bases at the 3' end of primer %s (%s) are complementary to itself",
+						d.Len, d.Pair1, d.Primer1)
+					continue
+				}
+				log.Warningf("primer-dimer: %d bases at the 3' end of primer %s (%s) are complementary to primer %s (%s)",
+					d.Len, d.Pair1, d.Primer1, d.Pair2, d.Primer2)
+			}
+
+			names := make(map[string]struct{}, len(primers))
+			for _, primer := range primers {
+				if _, ok := names[primer.Name]; !ok {
+					names[primer.Name] = struct{}{}
+					pairNames = append(pairNames, primer.Name)
+				}
+			}
+		}
+
+		// searching with mismatches
+		var withMismatch bool
+		for _, primer := range primers {
+			if primer.Rule != nil && primer.Rule.MaxMismatch > 0 {
+				withMismatch = true
+				break
+			}
+		}
+		if maxMismatch > 0 {
+			withMismatch = true
+		}
+
+		opt := &lib.AmpliconOptions{
+			MaxMismatch:        maxMismatch,
+			NoMismatch3End:     noMismatch3End,
+			OnlyPositiveStrand: onlyPositiveStrand,
+			Strict:             strict,
+			MaxProductSize:     maxProductSize,
+		}
 
-		var usingRegion bool
 		if region != "" {
 			if !reRegion.MatchString(region) {
 				checkError(fmt.Errorf(`invalid region: %s. type "seqkit amplicon -h" for more examples`, region))
 			}
+			var begin, end int
 			r := strings.Split(region, ":")
 			begin, err = strconv.Atoi(r[0])
 			checkError(err)
@@ -186,21 +272,78 @@ Examples:
 					checkError(fmt.Errorf("invalid inner region (-x:y): %d:%d", begin, end))
 				}
 			}
-			usingRegion = true
+			opt.Begin, opt.End, opt.Flanking = begin, end, fregion
 		}
 
-		strands := []string{"+", "-"}
+		var jw *jsonTableWriter
+		if outFormat != outFormatTSV {
+			if saveUnmatched {
+				checkError(fmt.Errorf("flag -u (--save-unmatched) is not allowed with --out-format %s", outFormat))
+			}
+			if report {
+				jw, err = newJSONTableWriter(outfh, outFormat, "amplicon.report", []string{"seq_id", "primer", "strand", "start", "end",
+					"size", "mismatches", "mismatch_pos_f", "mismatch_pos_r", "off_target"})
+				checkError(err)
+			} else {
+				jw, err = newJSONTableWriter(outfh, outFormat, "amplicon", []string{"seq_id", "primer", "strand", "start", "end",
+					"amplicon", "mismatches", "mismatches_f", "mismatches_r"})
+				checkError(err)
+			}
+			defer func() {
+				checkError(jw.Close())
+			}()
+		} else if report {
+			outfh.WriteString("seqID\tprimer\tstrand\tstart\tend\tsize\tmismatches\tmismatchPosF\tmismatchPosR\toffTarget\n")
+		}
+		format := func(record *fastx.Record, a *lib.Amplicon) string {
+			if jw == nil {
+				return formatAmplicon(record, a, outFmtBED, outputMismatches, config.LineWidth)
+			}
+			row, err := jw.Row(record.ID, a.Primer, a.Strand, a.Begin, a.End,
+				a.Seq.Seq, a.Mismatch5+a.Mismatch3, a.Mismatch5, a.Mismatch3)
+			checkError(err)
+			return string(row)
+		}
+		formatProduct := func(record *fastx.Record, p *lib.PCRProduct) string {
+			if jw == nil {
+				return formatPCRProduct(record, p)
+			}
+			misF, misR := p.MismatchesF, p.MismatchesR
+			if misF == nil {
+				misF = []int{}
+			}
+			if misR == nil {
+				misR = []int{}
+			}
+			row, err := jw.Row(record.ID, p.Primer, p.Strand, p.Begin, p.End,
+				p.Size(), len(misF)+len(misR), misF, misR, p.OffTarget())
+			checkError(err)
+			return string(row)
+		}
+		writeRow := func(row string) {
+			if jw != nil {
+				checkError(jw.WriteRaw([]byte(row)))
+				return
+			}
+			outfh.WriteString(row)
+		}
 
 		// -------------------------------------------------------------------
-		// only for m > 0, where FMI is slow
+		// only for searching with mismatches, where FMI is slow, and the report mode
 
-		if maxMismatch > 0 {
+		if withMismatch || report {
 			type Arecord struct {
 				id     uint64
 				ok     bool
 				record []string
+
+				// only for the report mode
+				seqID  string
+				counts map[string]int // primer pair -> number of products
 			}
 
+			nProducts := make(map[string]int, len(pairNames)) // primer pair -> number of products
+
 			var wg sync.WaitGroup
 			ch := make(chan *Arecord, config.Threads)
 			tokens := make(chan int, config.Threads)
@@ -213,20 +356,32 @@ Examples:
 				var _r *Arecord
 				var row string
 
+				output := func(r *Arecord) {
+					if r.ok {
+						for _, row = range r.record {
+							writeRow(row)
+						}
+
+						if immediateOutput {
+							outfh.Flush()
+						}
+					}
+
+					for _, name := range pairNames {
+						n := r.counts[name]
+						if n > 1 {
+							log.Warningf("primer pair %s: %d products in sequence %s", name, n, r.seqID)
+						}
+						nProducts[name] += n
+					}
+				}
+
 				id = 1
 				for r := range ch {
 					_id = r.id
 
 					if _id == id { // right there
-						if r.ok {
-							for _, row = range r.record {
-								outfh.WriteString(row)
-							}
-
-							if immediateOutput {
-								outfh.Flush()
-							}
-						}
+						output(r)
 						id++
 						continue
 					}
@@ -234,15 +389,7 @@ Examples:
 					m[_id] = r // save for later check
 
 					if _r, ok = m[id]; ok { // check buffered
-						if _r.ok {
-							for _, row = range _r.record {
-								outfh.WriteString(row)
-							}
-
-							if immediateOutput {
-								outfh.Flush()
-							}
-						}
+						output(_r)
 						delete(m, id)
 						id++
 					}
@@ -257,17 +404,7 @@ Examples:
 					}
 					sortutil.Uint64s(ids)
 					for _, _id = range ids {
-						_r = m[_id]
-
-						if _r.ok {
-							for _, row = range _r.record {
-								outfh.WriteString(row)
-							}
-
-							if immediateOutput {
-								outfh.Flush()
-							}
-						}
+						output(m[_id])
 					}
 				}
 				done <- 1
@@ -304,94 +441,34 @@ Examples:
 							<-tokens
 						}()
 
-						var finder *AmpliconFinder
-						var loc []int
-						var mis []int
-						var strand string
-						var tmpSeq *seq.Seq
-						var primer [3][]byte
-
-						results := make([]string, 0, 2)
-						var s []byte
-						name0 := string(record.Name)
-
-						for _, strand = range strands {
-							if strand == "-" {
-								if onlyPositiveStrand {
-									continue
-								}
-								record.Seq.RevComInplace()
-							}
+						if report {
+							products, err := lib.FindPCRProducts(record, primers, opt)
+							checkError(err)
 
-							for _, primer = range primers {
-								finder, err = NewAmpliconFinder(record.Seq.Seq, primer[1], primer[2], maxMismatch)
-								checkError(err)
-
-								if usingRegion {
-									loc, mis, err = finder.LocateRange(begin, end, fregion, strict)
-								} else {
-									loc, mis, err = finder.Locate()
-								}
-								checkError(err)
-
-								if loc == nil {
-									continue
-								}
-
-								if outFmtBED {
-									if outputMismatches {
-										s = record.Seq.SubSeq(loc[0], loc[1]).Seq
-										results = append(results, fmt.Sprintf("%s\t%d\t%d\t%s\t%d\t%s\t%s\t%d\t%d\t%d\n",
-											record.ID,
-											loc[0]-1,
-											loc[1],
-											primer[0],
-											0,
-											strand,
-											s,
-											mis[0]+mis[1],
-											mis[0],
-											mis[1],
-										))
-									} else {
-										results = append(results, fmt.Sprintf("%s\t%d\t%d\t%s\t%d\t%s\t%s\n",
-											record.ID,
-											loc[0]-1,
-											loc[1],
-											primer[0],
-											0,
-											strand,
-											record.Seq.SubSeq(loc[0], loc[1]).Seq))
-									}
-
-									continue
-								}
-								tmpSeq = record.Seq
-
-								record.Seq = record.Seq.SubSeq(loc[0], loc[1])
-								if outputMismatches {
-									record.Name = []byte(fmt.Sprintf("%s mismatches=%d(%d+%d)", name0, mis[0]+mis[1], mis[0], mis[1]))
-								}
-								results = append(results, string(record.Format(config.LineWidth)))
-
-								record.Seq = tmpSeq
+							results := make([]string, 0, len(products))
+							counts := make(map[string]int, len(pairNames))
+							for i := range products {
+								results = append(results, formatProduct(record, &products[i]))
+								counts[products[i].Primer]++
 							}
+
+							ch <- &Arecord{record: results, id: id, ok: len(results) > 0,
+								seqID: string(record.ID), counts: counts}
+							return
 						}
 
-						if len(results) > 0 {
-							ch <- &Arecord{record: results, id: id, ok: true}
-						} else if saveUnmatched {
-							if onlyPositiveStrand {
-								results = append(results, string(record.Format(config.LineWidth)))
-							} else {
-								record.Seq.RevComInplace()
-								results = append(results, string(record.Format(config.LineWidth)))
-							}
-							ch <- &Arecord{record: results, id: id, ok: true}
-						} else {
-							ch <- &Arecord{record: results, id: id, ok: false}
+						amplicons, err := lib.FindAmplicons(record, primers, opt)
+						checkError(err)
+
+						results := make([]string, 0, len(amplicons))
+						for i := range amplicons {
+							results = append(results, format(record, &amplicons[i]))
+						}
+						if len(results) == 0 && saveUnmatched {
+							results = append(results, string(record.Format(config.LineWidth)))
 						}
 
+						ch <- &Arecord{record: results, id: id, ok: len(results) > 0}
 					}(record.Clone(), id)
 				}
 
@@ -402,20 +479,17 @@ Examples:
 			close(ch)
 			<-done
 
+			for _, name := range pairNames {
+				if nProducts[name] == 0 {
+					log.Warningf("primer pair %s: no products", name)
+				}
+			}
 			return
 		}
 
 		var record *fastx.Record
 		var fastxReader *fastx.Reader
-
-		var finder *AmpliconFinder
-		var loc []int
-
-		var strand string
-		var tmpSeq *seq.Seq
-		var primer [3][]byte
-		var matched bool
-		var name0 string
+		var amplicons []lib.Amplicon
 
 		for _, file := range files {
 			fastxReader, err = fastx.NewReader(alphabet, file, idRegexp)
@@ -435,79 +509,14 @@ Examples:
 					fastx.ForcelyOutputFastq = true
 				}
 
-				matched = false
-				name0 = string(record.Name)
-
-				for _, strand = range strands {
-					if strand == "-" {
-						if onlyPositiveStrand {
-							continue
-						}
-						record.Seq.RevComInplace()
-					}
-
-					for _, primer = range primers {
-						finder, err = NewAmpliconFinder(record.Seq.Seq, primer[1], primer[2], maxMismatch)
-						checkError(err)
-
-						if usingRegion {
-							loc, _, err = finder.LocateRange(begin, end, fregion, strict)
-						} else {
-							loc, _, err = finder.Locate()
-						}
-						checkError(err)
-
-						if loc == nil {
-							continue
-						}
-
-						matched = true
-
-						if outFmtBED {
-							if outputMismatches {
-								fmt.Fprintf(outfh,
-									"%s\t%d\t%d\t%s\t%d\t%s\t%s\t%d\t%d\t%d\n",
-									record.ID,
-									loc[0]-1,
-									loc[1],
-									primer[0],
-									0,
-									strand,
-									record.Seq.SubSeq(loc[0], loc[1]).Seq,
-									0,
-									0,
-									0,
-								)
-							} else {
-								fmt.Fprintf(outfh,
-									"%s\t%d\t%d\t%s\t%d\t%s\t%s\n",
-									record.ID,
-									loc[0]-1,
-									loc[1],
-									primer[0],
-									0,
-									strand,
-									record.Seq.SubSeq(loc[0], loc[1]).Seq)
-							}
-
-							continue
-						}
-						tmpSeq = record.Seq
-
-						record.Seq = record.Seq.SubSeq(loc[0], loc[1])
-						if outputMismatches {
-							record.Name = []byte(fmt.Sprintf("%s mismatches=%d(%d+%d)", name0, 0, 0, 0))
-						}
-						record.FormatToWriter(outfh, config.LineWidth)
+				amplicons, err = lib.FindAmplicons(record, primers, opt)
+				checkError(err)
 
-						record.Seq = tmpSeq
-					}
+				for i := range amplicons {
+					writeRow(format(record, &amplicons[i]))
 				}
 
-				if saveUnmatched && !matched {
-					if !onlyPositiveStrand {
-						record.Seq.RevComInplace()
-					}
+				if saveUnmatched && len(amplicons) == 0 {
 					record.FormatToWriter(outfh, config.LineWidth)
 				}
 			}
@@ -524,7 +533,8 @@ func init() {
 	ampliconaaCmd.Flags().StringP("reverse", "R", "", "reverse primer (5'-primer-3'), degenerate bases allowed")
 	ampliconaaCmd.Flags().IntP("max-mismatch", "m", 0, "max mismatch when matching primers, no degenerate bases allowed")
 	ampliconaaCmd.Flags().BoolP("output-mismatches", "M", false, "append the total mismatches and mismatches of 5' end and 3' end")
-	ampliconaaCmd.Flags().StringP("primer-file", "p", "", "3- or 2-column tabular primer file, with first column as primer name")
+	ampliconaaCmd.Flags().IntP("no-mismatch-3end", "", 0, "no mismatches allowed in the last N bases at the 3' end of primers, 0 for no limit")
+	ampliconaaCmd.Flags().StringP("primer-file", "p", "", `2- to 5-column tabular primer file, with first column as primer name, and optional mismatch rules. type "seqkit amplicon -h" for details`)
 
 	ampliconaaCmd.Flags().StringP("region", "r", "", `specify region to return. type "seqkit amplicon -h" for detail`)
 	ampliconaaCmd.Flags().BoolP("flanking-region", "f", false, "region is flanking region")
@@ -533,469 +543,76 @@ func init() {
 	ampliconaaCmd.Flags().BoolP("bed", "", false, "output in BED6+1 format with amplicon as the 7th column")
 	ampliconaaCmd.Flags().BoolP("immediate-output", "I", false, "print output immediately, do not use write buffer")
 	ampliconaaCmd.Flags().BoolP("save-unmatched", "u", false, "also save records that do not match any primer")
-}
-
-// only used in this command
-func amplicon_mismatches(s1, s2 []byte) int {
-	var n int
-	for i, a := range s1 {
-		if a != s2[i] {
-			n++
-		}
-	}
-	return n
-}
-
-func loadPrimers(file string) ([][3]string, error) {
-	fh, err := os.Open(file)
-	if err != nil {
-		return nil, fmt.Errorf("load primers from '%s': %s", file, err)
-	}
-
-	var text string
-	var items []string
-	lists := make([][3]string, 0, 100)
-	scanner := bufio.NewScanner(fh)
-	for scanner.Scan() {
-		text = strings.TrimSpace(scanner.Text())
-		if text == "" || text[0] == '#' {
-			continue
-		}
-
-		items = strings.Split(text, "\t")
-		switch len(items) {
-		case 3:
-			lists = append(lists, [3]string{items[0], items[1], items[2]})
-		case 2:
-			lists = append(lists, [3]string{items[0], items[1], ""})
-		default:
-			continue
-		}
-	}
-	if err = scanner.Err(); err != nil {
-		return nil, fmt.Errorf("load primers from '%s': %s", file, err)
-	}
-
-	return lists, nil
-}
-
-func parsePrimers(primers [][3]string) ([][3][]byte, error) {
-	list := make([][3][]byte, 0, len(primers))
-
-	for _, items := range primers {
-		name := []byte(items[0])
-
-		forward := []byte(items[1])
-		if seq.Unlimit.IsValid(forward) != nil {
-			return nil, fmt.Errorf("invalid primer sequence: %s", forward)
-		}
-
-		reverse := []byte(items[2])
-		if seq.Unlimit.IsValid(reverse) != nil {
-			return nil, fmt.Errorf("invalid primer sequence: %s", reverse)
-		}
-
-		// compute revcom of reverse
-		s, _ := seq.NewSeq(seq.Unlimit, reverse)
-		reverse = s.Reverse().Seq
 
-		list = append(list, [3][]byte{name, forward, reverse})
-	}
-	return list, nil
-}
-
-// AmpliconFinder is a struct for locating amplicon via primer(s).
-type AmpliconFinder struct {
-	Seq []byte
-	F   []byte // Forward primer
-	R   []byte // R should be reverse complementary sequence of reverse primer
-
-	MaxMismatch int
-	FMindex     *fmi.FMIndex
-
-	searched, found bool
-	iBegin, iEnd    int // 0-based
-	mis5, mis3      int
-
-	rF, rR *regexp.Regexp
-}
-
-// NewAmpliconFinder returns a AmpliconFinder struct.
-func NewAmpliconFinder(sequence, forwardPrimer, reversePrimerRC []byte, maxMismatch int) (*AmpliconFinder, error) {
-	if len(sequence) == 0 {
-		return nil, fmt.Errorf("non-blank sequence needed")
-	}
-	if len(forwardPrimer) == 0 && len(reversePrimerRC) == 0 {
-		return nil, fmt.Errorf("at least one primer needed")
-	}
-
-	if len(forwardPrimer) == 0 { // F = R.revcom()
-		forwardPrimer = reversePrimerRC
-		reversePrimerRC = nil
-	}
-
-	finder := &AmpliconFinder{
-		Seq: bytes.ToUpper(sequence), // to upper case
-		F:   bytes.ToUpper(forwardPrimer),
-		R:   bytes.ToUpper(reversePrimerRC),
-	}
-
-	if maxMismatch > 0 { // using FM-index
-		index := fmi.NewFMIndex()
-		_, err := index.Transform(finder.Seq)
-		if err != nil {
-			return nil, err
-		}
-		finder.MaxMismatch = maxMismatch
-		finder.FMindex = index
-	} else {
-		if seq.Unlimit.IsValid(finder.F) != nil { // containing degenerate base
-			if maxMismatch > 0 {
-				checkError(fmt.Errorf("it does not support both degenerate base and mismatch"))
-			}
-			s, _ := seq.NewSeq(seq.Unlimit, finder.F)
-			rF, err := regexp.Compile(s.Degenerate2Regexp())
-			if err != nil {
-				return nil, fmt.Errorf("fail to parse primer containing degenerate base: %s", finder.F)
-			}
-			finder.rF = rF
-		}
-
-		if seq.Unlimit.IsValid(finder.R) != nil { // containing degenerate base
-			if maxMismatch > 0 {
-				checkError(fmt.Errorf("it does not support both degenerate base and mismatch"))
-			}
-			s, _ := seq.NewSeq(seq.Unlimit, finder.R)
-			rR, err := regexp.Compile(s.Degenerate2Regexp())
-			if err != nil {
-				return nil, fmt.Errorf("fail to parse primer containing degenerate base: %s", finder.R)
-			}
-			finder.rR = rR
-		}
-	}
-	return finder, nil
-}
-
-// LocateRange returns location of the range (begin:end, 1-based).
-func (finder *AmpliconFinder) LocateRange(begin, end int, flanking bool, strictMode bool) ([]int, []int, error) {
-	if begin == 0 || end == 0 {
-		checkError(fmt.Errorf("both begin and end in region should not be 0"))
-	}
-
-	if !finder.searched {
-		_, _, err := finder.Locate()
-		if err != nil {
-			return nil, nil, err
-		}
-	}
-	if !finder.found {
-		return nil, nil, nil
-	}
-
-	var b, e int
-	var ok bool
-	if flanking {
-		b, e, ok = SubLocationFlanking(len(finder.Seq), finder.iBegin, finder.iEnd, begin, end, strictMode)
-	} else {
-		b, e, ok = SubLocationInner(len(finder.Seq), finder.iBegin, finder.iEnd, begin, end, strictMode)
-	}
-
-	if ok {
-		return []int{b, e}, []int{finder.mis5, finder.mis3}, nil
-	}
-
-	return nil, nil, nil
-}
-
-// SubLocationInner returns location of a range (begin:end, relative to amplicon).
-// B/E: 0-based, location of amplicon.
-// begin/end: 1-based, begin: relative location to 5' end of amplicon,
-// end: relative location to 3' end of amplicon.
-// Returned locations are 1-based.
-//
-//                     F
-//         -----===============-----
-//              1 3 5                    x/y
-//                       -5-3-1          x/y
-//              F             R
-//         -----=====-----=====-----     x:y
-//
-//              ===============          1:-1
-//              =======                  1:7
-//                =====                  3:7
-//                   =====               6:10
-//                   =====             -10:-6
-//                      =====           -7:-3
-//                                      -x:y (invalid)
-//
-func SubLocationInner(length, B, E, begin, end int, strictMode bool) (int, int, bool) {
-	if begin == 0 || end == 0 {
-		return 0, 0, false
-	}
-
-	if begin < 0 && end > 0 {
-		checkError(fmt.Errorf("invalid inner region (-x:y): %d:%d", begin, end))
-	}
-
-	if length == 0 || B < 0 || B > length-1 || E < 0 || E > length-1 {
-		return 0, 0, false
-	}
-
-	var b, e int
-
-	if begin > 0 {
-		b = B + begin
-	} else {
-		b = E + begin + 2
-	}
-	if b > length {
-		if strictMode {
-			return 0, 0, false
-		}
-		b = length
-	} else if b < 1 {
-		if strictMode {
-			return 0, 0, false
-		}
-		b = 1
-	}
-
-	if end > 0 {
-		e = B + end
-	} else {
-		e = E + end + 2
-	}
-	if e > length {
-		if strictMode {
-			return 0, 0, false
-		}
-		e = length
-	} else if e < 1 {
-		if strictMode {
-			return 0, 0, false
-		}
-		e = 1
-	}
-
-	if b > e {
-		return b, e, false
-	}
-
-	return b, e, true
+	ampliconaaCmd.Flags().BoolP("report", "", false, `output an in-silico PCR report of all products and warnings of primer pairs. type "seqkit amplicon -h" for details`)
+	ampliconaaCmd.Flags().IntP("max-product-size", "", 5000, "maximum product size in the report mode, 0 for no limit")
+	ampliconaaCmd.Flags().IntP("min-dimer-len", "", 5, "minimum length of 3'-end complementary bases of primers to warn primer-dimers in the report mode")
 }
 
-// SubLocationFlanking returns location of a flanking range (begin:end, relative to amplicon).
-// B/E: 0-based, location of amplicon.
-// begin/end: 1-based, begin: relative location to 5' end of amplicon,
-// end: relative location to 3' end of amplicon.
-// Returned locations are 1-based.
-//
-//                     F
-//         -----===============-----
-//          -3-1                        x/y
-//                             1 3 5    x/y
-//              F             R
-//         -----=====-----=====-----
-//         =====                        -5:-1
-//         ===                          -5:-3
-//                             =====     1:5
-//                               ===     3:5
-//             =================        -1:1
-//         =========================    -5:5
-//                                       x:-y (invalid)
-//
-func SubLocationFlanking(length, B, E, begin, end int, strictMode bool) (int, int, bool) {
-	if begin == 0 || end == 0 {
-		return 0, 0, false
-	}
-
-	if begin > 0 && end < 0 {
-		checkError(fmt.Errorf("invalid flanking region (x:-y): %d:%d", begin, end))
-	}
-
-	if length == 0 || B < 0 || B > length-1 || E < 0 || E > length-1 {
-		return 0, 0, false
-	}
-
-	var b, e int
-	var flag bool // 5' flanking is shorter than -begin
-
-	if begin > 0 {
-		b = E + begin + 1
-	} else {
-		b = B + begin + 1
-	}
-	if b > length {
-		// b = length
-		return 0, 0, false
-	} else if b < 1 {
-		if strictMode {
-			return 0, 0, false
+// formatAmplicon formats an amplicon of a record in BED6+1 (+3 with mismatches)
+// or FASTA/Q format.
+func formatAmplicon(record *fastx.Record, a *lib.Amplicon, outFmtBED bool, outputMismatches bool, lineWidth int) string {
+	if outFmtBED {
+		if outputMismatches {
+			return fmt.Sprintf("%s\t%d\t%d\t%s\t%d\t%s\t%s\t%d\t%d\t%d\n",
+				record.ID,
+				a.Begin-1,
+				a.End,
+				a.Primer,
+				0,
+				a.Strand,
+				a.Seq.Seq,
+				a.Mismatch5+a.Mismatch3,
+				a.Mismatch5,
+				a.Mismatch3,
+			)
 		}
-		b = 1
-		flag = true
-		// return 0, 0, false
-	}
-
-	if end > 0 {
-		e = E + end + 1
-	} else {
-		e = B + end + 1
-	}
-	if e > length {
-		if strictMode {
-			return 0, 0, false
-		}
-		e = length
-	} else if e < 1 {
-		if strictMode {
-			return 0, 0, false
-		}
-		if flag {
-			return 0, 0, false
-		}
-		e = 1
-	}
-
-	if b > e {
-		return b, e, false
-	}
-
-	return b, e, true
+		return fmt.Sprintf("%s\t%d\t%d\t%s\t%d\t%s\t%s\n",
+			record.ID,
+			a.Begin-1,
+			a.End,
+			a.Primer,
+			0,
+			a.Strand,
+			a.Seq.Seq)
+	}
+
+	name := record.Name
+	if outputMismatches {
+		name = []byte(fmt.Sprintf("%s mismatches=%d(%d+%d)", record.Name, a.Mismatch5+a.Mismatch3, a.Mismatch5, a.Mismatch3))
+	}
+	amplicon := &fastx.Record{ID: record.ID, Name: name, Desc: record.Desc, Seq: a.Seq}
+	return string(amplicon.Format(lineWidth))
 }
 
-// Locate returns location of amplicon.
-// Locations are 1-based, nil returns if not found.
-func (finder *AmpliconFinder) Locate() ([]int, []int, error) {
-	if finder.searched {
-		if finder.found {
-			return []int{finder.iBegin, finder.iEnd}, []int{finder.mis5, finder.mis3}, nil
-		}
-		return nil, nil, nil
-	}
-
-	if finder.MaxMismatch <= 0 { // exactly matching
-		// search F
-		var i int
-
-		if finder.rF == nil {
-			i = bytes.Index(finder.Seq, finder.F)
-			if i < 0 { // not found
-				finder.searched, finder.found = true, false
-				return nil, nil, nil
-			}
-		} else {
-			loc := finder.rF.FindSubmatchIndex(finder.Seq)
-			if len(loc) == 0 {
-				finder.searched, finder.found = true, false
-				return nil, nil, nil
-			}
-			i = loc[0]
-		}
-
-		if len(finder.R) == 0 { // only forward primer, returns location of F
-			finder.searched, finder.found = true, true
-			finder.iBegin, finder.iEnd = i, i+len(finder.F)-1
-			finder.mis5 = amplicon_mismatches(finder.Seq[i:i+len(finder.F)], finder.F)
-			finder.mis3 = 0
-			return []int{i + 1, i + len(finder.F)},
-				[]int{finder.mis5, finder.mis3},
-				nil
-		}
-
-		// two primers given, need to search R
-		var j int
-		if finder.rR == nil {
-			j = bytes.Index(finder.Seq, finder.R)
-			if j < 0 {
-				finder.searched, finder.found = true, false
-				return nil, nil, nil
-			}
-
-			for {
-				if j+1 >= len(finder.Seq) {
-					break
-				}
-				k := bytes.Index(finder.Seq[j+1:], finder.R)
-				if k < 0 {
-					break
-				}
-				j += k + 1
-			}
-		} else {
-			loc := finder.rR.FindAllSubmatchIndex(finder.Seq, -1)
-			if len(loc) == 0 {
-				finder.searched, finder.found = true, false
-				return nil, nil, nil
-			}
-			j = loc[len(loc)-1][0]
-		}
-
-		if j < i { // wrong location of F and R:  5' ---R-----F---- 3'
-			finder.searched, finder.found = true, false
-			return nil, nil, nil
-		}
-		finder.searched, finder.found = true, true
-		finder.iBegin, finder.iEnd = i, j+len(finder.R)-1
-		finder.mis5 = amplicon_mismatches(finder.Seq[i:i+len(finder.F)], finder.F)
-		finder.mis3 = amplicon_mismatches(finder.Seq[j:j+len(finder.R)], finder.R)
-		return []int{i + 1, j + len(finder.R)},
-			[]int{finder.mis5, finder.mis3},
-			nil
-	}
-
-	// search F
-	locsI, err := finder.FMindex.Locate(finder.F, finder.MaxMismatch)
-	if err != nil {
-		return nil, nil, err
-	}
-	if len(locsI) == 0 { // F not found
-		finder.searched, finder.found = true, false
-		return nil, nil, nil
-	}
-	if len(finder.R) == 0 { // returns location of F
-		sort.Ints(locsI) // remain the first location
-		finder.searched, finder.found = true, true
-		finder.iBegin, finder.iEnd = locsI[0], locsI[0]+len(finder.F)-1
-		finder.mis5 = amplicon_mismatches(finder.Seq[locsI[0]:locsI[0]+len(finder.F)], finder.F)
-		finder.mis3 = 0
-		return []int{locsI[0] + 1, locsI[0] + len(finder.F)},
-			[]int{finder.mis5, finder.mis3},
-			nil
-	}
-
-	// search R
-	locsJ, err := finder.FMindex.Locate(finder.R, finder.MaxMismatch)
-	if err != nil {
-		return nil, nil, err
-	}
-	if len(locsJ) == 0 {
-		finder.searched, finder.found = true, false
-		return nil, nil, nil
-	}
-	sort.Ints(locsI) // to remain the FIRST location
-	sort.Ints(locsJ) // to remain the LAST location
-	finder.searched, finder.found = true, true
-	finder.iBegin, finder.iEnd = locsI[0], locsJ[len(locsJ)-1]+len(finder.R)-1
-	finder.mis5 = amplicon_mismatches(finder.Seq[locsI[0]:locsI[0]+len(finder.F)], finder.F)
-	finder.mis3 = amplicon_mismatches(finder.Seq[locsJ[len(locsJ)-1]:locsJ[len(locsJ)-1]+len(finder.R)], finder.R)
-	return []int{locsI[0] + 1, locsJ[len(locsJ)-1] + len(finder.R)},
-		[]int{finder.mis5, finder.mis3},
-		nil
+// formatPCRProduct formats a product of in-silico PCR of a record in a row
+// of the report.
+func formatPCRProduct(record *fastx.Record, p *lib.PCRProduct) string {
+	offTarget := "no"
+	if p.OffTarget() {
+		offTarget = "yes"
+	}
+	return fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n",
+		record.ID,
+		p.Primer,
+		p.Strand,
+		p.Begin,
+		p.End,
+		p.Size(),
+		len(p.MismatchesF)+len(p.MismatchesR),
+		joinInts(p.MismatchesF),
+		joinInts(p.MismatchesR),
+		offTarget)
 }
 
-// Location returns location of amplicon.
-// Locations are 1-based, nil returns if not found.
-func (finder *AmpliconFinder) Location() ([]int, []int, error) {
-	if !finder.searched {
-		_, _, err := finder.Locate()
-		if err != nil {
-			return nil, nil, err
-		}
+// joinInts joins integers with commas, "-" is returned for an empty list.
+func joinInts(list []int) string {
+	if len(list) == 0 {
+		return "-"
 	}
-	if !finder.found {
-		return nil, nil, nil
+	items := make([]string, len(list))
+	for i, v := range list {
+		items[i] = strconv.Itoa(v)
 	}
-
-	return []int{finder.iBegin + 1, finder.iEnd + 1}, []int{finder.mis5, finder.mis3}, nil
+	return strings.Join(items, ",")
 }
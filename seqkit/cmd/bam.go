@@ -176,7 +176,7 @@ func reportCounts(readCounts ReadCounts, countFile string, field string, rangeMi
 }
 
 // CountReads counts total, secondary and supplementary reads mapped to each reference.
-func CountReads(bamReader *bam.Reader, bamWriter *bam.Writer, countFile string, field string, rangeMin, rangeMax float64, printPass bool, printPrim bool, printLog bool, printBins int, binMode string, mapQual int, printFreq int, printDump bool, printDelay int, printPdf string, execBefore, execAfter string, includeIds map[string]bool, excludeIds map[string]bool, printQuiet bool) {
+func CountReads(bamReader BamRecordReader, bamWriter *bam.Writer, countFile string, field string, rangeMin, rangeMax float64, printPass bool, printPrim bool, printLog bool, printBins int, binMode string, mapQual int, printFreq int, printDump bool, printDelay int, printPdf string, execBefore, execAfter string, includeIds map[string]bool, excludeIds map[string]bool, printQuiet bool) {
 	readCounts := NewReadCounts(bamReader.Header().Refs())
 	validFields := []string{"Count", "SecCount", "SupCount"}
 	fields := strings.Split(field, ",")
@@ -416,7 +416,20 @@ func bamStatsOnce(f string, mapQual int, includeIds map[string]bool, excludeIds
 }
 
 // bamStats calculates detailed statistics for multiple BAM files and prints to stderr.
-func bamStats(files []string, mapQual int, includeIds map[string]bool, excludeIds map[string]bool, threads int, pretty bool) {
+func bamStats(files []string, mapQual int, includeIds map[string]bool, excludeIds map[string]bool, threads int, pretty bool, outFormat string) {
+	if outFormat != outFormatTSV {
+		jw, err := newJSONTableWriter(os.Stderr, outFormat, "bam.stats", []string{"prim_aln_perc", "multimap_perc",
+			"prim_aln", "sec_aln", "sup_aln", "unmapped", "total_reads", "total_records", "file"})
+		checkError(err)
+		for _, f := range files {
+			s := bamStatsOnce(f, mapQual, includeIds, excludeIds, threads)
+			checkError(jw.WriteRow(s.PrimAlnPerc, s.MultimapPerc, s.PrimAln, s.SecAln, s.SupAln,
+				s.Unmapped, s.TotalReads, s.TotalRec, s.File))
+		}
+		checkError(jw.Close())
+		return
+	}
+
 	width := 0
 	if pretty {
 		width = -1
@@ -446,7 +459,19 @@ func bamStats(files []string, mapQual int, includeIds map[string]bool, excludeId
 }
 
 // idxStats print rough statistics for multiple BAM files to stderr.
-func idxStats(files []string, pretty bool) {
+func idxStats(files []string, pretty bool, outFormat string) {
+	if outFormat != outFormatTSV {
+		jw, err := newJSONTableWriter(os.Stderr, outFormat, "bam.idxstats", []string{"aln_perc", "aligned", "unmapped", "total_records", "file"})
+		checkError(err)
+		for _, f := range files {
+			s := bamIdxStats(f)
+			checkError(jw.WriteRow(float64(s.PrimAln*100)/float64(s.PrimAln+s.Unmapped),
+				s.PrimAln, s.Unmapped, s.PrimAln+s.Unmapped, s.File))
+		}
+		checkError(jw.Close())
+		return
+	}
+
 	width := 0
 	if pretty {
 		width = -1
@@ -536,6 +561,10 @@ var bamCmd = &cobra.Command{
 		toolYaml := getFlagString(cmd, "tool")
 		includeIdList := getFlagString(cmd, "grep-ids")
 		excludeIdList := getFlagString(cmd, "exclude-ids")
+		regionStrs := getFlagStringSlice(cmd, "region")
+		regionFile := getFlagString(cmd, "region-file")
+		printDepth := getFlagString(cmd, "depth")
+		depthWindow := getFlagNonNegativeInt(cmd, "depth-window")
 
 		var includeIds map[string]bool
 		var excludeIds map[string]bool
@@ -548,13 +577,37 @@ var bamCmd = &cobra.Command{
 			excludeIds = loadIdList(excludeIdList)
 		}
 
+		var regions []*BamRegion
+		for _, r := range regionStrs {
+			region, err := ParseBamRegion(r)
+			checkError(err)
+			regions = append(regions, region)
+		}
+		if regionFile != "" {
+			rs, err := LoadBamRegions(regionFile)
+			checkError(err)
+			if len(rs) == 0 {
+				log.Warningf("no regions found in file: %s", regionFile)
+			}
+			regions = append(regions, rs...)
+		}
+		queryRegions := len(regionStrs) > 0 || regionFile != ""
+		if queryRegions {
+			if printIdxStat || printStat || printIdxCount || printBundle != 0 {
+				checkError(fmt.Errorf("flag -r/--region and --region-file are not supported by -i/--idx-stat, -s/--stat, -C/--idx-count and -N/--bundle"))
+			}
+			if len(files) != 1 {
+				checkError(fmt.Errorf("only one BAM file is allowed when querying regions"))
+			}
+		}
+
 		if printIdxStat {
-			idxStats(files, prettyTSV)
+			idxStats(files, prettyTSV, getFlagOutFormat(cmd))
 			os.Exit(0)
 		}
 
 		if printStat {
-			bamStats(files, mapQual, includeIds, excludeIds, config.Threads, prettyTSV)
+			bamStats(files, mapQual, includeIds, excludeIds, config.Threads, prettyTSV, getFlagOutFormat(cmd))
 			os.Exit(0)
 		}
 
@@ -571,7 +624,7 @@ var bamCmd = &cobra.Command{
 			if len(files) != 1 {
 				log.Fatal("The BAM toolbox takes exactly one input file!")
 			}
-			BamToolbox(toolYaml, files[0], outFile, printQuiet, silentMode, config.Threads)
+			BamToolbox(toolYaml, files[0], outFile, printQuiet, silentMode, config.Threads, regions, queryRegions)
 			os.Exit(0)
 		}
 
@@ -591,6 +644,10 @@ var bamCmd = &cobra.Command{
 			binMode = "fixed"
 		}
 
+		if printPass && printDepth != "" {
+			checkError(fmt.Errorf("flag -x/--pass is not supported by -D/--depth"))
+		}
+
 		if printPass && printCount == "-" {
 			fmt.Fprintf(os.Stderr, "Cannot enable pass-through mode when count output is stdout!\n")
 			os.Exit(1)
@@ -822,7 +879,15 @@ var bamCmd = &cobra.Command{
 			os.Exit(0)
 		}
 
-		bamReader := NewBamReader(files[0], config.Threads)
+		var bamReader BamRecordReader
+		if queryRegions {
+			regionReader, err := NewBamRegionReader(files[0], regions, config.Threads)
+			checkError(err)
+			defer regionReader.Close()
+			bamReader = regionReader
+		} else {
+			bamReader = NewBamReader(files[0], config.Threads)
+		}
 		bamHeader := bamReader.Header()
 
 		var bamWriter *bam.Writer
@@ -842,6 +907,11 @@ var bamCmd = &cobra.Command{
 			outfh.Flush()
 		}
 
+		if printDepth != "" {
+			bamDepth(bamReader, printDepth, depthWindow, mapQual, printPrim, includeIds, excludeIds, prettyTSV, getFlagOutFormat(cmd), printQuiet, printDump, printPdf, printBins, binMode)
+			return
+		}
+
 		if printCount != "" {
 			CountReads(bamReader, bamWriter, printCount, field, rangeMin, rangeMax, printPass, printPrim, printLog, printBins, binMode, mapQual, printFreq, printDump, printDelay, printPdf, execBefore, execAfter, includeIds, excludeIds, printQuiet)
 			outfh.Flush()
@@ -1259,6 +1329,8 @@ func init() {
 	bamCmd.Flags().BoolP("idx-stat", "i", false, "fast statistics based on the BAM index")
 	bamCmd.Flags().BoolP("idx-count", "C", false, "fast read per reference counting based on the BAM index")
 	bamCmd.Flags().StringP("count", "c", "", "count reads per reference and save to this file")
+	bamCmd.Flags().StringP("depth", "D", "", "compute depth of coordinate-sorted records and save bedGraph to this file, with a per-reference summary to stderr. Only the queried regions are computed with -r/--region or --region-file")
+	bamCmd.Flags().IntP("depth-window", "", 0, "report mean depth of fixed windows of this size for -D/--depth, and plot their histogram, 0 for per-base depth (no histogram, as depths of all bases are too many to plot, use 1 to plot them)")
 	bamCmd.Flags().StringP("tool", "T", "", "invoke toolbox in YAML format (see documentation)")
 	bamCmd.Flags().BoolP("log", "L", false, "log10(x+1) transform numeric values")
 	bamCmd.Flags().BoolP("reset", "R", false, "reset histogram after every report")
@@ -1273,5 +1345,7 @@ func init() {
 	bamCmd.Flags().StringP("top-bam", "@", "", "save the top -? records to this bam file")
 	bamCmd.Flags().StringP("grep-ids", "g", "", "only keep records with IDs contained in this file")
 	bamCmd.Flags().StringP("exclude-ids", "G", "", "exclude records with IDs contained in this file")
+	bamCmd.Flags().StringSliceP("region", "r", []string{}, `only read records overlapping with the region (chr, chr:start, or chr:start-end, 1-based) via the BAM index, multiple values supported`)
+	bamCmd.Flags().StringP("region-file", "", "", "only read records overlapping with regions in this BED file via the BAM index")
 	bamCmd.Flags().IntP("top-size", "?", 100, "size of the top-mode buffer")
 }
@@ -0,0 +1,263 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/biogo/hts/sam"
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// bam2fxCmd represents the bam2fx command
+var bam2fxCmd = &cobra.Command{
+	Use:   "bam2fx",
+	Short: "convert SAM/BAM to FASTQ/FASTA, restoring original reads",
+	Long: `convert SAM/BAM to FASTQ/FASTA, restoring original reads
+
+Reads aligned to the reverse strand are reverse-complemented, and their
+quality scores are reversed, to restore the sequences of original reads.
+So unaligned and aligned BAM files can both be converted back to FASTQ.
+
+Attentions:
+  1. The input format is detected from the content. CRAM is not supported,
+     please convert it to BAM first, e.g., samtools view -b.
+  2. Secondary and supplementary alignments, and records without sequences,
+     are skipped. Hard-clipped bases can not be restored.
+  3. Aux tags given by -T/--tags are appended to the header line in the SAM
+     format (TAG:TYPE:VALUE) and separated by tabs, e.g., "RG:Z:grp1".
+     Use "-T '*'" to copy all tags.
+  4. With -1/--read1 and -2/--read2, reads flagged as read1 (0x40) and
+     read2 (0x80) are saved into the two files, respectively,
+     other reads are saved into the file given by -o/--out-file.
+  5. Missing quality scores are filled with '!'.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		lineWidth := config.LineWidth
+		outFile := config.OutFile
+		quiet := config.Quiet
+		runtime.GOMAXPROCS(config.Threads)
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+
+		read1 := getFlagString(cmd, "read1")
+		read2 := getFlagString(cmd, "read2")
+		if (read1 == "") != (read2 == "") {
+			checkError(fmt.Errorf("flag -1/--read1 and -2/--read2 should be given together"))
+		}
+		splitMates := read1 != ""
+		if splitMates && (read1 == read2 || read1 == outFile || read2 == outFile) {
+			checkError(fmt.Errorf("values of flag -1/--read1, -2/--read2 and -o/--out-file should be different"))
+		}
+
+		fasta := getFlagBool(cmd, "fasta")
+		mateSuffix := getFlagBool(cmd, "mate-suffix")
+		if !fasta {
+			lineWidth = 0
+		}
+
+		var allTags bool
+		var tags []sam.Tag
+		tagsStr := getFlagString(cmd, "tags")
+		if tagsStr == "*" {
+			allTags = true
+		} else if tagsStr != "" {
+			for _, t := range strings.Split(tagsStr, ",") {
+				t = strings.TrimSpace(t)
+				if len(t) != 2 {
+					checkError(fmt.Errorf("invalid SAM tag: %s, two characters expected", t))
+				}
+				tags = append(tags, sam.NewTag(t))
+			}
+		}
+
+		var includeIds, excludeIds map[string]bool
+		if includeIdList := getFlagString(cmd, "grep-ids"); includeIdList != "" {
+			includeIds = loadIdList(includeIdList)
+		}
+		if excludeIdList := getFlagString(cmd, "exclude-ids"); excludeIdList != "" {
+			excludeIds = loadIdList(excludeIdList)
+		}
+
+		outfh, err := xopen.Wopen(outFile)
+		checkError(err)
+		defer outfh.Close()
+
+		var outfh1, outfh2 *xopen.Writer
+		if splitMates {
+			outfh1, err = xopen.Wopen(read1)
+			checkError(err)
+			defer outfh1.Close()
+			outfh2, err = xopen.Wopen(read2)
+			checkError(err)
+			defer outfh2.Close()
+		}
+
+		inChan, _ := NewSamReaderChan(files[0], 5000, 1024*128, config.Threads)
+
+		var n, n1, n2, nFiltered, nNonPrimary, nNoSeq int
+		var record *fastx.Record
+		for r := range inChan {
+			if filterById(r.Name, includeIds, excludeIds) {
+				nFiltered++
+				continue
+			}
+			if r.Flags&(sam.Secondary|sam.Supplementary) != 0 {
+				nNonPrimary++
+				continue
+			}
+			if r.Seq.Length == 0 {
+				nNoSeq++
+				continue
+			}
+
+			record = samRecord2Fastx(r, tags, allTags, mateSuffix, fasta)
+
+			switch {
+			case splitMates && r.Flags&sam.Read1 != 0:
+				record.FormatToWriter(outfh1, lineWidth)
+				n1++
+			case splitMates && r.Flags&sam.Read2 != 0:
+				record.FormatToWriter(outfh2, lineWidth)
+				n2++
+			default:
+				record.FormatToWriter(outfh, lineWidth)
+				n++
+			}
+		}
+
+		if !quiet {
+			if splitMates {
+				log.Infof("%d read1 saved to %s, %d read2 saved to %s", n1, read1, n2, read2)
+				if n > 0 {
+					log.Infof("%d other reads saved to %s", n, outFile)
+				}
+			} else {
+				log.Infof("%d reads saved to %s", n, outFile)
+			}
+			if nFiltered > 0 {
+				log.Infof("%d records filtered by IDs", nFiltered)
+			}
+			if nNonPrimary > 0 {
+				log.Infof("%d secondary or supplementary alignments skipped", nNonPrimary)
+			}
+			if nNoSeq > 0 {
+				log.Warningf("%d records without sequences skipped", nNoSeq)
+			}
+		}
+	},
+}
+
+// samRecord2Fastx converts a SAM record to a FASTQ record, or a FASTA record
+// if fasta is true. Reads aligned to the reverse strand are reverse
+// complemented. Aux tags in tags, or all tags if allTags is true, are
+// appended to the header line.
+func samRecord2Fastx(r *sam.Record, tags []sam.Tag, allTags bool, mateSuffix bool, fasta bool) *fastx.Record {
+	id := r.Name
+	if mateSuffix {
+		if r.Flags&sam.Read1 != 0 {
+			id += "/1"
+		} else if r.Flags&sam.Read2 != 0 {
+			id += "/2"
+		}
+	}
+
+	name := []byte(id)
+	for _, aux := range r.AuxFields {
+		if !allTags {
+			wanted := false
+			for _, t := range tags {
+				if aux.Tag() == t {
+					wanted = true
+					break
+				}
+			}
+			if !wanted {
+				continue
+			}
+		}
+		name = append(name, '\t')
+		name = append(name, samAuxString(aux)...)
+	}
+
+	s := []byte(GetSamReadSeq(r))
+	var _seq *seq.Seq
+	if fasta {
+		_seq, _ = seq.NewSeqWithoutValidation(seq.DNAredundant, s)
+	} else {
+		q := make([]byte, len(s))
+		if len(r.Qual) == len(s) && (len(r.Qual) == 0 || r.Qual[0] != 0xff) {
+			for i, v := range r.Qual {
+				q[i] = v + 33
+			}
+		} else {
+			for i := range q {
+				q[i] = '!'
+			}
+		}
+		_seq, _ = seq.NewSeqWithQualWithoutValidation(seq.DNAredundant, s, q)
+	}
+
+	if r.Flags&sam.Reverse != 0 {
+		_seq.RevComInplace()
+	}
+
+	return &fastx.Record{ID: []byte(id), Name: name, Seq: _seq}
+}
+
+// samAuxString returns the aux field in the SAM format, which is different
+// from Aux.String() for B arrays, e.g., "ML:B:C,200,10" vs "ML:B:C:[200 10]".
+func samAuxString(a sam.Aux) string {
+	if a.Type() != 'B' {
+		return a.String()
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s:B:%c", []byte(a[:2]), a[3])
+	rv := reflect.ValueOf(a.Value())
+	for i := 0; i < rv.Len(); i++ {
+		fmt.Fprintf(&buf, ",%v", rv.Index(i).Interface())
+	}
+	return buf.String()
+}
+
+func init() {
+	RootCmd.AddCommand(bam2fxCmd)
+
+	bam2fxCmd.Flags().StringP("read1", "1", "", "save read1 (flag 0x40) to this file")
+	bam2fxCmd.Flags().StringP("read2", "2", "", "save read2 (flag 0x80) to this file")
+	bam2fxCmd.Flags().StringP("tags", "T", "", `comma-separated aux tags to copy into the header line, e.g., "RG,BC,MM,ML", "*" for all`)
+	bam2fxCmd.Flags().BoolP("mate-suffix", "m", false, `append "/1" and "/2" to names of read1 and read2`)
+	bam2fxCmd.Flags().BoolP("fasta", "", false, "output FASTA instead of FASTQ")
+	bam2fxCmd.Flags().StringP("grep-ids", "g", "", "only keep records with IDs contained in this file")
+	bam2fxCmd.Flags().StringP("exclude-ids", "G", "", "exclude records with IDs contained in this file")
+}
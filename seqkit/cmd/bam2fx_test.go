@@ -0,0 +1,107 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/biogo/hts/sam"
+)
+
+// testSamRecord creates an unaligned SAM record with Phred qualities.
+func testSamRecord(t *testing.T, name, s string, qual []byte, flags sam.Flags, aux ...string) *sam.Record {
+	var auxFields []sam.Aux
+	for _, a := range aux {
+		f, err := sam.ParseAux([]byte(a))
+		if err != nil {
+			t.Fatal(err)
+		}
+		auxFields = append(auxFields, f)
+	}
+	r, err := sam.NewRecord(name, nil, nil, -1, -1, 0, 0, nil, []byte(s), qual, auxFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Flags = flags
+	return r
+}
+
+func TestSamRecord2Fastx(t *testing.T) {
+	qual := []byte{0, 10, 20, 30, 40}
+	aux := []string{"RG:Z:grp1", "NM:i:2", "ML:B:C,200,10"}
+
+	tests := []struct {
+		name       string
+		flags      sam.Flags
+		qual       []byte
+		tags       []sam.Tag
+		allTags    bool
+		mateSuffix bool
+		fasta      bool
+
+		id, header, seq, qual2 string
+	}{
+		{"plain", sam.Unmapped, qual, nil, false, false, false,
+			"r1", "r1", "ACGTT", "!+5?I"},
+		{"reverse strand", sam.Reverse, qual, nil, false, false, false,
+			"r1", "r1", "AACGT", "I?5+!"},
+		{"no qualities", sam.Unmapped, nil, nil, false, false, false,
+			"r1", "r1", "ACGTT", "!!!!!"},
+		{"FASTA", sam.Reverse, qual, nil, false, false, true,
+			"r1", "r1", "AACGT", ""},
+		{"read1 with suffix", sam.Paired | sam.Read1, qual, nil, false, true, false,
+			"r1/1", "r1/1", "ACGTT", "!+5?I"},
+		{"read2 with suffix", sam.Paired | sam.Read2, qual, nil, false, true, false,
+			"r1/2", "r1/2", "ACGTT", "!+5?I"},
+		{"some tags", sam.Unmapped, qual, []sam.Tag{sam.NewTag("ML"), sam.NewTag("RG"), sam.NewTag("XX")}, false, false, false,
+			"r1", "r1\tRG:Z:grp1\tML:B:C,200,10", "ACGTT", "!+5?I"},
+		{"all tags", sam.Unmapped, qual, nil, true, false, false,
+			"r1", "r1\tRG:Z:grp1\tNM:i:2\tML:B:C,200,10", "ACGTT", "!+5?I"},
+	}
+	for _, test := range tests {
+		r := testSamRecord(t, "r1", "ACGTT", test.qual, test.flags, aux...)
+		record := samRecord2Fastx(r, test.tags, test.allTags, test.mateSuffix, test.fasta)
+		if string(record.ID) != test.id {
+			t.Errorf("%s: ID: expected %s, returned %s", test.name, test.id, record.ID)
+		}
+		if string(record.Name) != test.header {
+			t.Errorf("%s: header: expected %q, returned %q", test.name, test.header, record.Name)
+		}
+		if string(record.Seq.Seq) != test.seq {
+			t.Errorf("%s: sequence: expected %s, returned %s", test.name, test.seq, record.Seq.Seq)
+		}
+		if string(record.Seq.Qual) != test.qual2 {
+			t.Errorf("%s: qualities: expected %s, returned %s", test.name, test.qual2, record.Seq.Qual)
+		}
+	}
+}
+
+func TestSamAuxString(t *testing.T) {
+	for _, s := range []string{"RG:Z:grp1", "NM:i:2", "ML:B:C,200,10", "XB:B:s,-1,2,3", "XF:B:f,0.5"} {
+		a, err := sam.ParseAux([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := samAuxString(a); v != s {
+			t.Errorf("expected %s, returned %s", s, v)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/biogo/hts/sam"
+	"github.com/bsipos/thist"
+	"github.com/shenwei356/xopen"
+)
+
+// bamDepthSummary holds the depth summary of a reference.
+type bamDepthSummary struct {
+	Ref        string
+	Length     int
+	MeanDepth  float64
+	Breadth1x  float64 // percentage of bases with depth >= 1
+	Breadth10x float64
+	Breadth30x float64
+}
+
+var bamDepthFields = []string{"Ref", "Length", "MeanDepth", "Breadth1x", "Breadth10x", "Breadth30x"}
+
+// bamDepth computes per-base depth from coordinate-sorted records, and
+// writes depths in bedGraph format to depthFile, per base (window == 0,
+// zero depths omitted) or as mean depths of fixed windows.
+// Aligned bases (M, =, X) are counted, deletions and skipped regions are not.
+// Only the queried regions are computed if bamReader is a *BamRegionReader,
+// otherwise whole references.
+// A per-reference summary is printed to stderr, and the histogram of
+// window depths is plotted if window > 0.
+func bamDepth(bamReader BamRecordReader, depthFile string, window int, mapQual int, printPrim bool, includeIds map[string]bool, excludeIds map[string]bool, pretty bool, outFormat string, printQuiet bool, printDump bool, printPdf string, printBins int, binMode string) {
+	refs := bamReader.Header().Refs()
+
+	// sorted and non-overlapping intervals of each reference
+	intervals := make([][][2]int, len(refs))
+	if regionReader, ok := bamReader.(*BamRegionReader); ok {
+		for _, r := range regionReader.regions {
+			intervals[r.ref.ID()] = append(intervals[r.ref.ID()], [2]int{r.start, r.end})
+		}
+	} else {
+		for i, ref := range refs {
+			intervals[i] = [][2]int{{0, ref.Len()}}
+		}
+	}
+
+	outfh, err := xopen.Wopen(depthFile)
+	checkError(err)
+	defer outfh.Close()
+
+	var h *thist.Hist
+	if window > 0 {
+		h = thist.NewHist([]float64{}, fmt.Sprintf("Mean depth of %d bp windows", window), binMode, printBins, true)
+	}
+
+	summaries := make([]*bamDepthSummary, 0, len(refs))
+
+	var cur *sam.Reference
+	var s *bamDepthSummary
+	var ivs [][2]int
+	var k int        // index of the current interval
+	var start int    // position of diff[0], depths of positions before it are computed
+	var diff []int32 // difference array, only covering positions of records added
+	var d, runDepth int32
+	var sum, wsum int64
+	var n1, n10, n30 int
+	var runStart, wstart int
+
+	// begin starts computing depths of a reference.
+	begin := func(ref *sam.Reference) {
+		cur, ivs, k = ref, intervals[ref.ID()], 0
+		start, diff, d = 0, diff[:0], 0
+		sum, n1, n10, n30 = 0, 0, 0, 0
+		s = &bamDepthSummary{Ref: ref.Name()}
+		for _, iv := range ivs {
+			s.Length += iv[1] - iv[0]
+		}
+		if len(ivs) > 0 {
+			runStart, runDepth, wstart, wsum = ivs[0][0], 0, ivs[0][0], 0
+		}
+	}
+
+	// advance computes depths of positions before to, which should not be
+	// covered by records added later.
+	advance := func(to int) {
+		var e, m int
+		for k < len(ivs) && start < to {
+			if start < ivs[k][0] { // skipping positions before the interval
+				e = ivs[k][0]
+				if e > to {
+					e = to
+				}
+				m = e - start
+				if m > len(diff) {
+					m = len(diff)
+				}
+				for _, v := range diff[:m] {
+					d += v
+				}
+				diff = diff[m:]
+				start = e
+				continue
+			}
+
+			e = ivs[k][1]
+			if e > to {
+				e = to
+			}
+			for ; start < e; start++ {
+				if len(diff) > 0 {
+					d += diff[0]
+					diff = diff[1:]
+				}
+				sum += int64(d)
+				if d >= 1 {
+					n1++
+					if d >= 10 {
+						n10++
+						if d >= 30 {
+							n30++
+						}
+					}
+				}
+
+				if window > 0 {
+					wsum += int64(d)
+					if start-wstart+1 == window || start == ivs[k][1]-1 {
+						mean := float64(wsum) / float64(start-wstart+1)
+						fmt.Fprintf(outfh, "%s\t%d\t%d\t%.2f\n", s.Ref, wstart, start+1, mean)
+						h.Update(mean)
+						wsum, wstart = 0, start+1
+					}
+					continue
+				}
+
+				if d != runDepth {
+					if runDepth > 0 {
+						fmt.Fprintf(outfh, "%s\t%d\t%d\t%d\n", s.Ref, runStart, start, runDepth)
+					}
+					runStart, runDepth = start, d
+				}
+			}
+
+			if start == ivs[k][1] { // end of the interval
+				if window == 0 && runDepth > 0 {
+					fmt.Fprintf(outfh, "%s\t%d\t%d\t%d\n", s.Ref, runStart, start, runDepth)
+				}
+				k++
+				if k < len(ivs) {
+					runStart, runDepth, wstart, wsum = ivs[k][0], 0, ivs[k][0], 0
+				}
+			}
+		}
+	}
+
+	// finish computes depths of the remaining positions and saves the summary.
+	finish := func() {
+		advance(cur.Len())
+		if s.Length > 0 {
+			s.MeanDepth = float64(sum) / float64(s.Length)
+			s.Breadth1x = float64(n1) / float64(s.Length) * 100
+			s.Breadth10x = float64(n10) / float64(s.Length) * 100
+			s.Breadth30x = float64(n30) / float64(s.Length) * 100
+		}
+		summaries = append(summaries, s)
+	}
+
+	// skipTo saves summaries of queried references without records before id.
+	var next int
+	skipTo := func(id int) {
+		for ; next < id; next++ {
+			if len(intervals[next]) > 0 {
+				begin(refs[next])
+				finish()
+			}
+		}
+	}
+
+	var lastPos, pos, end int
+	for {
+		record, err := bamReader.Read()
+		if err == io.EOF {
+			break
+		}
+		checkError(err)
+
+		if filterById(record.Name, includeIds, excludeIds) {
+			continue
+		}
+		if record.Flags&sam.Unmapped != 0 || record.Ref == nil {
+			continue
+		}
+		if printPrim && record.Flags&(sam.Secondary|sam.Supplementary) != 0 {
+			continue
+		}
+		if int(record.MapQ) < mapQual {
+			continue
+		}
+
+		if cur == nil || record.Ref.ID() != cur.ID() {
+			if cur != nil {
+				if record.Ref.ID() < cur.ID() {
+					checkError(fmt.Errorf("BAM records should be sorted by coordinate for computing depth"))
+				}
+				finish()
+				next = cur.ID() + 1
+			}
+			skipTo(record.Ref.ID())
+			begin(record.Ref)
+			lastPos = 0
+		}
+		if record.Pos < lastPos {
+			checkError(fmt.Errorf("BAM records should be sorted by coordinate for computing depth"))
+		}
+		lastPos = record.Pos
+
+		advance(record.Pos)
+		if k == len(ivs) { // after all intervals
+			continue
+		}
+
+		pos = record.Pos
+		for _, op := range record.Cigar {
+			switch op.Type() {
+			case sam.CigarMatch, sam.CigarEqual, sam.CigarMismatch:
+				end = pos + op.Len()
+				if end > cur.Len() {
+					end = cur.Len()
+				}
+				if pos < end {
+					for len(diff) <= end-start {
+						diff = append(diff, 0)
+					}
+					diff[pos-start]++
+					diff[end-start]--
+				}
+				pos += op.Len()
+			case sam.CigarDeletion, sam.CigarSkipped:
+				pos += op.Len()
+			}
+		}
+	}
+	if cur != nil {
+		finish()
+		next = cur.ID() + 1
+	}
+	skipTo(len(refs))
+
+	printBamDepthSummary(summaries, pretty, outFormat)
+
+	if h != nil && h.DataCount > 0 {
+		if printDump {
+			os.Stderr.Write([]byte(h.Dump()))
+		} else if !printQuiet {
+			os.Stderr.Write([]byte(h.Draw()))
+		}
+		if printPdf != "" {
+			h.SaveImage(printPdf)
+		}
+	}
+}
+
+// printBamDepthSummary prints per-reference depth summaries to stderr.
+func printBamDepthSummary(summaries []*bamDepthSummary, pretty bool, outFormat string) {
+	if outFormat != outFormatTSV {
+		jw, err := newJSONTableWriter(os.Stderr, outFormat, "bam.depth", []string{"ref", "length", "mean_depth", "breadth_1x", "breadth_10x", "breadth_30x"})
+		checkError(err)
+		for _, s := range summaries {
+			checkError(jw.WriteRow(s.Ref, s.Length, s.MeanDepth, s.Breadth1x, s.Breadth10x, s.Breadth30x))
+		}
+		checkError(jw.Close())
+		return
+	}
+
+	width := 0
+	if pretty {
+		width = -1
+	}
+	data := make([][]string, len(bamDepthFields))
+	for _, s := range summaries {
+		data[0] = append(data[0], s.Ref)
+		data[1] = append(data[1], fmt.Sprintf("%d", s.Length))
+		data[2] = append(data[2], fmt.Sprintf("%.2f", s.MeanDepth))
+		data[3] = append(data[3], fmt.Sprintf("%.2f", s.Breadth1x))
+		data[4] = append(data[4], fmt.Sprintf("%.2f", s.Breadth10x))
+		data[5] = append(data[5], fmt.Sprintf("%.2f", s.Breadth30x))
+	}
+	fs, brush := PrettyPrintTsv(bamDepthFields, data, width, width != 0)
+	brush.WrapWriter(os.Stderr).Write([]byte(fs))
+}
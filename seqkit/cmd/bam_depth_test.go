@@ -0,0 +1,133 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/biogo/hts/bam"
+)
+
+// captureStderr returns what fn writes to os.Stderr.
+func captureStderr(t *testing.T, fn func()) string {
+	fh, err := ioutil.TempFile(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	stderr := os.Stderr
+	os.Stderr = fh
+	defer func() { os.Stderr = stderr }()
+
+	fn()
+
+	data, err := ioutil.ReadFile(fh.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestBamDepth(t *testing.T) {
+	dir := t.TempDir()
+	file := writeTestBam(t, dir, map[string]int{"chr1": 100, "chr2": 50, "chr3": 50}, []string{"chr1", "chr2", "chr3"}, []testAln{
+		{"a", 0, 10, 20},
+		{"b", 0, 20, 20},
+		{"c", 0, 35, 10},
+		{"d", 2, 0, 10},
+	})
+
+	tests := []struct {
+		name    string
+		regions []string
+		window  int
+		depth   string
+		summary string
+	}{
+		{"whole references", nil, 0,
+			"chr1\t10\t20\t1\nchr1\t20\t30\t2\nchr1\t30\t35\t1\nchr1\t35\t40\t2\nchr1\t40\t45\t1\nchr3\t0\t10\t1\n",
+			`{"ref":"chr1","length":100,"mean_depth":0.5,"breadth_1x":35,"breadth_10x":0,"breadth_30x":0}
+{"ref":"chr2","length":50,"mean_depth":0,"breadth_1x":0,"breadth_10x":0,"breadth_30x":0}
+{"ref":"chr3","length":50,"mean_depth":0.2,"breadth_1x":20,"breadth_10x":0,"breadth_30x":0}
+`},
+		// chr2 is not queried
+		{"regions", []string{"chr3:6-20", "chr1:16-38"}, 0,
+			"chr1\t15\t20\t1\nchr1\t20\t30\t2\nchr1\t30\t35\t1\nchr1\t35\t38\t2\nchr3\t5\t10\t1\n",
+			`{"ref":"chr1","length":23,"mean_depth":1.565217391304348,"breadth_1x":100,"breadth_10x":0,"breadth_30x":0}
+{"ref":"chr3","length":15,"mean_depth":0.3333333333333333,"breadth_1x":33.33333333333333,"breadth_10x":0,"breadth_30x":0}
+`},
+		// windows are reset at starts of regions
+		{"windows of regions", []string{"chr3:6-20", "chr1:16-38", "chr1:91-100"}, 10,
+			"chr1\t15\t25\t1.50\nchr1\t25\t35\t1.50\nchr1\t35\t38\t2.00\nchr1\t90\t100\t0.00\nchr3\t5\t15\t0.50\nchr3\t15\t20\t0.00\n",
+			`{"ref":"chr1","length":33,"mean_depth":1.0909090909090908,"breadth_1x":69.6969696969697,"breadth_10x":0,"breadth_30x":0}
+{"ref":"chr3","length":15,"mean_depth":0.3333333333333333,"breadth_1x":33.33333333333333,"breadth_10x":0,"breadth_30x":0}
+`},
+	}
+	for i, test := range tests {
+		var reader BamRecordReader
+		if len(test.regions) == 0 {
+			fh, err := os.Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := bam.NewReader(fh, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fh.Close()
+			reader = r
+		} else {
+			regions := make([]*BamRegion, len(test.regions))
+			for j, s := range test.regions {
+				region, err := ParseBamRegion(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				regions[j] = region
+			}
+			r, err := NewBamRegionReader(file, regions, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			reader = r
+		}
+
+		depthFile := filepath.Join(dir, fmt.Sprintf("depth%d.bedGraph", i))
+		summary := captureStderr(t, func() {
+			bamDepth(reader, depthFile, test.window, 0, false, nil, nil, false, outFormatNDJSON, true, false, "", -1, "termfit")
+		})
+		depth, err := ioutil.ReadFile(depthFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(depth) != test.depth {
+			t.Errorf("%s: depth: expected:\n%s\nreturned:\n%s", test.name, test.depth, depth)
+		}
+		if summary != test.summary {
+			t.Errorf("%s: summary: expected:\n%s\nreturned:\n%s", test.name, test.summary, summary)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/biogo/hts/sam"
+)
+
+// alleles of pileup columns
+const (
+	pileupA = iota
+	pileupC
+	pileupG
+	pileupT
+	pileupN
+	pileupDel // deletion
+	pileupNumAlleles
+)
+
+// pileupBases are the bases of alleles pileupA to pileupN.
+var pileupBases = []byte("ACGTN")
+
+// pileupAllele returns the allele of a base.
+func pileupAllele(b byte) int {
+	switch b {
+	case 'A', 'a':
+		return pileupA
+	case 'C', 'c':
+		return pileupC
+	case 'G', 'g':
+		return pileupG
+	case 'T', 't':
+		return pileupT
+	}
+	return pileupN
+}
+
+// PileupColumn holds counts of bases and indels at a reference position.
+// Counts are indexed by allele and strand (0 for forward, 1 for reverse).
+type PileupColumn struct {
+	Pos    int // 0-based position
+	Counts [pileupNumAlleles][2]int
+
+	// Ins holds counts of sequences inserted after this position,
+	// indexed by strand.
+	Ins map[string]*[2]int
+	// Dels holds counts of deletions starting after this position,
+	// indexed by length and strand.
+	Dels map[int]*[2]int
+}
+
+// Count returns the count of an allele on both strands.
+func (c *PileupColumn) Count(allele int) int {
+	return c.Counts[allele][0] + c.Counts[allele][1]
+}
+
+// Depth returns the number of reads covering the position,
+// including deletions.
+func (c *PileupColumn) Depth() int {
+	var n int
+	for _, counts := range c.Counts {
+		n += counts[0] + counts[1]
+	}
+	return n
+}
+
+// StrandDepth returns the depth of reads of a strand.
+func (c *PileupColumn) StrandDepth(strand int) int {
+	var n int
+	for _, counts := range c.Counts {
+		n += counts[strand]
+	}
+	return n
+}
+
+// TopInsertion returns the most frequent inserted sequence and its count.
+func (c *PileupColumn) TopInsertion() (string, int) {
+	var top string
+	var max, n int
+	for s, counts := range c.Ins {
+		n = counts[0] + counts[1]
+		if n > max || (n == max && s < top) {
+			top, max = s, n
+		}
+	}
+	return top, max
+}
+
+// pileupSkipRecord tells whether a record should be skipped in pileup,
+// i.e., unmapped, secondary, QC failed, duplicate records, or records
+// with a mapping quality lower than minMapQual.
+func pileupSkipRecord(r *sam.Record, minMapQual int) bool {
+	if r.Ref == nil || r.Flags&(sam.Unmapped|sam.Secondary|sam.QCFail|sam.Duplicate) != 0 {
+		return true
+	}
+	return int(r.MapQ) < minMapQual
+}
+
+// Pileup builds pileup columns from coordinate-sorted records, by walking
+// through CIGAR operations like GetSamAlnDetails does. Bases with a quality
+// lower than MinBaseQual are ignored, so do insertions containing such bases.
+// Insertions at the beginning of reads are ignored as they have no anchor,
+// while deletions there are only counted in columns they cover.
+//
+// Columns covered by any read are passed to Emit in order, once no more
+// records could overlap them.
+type Pileup struct {
+	MinBaseQual int
+	Emit        func(ref *sam.Reference, col *PileupColumn)
+
+	ref     *sam.Reference
+	lastPos int
+	start   int             // position of cols[0]
+	cols    []*PileupColumn // nil for positions not covered
+}
+
+// NewPileup creates a Pileup.
+func NewPileup(minBaseQual int, emit func(ref *sam.Reference, col *PileupColumn)) *Pileup {
+	return &Pileup{MinBaseQual: minBaseQual, Emit: emit}
+}
+
+// Add adds a mapped record, an error is returned if records are not
+// sorted by coordinate.
+func (p *Pileup) Add(r *sam.Record) error {
+	if p.ref == nil || r.Ref.ID() != p.ref.ID() {
+		if p.ref != nil && r.Ref.ID() < p.ref.ID() {
+			return fmt.Errorf("records should be sorted by coordinate: %s", r.Name)
+		}
+		p.Flush()
+		p.ref = r.Ref
+		p.lastPos = 0
+		p.start = 0
+	}
+	if r.Pos < p.lastPos {
+		return fmt.Errorf("records should be sorted by coordinate: %s", r.Name)
+	}
+	p.lastPos = r.Pos
+	p.emitBefore(r.Pos)
+
+	s := r.Seq.Expand()
+	hasQual := len(r.Qual) == len(s) && (len(r.Qual) == 0 || r.Qual[0] != 0xff)
+	var strand int
+	if r.Flags&sam.Reverse != 0 {
+		strand = 1
+	}
+
+	refLen := r.Ref.Len()
+	pos, i := r.Pos, 0 // positions on reference and read
+	var n, j int
+	var ok bool
+	var col *PileupColumn
+	for _, op := range r.Cigar {
+		n = op.Len()
+		switch op.Type() {
+		case sam.CigarMatch, sam.CigarEqual, sam.CigarMismatch:
+			for j = 0; j < n && pos+j < refLen; j++ {
+				if hasQual && int(r.Qual[i+j]) < p.MinBaseQual {
+					continue
+				}
+				p.column(pos + j).Counts[pileupAllele(s[i+j])][strand]++
+			}
+			pos += n
+			i += n
+		case sam.CigarDeletion:
+			for j = 0; j < n && pos+j < refLen; j++ {
+				p.column(pos + j).Counts[pileupDel][strand]++
+			}
+			if pos > r.Pos && pos+n <= refLen {
+				col = p.column(pos - 1)
+				if col.Dels == nil {
+					col.Dels = make(map[int]*[2]int)
+				}
+				if _, ok = col.Dels[n]; !ok {
+					col.Dels[n] = &[2]int{}
+				}
+				col.Dels[n][strand]++
+			}
+			pos += n
+		case sam.CigarSkipped:
+			pos += n
+		case sam.CigarInsertion:
+			ok = pos > r.Pos && pos <= refLen
+			if ok && hasQual {
+				for _, q := range r.Qual[i : i+n] {
+					if int(q) < p.MinBaseQual {
+						ok = false
+						break
+					}
+				}
+			}
+			if ok {
+				col = p.column(pos - 1)
+				if col.Ins == nil {
+					col.Ins = make(map[string]*[2]int)
+				}
+				ins := string(s[i : i+n])
+				if _, ok = col.Ins[ins]; !ok {
+					col.Ins[ins] = &[2]int{}
+				}
+				col.Ins[ins][strand]++
+			}
+			i += n
+		case sam.CigarSoftClipped:
+			i += n
+		}
+	}
+	return nil
+}
+
+// column returns the column of a position, creating it if needed.
+func (p *Pileup) column(pos int) *PileupColumn {
+	k := pos - p.start
+	for len(p.cols) <= k {
+		p.cols = append(p.cols, nil)
+	}
+	if p.cols[k] == nil {
+		p.cols[k] = &PileupColumn{Pos: pos}
+	}
+	return p.cols[k]
+}
+
+// emitBefore emits columns before pos.
+func (p *Pileup) emitBefore(pos int) {
+	k := pos - p.start
+	if k <= 0 {
+		return
+	}
+	if k > len(p.cols) {
+		k = len(p.cols)
+	}
+	for _, col := range p.cols[:k] {
+		if col != nil {
+			p.Emit(p.ref, col)
+		}
+	}
+	p.cols = p.cols[k:]
+	p.start = pos
+}
+
+// Flush emits all remaining columns.
+func (p *Pileup) Flush() {
+	if p.ref == nil {
+		return
+	}
+	p.emitBefore(p.start + len(p.cols))
+}
+
+// pileupRefSeq returns the upper-case sequence of a reference,
+// whose length should be the same as in the SAM/BAM header.
+func pileupRefSeq(ref *RefWithFaidx, r *sam.Reference) []byte {
+	s, err := ref.IdxSubSeq(r.Name(), 1, -1)
+	checkError(err)
+	if len(s) != r.Len() {
+		checkError(fmt.Errorf("length of reference sequence %s (%d) does not match that in the SAM/BAM header (%d)", r.Name(), len(s), r.Len()))
+	}
+	return bytes.ToUpper([]byte(s))
+}
@@ -0,0 +1,141 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/biogo/hts/sam"
+)
+
+// testAlnRecord creates a mapped SAM record with a CIGAR string,
+// and the same quality qual of all bases.
+func testAlnRecord(t *testing.T, name string, ref *sam.Reference, pos int, cigar, s string, qual byte, reverse bool) *sam.Record {
+	co, err := sam.ParseCigar([]byte(cigar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := make([]byte, len(s))
+	for i := range q {
+		q[i] = qual
+	}
+	r, err := sam.NewRecord(name, ref, nil, pos, -1, 0, 60, co, []byte(s), q, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reverse {
+		r.Flags |= sam.Reverse
+	}
+	return r
+}
+
+func TestPileup(t *testing.T) {
+	ref1, _ := sam.NewReference("chr1", "", "", 20, nil, nil)
+	ref2, _ := sam.NewReference("chr2", "", "", 20, nil, nil)
+	if _, err := sam.NewHeader(nil, []*sam.Reference{ref1, ref2}); err != nil { // setting IDs of references
+		t.Fatal(err)
+	}
+
+	var positions []int
+	cols := make(map[int]*PileupColumn)
+	p := NewPileup(10, func(ref *sam.Reference, col *PileupColumn) {
+		if ref == ref1 {
+			positions = append(positions, col.Pos)
+			cols[col.Pos] = col
+		}
+	})
+
+	records := []*sam.Record{
+		// 2:A 3:C 4:G +T 5:A 6:C -1 8:G 9:A
+		testAlnRecord(t, "r1", ref1, 2, "2S3M1I2M1D2M", "TTACGTACGA", 30, false),
+		// the base at 5 is ignored for its low quality
+		testAlnRecord(t, "r2", ref1, 3, "4M", "CGTA", 30, true),
+		// the insertion at the beginning is ignored
+		testAlnRecord(t, "r3", ref1, 3, "1I3M", "GCGA", 30, false),
+		testAlnRecord(t, "r4", ref2, 0, "2M", "AC", 30, false),
+	}
+	records[1].Qual[2] = 5
+	for i, r := range records {
+		if err := p.Add(r); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 && !reflect.DeepEqual(positions, []int{2}) {
+			t.Errorf("columns before the second record: expected [2], returned %v", positions)
+		}
+	}
+	p.Flush()
+
+	if expected := []int{2, 3, 4, 5, 6, 7, 8, 9}; !reflect.DeepEqual(positions, expected) {
+		t.Errorf("positions: expected %v, returned %v", expected, positions)
+	}
+
+	counts := []struct {
+		pos, allele int
+		counts      [2]int
+	}{
+		{2, pileupA, [2]int{1, 0}},
+		{3, pileupC, [2]int{2, 1}},
+		{4, pileupG, [2]int{2, 1}},
+		{5, pileupA, [2]int{2, 0}},
+		{5, pileupT, [2]int{0, 0}},
+		{6, pileupC, [2]int{1, 0}},
+		{6, pileupA, [2]int{0, 1}},
+		{7, pileupDel, [2]int{1, 0}},
+		{9, pileupA, [2]int{1, 0}},
+	}
+	for _, c := range counts {
+		if v := cols[c.pos].Counts[c.allele]; v != c.counts {
+			t.Errorf("position %d, allele %c: expected %v, returned %v", c.pos, "ACGTN-"[c.allele], c.counts, v)
+		}
+	}
+	if d := cols[4].Depth(); d != 3 {
+		t.Errorf("depth of position 4: expected 3, returned %d", d)
+	}
+	if d := cols[6].StrandDepth(1); d != 1 {
+		t.Errorf("reverse depth of position 6: expected 1, returned %d", d)
+	}
+	if ins, n := cols[4].TopInsertion(); ins != "T" || n != 1 {
+		t.Errorf("insertion after position 4: expected T 1, returned %s %d", ins, n)
+	}
+	if len(cols[2].Ins) != 0 {
+		t.Errorf("unexpected insertions after position 2: %v", cols[2].Ins)
+	}
+	if dels := cols[6].Dels; len(dels) != 1 || dels[1] == nil || *dels[1] != [2]int{1, 0} {
+		t.Errorf("deletions after position 6: unexpected %v", dels)
+	}
+
+	// unsorted records
+	p = NewPileup(0, func(ref *sam.Reference, col *PileupColumn) {})
+	if err := p.Add(testAlnRecord(t, "r1", ref1, 5, "2M", "AC", 30, false)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Add(testAlnRecord(t, "r2", ref1, 4, "2M", "AC", 30, false)); err == nil {
+		t.Errorf("unsorted positions: error expected")
+	}
+	p = NewPileup(0, func(ref *sam.Reference, col *PileupColumn) {})
+	if err := p.Add(testAlnRecord(t, "r1", ref2, 5, "2M", "AC", 30, false)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Add(testAlnRecord(t, "r2", ref1, 6, "2M", "AC", 30, false)); err == nil {
+		t.Errorf("unsorted references: error expected")
+	}
+}
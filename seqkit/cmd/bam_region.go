@@ -0,0 +1,283 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/bgzf/index"
+	"github.com/biogo/hts/sam"
+	"github.com/shenwei356/xopen"
+)
+
+// BamRecordReader reads SAM records, it's implemented by *bam.Reader
+// and *BamRegionReader.
+type BamRecordReader interface {
+	Read() (*sam.Record, error)
+	Header() *sam.Header
+}
+
+// BamRegion is a genomic region of a BAM query, 0-based and half-open.
+// End is -1 for the end of the reference.
+type BamRegion struct {
+	Chrom string
+	Start int
+	End   int
+}
+
+// ParseBamRegion parses a region in the samtools format: chr, chr:start,
+// or chr:start-end, where positions are 1-based and inclusive.
+func ParseBamRegion(s string) (*BamRegion, error) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		if s == "" {
+			return nil, fmt.Errorf("empty region")
+		}
+		return &BamRegion{Chrom: s, Start: 0, End: -1}, nil
+	}
+
+	chrom, loc := s[:i], strings.ReplaceAll(s[i+1:], ",", "")
+	if chrom == "" {
+		return nil, fmt.Errorf("invalid region: %s", s)
+	}
+	startS, endS := loc, ""
+	if j := strings.IndexByte(loc, '-'); j >= 0 {
+		startS, endS = loc[:j], loc[j+1:]
+	}
+
+	start, err := strconv.Atoi(startS)
+	if err != nil || start < 1 {
+		return nil, fmt.Errorf("invalid start position of region: %s", s)
+	}
+	end := -1
+	if endS != "" {
+		end, err = strconv.Atoi(endS)
+		if err != nil || end < start {
+			return nil, fmt.Errorf("invalid end position of region: %s", s)
+		}
+	}
+	return &BamRegion{Chrom: chrom, Start: start - 1, End: end}, nil
+}
+
+// LoadBamRegions loads regions from a BED file, lines starting with
+// "#", "track" or "browser" are skipped.
+func LoadBamRegions(file string) ([]*BamRegion, error) {
+	fh, err := xopen.Ropen(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var regions []*BamRegion
+	scanner := bufio.NewScanner(fh)
+	var line string
+	var n int
+	for scanner.Scan() {
+		n++
+		line = strings.TrimRight(scanner.Text(), "\r\n")
+		if line == "" || line[0] == '#' || strings.HasPrefix(line, "track") || strings.HasPrefix(line, "browser") {
+			continue
+		}
+		items := strings.Split(line, "\t")
+		if len(items) < 3 {
+			return nil, fmt.Errorf("%s:%d: at least 3 columns needed for BED", file, n)
+		}
+		start, err := strconv.Atoi(items[1])
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("%s:%d: invalid start position: %s", file, n, items[1])
+		}
+		end, err := strconv.Atoi(items[2])
+		if err != nil || end < start {
+			return nil, fmt.Errorf("%s:%d: invalid end position: %s", file, n, items[2])
+		}
+		regions = append(regions, &BamRegion{Chrom: items[0], Start: start, End: end})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return regions, nil
+}
+
+type bamRefRegion struct {
+	ref        *sam.Reference
+	start, end int
+}
+
+// BamRegionReader reads records overlapping with given regions from an
+// indexed BAM file, by seeking via the index. A record overlapping with
+// multiple regions is returned only once.
+type BamRegionReader struct {
+	fh      *os.File
+	reader  *bam.Reader
+	idx     *bam.Index
+	regions []bamRefRegion // sorted and merged
+
+	i    int // index of next region
+	it   *bam.Iterator
+	cur  *bamRefRegion
+	prev *bamRefRegion
+}
+
+// NewBamRegionReader creates a BamRegionReader, the index file
+// (file.bai or file without .bam plus .bai) is required.
+func NewBamRegionReader(file string, regions []*BamRegion, nrProc int) (*BamRegionReader, error) {
+	if isStdin(file) {
+		return nil, fmt.Errorf("an indexed BAM file is needed for querying regions, stdin is not supported")
+	}
+
+	idxFile := file + ".bai"
+	if _, err := os.Stat(idxFile); err != nil {
+		idxFile = strings.TrimSuffix(file, ".bam") + ".bai"
+		if _, err = os.Stat(idxFile); err != nil {
+			return nil, fmt.Errorf("index file not found for file %s, please run samtools index on the sorted file", file)
+		}
+	}
+	ifh, err := os.Open(idxFile)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := bam.ReadIndex(bufio.NewReader(ifh))
+	ifh.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", idxFile, err)
+	}
+
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := bam.NewReader(fh, nrProc)
+	if err != nil {
+		fh.Close()
+		return nil, err
+	}
+
+	refs := make(map[string]*sam.Reference, len(reader.Header().Refs()))
+	for _, ref := range reader.Header().Refs() {
+		refs[ref.Name()] = ref
+	}
+	rs := make([]bamRefRegion, 0, len(regions))
+	for _, r := range regions {
+		ref, ok := refs[r.Chrom]
+		if !ok {
+			fh.Close()
+			return nil, fmt.Errorf("reference not found in the BAM header: %s", r.Chrom)
+		}
+		end := r.End
+		if end < 0 || end > ref.Len() {
+			end = ref.Len()
+		}
+		if r.Start >= end {
+			continue
+		}
+		rs = append(rs, bamRefRegion{ref: ref, start: r.Start, end: end})
+	}
+
+	// sort and merge overlapping regions
+	sort.Slice(rs, func(i, j int) bool {
+		if rs[i].ref.ID() == rs[j].ref.ID() {
+			return rs[i].start < rs[j].start
+		}
+		return rs[i].ref.ID() < rs[j].ref.ID()
+	})
+	merged := make([]bamRefRegion, 0, len(rs))
+	for _, r := range rs {
+		if n := len(merged); n > 0 && merged[n-1].ref == r.ref && r.start <= merged[n-1].end {
+			if r.end > merged[n-1].end {
+				merged[n-1].end = r.end
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+
+	return &BamRegionReader{fh: fh, reader: reader, idx: idx, regions: merged}, nil
+}
+
+// Header returns the header of the BAM file.
+func (r *BamRegionReader) Header() *sam.Header {
+	return r.reader.Header()
+}
+
+// Read returns the next record overlapping with the regions,
+// and io.EOF after all regions are read.
+func (r *BamRegionReader) Read() (*sam.Record, error) {
+	var rec *sam.Record
+	for {
+		if r.it == nil {
+			if r.i == len(r.regions) {
+				return nil, io.EOF
+			}
+			reg := &r.regions[r.i]
+			r.i++
+
+			chunks, err := r.idx.Chunks(reg.ref, reg.start, reg.end)
+			if err == index.ErrNoReference { // no records of the reference
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if len(chunks) == 0 {
+				continue
+			}
+			r.it, err = bam.NewIterator(r.reader, chunks)
+			if err != nil {
+				return nil, err
+			}
+			r.cur = reg
+		}
+
+		if !r.it.Next() {
+			err := r.it.Close()
+			r.it = nil
+			if err != nil {
+				return nil, err
+			}
+			r.prev = r.cur
+			continue
+		}
+
+		rec = r.it.Record()
+		// chunks may contain records not overlapping with the region
+		if rec.Ref != r.cur.ref || rec.Pos >= r.cur.end || rec.End() <= r.cur.start {
+			continue
+		}
+		// records overlapping with the previous region are already returned
+		if r.prev != nil && rec.Ref == r.prev.ref && rec.Pos < r.prev.end {
+			continue
+		}
+		return rec, nil
+	}
+}
+
+// Close closes the BAM file.
+func (r *BamRegionReader) Close() error {
+	r.reader.Close()
+	return r.fh.Close()
+}
@@ -0,0 +1,238 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/sam"
+)
+
+// testAln is an alignment of a test BAM file, with a CIGAR of only M.
+type testAln struct {
+	name   string
+	ref    int // index of the reference
+	pos    int // 0-based
+	length int
+}
+
+// writeTestBam writes a sorted BAM file and its index, and returns the path.
+func writeTestBam(t *testing.T, dir string, refLens map[string]int, refNames []string, alns []testAln) string {
+	refs := make([]*sam.Reference, len(refNames))
+	for i, name := range refNames {
+		ref, err := sam.NewReference(name, "", "", refLens[name], nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs[i] = ref
+	}
+	header, err := sam.NewHeader(nil, refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "test.bam")
+	fh, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := bam.NewWriter(fh, header, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range alns {
+		r, err := sam.NewRecord(a.name, refs[a.ref], nil, a.pos, -1, 0, 60,
+			[]sam.CigarOp{sam.NewCigarOp(sam.CigarMatch, a.length)}, []byte(strings.Repeat("A", a.length)), nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = fh.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// index
+	fh, err = os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	reader, err := bam.NewReader(fh, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var idx bam.Index
+	for {
+		r, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = idx.Add(r, reader.LastChunk()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ifh, err := os.Create(file + ".bai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bam.WriteIndex(ifh, &idx); err != nil {
+		t.Fatal(err)
+	}
+	if err = ifh.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestParseBamRegion(t *testing.T) {
+	tests := []struct {
+		s      string
+		region BamRegion
+		ok     bool
+	}{
+		{"chr1", BamRegion{"chr1", 0, -1}, true},
+		{"chr1:100", BamRegion{"chr1", 99, -1}, true},
+		{"chr1:100-200", BamRegion{"chr1", 99, 200}, true},
+		{"chr1:1,000-2,000", BamRegion{"chr1", 999, 2000}, true},
+		{"HLA-A*01:01:1-10", BamRegion{"HLA-A*01:01", 0, 10}, true},
+		{"chr1:5-5", BamRegion{"chr1", 4, 5}, true},
+		{"", BamRegion{}, false},
+		{":1-10", BamRegion{}, false},
+		{"chr1:0-10", BamRegion{}, false},
+		{"chr1:a-10", BamRegion{}, false},
+		{"chr1:10-5", BamRegion{}, false},
+		{"chr1:10-b", BamRegion{}, false},
+	}
+	for _, test := range tests {
+		region, err := ParseBamRegion(test.s)
+		if test.ok != (err == nil) {
+			t.Errorf("%s: unexpected error: %v", test.s, err)
+			continue
+		}
+		if test.ok && *region != test.region {
+			t.Errorf("%s: expected %v, returned %v", test.s, test.region, *region)
+		}
+	}
+}
+
+func TestLoadBamRegions(t *testing.T) {
+	dir := t.TempDir()
+	file := writeTestFile(t, dir, "r.bed", "track name=test\n# comment\nchr1\t0\t100\tname\r\n\nchr2\t50\t60\n")
+	regions, err := LoadBamRegions(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regions) != 2 || *regions[0] != (BamRegion{"chr1", 0, 100}) || *regions[1] != (BamRegion{"chr2", 50, 60}) {
+		t.Errorf("unexpected regions: %v", regions)
+	}
+
+	for i, content := range []string{"chr1\t0\n", "chr1\t-1\t10\n", "chr1\t10\t5\n", "chr1\t0\tx\n"} {
+		file = writeTestFile(t, dir, "bad.bed", content)
+		if _, err = LoadBamRegions(file); err == nil {
+			t.Errorf("invalid BED file #%d: error expected", i+1)
+		}
+	}
+}
+
+func TestBamRegionReader(t *testing.T) {
+	dir := t.TempDir()
+	file := writeTestBam(t, dir, map[string]int{"chr1": 1000, "chr2": 500}, []string{"chr1", "chr2"}, []testAln{
+		{"r1", 0, 10, 50},
+		{"r2", 0, 100, 50},
+		{"r3", 0, 140, 50},
+		{"r4", 0, 500, 50},
+		{"r5", 1, 0, 50},
+		{"r6", 1, 400, 50},
+	})
+
+	regions := func(ss ...string) []*BamRegion {
+		var rs []*BamRegion
+		for _, s := range ss {
+			r, err := ParseBamRegion(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs = append(rs, r)
+		}
+		return rs
+	}
+
+	tests := []struct {
+		name    string
+		regions []*BamRegion
+		ids     string
+	}{
+		{"one region", regions("chr1:50-120"), "r1,r2"},
+		{"whole reference", regions("chr2"), "r5,r6"},
+		{"unsorted regions", regions("chr2:450", "chr1:1-20"), "r1,r6"},
+		// r3 overlaps with both regions
+		{"overlapping and merged regions", regions("chr1:150-200", "chr1:50-120", "chr1:110-145"), "r1,r2,r3"},
+		{"region without records", regions("chr1:300-400"), ""},
+		{"region out of the reference", regions("chr2:1000"), ""},
+	}
+	for _, test := range tests {
+		reader, err := NewBamRegionReader(file, test.regions, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for {
+			r, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, r.Name)
+		}
+		if err = reader.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if s := strings.Join(ids, ","); s != test.ids {
+			t.Errorf("%s: expected %s, returned %s", test.name, test.ids, s)
+		}
+	}
+
+	if _, err := NewBamRegionReader(file, regions("chr3"), 1); err == nil {
+		t.Errorf("unknown reference: error expected")
+	}
+	if err := os.Remove(file + ".bai"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewBamRegionReader(file, regions("chr1"), 1); err == nil {
+		t.Errorf("missing index: error expected")
+	}
+}
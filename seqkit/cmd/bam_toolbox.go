@@ -22,25 +22,35 @@ package cmd
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"regexp"
 	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 
 	"github.com/biogo/hts/bam"
 	"github.com/biogo/hts/sam"
+	"github.com/cespare/xxhash/v2"
 	"github.com/shenwei356/bio/seq"
 	"github.com/shenwei356/bio/seqio/fai"
 	"github.com/shenwei356/bio/seqio/fastx"
 	syaml "github.com/smallfish/simpleyaml"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
+	"gopkg.in/yaml.v2"
 )
 
 type BamTool struct {
 	Name string
 	Desc string
 	Use  func(params *BamToolParams)
+	// Threaded tools support the Threads parameter, see runBamRecordTool.
+	Threaded bool
 }
 
 type BamToolParams struct {
@@ -72,10 +82,14 @@ func (s Toolshed) String() string {
 
 func NewToolshed() Toolshed {
 	ts := map[string]BamTool{
-		"AlnContext": BamTool{Name: "AlnContext", Desc: "filter records by the sequence context at start and end", Use: BamToolAlnContext},
-		"AccStats":   BamTool{Name: "AccStats", Desc: "calculates mean accuracy weighted by aligment lengths", Use: BamToolAccStats},
-		"Dump":       BamTool{Name: "Dump", Desc: "dump various record properties in TSV format", Use: BamToolDump},
-		"help":       BamTool{Name: "help", Desc: "list all tools with description", Use: ListTools},
+		"AlnContext":   BamTool{Name: "AlnContext", Desc: "filter records by the sequence context at start and end", Use: BamToolAlnContext, Threaded: true},
+		"AccStats":     BamTool{Name: "AccStats", Desc: "calculates mean accuracy weighted by aligment lengths", Use: BamToolAccStats},
+		"Dump":         BamTool{Name: "Dump", Desc: "dump various record properties in TSV format", Use: BamToolDump, Threaded: true},
+		"Filter":       BamTool{Name: "Filter", Desc: "filter records by a boolean expression over fields of Dump", Use: BamToolFilter, Threaded: true},
+		"Tag":          BamTool{Name: "Tag", Desc: "add or overwrite aux tags", Use: BamToolTag, Threaded: true},
+		"SoftClipTrim": BamTool{Name: "SoftClipTrim", Desc: "soft- or hard-clip bases at alignment ends", Use: BamToolSoftClipTrim, Threaded: true},
+		"Downsample":   BamTool{Name: "Downsample", Desc: "subsample a fraction of reads, keeping all records of a read", Use: BamToolDownsample, Threaded: true},
+		"help":         BamTool{Name: "help", Desc: "list all tools with description", Use: ListTools},
 	}
 	return ts
 }
@@ -89,23 +103,58 @@ func NewBamReaderChan(inFile string, cp int, buff int, threads int) (chan *sam.R
 	}
 
 	r, err := bam.NewReader(bufio.NewReaderSize(fh, buff), threads)
-	go func() {
-		for {
-			rec, err := r.Read()
-			if err == io.EOF {
-				close(outChan)
-				return
-			}
-			if err != nil {
-				close(outChan)
-			}
-			checkError(err)
-			outChan <- rec
-		}
-	}()
+	checkError(err)
+	go sendSamRecords(r.Read, outChan)
 	return outChan, r
 }
 
+// NewSamReaderChan is similar to NewBamReaderChan, but accepts both SAM and
+// BAM input, the format is detected from the content. CRAM is not supported.
+func NewSamReaderChan(inFile string, cp int, buff int, threads int) (chan *sam.Record, *sam.Header) {
+	outChan := make(chan *sam.Record, cp)
+	fh, err := os.Stdin, error(nil)
+	if inFile != "-" {
+		fh, err = os.Open(inFile)
+		checkError(err)
+	}
+
+	br := bufio.NewReaderSize(fh, buff)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		checkError(err)
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte("CRAM")):
+		checkError(fmt.Errorf("%s: CRAM is not supported, please convert it to BAM first, e.g., samtools view -b", inFile))
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}): // BGZF
+		r, err := bam.NewReader(br, threads)
+		checkError(err)
+		go sendSamRecords(r.Read, outChan)
+		return outChan, r.Header()
+	}
+
+	r, err := sam.NewReader(br)
+	checkError(err)
+	go sendSamRecords(r.Read, outChan)
+	return outChan, r.Header()
+}
+
+// sendSamRecords sends records returned by read to ch until EOF.
+func sendSamRecords(read func() (*sam.Record, error), ch chan *sam.Record) {
+	for {
+		rec, err := read()
+		if err == io.EOF {
+			close(ch)
+			return
+		}
+		if err != nil {
+			close(ch)
+		}
+		checkError(err)
+		ch <- rec
+	}
+}
+
 func NewBamSinkChan(cp int) (chan *sam.Record, chan bool) {
 	outChan := make(chan *sam.Record, cp)
 	doneChan := make(chan bool, 0)
@@ -143,20 +192,23 @@ func NewBamWriterChan(inFile string, head *sam.Header, cp int, buff int, threads
 	return outChan, doneChan
 }
 
-func BamToolbox(toolYaml string, inFile string, outFile string, quiet bool, silent bool, threads int) {
+// BamToolbox runs tools on records of inFile, only records overlapping with
+// regions are read via the BAM index if queryRegions is true.
+func BamToolbox(toolYaml string, inFile string, outFile string, quiet bool, silent bool, threads int, regions []*BamRegion, queryRegions bool) {
 	if toolYaml == "help" {
 		toolYaml = "help: true"
 	}
-	y, err := syaml.NewYaml([]byte(toolYaml))
+	body := []byte(toolYaml)
+	y, err := syaml.NewYaml(body)
 	checkError(err)
 	ty, err := y.GetMapKeys()
 	checkError(err)
 	if ty[0] == "Yaml" {
 		conf, err := y.Get("Yaml").String()
 		checkError(err)
-		cb, err := ioutil.ReadFile(conf)
+		body, err = ioutil.ReadFile(conf)
 		checkError(err)
-		y, err = syaml.NewYaml(cb)
+		y, err = syaml.NewYaml(body)
 		checkError(err)
 	}
 
@@ -171,20 +223,30 @@ func BamToolbox(toolYaml string, inFile string, outFile string, quiet bool, sile
 	case 0:
 		log.Fatal("toolbox: not tool specified!")
 	default:
-		tkeys, err := y.GetMapKeys()
+		tkeys, err := yamlMapKeys(body)
 		checkError(err)
 		shed := NewToolshed()
 		var inChan, outChan, lastOut chan *sam.Record
-		var bamReader *bam.Reader
+		var bamHeader *sam.Header
 		var doneChan chan bool
 		var sink bool
 		if tkeys[0] != "help" {
-			inChan, bamReader = NewBamReaderChan(inFile, chanCap, ioBuff, threads)
+			if queryRegions {
+				regionReader, err := NewBamRegionReader(inFile, regions, threads)
+				checkError(err)
+				inChan = make(chan *sam.Record, chanCap)
+				go sendSamRecords(regionReader.Read, inChan)
+				bamHeader = regionReader.Header()
+			} else {
+				var bamReader *bam.Reader
+				inChan, bamReader = NewBamReaderChan(inFile, chanCap, ioBuff, threads)
+				bamHeader = bamReader.Header()
+			}
 			sink, err = y.Get("Sink").Bool()
 			if err == nil && sink {
 				lastOut, doneChan = NewBamSinkChan(chanCap)
 			} else {
-				lastOut, doneChan = NewBamWriterChan(outFile, bamReader.Header(), chanCap, ioBuff, threads)
+				lastOut, doneChan = NewBamWriterChan(outFile, bamHeader, chanCap, ioBuff, threads)
 			}
 		}
 		outChan = make(chan *sam.Record, chanCap)
@@ -201,6 +263,9 @@ func BamToolbox(toolYaml string, inFile string, outFile string, quiet bool, sile
 			if wt, ok = shed[tool]; !ok {
 				log.Fatal("Unknown tool:", tool)
 			}
+			if y.Get(tool).Get("Threads").IsFound() && !wt.Threaded {
+				log.Warningf("parameter Threads is not supported by tool %s, ignored", tool)
+			}
 			if rank == (len(clearKeys) - 1) {
 				nextOut = lastOut
 			}
@@ -224,6 +289,109 @@ func BamToolbox(toolYaml string, inFile string, outFile string, quiet bool, sile
 
 }
 
+// yamlMapKeys returns keys of a YAML map in the order of the text,
+// so tools are chained in the order they are given.
+func yamlMapKeys(body []byte) ([]string, error) {
+	var m yaml.MapSlice
+	if err := yaml.Unmarshal(body, &m); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(m))
+	for _, item := range m {
+		if k, ok := item.Key.(string); ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+// BamRecordFunc processes a record, and returns whether to pass it
+// downstream, and text to write to the TSV output of the tool.
+type BamRecordFunc func(r *sam.Record) (keep bool, text string)
+
+// runBamRecordTool runs a tool processing records one by one, and closes
+// p.OutChan in the end. Non-empty texts are written to tsvFh if it's not nil.
+// With the parameter Threads > 1, records are processed by that many
+// workers, each with a BamRecordFunc created by newFunc, and both records
+// and texts are output in the input order, so sorted BAMs stay sorted.
+func runBamRecordTool(p *BamToolParams, tsvFh io.StringWriter, newFunc func() BamRecordFunc) {
+	defer close(p.OutChan)
+
+	threads, err := p.Yaml.Get("Threads").Int()
+	if err != nil || threads < 1 {
+		threads = 1
+	}
+
+	if threads == 1 {
+		process := newFunc()
+		for r := range p.InChan {
+			keep, text := process(r)
+			if tsvFh != nil && text != "" {
+				tsvFh.WriteString(text)
+			}
+			if keep {
+				p.OutChan <- r
+			}
+		}
+		return
+	}
+
+	// records are processed in chunks to reduce the cost of synchronization
+	const chunkSize = 256
+	type chunk struct {
+		records []*sam.Record
+		keep    []bool
+		texts   []string
+		done    chan struct{}
+	}
+
+	jobs := make(chan *chunk, threads)
+	queue := make(chan *chunk, threads*4) // chunks in the input order
+	go func() {
+		c := &chunk{done: make(chan struct{})}
+		for r := range p.InChan {
+			c.records = append(c.records, r)
+			if len(c.records) == chunkSize {
+				queue <- c
+				jobs <- c
+				c = &chunk{done: make(chan struct{})}
+			}
+		}
+		if len(c.records) > 0 {
+			queue <- c
+			jobs <- c
+		}
+		close(queue)
+		close(jobs)
+	}()
+
+	for i := 0; i < threads; i++ {
+		process := newFunc()
+		go func() {
+			for c := range jobs {
+				c.keep = make([]bool, len(c.records))
+				c.texts = make([]string, len(c.records))
+				for j, r := range c.records {
+					c.keep[j], c.texts[j] = process(r)
+				}
+				close(c.done)
+			}
+		}()
+	}
+
+	for c := range queue {
+		<-c.done
+		for j, r := range c.records {
+			if tsvFh != nil && c.texts[j] != "" {
+				tsvFh.WriteString(c.texts[j])
+			}
+			if c.keep[j] {
+				p.OutChan <- r
+			}
+		}
+	}
+}
+
 func ListTools(p *BamToolParams) {
 	os.Stderr.WriteString(p.Shed.String())
 	os.Exit(0)
@@ -232,7 +400,6 @@ func ListTools(p *BamToolParams) {
 func BamToolAlnContext(p *BamToolParams) {
 	ref, err := p.Yaml.Get("Ref").String()
 	checkError(err)
-	idx := NewRefWitdFaidx(ref, false, p.Silent)
 	leftShift, err := p.Yaml.Get("LeftShift").Int()
 	checkError(err)
 	rightShift, err := p.Yaml.Get("RightShift").Int()
@@ -261,55 +428,59 @@ func BamToolAlnContext(p *BamToolParams) {
 	head := fmt.Sprintf("Read\tRef\tStrand\tStartSeq\tStartMatch\tEndSeq\tEndMatch\n")
 	tsvFh.WriteString(head)
 
-	for r := range p.InChan {
-		chrom := r.Ref.Name()
-		startPos, endPos := r.Pos, r.End()
-		startSeq, err := idx.IdxSubSeq(chrom, startPos+leftShift, startPos+rightShift)
-		checkError(err)
-		endSeq, err := idx.IdxSubSeq(chrom, endPos+leftShift, endPos+rightShift)
-		checkError(err)
-		strand := 1
-		if GetSamReverse(r) {
-			strand = -1
-			if stranded {
-				startSeq, endSeq = RevCompDNA(endSeq), RevCompDNA(startSeq)
-			}
-		}
-
-		yes, no := -1, 1
-		if invert {
-			no, yes = yes, no
+	// the index file is created once, and every worker has its own handler
+	first := NewRefWitdFaidx(ref, false, p.Silent)
+	runBamRecordTool(p, tsvFh, func() BamRecordFunc {
+		idx := first
+		if idx == nil {
+			idx = NewRefWitdFaidx(ref, false, true)
 		}
-		startMatch := no
-		endMatch := no
-		if regStart != nil {
-			if regStart.MatchString(startSeq) {
-				startMatch = yes
+		first = nil
+		return func(r *sam.Record) (bool, string) {
+			chrom := r.Ref.Name()
+			startPos, endPos := r.Pos, r.End()
+			startSeq, err := idx.IdxSubSeq(chrom, startPos+leftShift, startPos+rightShift)
+			checkError(err)
+			endSeq, err := idx.IdxSubSeq(chrom, endPos+leftShift, endPos+rightShift)
+			checkError(err)
+			strand := 1
+			if GetSamReverse(r) {
+				strand = -1
+				if stranded {
+					startSeq, endSeq = lib.RevCompDNA(endSeq), lib.RevCompDNA(startSeq)
+				}
 			}
-		}
 
-		if regEnd != nil {
-			if regEnd.MatchString(endSeq) {
-				endMatch = yes
+			yes, no := -1, 1
+			if invert {
+				no, yes = yes, no
+			}
+			startMatch := no
+			endMatch := no
+			if regStart != nil {
+				if regStart.MatchString(startSeq) {
+					startMatch = yes
+				}
 			}
-		}
 
-		match := (startMatch == yes) || (endMatch == yes)
+			if regEnd != nil {
+				if regEnd.MatchString(endSeq) {
+					endMatch = yes
+				}
+			}
 
-		info := fmt.Sprintf("%s\t%s\t%d\t%s\t%d\t%s\t%d\n", GetSamName(r), GetSamRef(r), strand, startSeq, startMatch, endSeq, endMatch)
+			match := (startMatch == yes) || (endMatch == yes)
 
-		if match && !invert {
-			p.OutChan <- r
-			tsvFh.WriteString(info)
-		} else if !match && invert {
-			p.OutChan <- r
-		} else {
-			tsvFh.WriteString(info)
+			info := fmt.Sprintf("%s\t%s\t%d\t%s\t%d\t%s\t%d\n", GetSamName(r), GetSamRef(r), strand, startSeq, startMatch, endSeq, endMatch)
 
+			if match && !invert {
+				return true, info
+			} else if !match && invert {
+				return true, ""
+			}
+			return false, info
 		}
-
-	}
-	close(p.OutChan)
+	})
 	tsvFh.Close()
 }
 
@@ -456,8 +627,11 @@ func GetSamAlnDetails(r *sam.Record) *AlnDetails {
 	return res
 }
 
+// samDumpFields are the fields supported by GetSamDump.
+var samDumpFields = []string{"Read", "Ref", "Pos", "EndPos", "MapQual", "Acc", "Match", "Mismatch", "Ins", "Del", "AlnLen", "ReadLen", "RefLen", "RefAln", "RefCov", "ReadAln", "ReadCov", "Strand", "MeanQual", "LeftClip", "RightClip", "Flags", "IsSec", "IsSup", "ReadSeq", "ReadAlnSeq", "LeftSoftClipSeq", "RightSoftClipSeq", "RightSoftClip", "LeftHardClip", "RightHardClip"}
+
 func BamToolDump(p *BamToolParams) {
-	validFields := []string{"Read", "Ref", "Pos", "EndPos", "MapQual", "Acc", "Match", "Mismatch", "Ins", "Del", "AlnLen", "ReadLen", "RefLen", "RefAln", "RefCov", "ReadAln", "ReadCov", "Strand", "MeanQual", "LeftClip", "RightClip", "Flags", "IsSec", "IsSup", "ReadSeq", "ReadAlnSeq", "LeftSoftClipSeq", "RightSoftClipSeq", "RightSoftClip", "LeftHardClip", "RightHardClip"}
+	validFields := samDumpFields
 
 	tsvFh := os.Stderr
 	tsvFile, err := p.Yaml.Get("Tsv").String()
@@ -493,16 +667,268 @@ func BamToolDump(p *BamToolParams) {
 		}
 	}
 	tsvFh.WriteString(PrintTsvLine(keys))
-	for r := range p.InChan {
-		if GetSamMapped(r) {
-			tsvFh.WriteString(PrintTsvLine(SamDumper(keys, r)))
+	runBamRecordTool(p, tsvFh, func() BamRecordFunc {
+		return func(r *sam.Record) (bool, string) {
+			if GetSamMapped(r) {
+				return true, PrintTsvLine(SamDumper(keys, r))
+			}
+			return true, ""
 		}
-		p.OutChan <- r
-	}
-	close(p.OutChan)
+	})
 	tsvFh.Close()
 }
 
+// samDumpStringFields are fields of GetSamDump with string values,
+// others are numbers.
+var samDumpStringFields = map[string]bool{"Read": true, "Ref": true, "ReadSeq": true, "ReadAlnSeq": true, "LeftSoftClipSeq": true, "RightSoftClipSeq": true}
+
+func BamToolFilter(p *BamToolParams) {
+	exprStr, err := p.Yaml.Get("Expr").String()
+	if err != nil {
+		log.Fatal("Filter: parameter Expr needed")
+	}
+	expr, err := lib.CompileExpr(exprStr)
+	checkError(err)
+	validFields := make(map[string]bool, len(samDumpFields))
+	for _, f := range samDumpFields {
+		validFields[f] = true
+	}
+	for _, v := range expr.Vars() {
+		if !validFields[v] {
+			log.Fatalf("Filter: unknown field: %s, available: %s", v, strings.Join(samDumpFields, ", "))
+		}
+	}
+	invert, _ := p.Yaml.Get("Invert").Bool()
+
+	runBamRecordTool(p, nil, func() BamRecordFunc {
+		var r *sam.Record
+		lookup := func(field string) (interface{}, bool) {
+			v := GetSamDump(field, r)
+			if samDumpStringFields[field] {
+				return v, true
+			}
+			f, err := strconv.ParseFloat(v, 64)
+			checkError(err)
+			return f, true
+		}
+		return func(record *sam.Record) (bool, string) {
+			if !GetSamMapped(record) {
+				return false, ""
+			}
+			r = record
+			pass, err := expr.EvalBool(lookup)
+			checkError(err)
+			return pass != invert, ""
+		}
+	})
+}
+
+func BamToolTag(p *BamToolParams) {
+	arr, err := p.Yaml.Get("Tags").Array()
+	if err != nil {
+		log.Fatal("Tag: parameter Tags needed")
+	}
+	tags := make([]sam.Aux, 0, len(arr))
+	for _, t := range arr {
+		s, ok := t.(string)
+		if !ok {
+			log.Fatalf("Tag: tags should be strings like \"RG:Z:grp1\": %v", t)
+		}
+		aux, err := sam.ParseAux([]byte(s))
+		checkError(err)
+		tags = append(tags, aux)
+	}
+
+	runBamRecordTool(p, nil, func() BamRecordFunc {
+		return func(r *sam.Record) (bool, string) {
+			var found bool
+			for _, aux := range tags {
+				found = false
+				for i, a := range r.AuxFields {
+					if a.Tag() == aux.Tag() {
+						r.AuxFields[i] = aux
+						found = true
+						break
+					}
+				}
+				if !found {
+					r.AuxFields = append(r.AuxFields, aux)
+				}
+			}
+			return true, ""
+		}
+	})
+}
+
+func BamToolSoftClipTrim(p *BamToolParams) {
+	left, _ := p.Yaml.Get("Left").Int()
+	right, _ := p.Yaml.Get("Right").Int()
+	if left < 0 || right < 0 {
+		log.Fatal("SoftClipTrim: Left and Right should not be negative")
+	}
+	hard, _ := p.Yaml.Get("Hard").Bool()
+
+	var n int64
+	runBamRecordTool(p, nil, func() BamRecordFunc {
+		return func(r *sam.Record) (bool, string) {
+			if GetSamMapped(r) && !SamClipEnds(r, left, right, hard) {
+				atomic.AddInt64(&n, 1)
+			}
+			return true, ""
+		}
+	})
+	if n > 0 && !p.Silent {
+		log.Warningf("SoftClipTrim: %d records with aligned parts not longer than clipping lengths left unchanged", n)
+	}
+}
+
+// SamClipEnds clips left and right aligned bases at the two ends of a
+// mapped record, in the orientation of the reference. Existing clipping
+// operations are kept, but with hard set, soft-clipped bases are removed
+// from the sequence and quality, and hard-clipped instead.
+// NM and MD tags are not updated. The record is unchanged and false is
+// returned if its aligned part is not longer than left+right,
+// or nothing is left after clipping insertions next to the clipped parts.
+func SamClipEnds(r *sam.Record, left, right int, hard bool) bool {
+	// clipping operations at the two ends and aligned ones between them
+	var lh, ls, rs, rh int
+	core := r.Cigar
+	if len(core) > 0 && core[0].Type() == sam.CigarHardClipped {
+		lh, core = core[0].Len(), core[1:]
+	}
+	if len(core) > 0 && core[0].Type() == sam.CigarSoftClipped {
+		ls, core = core[0].Len(), core[1:]
+	}
+	if len(core) > 0 && core[len(core)-1].Type() == sam.CigarHardClipped {
+		rh, core = core[len(core)-1].Len(), core[:len(core)-1]
+	}
+	if len(core) > 0 && core[len(core)-1].Type() == sam.CigarSoftClipped {
+		rs, core = core[len(core)-1].Len(), core[:len(core)-1]
+	}
+
+	var aligned int
+	for _, op := range core {
+		aligned += op.Len() * op.Type().Consumes().Query
+	}
+	if aligned <= left+right {
+		return false
+	}
+
+	ops := make([]sam.CigarOp, len(core))
+	copy(ops, core)
+	pos := r.Pos
+	var nl, nr int // clipped bases
+	ops, nl, pos = samClipOps(ops, left, pos)
+	// clip the right end on the reversed operations
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	ops, nr, _ = samClipOps(ops, right, 0)
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	if len(ops) == 0 {
+		return false
+	}
+	ls += nl
+	rs += nr
+
+	if hard && r.Seq.Length > 0 {
+		s := r.Seq.Expand()
+		s = s[ls : len(s)-rs]
+		if len(r.Qual) > 0 {
+			r.Qual = r.Qual[ls : len(r.Qual)-rs]
+		}
+		r.Seq = sam.NewSeq(s)
+	}
+
+	cigar := make(sam.Cigar, 0, len(ops)+4)
+	if hard {
+		lh, ls, rh, rs = lh+ls, 0, rh+rs, 0
+	}
+	if lh > 0 {
+		cigar = append(cigar, sam.NewCigarOp(sam.CigarHardClipped, lh))
+	}
+	if ls > 0 {
+		cigar = append(cigar, sam.NewCigarOp(sam.CigarSoftClipped, ls))
+	}
+	cigar = append(cigar, ops...)
+	if rs > 0 {
+		cigar = append(cigar, sam.NewCigarOp(sam.CigarSoftClipped, rs))
+	}
+	if rh > 0 {
+		cigar = append(cigar, sam.NewCigarOp(sam.CigarHardClipped, rh))
+	}
+	r.Cigar = cigar
+	r.Pos = pos
+	return true
+}
+
+// samClipOps clips n query bases from the start of aligned CIGAR operations,
+// deletions and skipped regions next to the clipped part are removed, and
+// insertions there are also clipped. It returns the remaining operations,
+// the number of clipped bases, and the updated leftmost position.
+func samClipOps(ops []sam.CigarOp, n int, pos int) ([]sam.CigarOp, int, int) {
+	var clipped, k int
+	for len(ops) > 0 {
+		op := ops[0]
+		t, l := op.Type(), op.Len()
+		switch t {
+		case sam.CigarMatch, sam.CigarEqual, sam.CigarMismatch:
+			if clipped >= n {
+				return ops, clipped, pos
+			}
+			k = n - clipped
+			if k >= l {
+				clipped += l
+				pos += l
+				ops = ops[1:]
+			} else {
+				clipped += k
+				pos += k
+				ops[0] = sam.NewCigarOp(t, l-k)
+			}
+		case sam.CigarInsertion:
+			clipped += l
+			ops = ops[1:]
+		case sam.CigarDeletion, sam.CigarSkipped:
+			pos += l
+			ops = ops[1:]
+		default: // padding
+			ops = ops[1:]
+		}
+	}
+	return ops, clipped, pos
+}
+
+func BamToolDownsample(p *BamToolParams) {
+	fraction, err := p.Yaml.Get("Fraction").Float()
+	if err != nil {
+		if i, err2 := p.Yaml.Get("Fraction").Int(); err2 == nil {
+			fraction, err = float64(i), nil
+		}
+	}
+	if err != nil || fraction <= 0 || fraction > 1 {
+		log.Fatal("Downsample: parameter Fraction should be in range of (0, 1]")
+	}
+	seed, err := p.Yaml.Get("Seed").Int()
+	if err != nil {
+		seed = 11
+	}
+
+	// reads are kept by hash values of names, so all records of a read,
+	// including mates, secondary and supplementary alignments, are kept together
+	prefix := []byte(fmt.Sprintf("%d\t", seed))
+	threshold := uint64(fraction * float64(math.MaxUint64))
+	runBamRecordTool(p, nil, func() BamRecordFunc {
+		var buf []byte
+		return func(r *sam.Record) (bool, string) {
+			buf = append(append(buf[:0], prefix...), r.Name...)
+			return fraction == 1 || xxhash.Sum64(buf) < threshold, ""
+		}
+	})
+}
+
 func SamDumper(fields []string, r *sam.Record) []string {
 	res := make([]string, len(fields))
 	for i, f := range fields {
@@ -512,7 +938,11 @@ func SamDumper(fields []string, r *sam.Record) []string {
 }
 
 func GetSamDump(field string, r *sam.Record) string {
-	acc := GetSamAlnDetails(r)
+	var acc *AlnDetails
+	switch field {
+	case "Acc", "Match", "Mismatch", "Ins", "Del", "AlnLen":
+		acc = GetSamAlnDetails(r)
+	}
 	switch field {
 	case "Read":
 		return fmt.Sprintf("%s", GetSamName(r))
@@ -551,7 +981,7 @@ func GetSamDump(field string, r *sam.Record) string {
 	case "Strand":
 		return fmt.Sprintf("%d", GetSamStrand(r))
 	case "MeanQual":
-		return fmt.Sprintf("%d", GetSamReadAln(r))
+		return fmt.Sprintf("%.3f", GetSamMeanBaseQual(r))
 	case "LeftClip":
 		return fmt.Sprintf("%d", GetSamLeftClip(r))
 	case "RightClip":
@@ -0,0 +1,180 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/biogo/hts/sam"
+	syaml "github.com/smallfish/simpleyaml"
+)
+
+// testToolRecords creates n sorted records on a reference, the mapping
+// quality of the ith record is i % 60.
+func testToolRecords(t *testing.T, n int) []*sam.Record {
+	ref, err := sam.NewReference("chr1", "", "", n*10+100, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sam.NewHeader(nil, []*sam.Reference{ref}); err != nil { // setting the ID of the reference
+		t.Fatal(err)
+	}
+	co := []sam.CigarOp{sam.NewCigarOp(sam.CigarMatch, 50)}
+	records := make([]*sam.Record, n)
+	for i := range records {
+		records[i], err = sam.NewRecord(fmt.Sprintf("r%d", i), ref, nil, i*10, -1, 0, byte(i%60), co,
+			[]byte(strings.Repeat("A", 50)), nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return records
+}
+
+// runBamTool runs a tool with parameters in YAML, and returns the output records.
+func runBamTool(t *testing.T, use func(p *BamToolParams), params string, records []*sam.Record) []*sam.Record {
+	y, err := syaml.NewYaml([]byte(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := make(chan *sam.Record, len(records))
+	for _, r := range records {
+		in <- r
+	}
+	close(in)
+	out := make(chan *sam.Record, 10)
+	go use(&BamToolParams{Yaml: y, InChan: in, OutChan: out, Quiet: true, Silent: true})
+
+	var result []*sam.Record
+	for r := range out {
+		result = append(result, r)
+	}
+	return result
+}
+
+// recordNames returns names of SAM records.
+func recordNames(records []*sam.Record) []string {
+	names := make([]string, len(records))
+	for i, r := range records {
+		names[i] = r.Name
+	}
+	return names
+}
+
+// stringsWriter collects strings written.
+type stringsWriter struct {
+	texts []string
+}
+
+func (w *stringsWriter) WriteString(s string) (int, error) {
+	w.texts = append(w.texts, s)
+	return len(s), nil
+}
+
+func TestRunBamRecordTool(t *testing.T) {
+	records := testToolRecords(t, 1000)
+
+	var expected []string
+	var expectedTexts []string
+	for i, r := range records {
+		if i%2 == 0 {
+			expected = append(expected, r.Name)
+		}
+		if i%3 == 0 {
+			expectedTexts = append(expectedTexts, r.Name+"\n")
+		}
+	}
+
+	for _, threads := range []int{0, 1, 3, 8} {
+		w := &stringsWriter{}
+		var nFuncs int
+		tool := func(p *BamToolParams) {
+			runBamRecordTool(p, w, func() BamRecordFunc {
+				nFuncs++
+				return func(r *sam.Record) (bool, string) {
+					var i int
+					fmt.Sscanf(r.Name, "r%d", &i)
+					if i%3 == 0 {
+						return i%2 == 0, r.Name + "\n"
+					}
+					return i%2 == 0, ""
+				}
+			})
+		}
+		names := recordNames(runBamTool(t, tool, fmt.Sprintf("Threads: %d", threads), records))
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("threads %d: records are not kept in order", threads)
+		}
+		if !reflect.DeepEqual(w.texts, expectedTexts) {
+			t.Errorf("threads %d: texts are not written in order", threads)
+		}
+		n := threads
+		if n < 1 {
+			n = 1
+		}
+		if nFuncs != n {
+			t.Errorf("threads %d: expected %d functions, returned %d", threads, n, nFuncs)
+		}
+	}
+}
+
+func TestBamToolsThreads(t *testing.T) {
+	tests := []struct {
+		name   string
+		use    func(p *BamToolParams)
+		params string
+	}{
+		{"Filter", BamToolFilter, "Expr: 'MapQual >= 30 && Read =~ \"[02468]$\"'"},
+		{"Downsample", BamToolDownsample, "Fraction: 0.3"},
+		{"Tag", BamToolTag, "Tags: [\"RG:Z:grp1\"]"},
+	}
+	for _, test := range tests {
+		single := runBamTool(t, test.use, test.params, testToolRecords(t, 2000))
+		multi := runBamTool(t, test.use, test.params+"\nThreads: 4", testToolRecords(t, 2000))
+		if len(single) == 0 {
+			t.Errorf("%s: no records returned", test.name)
+		}
+		if !reflect.DeepEqual(recordNames(single), recordNames(multi)) {
+			t.Errorf("%s: different records returned with 4 threads", test.name)
+		}
+	}
+
+	records := runBamTool(t, BamToolFilter, "Expr: 'MapQual >= 30 && Read =~ \"[02468]$\"'\nThreads: 4", testToolRecords(t, 120))
+	var expected []string
+	for i := 0; i < 120; i++ {
+		if i%60 >= 30 && i%2 == 0 {
+			expected = append(expected, fmt.Sprintf("r%d", i))
+		}
+	}
+	if names := recordNames(records); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Filter: expected %v, returned %v", expected, names)
+	}
+
+	records = runBamTool(t, BamToolTag, "Tags: [\"RG:Z:grp1\"]\nThreads: 4", testToolRecords(t, 10))
+	for _, r := range records {
+		if a := r.AuxFields.Get(sam.NewTag("RG")); a == nil || a.Value() != "grp1" {
+			t.Errorf("Tag: RG:Z:grp1 expected for %s", r.Name)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+
+	"github.com/biogo/hts/sam"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// consensusCmd represents the consensus command
+var consensusCmd = &cobra.Command{
+	Use:   "consensus",
+	Short: "call consensus sequences from pileups of coordinate-sorted SAM/BAM",
+	Long: `call consensus sequences from pileups of coordinate-sorted SAM/BAM
+
+A consensus sequence is called for every reference sequence in the header,
+from the pileup of alignments. Unmapped, secondary, QC-failed and duplicate
+records are skipped, so do bases with a quality lower than -Q/--min-base-qual.
+
+Rules of a position:
+  1. Positions with a depth (including deletions) lower than -d/--min-depth
+     are masked with N, or filled with reference bases (--fill-ref).
+  2. The position is deleted if more than half of the reads have a deletion.
+  3. Otherwise, bases with a frequency >= -a/--ambiguity are merged into an
+     IUPAC ambiguity code, e.g., R for A and G. If no bases reach the
+     threshold, or it's 0, the most frequent base is used (ties are merged).
+  4. The most frequent insertion after the position is added if it's
+     supported by more than half of the reads.
+
+Attentions:
+  1. The input should be sorted by coordinate.
+  2. The reference FASTA file is indexed with the suffix .seqkit.fai.
+     All reference sequences in the SAM/BAM header should exist in it.
+  3. IDs of output sequences are those of reference sequences.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		outFile := config.OutFile
+		quiet := config.Quiet
+		runtime.GOMAXPROCS(config.Threads)
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+
+		refFile := getFlagString(cmd, "ref")
+		if refFile == "" {
+			checkError(fmt.Errorf("flag -r/--ref needed"))
+		}
+		minDepth := getFlagPositiveInt(cmd, "min-depth")
+		minBaseQual := getFlagNonNegativeInt(cmd, "min-base-qual")
+		minMapQual := getFlagNonNegativeInt(cmd, "min-map-qual")
+		ambiguity := getFlagFloat64(cmd, "ambiguity")
+		if ambiguity < 0 || ambiguity > 1 {
+			checkError(fmt.Errorf("value of flag -a/--ambiguity should be in range of [0, 1]"))
+		}
+		fillRef := getFlagBool(cmd, "fill-ref")
+
+		ref := NewRefWitdFaidx(refFile, false, quiet)
+
+		outfh, err := xopen.Wopen(outFile)
+		checkError(err)
+		defer outfh.Close()
+
+		inChan, header := NewSamReaderChan(files[0], 5000, 1024*128, config.Threads)
+		refs := header.Refs()
+
+		var buffer *bytes.Buffer
+		var text []byte
+		var cur *sam.Reference
+		var refSeq, cons []byte
+		var next, pos int // next reference to output, next position to call
+
+		// fill calls positions before end as low-coverage ones
+		fill := func(end int) {
+			for ; pos < end; pos++ {
+				if fillRef {
+					cons = append(cons, refSeq[pos])
+				} else {
+					cons = append(cons, 'N')
+				}
+			}
+		}
+		begin := func(r *sam.Reference) {
+			cur = r
+			refSeq = pileupRefSeq(ref, r)
+			cons = cons[:0]
+			pos = 0
+		}
+		end := func() {
+			fill(cur.Len())
+			outfh.WriteString(fmt.Sprintf(">%s\n", cur.Name()))
+			text, buffer = wrapByteSlice(cons, config.LineWidth, buffer)
+			outfh.Write(text)
+			outfh.WriteString("\n")
+			next = cur.ID() + 1
+			cur = nil
+		}
+		// skipTo outputs references before id, which have no reads
+		skipTo := func(id int) {
+			for next < id {
+				begin(refs[next])
+				end()
+			}
+		}
+
+		var ins string
+		var nIns, depth int
+		pileup := NewPileup(minBaseQual, func(r *sam.Reference, col *PileupColumn) {
+			if cur == nil || r.ID() != cur.ID() {
+				if cur != nil {
+					end()
+				}
+				skipTo(r.ID())
+				begin(r)
+			}
+
+			fill(col.Pos)
+			depth = col.Depth()
+			if depth < minDepth {
+				fill(col.Pos + 1)
+				return
+			}
+			pos++
+			if col.Count(pileupDel)*2 <= depth {
+				cons = append(cons, consensusBase(col, ambiguity))
+			}
+			ins, nIns = col.TopInsertion()
+			if nIns*2 > depth {
+				cons = append(cons, bytes.ToUpper([]byte(ins))...)
+			}
+		})
+
+		var nSkipped int
+		for r := range inChan {
+			if pileupSkipRecord(r, minMapQual) {
+				nSkipped++
+				continue
+			}
+			checkError(pileup.Add(r))
+		}
+		pileup.Flush()
+		if cur != nil {
+			end()
+		}
+		skipTo(len(refs))
+
+		if !quiet && nSkipped > 0 {
+			log.Infof("%d records skipped", nSkipped)
+		}
+	},
+}
+
+// iupacCodes are IUPAC codes of sets of bases, indexed by bit masks of
+// A (1), C (2), G (4) and T (8).
+var iupacCodes = []byte("NACMGRSVTWYHKDBN")
+
+// consensusBase returns the consensus base of a pileup column, bases with a
+// frequency >= ambiguity are merged into an IUPAC code. If none, or
+// ambiguity is 0, the most frequent bases are used.
+func consensusBase(col *PileupColumn, ambiguity float64) byte {
+	var total, max int
+	var counts [4]int
+	for a := pileupA; a <= pileupT; a++ {
+		counts[a] = col.Count(a)
+		total += counts[a]
+		if counts[a] > max {
+			max = counts[a]
+		}
+	}
+	if total == 0 {
+		return 'N'
+	}
+
+	var mask int
+	if ambiguity > 0 {
+		for a, n := range counts {
+			if float64(n)/float64(total) >= ambiguity {
+				mask |= 1 << a
+			}
+		}
+	}
+	if mask == 0 {
+		for a, n := range counts {
+			if n == max {
+				mask |= 1 << a
+			}
+		}
+	}
+	return iupacCodes[mask]
+}
+
+func init() {
+	RootCmd.AddCommand(consensusCmd)
+
+	consensusCmd.Flags().StringP("ref", "r", "", "reference sequences in FASTA format")
+	consensusCmd.Flags().IntP("min-depth", "d", 10, "minimum depth, positions with lower depths are masked")
+	consensusCmd.Flags().IntP("min-base-qual", "Q", 20, "minimum base quality")
+	consensusCmd.Flags().IntP("min-map-qual", "q", 0, "minimum mapping quality")
+	consensusCmd.Flags().Float64P("ambiguity", "a", 0, "minimum frequency of bases to be merged into an IUPAC ambiguity code, 0 for majority rule")
+	consensusCmd.Flags().BoolP("fill-ref", "", false, "fill low-coverage positions with reference bases instead of N")
+}
@@ -0,0 +1,52 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import "testing"
+
+func TestConsensusBase(t *testing.T) {
+	tests := []struct {
+		counts    [pileupNumAlleles]int // A, C, G, T, N, deletion
+		ambiguity float64
+		base      byte
+	}{
+		{[pileupNumAlleles]int{0, 0, 0, 0, 0, 0}, 0, 'N'},
+		{[pileupNumAlleles]int{0, 0, 0, 0, 5, 3}, 0.2, 'N'},
+		{[pileupNumAlleles]int{10, 0, 0, 0, 0, 0}, 0, 'A'},
+		{[pileupNumAlleles]int{0, 0, 0, 1, 5, 10}, 0, 'T'},
+		{[pileupNumAlleles]int{5, 5, 0, 0, 0, 0}, 0, 'M'},
+		{[pileupNumAlleles]int{8, 0, 2, 0, 0, 0}, 0, 'A'},
+		{[pileupNumAlleles]int{8, 0, 2, 0, 0, 0}, 0.2, 'R'},
+		{[pileupNumAlleles]int{8, 0, 2, 0, 0, 0}, 0.3, 'A'},
+		{[pileupNumAlleles]int{4, 3, 3, 0, 0, 0}, 0.5, 'A'}, // no bases >= 0.5
+		{[pileupNumAlleles]int{1, 1, 1, 1, 0, 0}, 0.25, 'N'},
+		{[pileupNumAlleles]int{0, 3, 3, 4, 0, 0}, 0.3, 'B'},
+	}
+	for _, test := range tests {
+		col := &PileupColumn{}
+		for a, n := range test.counts {
+			col.Counts[a][a%2] = n
+		}
+		if b := consensusBase(col, test.ambiguity); b != test.base {
+			t.Errorf("%v, %.2f: expected %c, returned %c", test.counts, test.ambiguity, test.base, b)
+		}
+	}
+}
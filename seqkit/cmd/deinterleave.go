@@ -0,0 +1,202 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/util/pathutil"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// deinterleaveCmd represents the deinterleave command
+var deinterleaveCmd = &cobra.Command{
+	Use:   "deinterleave",
+	Short: "split an interleaved file into read1 and read2 files",
+	Long: `split an interleaved file into read1 and read2 files
+
+Attentions:
+1. In an interleaved file, read2 should follow read1 of the same fragment.
+   Mate names are compared after removing the suffixes "/1" and "/2",
+   and mate numbers in the suffixes or Illumina comments like "1:N:0:ATCACG"
+   are also checked. You can check the file with "seqkit validate".
+2. Reads not adjacent to their mates are orphans, which are optional
+   outputted with the flag -u/--save-unpaired.
+
+The names of output files:
+  1. For stdin: stdin_1.fast[aq], stdin_2.fast[aq], stdin.unpaired.fast[aq]
+  2. Others: same to the input file, with the suffixes "_1", "_2" and
+     ".unpaired", e.g., reads_1.fq.gz and reads_2.fq.gz for reads.fq.gz
+  3. Additional extension via the option -e/--extension, like split2.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		alphabet := config.Alphabet
+		idRegexp := config.IDRegexp
+		lineWidth := config.LineWidth
+		quiet := config.Quiet
+		seq.AlphabetGuessSeqLengthThreshold = config.AlphabetGuessSeqLength
+		seq.ValidateSeq = false
+		runtime.GOMAXPROCS(config.Threads)
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+		file := files[0]
+
+		outdir := getFlagString(cmd, "out-dir")
+		force := getFlagBool(cmd, "force")
+		extension := getFlagString(cmd, "extension")
+		saveUnpaired := getFlagBool(cmd, "save-unpaired")
+
+		isstdin := isStdin(file)
+		var fileName, fileExt, fileExt2 string
+		if isstdin {
+			fileName = "stdin"
+			if outdir == "" {
+				outdir = "."
+			}
+		} else {
+			fileName, fileExt, fileExt2 = filepathTrimExtension2(file, nil)
+			if extension != "" {
+				fileExt += extension
+			} else {
+				fileExt += fileExt2
+			}
+			if outdir == "" {
+				outdir = filepath.Dir(file)
+			}
+		}
+		fileName = filepath.Base(fileName)
+
+		pwd, _ := os.Getwd()
+		if outdir != "./" && outdir != "." && pwd != filepath.Clean(outdir) &&
+			(isstdin || filepath.Clean(outdir) != filepath.Clean(filepath.Dir(file))) {
+			existed, err := pathutil.DirExists(outdir)
+			checkError(err)
+			if existed {
+				empty, err := pathutil.IsEmpty(outdir)
+				checkError(err)
+				if !empty {
+					if force {
+						checkError(os.RemoveAll(outdir))
+						checkError(os.MkdirAll(outdir, 0755))
+					} else {
+						log.Warningf("outdir not empty: %s, you can use --force to overwrite", outdir)
+					}
+				}
+			} else {
+				checkError(os.MkdirAll(outdir, 0755))
+			}
+		}
+
+		reader, err := newInterleavedReader(alphabet, file, idRegexp)
+		checkError(err)
+
+		// output files are created after reading the first pair,
+		// when the format of stdin is known.
+		var outFile1, outFile2 string
+		var outfh1, outfh2 *xopen.Writer
+		wopen := func(suffix string) (string, *xopen.Writer) {
+			outFile := filepath.Join(outdir, fileName+suffix+fileExt)
+			outfh, err := xopen.Wopen(outFile)
+			checkError(errors.Wrap(err, outFile))
+			return outFile, outfh
+		}
+		setFileExt := func() {
+			if isstdin {
+				if reader.IsFastq() {
+					fileExt = suffixFQ + extension
+				} else {
+					fileExt = suffixFA + extension
+				}
+			}
+			if reader.IsFastq() {
+				lineWidth = 0
+			}
+		}
+
+		var n uint64
+		checkError(reader.Walk(func(r1, r2 *fastx.Record) bool {
+			if outfh1 == nil {
+				setFileExt()
+				outFile1, outfh1 = wopen("_1")
+				outFile2, outfh2 = wopen("_2")
+			}
+			r1.FormatToWriter(outfh1, lineWidth)
+			r2.FormatToWriter(outfh2, lineWidth)
+			n++
+			return false
+		}))
+
+		if outfh1 != nil {
+			checkError(outfh1.Close())
+			checkError(outfh2.Close())
+			if !quiet {
+				log.Infof("%d paired-end reads saved to %s and %s", n, outFile1, outFile2)
+			}
+		} else if !quiet {
+			log.Warningf("no paired-end reads found in %s", file)
+		}
+
+		if !saveUnpaired {
+			reader.warnUnpaired()
+			return
+		}
+
+		orphans1, orphans2 := reader.Unpaired()
+		if len(orphans1)+len(orphans2) == 0 {
+			if !quiet {
+				log.Infof("no orphan reads in %s", file)
+			}
+			return
+		}
+		setFileExt()
+		outFileU, outfhU := wopen(".unpaired")
+		for _, orphans := range [][]*fastx.Record{orphans1, orphans2} {
+			for _, record := range orphans {
+				record.FormatToWriter(outfhU, lineWidth)
+			}
+		}
+		checkError(outfhU.Close())
+		if !quiet {
+			log.Infof("%d orphan reads saved to %s", len(orphans1)+len(orphans2), outFileU)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(deinterleaveCmd)
+
+	deinterleaveCmd.Flags().StringP("out-dir", "O", "", "output directory (default value is the directory of the input file)")
+	deinterleaveCmd.Flags().BoolP("force", "f", false, "overwrite output directory")
+	deinterleaveCmd.Flags().StringP("extension", "e", "", `set output file extension, e.g., ".gz", ".xz", or ".zst"`)
+	deinterleaveCmd.Flags().BoolP("save-unpaired", "u", false, "save orphan reads if there are")
+}
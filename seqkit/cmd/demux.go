@@ -0,0 +1,428 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/util/pathutil"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
+)
+
+// demuxCmd represents the demux command
+var demuxCmd = &cobra.Command{
+	Use:   "demux",
+	Short: "demultiplex reads into samples by inline or index barcodes",
+	Long: `demultiplex reads into samples by inline or index barcodes
+
+The barcode file is a tab-delimited file with two columns: sample name and
+barcode, lines starting with "#" are ignored. Dual indexes are given as
+"ACGTACGT+TTGCAGTA".
+
+Locations of barcodes (-l/--location):
+
+  start    the start of reads, trimmed with -T/--trim-barcode.
+           In paired-end mode, the two segments of dual barcodes are
+           searched in read1 and read2 respectively, single barcodes
+           are searched in read1.
+  comment  the index field of Illumina comments, e.g.,
+           "1:N:0:ACGTACGT+TTGCAGTA" in "@r1 1:N:0:ACGTACGT+TTGCAGTA".
+           Single barcodes are compared with the first index.
+  index    index read files (-I/--index-file), one for each segment of
+           barcodes, with reads in the same order of the input.
+
+Barcodes are compared with the leading bases of the target, with at most
+-m/--max-mismatch mismatches. Reads matching no barcode, or more than one
+barcode with the fewest mismatches (ambiguous), are saved as "unmatched".
+
+Output files are saved in -O/--out-dir, named as $infile.$sample$ext, e.g.,
+reads.S1.fq.gz for reads.fq.gz, where the extension could be changed with
+-e/--extension. Numbers of reads of samples are written to stdout.
+
+Paired-end mode:
+  With -1/--read1 and -2/--read2, reads are paired with the same strategy of
+  "seqkit pair", and saved to two synchronized files of each sample.
+  Unpaired reads are ignored.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		alphabet := config.Alphabet
+		idRegexp := config.IDRegexp
+		lineWidth := config.LineWidth
+		quiet := config.Quiet
+		seq.AlphabetGuessSeqLengthThreshold = config.AlphabetGuessSeqLength
+		seq.ValidateSeq = false
+		runtime.GOMAXPROCS(config.Threads)
+
+		barcodeFile := getFlagString(cmd, "barcode-file")
+		if barcodeFile == "" {
+			checkError(fmt.Errorf("flag -b/--barcode-file needed"))
+		}
+		location := strings.ToLower(getFlagString(cmd, "location"))
+		indexFiles := getFlagStringSlice(cmd, "index-file")
+		maxMismatch := getFlagNonNegativeInt(cmd, "max-mismatch")
+		trimBarcode := getFlagBool(cmd, "trim-barcode")
+		outdir := getFlagString(cmd, "out-dir")
+		force := getFlagBool(cmd, "force")
+		extension := getFlagString(cmd, "extension")
+		read1 := getFlagString(cmd, "read1")
+		read2 := getFlagString(cmd, "read2")
+
+		samples, barcodes, err := readBarcodeFile(barcodeFile)
+		checkError(err)
+		matcher, err := lib.NewBarcodeMatcher(barcodes, maxMismatch)
+		checkError(errors.Wrap(err, barcodeFile))
+		segments := matcher.Segments()
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		pairedEnd := read1 != "" || read2 != ""
+		if pairedEnd {
+			if read1 == "" || read2 == "" {
+				checkError(fmt.Errorf("flag -1/--read1 and -2/--read2 should be both given for paired-end mode"))
+			}
+			if read1 == read2 {
+				checkError(fmt.Errorf("values of flag -1/--read1 and -2/--read2 can not be the same"))
+			}
+			if isStdin(read1) || isStdin(read2) {
+				checkError(fmt.Errorf("stdin is not supported in paired-end mode"))
+			}
+			if !quiet && !(len(files) == 1 && isStdin(files[0])) {
+				log.Infof("flag -1/--read1 and -2/--read2 given, ignore: %s", strings.Join(files, ", "))
+			}
+			files = []string{read1, read2}
+		} else if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+
+		switch location {
+		case "start":
+			if segments > 2 || segments == 2 && !pairedEnd {
+				checkError(fmt.Errorf("barcodes in read start should have one segment, or two in paired-end mode"))
+			}
+		case "comment":
+		case "index":
+			if len(indexFiles) != segments {
+				checkError(fmt.Errorf("%d index files (-I/--index-file) needed for barcodes with %d segments", segments, segments))
+			}
+		default:
+			checkError(fmt.Errorf("invalid value of flag -l/--location: %s, available values: start, comment, index", location))
+		}
+		if location != "index" && len(indexFiles) > 0 {
+			checkError(fmt.Errorf("flag -I/--index-file is only used with -l/--location index"))
+		}
+		if trimBarcode && location != "start" {
+			checkError(fmt.Errorf("flag -T/--trim-barcode is only used with -l/--location start"))
+		}
+
+		// output files
+
+		bases := make([]string, len(files))
+		exts := make([]string, len(files))
+		for i, file := range files {
+			if isStdin(file) {
+				bases[i], exts[i] = "stdin", "" // decided by the format
+				continue
+			}
+			var ext2 string
+			bases[i], exts[i], ext2 = filepathTrimExtension2(file, nil)
+			bases[i] = filepath.Base(bases[i])
+			if extension != "" {
+				exts[i] += extension
+			} else {
+				exts[i] += ext2
+			}
+		}
+		if pairedEnd && bases[0] == bases[1] && exts[0] == exts[1] {
+			checkError(fmt.Errorf("read1 and read2 files have the same output file names, please rename them"))
+		}
+		if outdir == "" {
+			outdir = files[0] + ".demux"
+			if isStdin(files[0]) {
+				outdir = "stdin.demux"
+			}
+		}
+
+		pwd, _ := os.Getwd()
+		if outdir != "./" && outdir != "." && pwd != filepath.Clean(outdir) {
+			existed, err := pathutil.DirExists(outdir)
+			checkError(err)
+			if existed {
+				empty, err := pathutil.IsEmpty(outdir)
+				checkError(err)
+				if !empty {
+					if force {
+						checkError(os.RemoveAll(outdir))
+						checkError(os.MkdirAll(outdir, 0755))
+					} else {
+						log.Warningf("outdir not empty: %s, you can use --force to overwrite", outdir)
+					}
+				}
+			} else {
+				checkError(os.MkdirAll(outdir, 0755))
+			}
+		}
+
+		names := make([]string, len(samples)+1) // the last one is for unmatched reads
+		seen := make(map[string]bool, len(samples)+1)
+		for i, sample := range append(samples, "unmatched") {
+			names[i] = pathutil.RemoveInvalidPathChars(sample, "__")
+			if seen[names[i]] {
+				checkError(fmt.Errorf("duplicated sample name (\"unmatched\" is reserved): %s", sample))
+			}
+			seen[names[i]] = true
+		}
+		unmatched := len(samples)
+
+		// output files are created when needed
+		outfhs := make([][]*xopen.Writer, len(names))
+		var outFiles []string
+		var nFiles int
+		getOutfhs := func(i int, isFastq bool) []*xopen.Writer {
+			if outfhs[i] != nil {
+				return outfhs[i]
+			}
+			outfhs[i] = make([]*xopen.Writer, len(files))
+			for j := range files {
+				ext := exts[j]
+				if isStdin(files[j]) {
+					if isFastq {
+						ext = suffixFQ + extension
+					} else {
+						ext = suffixFA + extension
+					}
+				}
+				outFile := filepath.Join(outdir, bases[j]+"."+names[i]+ext)
+				if sameFile(files[j], outFile) {
+					checkError(fmt.Errorf("output file would overwrite the input file: %s, please change -O/--out-dir", files[j]))
+				}
+				outfh, err := xopen.Wopen(outFile)
+				checkError(errors.Wrap(err, outFile))
+				outfhs[i][j] = outfh
+				outFiles = append(outFiles, outFile)
+			}
+			nFiles++
+			return outfhs[i]
+		}
+
+		counts := make([]uint64, len(names))
+		var nAmbiguous uint64
+
+		// assign reads to a sample, trimming barcodes if needed
+		var indexReaders []*fastx.Reader
+		for _, file := range indexFiles {
+			reader, err := fastx.NewReader(alphabet, file, idRegexp)
+			checkError(errors.Wrap(err, file))
+			indexReaders = append(indexReaders, reader)
+		}
+		query := make([][]byte, segments)
+		assign := func(reads ...*fastx.Record) int {
+			switch location {
+			case "start":
+				for i := range query {
+					query[i] = reads[i].Seq.Seq
+				}
+			case "comment":
+				for i := range query {
+					query[i] = nil
+				}
+				for i, s := range bytes.SplitN(illuminaIndex(reads[0].Desc), []byte{'+'}, len(query)+1) {
+					if i < len(query) {
+						query[i] = s
+					}
+				}
+			case "index":
+				for i, reader := range indexReaders {
+					record, err := reader.Read()
+					if err == io.EOF {
+						checkError(fmt.Errorf("index file %s has fewer reads than the input", indexFiles[i]))
+					}
+					checkError(errors.Wrap(err, indexFiles[i]))
+					if !bytes.Equal(trimMateSuffix(record.ID), trimMateSuffix(reads[0].ID)) {
+						checkError(fmt.Errorf("reads in index file %s are not in the same order of the input: %s, %s", indexFiles[i], record.ID, reads[0].ID))
+					}
+					query[i] = record.Seq.Seq
+				}
+			}
+
+			idx, _ := matcher.Match(query...)
+			if idx < 0 {
+				if idx == lib.BarcodeAmbiguous {
+					nAmbiguous++
+				}
+				return unmatched
+			}
+			if trimBarcode {
+				for i, seg := range strings.Split(barcodes[idx], "+") {
+					trimRecordHead(reads[i], len(seg))
+				}
+			}
+			return idx
+		}
+
+		write := func(idx int, reads ...*fastx.Record) {
+			counts[idx]++
+			width := lineWidth
+			isFastq := len(reads[0].Seq.Qual) > 0
+			if isFastq {
+				width = 0
+			}
+			for j, outfh := range getOutfhs(idx, isFastq) {
+				reads[j].FormatToWriter(outfh, width)
+			}
+		}
+
+		if pairedEnd {
+			reader, err := newPairedReader(alphabet, read1, read2, idRegexp)
+			checkError(err)
+			checkError(reader.Walk(func(r1, r2 *fastx.Record) bool {
+				write(assign(r1, r2), r1, r2)
+				return false
+			}))
+			reader.warnUnpaired()
+		} else {
+			fastxReader, err := fastx.NewReader(alphabet, files[0], idRegexp)
+			checkError(errors.Wrap(err, files[0]))
+			var record *fastx.Record
+			for {
+				record, err = fastxReader.Read()
+				if err != nil {
+					if err == io.EOF {
+						break
+					}
+					checkError(errors.Wrap(err, files[0]))
+					break
+				}
+				write(assign(record), record)
+			}
+		}
+		for i, reader := range indexReaders {
+			if _, err := reader.Read(); err != io.EOF {
+				log.Warningf("index file %s has more reads than the input", indexFiles[i])
+			}
+		}
+
+		for _, fhs := range outfhs {
+			for _, outfh := range fhs {
+				checkError(outfh.Close())
+			}
+		}
+		if !quiet {
+			log.Infof("%d files of %d samples saved to %s", len(outFiles), nFiles, outdir)
+			if nAmbiguous > 0 {
+				log.Infof("%d reads matched more than one barcode, saved as unmatched", nAmbiguous)
+			}
+		}
+
+		outfh, err := xopen.Wopen(config.OutFile)
+		checkError(err)
+		defer outfh.Close()
+		outfh.WriteString("sample\tbarcode\treads\n")
+		for i, sample := range samples {
+			fmt.Fprintf(outfh, "%s\t%s\t%d\n", sample, barcodes[i], counts[i])
+		}
+		fmt.Fprintf(outfh, "unmatched\t-\t%d\n", counts[unmatched])
+	},
+}
+
+// readBarcodeFile reads sample names and barcodes from a tab-delimited file,
+// keeping their orders.
+func readBarcodeFile(file string) ([]string, []string, error) {
+	fh, err := xopen.Ropen(file)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, file)
+	}
+	defer fh.Close()
+
+	var samples, barcodes []string
+	scanner := bufio.NewScanner(fh)
+	var line string
+	var n int
+	for scanner.Scan() {
+		n++
+		line = strings.TrimRight(scanner.Text(), "\r\n")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		items := strings.Split(line, "\t")
+		if len(items) < 2 || items[0] == "" || items[1] == "" {
+			return nil, nil, fmt.Errorf("%s: sample name and barcode expected in line %d: %s", file, n, line)
+		}
+		samples = append(samples, items[0])
+		barcodes = append(barcodes, items[1])
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, file)
+	}
+	if len(samples) == 0 {
+		return nil, nil, fmt.Errorf("no barcodes found in file: %s", file)
+	}
+	return samples, barcodes, nil
+}
+
+// illuminaIndex returns the index field of the Illumina comment like
+// "1:N:0:ACGTACGT+TTGCAGTA", or nil if not found.
+func illuminaIndex(desc []byte) []byte {
+	for _, item := range bytes.Fields(desc) {
+		if bytes.Count(item, []byte{':'}) == 3 {
+			return item[bytes.LastIndexByte(item, ':')+1:]
+		}
+	}
+	return nil
+}
+
+// trimRecordHead removes the first n bases of a record.
+func trimRecordHead(record *fastx.Record, n int) {
+	if n > len(record.Seq.Seq) {
+		n = len(record.Seq.Seq)
+	}
+	record.Seq.Seq = record.Seq.Seq[n:]
+	if len(record.Seq.Qual) > 0 {
+		record.Seq.Qual = record.Seq.Qual[n:]
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(demuxCmd)
+
+	demuxCmd.Flags().StringP("barcode-file", "b", "", "tab-delimited file of sample names and barcodes")
+	demuxCmd.Flags().StringP("location", "l", "start", `location of barcodes, available values: start, comment, index`)
+	demuxCmd.Flags().StringSliceP("index-file", "I", []string{}, "index read files for -l/--location index, one for each segment of barcodes")
+	demuxCmd.Flags().IntP("max-mismatch", "m", 1, "max mismatch when matching barcodes")
+	demuxCmd.Flags().BoolP("trim-barcode", "T", false, "remove barcodes from the start of reads")
+	demuxCmd.Flags().StringP("read1", "1", "", "(gzipped) read1 file, for paired-end mode")
+	demuxCmd.Flags().StringP("read2", "2", "", "(gzipped) read2 file, for paired-end mode")
+	demuxCmd.Flags().StringP("out-dir", "O", "", "output directory (default value is $infile.demux)")
+	demuxCmd.Flags().BoolP("force", "f", false, "overwrite output directory")
+	demuxCmd.Flags().StringP("extension", "e", "", `set output file extension, e.g., ".gz", ".xz", or ".zst"`)
+}
@@ -0,0 +1,338 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
+)
+
+// filterCmd represents the filter command
+var filterCmd = &cobra.Command{
+	Use:   "filter",
+	Short: "filter sequences by an expression of sequence features",
+	Long: fmt.Sprintf(`filter sequences by an expression of sequence features
+
+Examples:
+
+    seqkit filter -e 'len > 1000 && gc < 0.6 && avgqual >= 12 && id =~ "^chr"'
+    seqkit filter -e 'nfrac < 0.1 || tag.type == "primary"'
+
+Operators, from the lowest precedence to the highest:
+
+    ||  &&  == != < <= > >= =~ !~  + -  * / %%  unary ! -
+
+  "=~" and "!~" match a string against a regular expression. Strings are
+  quoted by " or ', where a backslash only escapes the quote itself, so
+  regular expressions like "\d+" need no double escaping.
+
+Variables:
+
+%s
+Attentions:
+
+  1. Tags are parsed from "key=value" pairs in the description (the part
+     after the ID), separated by whitespace. Numeric values are numbers,
+     others are strings.
+  2. If a tag used in the expression is absent in a record, the expression
+     is regarded as false, i.e., the record is not kept, or kept with
+     the flag -v/--invert-match.
+
+`, fxExprVarsHelp("    ")),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		alphabet := config.Alphabet
+		idRegexp := config.IDRegexp
+		outFile := config.OutFile
+		lineWidth := config.LineWidth
+		seq.AlphabetGuessSeqLengthThreshold = config.AlphabetGuessSeqLength
+		seq.ValidateSeq = false
+		runtime.GOMAXPROCS(config.Threads)
+
+		exprStr := getFlagString(cmd, "expr")
+		if exprStr == "" {
+			checkError(fmt.Errorf("flag -e/--expr needed"))
+		}
+		invert := getFlagBool(cmd, "invert-match")
+		qBase := getFlagPositiveInt(cmd, "qual-ascii-base")
+		justCount := getFlagBool(cmd, "count")
+
+		expr, err := lib.CompileExpr(exprStr)
+		checkError(err)
+		checkError(checkFxExprVars(expr))
+		env := newFxExprEnv(qBase)
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+
+		outfh, err := xopen.Wopen(outFile)
+		checkError(err)
+		defer outfh.Close()
+
+		var record *fastx.Record
+		var fastxReader *fastx.Reader
+		var pass bool
+		var count int
+		for _, file := range files {
+			fastxReader, err = fastx.NewReader(alphabet, file, idRegexp)
+			checkError(err)
+
+			for {
+				record, err = fastxReader.Read()
+				if err != nil {
+					if err == io.EOF {
+						break
+					}
+					checkError(err)
+					break
+				}
+				if fastxReader.IsFastq {
+					config.LineWidth = 0
+					fastx.ForcelyOutputFastq = true
+				}
+
+				env.Reset(record)
+				pass, err = expr.EvalBool(env.Lookup)
+				if err != nil {
+					if env.missingTag == "" {
+						checkError(fmt.Errorf("%s: %s", record.ID, err))
+					}
+					pass = false
+				}
+				if pass == invert {
+					continue
+				}
+
+				count++
+				if !justCount {
+					record.FormatToWriter(outfh, config.LineWidth)
+				}
+			}
+
+			config.LineWidth = lineWidth
+		}
+
+		if justCount {
+			fmt.Fprintf(outfh, "%d\n", count)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(filterCmd)
+	filterCmd.Flags().StringP("expr", "e", "", "filtering expression, e.g., 'len > 1000 && gc < 0.6'")
+	filterCmd.Flags().BoolP("invert-match", "v", false, "invert the sense of matching, to select non-matching records")
+	filterCmd.Flags().IntP("qual-ascii-base", "b", 33, "ASCII BASE, 33 for Phred+33")
+	filterCmd.Flags().BoolP("count", "C", false, "just print a count of matching records. with the -v/--invert-match flag, count non-matching records")
+}
+
+// fxExprVars are variables of FASTA/Q records in expressions of filter
+// and watch, "tag." is a prefix of tag variables.
+var fxExprVars = [][2]string{
+	{"len", "sequence length"},
+	{"gc", "GC content, (G+C)/len"},
+	{"gcskew", "GC skew, (G-C)/(G+C)"},
+	{"avgqual", "average quality, 0 for FASTA"},
+	{"a", "number of A, case-insensitive, so are c, g, t and n"},
+	{"c", ""},
+	{"g", ""},
+	{"t", ""},
+	{"n", ""},
+	{"nfrac", "fraction of N"},
+	{"id", "sequence ID"},
+	{"name", "full name, i.e., the whole header line"},
+	{"desc", "description, i.e., the part after the ID"},
+	{"tag.", "value of a key=value tag in the description, e.g., tag.barcode"},
+}
+
+func fxExprVarsHelp(indent string) string {
+	var b strings.Builder
+	for _, v := range fxExprVars {
+		if v[1] == "" {
+			continue
+		}
+		name := v[0]
+		if name == "tag." {
+			name = "tag.KEY"
+		}
+		fmt.Fprintf(&b, "%s%-10s%s\n", indent, name, v[1])
+	}
+	return b.String()
+}
+
+// checkFxExprVars checks if all variables in an expression are supported.
+func checkFxExprVars(expr *lib.Expr) error {
+	valid := make(map[string]bool, len(fxExprVars))
+	for _, v := range fxExprVars {
+		valid[v[0]] = true
+	}
+	for _, name := range expr.Vars() {
+		if strings.HasPrefix(name, "tag.") {
+			if len(name) > 4 {
+				continue
+			}
+		} else if valid[name] {
+			continue
+		}
+		return fmt.Errorf("unknown variable in expression: %s", name)
+	}
+	return nil
+}
+
+// fxExprEnv provides values of variables of a FASTA/Q record for
+// evaluating expressions. Base counts and tags are computed when needed,
+// and shared by variables of the same record.
+type fxExprEnv struct {
+	qBase  int
+	record *fastx.Record
+
+	counted bool
+	counts  [5]int // A, C, G, T, N
+
+	tags map[string]string
+
+	// the tag that is absent in the record, if any
+	missingTag string
+}
+
+func newFxExprEnv(qBase int) *fxExprEnv {
+	return &fxExprEnv{qBase: qBase}
+}
+
+// Reset sets the record to evaluate.
+func (env *fxExprEnv) Reset(record *fastx.Record) {
+	env.record = record
+	env.counted = false
+	env.tags = nil
+	env.missingTag = ""
+}
+
+func (env *fxExprEnv) count() {
+	if env.counted {
+		return
+	}
+	env.counts = [5]int{}
+	for _, b := range env.record.Seq.Seq {
+		switch b {
+		case 'A', 'a':
+			env.counts[0]++
+		case 'C', 'c':
+			env.counts[1]++
+		case 'G', 'g':
+			env.counts[2]++
+		case 'T', 't':
+			env.counts[3]++
+		case 'N', 'n':
+			env.counts[4]++
+		}
+	}
+	env.counted = true
+}
+
+func (env *fxExprEnv) parseTags() {
+	if env.tags != nil {
+		return
+	}
+	env.tags = make(map[string]string)
+	var i int
+	for _, item := range strings.Fields(string(env.record.Desc)) {
+		i = strings.IndexByte(item, '=')
+		if i <= 0 {
+			continue
+		}
+		env.tags[item[:i]] = item[i+1:]
+	}
+}
+
+// Lookup returns the value of a variable, it's a lib.ExprLookup.
+func (env *fxExprEnv) Lookup(name string) (interface{}, bool) {
+	r := env.record
+	switch name {
+	case "len":
+		return len(r.Seq.Seq), true
+	case "gc":
+		if len(r.Seq.Seq) == 0 {
+			return 0, true
+		}
+		env.count()
+		return float64(env.counts[1]+env.counts[2]) / float64(len(r.Seq.Seq)), true
+	case "gcskew":
+		env.count()
+		if env.counts[1]+env.counts[2] == 0 {
+			return 0, true
+		}
+		return float64(env.counts[2]-env.counts[1]) / float64(env.counts[1]+env.counts[2]), true
+	case "avgqual":
+		if len(r.Seq.Qual) == 0 {
+			return 0, true
+		}
+		return r.Seq.AvgQual(env.qBase), true
+	case "a":
+		env.count()
+		return env.counts[0], true
+	case "c":
+		env.count()
+		return env.counts[1], true
+	case "g":
+		env.count()
+		return env.counts[2], true
+	case "t":
+		env.count()
+		return env.counts[3], true
+	case "n":
+		env.count()
+		return env.counts[4], true
+	case "nfrac":
+		if len(r.Seq.Seq) == 0 {
+			return 0, true
+		}
+		env.count()
+		return float64(env.counts[4]) / float64(len(r.Seq.Seq)), true
+	case "id":
+		return r.ID, true
+	case "name":
+		return r.Name, true
+	case "desc":
+		return r.Desc, true
+	}
+
+	if !strings.HasPrefix(name, "tag.") {
+		return nil, false
+	}
+	env.parseTags()
+	v, ok := env.tags[name[4:]]
+	if !ok {
+		env.missingTag = name
+		return nil, false
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f, true
+	}
+	return v, true
+}
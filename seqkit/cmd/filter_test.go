@@ -0,0 +1,130 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
+)
+
+func TestFxExprEnv(t *testing.T) {
+	fq, _ := fastx.NewRecordWithQualWithoutValidation(seq.DNAredundant, []byte("r1"), []byte("r1 barcode=ACGT umi=12"),
+		[]byte("barcode=ACGT umi=12"), []byte("ACGTNNGG"), []byte("IIIIIIII"))
+	fa, _ := fastx.NewRecordWithoutValidation(seq.DNAredundant, []byte("r2"), []byte("r2"), []byte{}, []byte{})
+
+	tests := []struct {
+		record *fastx.Record
+		expr   string
+		pass   bool
+	}{
+		{fq, `len == 8`, true},
+		{fq, `gc == 0.5 && gcskew == 0.5`, true},
+		{fq, `a == 1 && c == 1 && g == 3 && t == 1 && n == 2 && nfrac == 0.25`, true},
+		{fq, `a + c + g + t + n == len`, true},
+		{fq, `avgqual == 40`, true},
+		{fq, `id == "r1" && name =~ "umi=" && desc !~ "^r1"`, true},
+		{fq, `tag.barcode == "ACGT" && tag.umi > 10`, true},
+		{fq, `tag.umi < 10`, false},
+		{fa, `len == 0 && gc == 0 && gcskew == 0 && nfrac == 0 && avgqual == 0`, true},
+	}
+	env := newFxExprEnv(33)
+	for _, test := range tests {
+		expr, err := lib.CompileExpr(test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = checkFxExprVars(expr); err != nil {
+			t.Errorf("%s: unexpected error: %s", test.expr, err)
+			continue
+		}
+		env.Reset(test.record)
+		pass, err := expr.EvalBool(env.Lookup)
+		if err != nil {
+			t.Errorf("%s: %s: unexpected error: %s", test.record.ID, test.expr, err)
+			continue
+		}
+		if pass != test.pass {
+			t.Errorf("%s: %s: expected %v, returned %v", test.record.ID, test.expr, test.pass, pass)
+		}
+	}
+
+	// missing tags
+	expr, _ := lib.CompileExpr(`len > 0 && tag.type == "primary"`)
+	env.Reset(fq)
+	if _, err := expr.EvalBool(env.Lookup); err == nil || env.missingTag != "tag.type" {
+		t.Errorf("missing tag: error expected, returned %v, %q", err, env.missingTag)
+	}
+	// and it is reset for the next record
+	env.Reset(fa)
+	if env.missingTag != "" {
+		t.Errorf("missing tag should be reset")
+	}
+
+	for _, s := range []string{`lenx > 1`, `tag. == 1`, `GC > 0.5`} {
+		expr, err := lib.CompileExpr(s)
+		if err != nil {
+			continue
+		}
+		if checkFxExprVars(expr) == nil {
+			t.Errorf("%s: unknown variable error expected", s)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	dir := t.TempDir()
+	file := writeTestFile(t, dir, "r.fq", "@r1 type=primary\nACGTACGT\n+\nIIIIIIII\n"+
+		"@r2 type=secondary\nACGTACGT\n+\nIIIIIIII\n"+
+		"@r3 type=primary\nACG\n+\nIII\n"+
+		"@r4\nACGTACGT\n+\n!!!!!!!!\n")
+	outFile := filepath.Join(dir, "out.txt")
+
+	tests := []struct {
+		args []string
+		out  string
+	}{
+		{[]string{"-e", `len >= 5 && tag.type == "primary"`}, "@r1 type=primary\nACGTACGT\n+\nIIIIIIII\n"},
+		{[]string{"-e", `len >= 5 && tag.type == "primary"`, "-C"}, "1\n"},
+		// records without the tag are kept with -v
+		{[]string{"-e", `len >= 5 && tag.type == "primary"`, "-v", "-C"}, "3\n"},
+		{[]string{"-e", `avgqual < 10`}, "@r4\nACGTACGT\n+\n!!!!!!!!\n"},
+	}
+	for _, test := range tests {
+		// flags are kept between executions
+		RootCmd.SetArgs(append([]string{"filter", file, "-o", outFile, "--quiet", "-v=false", "-C=false"}, test.args...))
+		if err := RootCmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(outFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.out {
+			t.Errorf("%s: expected:\n%s\nreturned:\n%s", strings.Join(test.args, " "), test.out, data)
+		}
+	}
+}
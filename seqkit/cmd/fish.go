@@ -30,85 +30,14 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/biogo/hts/bam"
 	"github.com/biogo/hts/sam"
 	"github.com/shenwei356/bio/seq"
 	"github.com/shenwei356/bio/seqio/fastx"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
 )
 
-// AlnParams holds the alignment parameters.
-type AlnParams struct {
-	Match     int
-	Mismatch  int
-	GapOpen   int
-	GapExtend int
-}
-
-// parseAlnParams parses alignment parameter string.
-func parseAlnParams(s string) *AlnParams {
-	p := new(AlnParams)
-	sp := strings.Split(s, ",")
-	if len(sp) != 4 {
-		panic("Invalid alignment parameters: " + s)
-	}
-	for i, tok := range sp {
-		sp[i] = strings.TrimSpace(tok)
-	}
-	var err error
-	p.Match, err = strconv.Atoi(sp[0])
-	checkError(err)
-	p.Mismatch, err = strconv.Atoi(sp[1])
-	checkError(err)
-	p.GapOpen, err = strconv.Atoi(sp[2])
-	checkError(err)
-	p.GapExtend, err = strconv.Atoi(sp[3])
-	checkError(err)
-	return p
-}
-
-// parseRanges parses ranges string into a slice of ranges.
-func parseRanges(rf string) Ranges {
-	res := Ranges{}
-	if len(rf) == 0 {
-		return Ranges{Range{math.NaN(), math.NaN()}}
-	}
-	rst := strings.Split(strings.TrimSpace(rf), ",")
-	for _, t := range rst {
-		t = strings.TrimSpace(t)
-		if len(t) == 0 {
-			continue
-		}
-		rt := strings.Split(t, ":")
-		if len(rt) != 2 {
-			panic("invalid range: " + t)
-		}
-		var err error
-		var ts, te string
-		var s, e float64
-		ts = strings.TrimSpace(rt[0])
-		te = strings.TrimSpace(rt[1])
-		if len(ts) == 0 {
-			s = math.NaN()
-		} else {
-			s, err = strconv.ParseFloat(ts, 64)
-			checkError(err)
-		}
-		if len(te) == 0 {
-			e = math.NaN()
-		} else {
-			e, err = strconv.ParseFloat(te, 64)
-			checkError(err)
-		}
-		if e > 0 && s > 0 && e < s {
-			panic("invalid range: " + t)
-		}
-		res = append(res, Range{s, e})
-	}
-	return res
-}
-
 // fishCmd represents the fish command
 var fishCmd = &cobra.Command{
 	Use:   "fish",
@@ -147,9 +76,15 @@ Attention:
 		flagAll := getFlagBool(cmd, "all")
 		flagDesc := getFlagBool(cmd, "print-desc")
 		flagInvert := getFlagBool(cmd, "invert")
+		outFormat := getFlagOutFormat(cmd)
+		if outFormat != outFormatTSV && flagAln {
+			checkError(fmt.Errorf("flag -g/--print-aln is not supported with --out-format %s", outFormat))
+		}
 
-		ranges := parseRanges(flagRange)
-		alnParams := parseAlnParams(flagAlnParams)
+		ranges, err := lib.ParseRanges(flagRange)
+		checkError(err)
+		alnParams, err := lib.ParseAlnParams(flagAlnParams)
+		checkError(err)
 
 		validateSeq := getFlagBool(cmd, "validate-seq")
 		validateSeqLength := getFlagValidateSeqLength(cmd, "validate-seq-length")
@@ -165,17 +100,19 @@ Attention:
 
 		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
 
-		var alns []*AlignedSeq
+		var alns []*lib.AlignedSeq
 		if len(files) == 0 {
 			files = []string{"-"}
 		}
 
-		detector := NewSeqDetector(flagAll, flagStranded, flagNullMode, flagCutoff, alnParams)
+		detector := lib.NewSeqDetector(flagAll, flagStranded, flagNullMode, flagCutoff, alnParams)
 		if queryFastx != "" {
-			detector.LoadQueries(queryFastx)
+			queryReader, err := fastx.NewReader(nil, queryFastx, "")
+			checkError(err)
+			checkError(detector.LoadQueries(queryReader))
 		}
 		if flagSeq != "" {
-			detector.AddAnonQueries(strings.Split(flagSeq, ","))
+			checkError(detector.AddAnonQueries(strings.Split(flagSeq, ",")))
 		}
 
 		outfh, err := xopen.Wopen(outFile)
@@ -194,12 +131,23 @@ Attention:
 		var refMap map[string]int
 		var samRefs []*sam.Reference
 		if flagBam != "" {
-			alns = make([]*AlignedSeq, 0, 1024)
+			alns = make([]*lib.AlignedSeq, 0, 1024)
 			samRefs = make([]*sam.Reference, 0, 1024)
 			refMap = make(map[string]int, 1024)
 		}
 		first := true
 
+		var jw *jsonTableWriter
+		if outFormat != outFormatTSV {
+			if flagInvert {
+				jw, err = newJSONTableWriter(os.Stderr, outFormat, "fish", []string{"ref"})
+				checkError(err)
+			} else {
+				jw, err = newJSONTableWriter(os.Stderr, outFormat, "fish", fishJSONColumns)
+				checkError(err)
+			}
+		}
+
 		for _, file := range files {
 			fastxReader, err = fastx.NewReader(alphabet, file, idRegexp)
 			checkError(err)
@@ -230,10 +178,16 @@ Attention:
 					refId = strings.Split(refId, " ")[0]
 				}
 
-				hits := detector.Detect(&Reference{refId, string(record.Seq.Seq), ranges}, flagAll)
+				hits, err := detector.Detect(&lib.Reference{Name: refId, Seq: string(record.Seq.Seq), Ranges: ranges}, flagAll)
+				checkError(err)
 
 				if !flagInvert {
 					for _, h := range hits {
+						if jw != nil {
+							checkError(jw.WriteRow(fishJSONValues(h)...))
+							h.Ref.Seq = ""
+							continue
+						}
 						if first {
 							fmt.Fprintf(os.Stderr, "%s\n", strings.Join(h.Fields(), "\t"))
 						}
@@ -251,6 +205,10 @@ Attention:
 						refMap[refId] = count
 						alns = append(alns, hits...)
 					}
+				} else if jw != nil {
+					if len(hits) == 0 {
+						checkError(jw.WriteRow(refId))
+					}
 				} else {
 					if first {
 						fmt.Fprintf(os.Stderr, "Ref\n")
@@ -298,6 +256,10 @@ Attention:
 
 		} //file
 
+		if jw != nil {
+			checkError(jw.Close())
+		}
+
 		if flagBam != "" {
 			saveBam(flagBam, samRefs, refMap, alns)
 		}
@@ -305,42 +267,34 @@ Attention:
 	},
 }
 
-// saveBam writes alignment records to a BAM file.
-func saveBam(bamFile string, refs []*sam.Reference, refMap map[string]int, alns []*AlignedSeq) {
-	var err error
-	var bamWriter *bam.Writer
-	//fh, err := xopen.Wopen(bamFile)
-	fh, err := os.Create(bamFile)
-	checkError(err)
+// fishJSONColumns are the JSON fields of hits, in the order of AlignedSeq.Fields().
+var fishJSONColumns = []string{"ref", "ref_start", "ref_end", "query", "query_start", "query_end",
+	"strand", "map_qual", "raw_score", "acc", "clip_acc", "query_cov"}
 
-	checkError(err)
-	var h *sam.Header
-	h, err = sam.NewHeader([]byte{}, refs)
-	checkError(err)
-	fish := sam.NewProgram("seqkit", "seqkit", "seqkit fish", "-", "1.0")
-	h.AddProgram(fish)
-	bamWriter, err = bam.NewWriter(fh, h, 50)
-	checkError(err)
-	for _, a := range alns {
-		mq := -10 * math.Log10(1.0-(a.Score/a.Query.NullScore))
-		if math.IsNaN(mq) || mq > 60 {
-			mq = 60
-		}
-		var record *sam.Record
-		pg, err := sam.NewAux(sam.NewTag("PG"), 0)
-		record, err = NewSAMRecordFromAln(a.Query.Name, refs[refMap[a.Ref.Name]], a.RefStart, a.RefEnd, a.QueryStart, a.QueryEnd, a.RefAln, a.QueryAln, a.Query.Strand, byte(uint8(mq)), a.Query.Seq, nil, []sam.Aux{pg})
-		checkError(err)
-		if !sam.IsValidRecord(record) {
-			panic("failed to build BAM record from raw alignment: \n" + a.String() + "\n" + record.String())
-		}
-		if !a.Best {
-			record.Flags |= sam.Secondary
+// fishJSONValues converts the tabular fields of a hit to typed values.
+func fishJSONValues(h *lib.AlignedSeq) []interface{} {
+	fields := strings.Split(h.String(), "\t")
+	values := make([]interface{}, len(fields))
+	var err error
+	for i, f := range fields {
+		switch i {
+		case 1, 2, 4, 5:
+			values[i], err = strconv.Atoi(f)
+		case 7, 8, 9, 10, 11:
+			values[i], err = strconv.ParseFloat(f, 64)
+		default:
+			values[i] = f
 		}
-
-		err = bamWriter.Write(record)
 		checkError(err)
 	}
-	checkError(bamWriter.Close())
+	return values
+}
+
+// saveBam writes alignment records to a BAM file.
+func saveBam(bamFile string, refs []*sam.Reference, refMap map[string]int, alns []*lib.AlignedSeq) {
+	fh, err := os.Create(bamFile)
+	checkError(err)
+	checkError(lib.WriteBam(fh, refs, refMap, alns))
 	checkError(fh.Close())
 }
 
@@ -362,84 +316,3 @@ func init() {
 	fishCmd.Flags().IntP("validate-seq-length", "V", 10000, "length of sequence to validate (0 for whole seq)")
 	fishCmd.Flags().Float64P("min-qual", "q", 5.0, "minimum mapping quality")
 }
-
-// NewRecordFromAln builds a new SAM record based on the provided local alignment and its reference/query coordinates.
-func NewSAMRecordFromAln(name string, ref *sam.Reference, refStart, refEnd, queryStart, queryEnd int, refAln, queryAln string, strand string, mapQ byte, seq string, qual []byte, aux []sam.Aux) (*sam.Record, error) {
-	if len(refAln) != len(queryAln) {
-		panic("alignment length mismatch")
-	}
-	if len(refAln) == 0 {
-		panic("empty alignment")
-	}
-	gap := byte('-')
-
-	rawCo := make([]sam.CigarOp, 0, len(seq))
-	co := make([]sam.CigarOp, 0, len(seq))
-	var consumed int
-	var nm int
-
-	// Building the CIGAR in two steps for clarity.
-	if queryStart > 0 {
-		rawCo = append(rawCo, sam.NewCigarOp(sam.CigarSoftClipped, queryStart))
-	}
-	for i := range refAln {
-		if queryAln[i] == gap {
-			rawCo = append(rawCo, sam.NewCigarOp(sam.CigarDeletion, 1))
-			nm++
-			continue
-
-		} else if refAln[i] == gap {
-			rawCo = append(rawCo, sam.NewCigarOp(sam.CigarInsertion, 1))
-			consumed++
-			nm++
-			continue
-		} else {
-			rawCo = append(rawCo, sam.NewCigarOp(sam.CigarMatch, 1))
-			consumed++
-			if queryAln[i] != refAln[i] {
-				nm++
-			}
-			continue
-
-		}
-	} // refAln
-
-	leftover := len(seq) - queryStart - consumed
-	if leftover > 0 {
-		rawCo = append(rawCo, sam.NewCigarOp(sam.CigarSoftClipped, leftover))
-	}
-
-	cop := rawCo[0].Type()
-	length := rawCo[0].Len()
-	var o sam.CigarOp
-	for i := 1; i < len(rawCo); i++ {
-		o = rawCo[i]
-		if o.Type() == cop {
-			length++
-			continue
-		}
-		co = append(co, sam.NewCigarOp(cop, length))
-		length = o.Len()
-		cop = o.Type()
-	}
-	co = append(co, sam.NewCigarOp(o.Type(), length))
-
-	switch strand {
-	case "-":
-	case "+":
-	default:
-		panic("Invalid strand: " + strand)
-
-	}
-
-	nmTag, _ := sam.NewAux(sam.NewTag("NM"), nm)
-	aux = append(aux, nmTag)
-	res, err := sam.NewRecord(name, ref, nil, refStart, -1, 0, mapQ, co, []byte(seq), qual, aux)
-	if err != nil {
-		panic(err)
-	}
-	if strand == "-" {
-		res.Flags |= sam.Reverse
-	}
-	return res, err
-}
@@ -0,0 +1,279 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/sam"
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/spf13/cobra"
+)
+
+// fx2bamCmd represents the fx2bam command
+var fx2bamCmd = &cobra.Command{
+	Use:   "fx2bam",
+	Short: "convert FASTA/Q to unaligned BAM",
+	Long: `convert FASTA/Q to unaligned BAM
+
+Single-end reads are given as positional arguments or from stdin, and
+paired-end reads via the flags -1/--read1 and -2/--read2, where mates are
+paired by names like "seqkit pair", and the suffixes "/1" and "/2" are
+removed from read names.
+
+Headers:
+  1. A read group can be added with -R/--rg, e.g., '@RG\tID:grp1\tSM:s1',
+     and its ID is added to every record as the tag RG, unless the record
+     has its own RG tag.
+  2. A @PG line of seqkit is added by default, which can be replaced with
+     --pg or removed with --no-pg.
+
+Tags:
+  Words in the FASTA/Q header comment in the SAM format (TAG:TYPE:VALUE),
+  e.g., "RG:Z:grp1", "BC:Z:ACGTAC", "MM:Z:C+m,0;", and "ML:B:C,200",
+  are converted into aux fields. Other words are dropped, or saved in the
+  tag CO with the flag -c/--keep-comment.
+
+Attentions:
+  1. Sequences are converted to upper case. Empty sequences are skipped.
+  2. FASTQ quality scores are treated as Phred+33.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		alphabet := config.Alphabet
+		idRegexp := config.IDRegexp
+		outFile := config.OutFile
+		quiet := config.Quiet
+		seq.AlphabetGuessSeqLengthThreshold = config.AlphabetGuessSeqLength
+		seq.ValidateSeq = false
+		runtime.GOMAXPROCS(config.Threads)
+
+		read1 := getFlagString(cmd, "read1")
+		read2 := getFlagString(cmd, "read2")
+		if (read1 == "") != (read2 == "") {
+			checkError(fmt.Errorf("flag -1/--read1 and -2/--read2 should be given together"))
+		}
+		paired := read1 != ""
+		if paired {
+			if len(args) > 0 {
+				checkError(fmt.Errorf("no positional arguments are allowed when using -1/--read1 and -2/--read2"))
+			}
+			if read1 == read2 {
+				checkError(fmt.Errorf("values of flag -1/--read1 and -2/--read2 can not be the same"))
+			}
+		}
+
+		keepComment := getFlagBool(cmd, "keep-comment")
+		header, rgID, err := fx2bamHeader(getFlagString(cmd, "rg"), getFlagString(cmd, "pg"), getFlagBool(cmd, "no-pg"))
+		checkError(err)
+
+		outw := os.Stdout
+		if outFile != "-" {
+			outw, err = os.Create(outFile)
+			checkError(err)
+		}
+		outfh := bufio.NewWriter(outw)
+
+		bamWriter, err := bam.NewWriter(outfh, header, config.Threads)
+		checkError(err)
+
+		var n, nEmpty int
+		write := func(record *fastx.Record, flags sam.Flags) {
+			if len(record.Seq.Seq) == 0 {
+				nEmpty++
+				return
+			}
+			r, err := fastx2SamRecord(record, flags, rgID, keepComment)
+			checkError(err)
+			checkError(bamWriter.Write(r))
+			n++
+		}
+
+		if paired {
+			reader, err := newPairedReader(alphabet, read1, read2, idRegexp)
+			checkError(err)
+			flags := sam.Paired | sam.Unmapped | sam.MateUnmapped
+			checkError(reader.Walk(func(r1, r2 *fastx.Record) bool {
+				r1.ID = trimMateSuffix(r1.ID)
+				r2.ID = trimMateSuffix(r2.ID)
+				write(r1, flags|sam.Read1)
+				write(r2, flags|sam.Read2)
+				return false
+			}))
+			reader.warnUnpaired()
+		} else {
+			files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+			for _, file := range files {
+				fastxReader, err := fastx.NewReader(alphabet, file, idRegexp)
+				checkError(err)
+				for {
+					record, err := fastxReader.Read()
+					if err != nil {
+						if err == io.EOF {
+							break
+						}
+						checkError(err)
+						break
+					}
+					write(record, sam.Unmapped)
+				}
+				fastxReader.Close()
+			}
+		}
+
+		checkError(bamWriter.Close())
+		checkError(outfh.Flush())
+		checkError(outw.Close())
+
+		if !quiet {
+			log.Infof("%d records saved to %s", n, outFile)
+			if nEmpty > 0 {
+				log.Warningf("%d empty sequences skipped", nEmpty)
+			}
+		}
+	},
+}
+
+// fx2bamHeader creates the header of unaligned BAM, with an optional @RG
+// line and a @PG line. It also returns the ID of the read group.
+func fx2bamHeader(rgLine, pgLine string, noPG bool) (*sam.Header, string, error) {
+	var buf bytes.Buffer
+	buf.WriteString("@HD\tVN:1.6\tSO:unknown\n")
+
+	var rgID string
+	if rgLine != "" {
+		rgLine = strings.ReplaceAll(rgLine, `\t`, "\t")
+		if !strings.HasPrefix(rgLine, "@RG\t") {
+			rgLine = "@RG\t" + rgLine
+		}
+		for _, field := range strings.Split(rgLine, "\t")[1:] {
+			if strings.HasPrefix(field, "ID:") {
+				rgID = field[3:]
+				break
+			}
+		}
+		if rgID == "" {
+			return nil, "", fmt.Errorf("no ID in the @RG line: %s", rgLine)
+		}
+		buf.WriteString(rgLine + "\n")
+	}
+
+	if !noPG {
+		if pgLine == "" {
+			pgLine = fmt.Sprintf("@PG\tID:seqkit\tPN:seqkit\tVN:%s\tCL:%s", VERSION, strings.Join(os.Args, " "))
+		} else {
+			pgLine = strings.ReplaceAll(pgLine, `\t`, "\t")
+			if !strings.HasPrefix(pgLine, "@PG\t") {
+				pgLine = "@PG\t" + pgLine
+			}
+		}
+		buf.WriteString(pgLine + "\n")
+	}
+
+	header, err := sam.NewHeader(buf.Bytes(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid BAM header: %s", err)
+	}
+	return header, rgID, nil
+}
+
+var reSamAuxText = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]:[AifZHB]:`)
+
+// fastx2SamRecord converts a FASTA/Q record to an unaligned SAM record.
+// Words in the comment in the SAM format are converted into aux fields,
+// other words are saved in the tag CO if keepComment is true.
+func fastx2SamRecord(record *fastx.Record, flags sam.Flags, rgID string, keepComment bool) (*sam.Record, error) {
+	var aux []sam.Aux
+	var others [][]byte
+	var hasRG bool
+	if i := bytes.IndexAny(record.Name, " \t"); i >= 0 {
+		for _, word := range bytes.Fields(record.Name[i+1:]) {
+			if !reSamAuxText.Match(word) {
+				if keepComment {
+					others = append(others, word)
+				}
+				continue
+			}
+			a, err := sam.ParseAux(word)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid tag: %s: %s", record.ID, word, err)
+			}
+			if a.Tag() == samTagRG {
+				hasRG = true
+			}
+			aux = append(aux, a)
+		}
+	}
+	if rgID != "" && !hasRG {
+		a, err := sam.NewAux(samTagRG, rgID)
+		if err != nil {
+			return nil, err
+		}
+		aux = append(aux, a)
+	}
+	if len(others) > 0 {
+		a, err := sam.NewAux(samTagCO, string(bytes.Join(others, []byte{' '})))
+		if err != nil {
+			return nil, err
+		}
+		aux = append(aux, a)
+	}
+
+	var qual []byte
+	if len(record.Seq.Qual) > 0 {
+		qual = make([]byte, len(record.Seq.Qual))
+		for i, q := range record.Seq.Qual {
+			qual[i] = q - 33
+		}
+	}
+
+	r, err := sam.NewRecord(string(record.ID), nil, nil, -1, -1, 0, 0, nil,
+		bytes.ToUpper(record.Seq.Seq), qual, aux)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", record.ID, err)
+	}
+	r.Flags = flags
+	return r, nil
+}
+
+var samTagRG = sam.NewTag("RG")
+var samTagCO = sam.NewTag("CO")
+
+func init() {
+	RootCmd.AddCommand(fx2bamCmd)
+
+	fx2bamCmd.Flags().StringP("read1", "1", "", "(gzipped) read1 file")
+	fx2bamCmd.Flags().StringP("read2", "2", "", "(gzipped) read2 file")
+	fx2bamCmd.Flags().StringP("rg", "R", "", `@RG header line, e.g., '@RG\tID:grp1\tSM:s1'`)
+	fx2bamCmd.Flags().StringP("pg", "", "", "@PG header line, replacing the default one of seqkit")
+	fx2bamCmd.Flags().BoolP("no-pg", "", false, "do not add @PG header line")
+	fx2bamCmd.Flags().BoolP("keep-comment", "c", false, "save words in the comment which are not tags in the tag CO")
+}
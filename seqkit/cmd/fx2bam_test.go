@@ -0,0 +1,142 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/biogo/hts/sam"
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+func TestFx2bamHeader(t *testing.T) {
+	tests := []struct {
+		rgLine, pgLine string
+		noPG           bool
+
+		rgID, pgID string // pgID is empty if no @PG line
+		ok         bool
+	}{
+		{"", "", false, "", "seqkit", true},
+		{"", "", true, "", "", true},
+		{`@RG\tID:grp1\tSM:s1`, "", true, "grp1", "", true},
+		{"ID:grp1\tSM:s1", "", true, "grp1", "", true},
+		{`SM:s1\tID:grp2`, `ID:aligner\tPN:aligner`, false, "grp2", "aligner", true},
+		{`SM:s1`, "", true, "", "", false},
+	}
+	for _, test := range tests {
+		header, rgID, err := fx2bamHeader(test.rgLine, test.pgLine, test.noPG)
+		if test.ok != (err == nil) {
+			t.Errorf("%q, %q: unexpected error: %v", test.rgLine, test.pgLine, err)
+			continue
+		}
+		if !test.ok {
+			continue
+		}
+		if rgID != test.rgID {
+			t.Errorf("%q: read group ID: expected %s, returned %s", test.rgLine, test.rgID, rgID)
+		}
+		rgs := header.RGs()
+		if test.rgID == "" && len(rgs) != 0 || test.rgID != "" && (len(rgs) != 1 || rgs[0].Name() != test.rgID) {
+			t.Errorf("%q: unexpected @RG lines: %v", test.rgLine, rgs)
+		}
+		progs := header.Progs()
+		if test.pgID == "" && len(progs) != 0 || test.pgID != "" && (len(progs) != 1 || progs[0].UID() != test.pgID) {
+			t.Errorf("%q: unexpected @PG lines: %v", test.pgLine, progs)
+		}
+	}
+}
+
+func TestFastx2SamRecord(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		rgID        string
+		keepComment bool
+
+		aux []string
+		ok  bool
+	}{
+		{"no comment", "r1", "", false, nil, true},
+		{"tags", "r1 BC:Z:ACGT\tXN:i:3", "", false, []string{"BC:Z:ACGT", "XN:i:3"}, true},
+		{"read group", "r1 BC:Z:ACGT", "grp1", false, []string{"BC:Z:ACGT", "RG:Z:grp1"}, true},
+		{"read group in the comment", "r1 RG:Z:grp2", "grp1", false, []string{"RG:Z:grp2"}, true},
+		{"other words dropped", "r1 length=5 BC:Z:ACGT", "", false, []string{"BC:Z:ACGT"}, true},
+		{"other words kept", "r1 length=5 BC:Z:ACGT x y", "", true, []string{"BC:Z:ACGT", "CO:Z:length=5 x y"}, true},
+		{"invalid tag", "r1 XN:i:abc", "", false, nil, false},
+	}
+	for _, test := range tests {
+		id := strings.Fields(test.header)[0]
+		record, _ := fastx.NewRecordWithQualWithoutValidation(seq.DNAredundant, []byte(id), []byte(test.header), []byte{},
+			[]byte("acgTT"), []byte("!+5?I"))
+		r, err := fastx2SamRecord(record, sam.Paired|sam.Read1|sam.Unmapped, test.rgID, test.keepComment)
+		if test.ok != (err == nil) {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !test.ok {
+			continue
+		}
+		if r.Name != id || r.Flags != sam.Paired|sam.Read1|sam.Unmapped || r.Ref != nil || r.Pos != -1 {
+			t.Errorf("%s: unexpected record: %s", test.name, r)
+		}
+		if s := GetSamReadSeq(r); s != "ACGTT" {
+			t.Errorf("%s: sequence: expected ACGTT, returned %s", test.name, s)
+		}
+		if q := r.Qual; len(q) != 5 || q[0] != 0 || q[4] != 40 {
+			t.Errorf("%s: qualities: expected [0 10 20 30 40], returned %v", test.name, q)
+		}
+		aux := make([]string, len(r.AuxFields))
+		for i, a := range r.AuxFields {
+			aux[i] = samAuxString(a)
+		}
+		if strings.Join(aux, " ") != strings.Join(test.aux, " ") {
+			t.Errorf("%s: aux fields: expected %v, returned %v", test.name, test.aux, aux)
+		}
+	}
+
+	// FASTA records have no qualities, which are written as 0xff by the BAM writer
+	r, err := fastx2SamRecord(testRecord("r1", "ACGT", ""), sam.Unmapped, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Qual != nil {
+		t.Errorf("FASTA: nil qualities expected, returned %v", r.Qual)
+	}
+}
+
+func TestFx2bamRoundTrip(t *testing.T) {
+	record, _ := fastx.NewRecordWithQualWithoutValidation(seq.DNAredundant, []byte("r1"), []byte("r1 BC:Z:ACGT"), []byte{},
+		[]byte("ACGTT"), []byte("!+5?I"))
+	r, err := fastx2SamRecord(record, sam.Paired|sam.Read2|sam.Unmapped, "grp1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record2 := samRecord2Fastx(r, nil, true, true, false)
+	if string(record2.Name) != "r1/2\tBC:Z:ACGT\tRG:Z:grp1" {
+		t.Errorf("header: expected %q, returned %q", "r1/2\tBC:Z:ACGT\tRG:Z:grp1", record2.Name)
+	}
+	if string(record2.Seq.Seq) != "ACGTT" || string(record2.Seq.Qual) != "!+5?I" {
+		t.Errorf("sequence and qualities: expected ACGTT and !+5?I, returned %s and %s", record2.Seq.Seq, record2.Seq.Qual)
+	}
+}
@@ -73,12 +73,60 @@ Attention:
 		qBase := getFlagPositiveInt(cmd, "qual-ascii-base")
 		printSeqHash := getFlagBool(cmd, "seq-hash")
 		noQual := getFlagBool(cmd, "no-qual")
+		outFormat := getFlagOutFormat(cmd)
 
 		outfh, err := xopen.Wopen(outFile)
 		checkError(err)
 		defer outfh.Close()
 
-		if printTitle {
+		var jw *jsonTableWriter
+		if outFormat != outFormatTSV {
+			columns := make([]string, 0, 16)
+			if onlyID {
+				columns = append(columns, "id")
+			} else {
+				columns = append(columns, "name")
+			}
+			if !onlyName {
+				columns = append(columns, "seq")
+				if !noQual {
+					columns = append(columns, "qual")
+				}
+			}
+			if printLength {
+				columns = append(columns, "length")
+			}
+			if printGC {
+				columns = append(columns, "gc")
+			}
+			if printGCSkew {
+				columns = append(columns, "gc_skew")
+			}
+			for _, bc := range baseCounts {
+				columns = append(columns, "count_"+bc)
+			}
+			for _, bc := range baseContents {
+				columns = append(columns, "content_"+bc)
+			}
+			if printAlphabet {
+				columns = append(columns, "alphabet")
+			}
+			if printAvgQual {
+				columns = append(columns, "avg_qual")
+			}
+			if printSeqHash {
+				columns = append(columns, "seq_hash")
+			}
+
+			jw, err = newJSONTableWriter(outfh, outFormat, "fx2tab", columns)
+			checkError(err)
+			defer func() {
+				checkError(jw.Close())
+			}()
+		}
+		var values []interface{}
+
+		if printTitle && jw == nil {
 			if onlyName {
 				if onlyID {
 					outfh.WriteString("#id")
@@ -155,6 +203,61 @@ Attention:
 				} else {
 					name = record.Name
 				}
+
+				if jw != nil {
+					values = values[:0]
+					values = append(values, name)
+					if !onlyName {
+						values = append(values, record.Seq.Seq)
+						if !noQual {
+							values = append(values, record.Seq.Qual)
+						}
+					}
+					if printLength {
+						values = append(values, len(record.Seq.Seq))
+					}
+					if printGC || printGCSkew {
+						g = record.Seq.BaseContent("G")
+						c = record.Seq.BaseContent("C")
+					}
+					if printGC {
+						values = append(values, (g+c)*100)
+					}
+					if printGCSkew {
+						values = append(values, (g-c)/(g+c)*100)
+					}
+					for _, bc := range baseCounts {
+						if caseSensitive {
+							values = append(values, record.Seq.BaseCountCaseSensitive(bc))
+						} else {
+							values = append(values, record.Seq.BaseCount(bc))
+						}
+					}
+					for _, bc := range baseContents {
+						if caseSensitive {
+							values = append(values, record.Seq.BaseContentCaseSensitive(bc)*100)
+						} else {
+							values = append(values, record.Seq.BaseContent(bc)*100)
+						}
+					}
+					if printAlphabet {
+						values = append(values, alphabetStr(record.Seq.Seq))
+					}
+					if printAvgQual {
+						values = append(values, record.Seq.AvgQual(qBase))
+					}
+					if printSeqHash {
+						if caseSensitive {
+							sum = md5.Sum(record.Seq.Seq)
+						} else {
+							sum = md5.Sum(bytes.ToLower(record.Seq.Seq))
+						}
+						values = append(values, hex.EncodeToString(sum[:]))
+					}
+					checkError(jw.WriteRow(values...))
+					continue
+				}
+
 				if onlyName {
 					outfh.Write(name)
 				} else {
@@ -40,6 +40,7 @@ import (
 	"github.com/shenwei356/bwt/fmi"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
 )
 
 // grepCmd represents the grep command
@@ -59,6 +60,12 @@ Attentions:
      and negative strands are searched.
      Mismatch is allowed using flag "-m/--max-mismatch", you can increase
      the value of "-j/--threads" to accelerate processing.
+     Insertions and deletions are also allowed using flag "--max-edits",
+     which could be used along with -d/--degenerate, but it's much slower.
+     FM-indexes of long sequences like genomes could be built once with
+     "seqkit index-fmi", and loaded with the flag --fmi-index. The input
+     files should be the same ones used in building the index, so do the
+     flags -i/--ignore-case, -c/--circular and -P/--only-positive-strand.
   3. Degenerate bases/residues like "RYMM.." are also supported by flag -d.
      But do not use degenerate bases/residues in regular expression, you need
      convert them to regular expression, e.g., change "N" or "X"  to ".".
@@ -73,6 +80,11 @@ Attentions:
         seqkit faidx seqs.fasta --infile-list IDs.txt
   6. For multiple patterns, you can either set "-p" multiple times, i.e.,
      -p pattern1 -p pattern2, or give a file of patterns via "-f/--pattern-file".
+  7. In paired-end mode (-1/--read1 and -2/--read2), reads are paired with
+     the same strategy of "seqkit pair", and a pair is kept if any mate
+     (or both mates with "--pair-filter both") is matched, after applying
+     -v/--invert-match on each mate. Kept pairs are saved to two synchronized
+     files in -O/--out-dir, and unpaired reads are ignored.
 
 You can specify the sequence region for searching with the flag -R (--region).
 The definition of region is 1-based and with some custom design.
@@ -105,6 +117,8 @@ Examples:
 		bySeq := getFlagBool(cmd, "by-seq")
 		onlyPositiveStrand := getFlagBool(cmd, "only-positive-strand")
 		mismatches := getFlagNonNegativeInt(cmd, "max-mismatch")
+		maxEdits := getFlagNonNegativeInt(cmd, "max-edits")
+		fmiFile := getFlagString(cmd, "fmi-index")
 		byName := getFlagBool(cmd, "by-name")
 		ignoreCase := getFlagBool(cmd, "ignore-case")
 		degenerate := getFlagBool(cmd, "degenerate")
@@ -153,6 +167,44 @@ Examples:
 			}
 		}
 
+		if maxEdits > 0 {
+			if useRegexp || mismatches > 0 {
+				checkError(fmt.Errorf("flag -r (--use-regexp) or -m (--max-mismatch) not allowed when giving flag --max-edits"))
+			}
+			if !bySeq {
+				log.Infof("when value of flag --max-edits > 0, flag -s (--by-seq) is automatically on")
+				bySeq = true
+			}
+		}
+
+		var fmiReader *lib.FMIndexReader
+		if fmiFile != "" {
+			if useRegexp || degenerate || maxEdits > 0 || region != "" {
+				checkError(fmt.Errorf("flag -r (--use-regexp), -d (--degenerate), --max-edits or -R (--region) not allowed when giving flag --fmi-index"))
+			}
+			if !bySeq {
+				log.Infof("when flag --fmi-index given, flag -s (--by-seq) is automatically on")
+				bySeq = true
+			}
+
+			fh, err := xopen.Ropen(fmiFile)
+			checkError(err)
+			defer fh.Close()
+			fmiReader, err = lib.NewFMIndexReader(fh)
+			checkError(err)
+
+			iopt := fmiReader.Options()
+			if iopt.IgnoreCase != ignoreCase {
+				checkError(fmt.Errorf("flag -i (--ignore-case) should be the same as the one used in building the FM-index"))
+			}
+			if iopt.Circular != circular {
+				checkError(fmt.Errorf("flag -c (--circular) should be the same as the one used in building the FM-index"))
+			}
+			if iopt.OnlyPositiveStrand && !onlyPositiveStrand {
+				checkError(fmt.Errorf("the FM-index only contains positive strand, please add the flag -P (--only-positive-strand)"))
+			}
+		}
+
 		if useRegexp && degenerate {
 			checkError(fmt.Errorf("could not give both flags -d (--degenerate) and -r (--use-regexp)"))
 		}
@@ -166,30 +218,46 @@ Examples:
 				log.Infof("when flag -R (--region) given, flag -s (--by-seq) is automatically on")
 				bySeq = true
 			}
-			if !reRegion.MatchString(region) {
-				checkError(fmt.Errorf(`invalid region: %s. type "seqkit grep -h" for more examples`, region))
-			}
-			r := strings.Split(region, ":")
-			start, err = strconv.Atoi(r[0])
-			checkError(err)
-			end, err = strconv.Atoi(r[1])
+			start, end, err = parseGrepRegion(region)
 			checkError(err)
-			if start == 0 || end == 0 {
-				checkError(fmt.Errorf("both start and end should not be 0"))
-			}
-			if start < 0 && end > 0 {
-				checkError(fmt.Errorf("when start < 0, end should not > 0"))
-			}
 		}
 
 		// prepare pattern
-		patternsR := make(map[uint64]*regexp.Regexp, 1<<10)
-		patternsN := make(map[uint64]interface{}, 1<<20)
-		// patternsS := make(map[string]interface{}, 1<<10)
-		patternsS := make([][]byte, 0, 16)
+		matcher := &grepMatcher{
+			byName:             byName,
+			bySeq:              bySeq,
+			useRegexp:          useRegexp,
+			degenerate:         degenerate,
+			ignoreCase:         ignoreCase,
+			onlyPositiveStrand: onlyPositiveStrand,
+			circular:           circular,
+			invertMatch:        invertMatch,
+			deleteMatched:      deleteMatched,
+			mismatches:         mismatches,
+			maxEdits:           maxEdits,
+			limitRegion:        limitRegion,
+			start:              start,
+			end:                end,
+
+			patternsR: make(map[uint64]*regexp.Regexp, 1<<10),
+			patternsN: make(map[uint64]interface{}, 1<<20),
+			patternsS: make([][]byte, 0, 16),
+			patternsE: make([]*lib.Motif, 0, 16),
+		}
+
+		checkPattern := func(p string) {
+			if !quiet {
+				if p[0] == '>' {
+					log.Warningf(`symbol ">" detected, it should not be a part of the sequence ID/name: %s`, p)
+				} else if p[0] == '@' {
+					log.Warningf(`symbol "@" detected, it should not be a part of the sequence ID/name. %s`, p)
+				} else if !byName && usingDefaultIDRegexp && strings.ContainsAny(p, "\t ") {
+					log.Warningf("space found in pattern, you may need use -n/--by-name: %s", p)
+				}
+			}
+			checkError(matcher.addPattern(p, alphabet))
+		}
 
-		var pattern2seq *seq.Seq
-		var pbyte []byte
 		if patternFile != "" {
 			var reader *breader.BufferedReader
 			reader, err = breader.NewDefaultBufferedReader(patternFile)
@@ -201,116 +269,19 @@ Examples:
 					if p == "" {
 						continue
 					}
-
-					if !quiet {
-						if p[0] == '>' {
-							log.Warningf(`symbol ">" detected, it should not be a part of the sequence ID/name: %s`, p)
-						} else if p[0] == '@' {
-							log.Warningf(`symbol "@" detected, it should not be a part of the sequence ID/name. %s`, p)
-						} else if !byName && usingDefaultIDRegexp && strings.ContainsAny(p, "\t ") {
-							log.Warningf("space found in pattern, you may need use -n/--by-name: %s", p)
-						}
-					}
-
-					if degenerate || useRegexp {
-						if degenerate {
-							pattern2seq, err = seq.NewSeq(alphabet, []byte(p))
-							if err != nil {
-								checkError(fmt.Errorf("it seems that flag -d is given, but you provide regular expression instead of available %s sequence", alphabet.String()))
-							}
-							p = pattern2seq.Degenerate2Regexp()
-						}
-						if ignoreCase {
-							p = "(?i)" + p
-						}
-						r, err := regexp.Compile(p)
-						checkError(err)
-						patternsR[xxhash.Sum64String(p)] = r
-					} else if bySeq {
-						pbyte = []byte(p)
-						if mismatches > 0 && mismatches > len(p) {
-							checkError(fmt.Errorf("mismatch should be <= length of sequence: %s", p))
-						}
-						if seq.DNAredundant.IsValid(pbyte) == nil ||
-							seq.RNAredundant.IsValid(pbyte) == nil ||
-							seq.Protein.IsValid(pbyte) == nil { // legal sequence
-							if ignoreCase {
-								// patternsS[strings.ToLower(p)] = struct{}{}
-								patternsS = append(patternsS, bytes.ToLower(pbyte))
-							} else {
-								// patternsS[p] = struct{}{}
-								patternsS = append(patternsS, pbyte)
-							}
-						} else {
-							checkError(fmt.Errorf("illegal DNA/RNA/Protein sequence: %s", p))
-						}
-					} else {
-						if ignoreCase {
-							patternsN[xxhash.Sum64String(strings.ToLower(p))] = struct{}{}
-						} else {
-							patternsN[xxhash.Sum64String(p)] = struct{}{}
-						}
-					}
+					checkPattern(p)
 				}
 			}
 			if !quiet {
-				if len(patternsR)+len(patternsN)+len(patternsS) == 0 {
+				if matcher.numPatterns() == 0 {
 					log.Warningf("%d patterns loaded from file", 0)
 				} else {
-					log.Infof("%d patterns loaded from file", len(patternsR)+len(patternsN)+len(patternsS))
+					log.Infof("%d patterns loaded from file", matcher.numPatterns())
 				}
 			}
 		} else {
 			for _, p := range pattern {
-				if !quiet {
-					if p[0] == '>' {
-						log.Warningf(`symbol ">" detected, it should not be a part of the sequence ID/name: %s`, p)
-					} else if p[0] == '@' {
-						log.Warningf(`symbol "@" detected, it should not be a part of the sequence ID/name. %s`, p)
-					} else if !byName && usingDefaultIDRegexp && strings.ContainsAny(p, "\t ") {
-						log.Warningf("space found in pattern, you may need use -n/--by-name: %s", p)
-					}
-				}
-
-				if degenerate || useRegexp {
-					if degenerate {
-						pattern2seq, err = seq.NewSeq(alphabet, []byte(p))
-						if err != nil {
-							checkError(fmt.Errorf("it seems that flag -d is given, but you provide regular expression instead of available %s sequence", alphabet.String()))
-						}
-						p = pattern2seq.Degenerate2Regexp()
-					}
-					if ignoreCase {
-						p = "(?i)" + p
-					}
-					r, err := regexp.Compile(p)
-					checkError(err)
-					patternsR[xxhash.Sum64String(p)] = r
-				} else if bySeq {
-					pbyte = []byte(p)
-					if mismatches > 0 && mismatches > len(p) {
-						checkError(fmt.Errorf("mismatch should be <= length of sequence: %s", p))
-					}
-					if seq.DNAredundant.IsValid(pbyte) == nil ||
-						seq.RNAredundant.IsValid(pbyte) == nil ||
-						seq.Protein.IsValid(pbyte) == nil { // legal sequence
-						if ignoreCase {
-							// patternsS[strings.ToLower(p)] = struct{}{}
-							patternsS = append(patternsS, bytes.ToLower(pbyte))
-						} else {
-							// patternsS[p] = struct{}{}
-							patternsS = append(patternsS, pbyte)
-						}
-					} else {
-						checkError(fmt.Errorf("illegal DNA/RNA/Protein sequence: %s", p))
-					}
-				} else {
-					if ignoreCase {
-						patternsN[xxhash.Sum64String(strings.ToLower(p))] = struct{}{}
-					} else {
-						patternsN[xxhash.Sum64String(p)] = struct{}{}
-					}
-				}
+				checkPattern(p)
 			}
 		}
 
@@ -318,16 +289,24 @@ Examples:
 		checkError(err)
 		defer outfh.Close()
 
+		if paired := getPairedOptions(cmd, files, quiet); paired != nil {
+			if fmiReader != nil {
+				checkError(fmt.Errorf("flag --fmi-index not supported in paired-end mode"))
+			}
+			grepPaired(paired, matcher, sfmi, justCount, outfh, alphabet, idRegexp, lineWidth, quiet)
+			return
+		}
+
 		var fastxReader *fastx.Reader
 		var record *fastx.Record
-		strands := []byte{'+', '-'}
 
 		var count int
 
 		// -------------------------------------------------------------------
-		// only for searching with sequences and mismatch > 0, were FMI is very slow
+		// only for searching with sequences and mismatch > 0, were FMI is very slow,
+		// and searching with edits or prebuilt FM-indexes
 
-		if bySeq && mismatches > 0 {
+		if bySeq && (mismatches > 0 || maxEdits > 0 || fmiReader != nil) {
 			type Arecord struct {
 				id     uint64
 				ok     bool
@@ -348,7 +327,9 @@ Examples:
 				id = 1
 				for r := range ch {
 					if justCount {
-						count++
+						if r.ok {
+							count++
+						}
 						continue
 					}
 
@@ -422,9 +403,7 @@ Examples:
 					}
 
 					if checkAlphabet {
-						if fastxReader.Alphabet() == seq.Unlimit || fastxReader.Alphabet() == seq.Protein {
-							onlyPositiveStrand = true
-						}
+						matcher.checkAlphabet(fastxReader.Alphabet())
 						checkAlphabet = false
 					}
 
@@ -433,84 +412,46 @@ Examples:
 						fastx.ForcelyOutputFastq = true
 					}
 
+					var idx *lib.SeqFMIndex
+					if fmiReader != nil {
+						idx, err = fmiReader.Read()
+						if err == io.EOF {
+							checkError(fmt.Errorf("more sequences found than those in the FM-index file: %s", fmiFile))
+						}
+						checkError(err)
+					}
+
 					tokens <- 1
 					wg.Add(1)
 					id++
-					go func(record *fastx.Record, id uint64) {
+					go func(record *fastx.Record, id uint64, idx *lib.SeqFMIndex) {
 						defer func() {
 							wg.Done()
 							<-tokens
 						}()
 
-						var sequence *seq.Seq
-						var target []byte
-						var hit bool
-						// var k string
-						var k []byte
-
-						sfmi := fmi.NewFMIndex()
-
-						for _, strand := range strands {
-							if hit {
-								break
-							}
-
-							if strand == '-' && onlyPositiveStrand {
-								break
-							}
-
-							sequence = record.Seq
-							if strand == '-' {
-								sequence = record.Seq.RevCom()
-							}
-							if limitRegion {
-								target = sequence.SubSeq(start, end).Seq
-							} else if circular {
-								// concat two copies of sequence, and do not change orginal sequence
-								target = make([]byte, len(sequence.Seq)*2)
-								copy(target[0:len(sequence.Seq)], sequence.Seq)
-								copy(target[len(sequence.Seq):], sequence.Seq)
-							} else {
-								target = sequence.Seq
-							}
-
-							if ignoreCase {
-								target = bytes.ToLower(target)
-							}
-
-							_, err = sfmi.Transform(target)
-							if err != nil {
-								checkError(fmt.Errorf("fail to build FMIndex for sequence: %s", record.Name))
-							}
-							// for k = range patternsS {
-							for _, k = range patternsS {
-								// hit, err = sfmi.Match([]byte(k), mismatches)
-								hit, err = sfmi.Match(k, mismatches)
-								if err != nil {
-									checkError(fmt.Errorf("fail to search pattern '%s' on seq '%s': %s", k, record.Name, err))
-								}
-								if hit {
-									break
-								}
-							}
-
-						}
-
-						if invertMatch {
-							if hit {
-								ch <- &Arecord{record: nil, ok: false, id: id}
-								return
-							}
+						var ok bool
+						var err error
+						if idx != nil {
+							ok, err = matcher.matchWithFMIndex(record, idx)
 						} else {
-							if !hit {
-								ch <- &Arecord{record: nil, ok: false, id: id}
-								return
-							}
+							ok, err = matcher.match(record, fmi.NewFMIndex())
+						}
+						checkError(err)
+						if !ok {
+							ch <- &Arecord{record: nil, ok: false, id: id}
+							return
 						}
 
 						ch <- &Arecord{record: record, ok: true, id: id}
 
-					}(record.Clone(), id)
+					}(record.Clone(), id, idx)
+				}
+			}
+
+			if fmiReader != nil {
+				if _, err = fmiReader.Read(); err != io.EOF {
+					checkError(fmt.Errorf("fewer sequences found than those in the FM-index file: %s", fmiFile))
 				}
 			}
 
@@ -526,14 +467,7 @@ Examples:
 
 		// -------------------------------------------------------------------
 
-		var sequence *seq.Seq
-		var target []byte
-		var ok, hit bool
-		// var k string
-		var k []byte
-		var re *regexp.Regexp
-		var h uint64
-		var strand byte
+		var ok bool
 		for _, file := range files {
 			fastxReader, err = fastx.NewReader(alphabet, file, idRegexp)
 			checkError(err)
@@ -554,9 +488,7 @@ Examples:
 				}
 
 				if checkAlphabet {
-					if fastxReader.Alphabet() == seq.Unlimit || fastxReader.Alphabet() == seq.Protein {
-						onlyPositiveStrand = true
-					}
+					matcher.checkAlphabet(fastxReader.Alphabet())
 					checkAlphabet = false
 				}
 
@@ -565,114 +497,10 @@ Examples:
 					fastx.ForcelyOutputFastq = true
 				}
 
-				if byName {
-					target = record.Name
-				} else if bySeq {
-
-				} else {
-					target = record.ID
-				}
-
-				hit = false
-
-				for _, strand = range strands {
-					if hit {
-						break
-					}
-
-					if strand == '-' {
-						if bySeq {
-							if onlyPositiveStrand {
-								break
-							}
-						} else {
-							break
-						}
-					}
-
-					if bySeq {
-						sequence = record.Seq
-						if strand == '-' {
-							sequence = record.Seq.RevCom()
-						}
-						if limitRegion {
-							target = sequence.SubSeq(start, end).Seq
-						} else if circular {
-							// concat two copies of sequence, and do not change orginal sequence
-							target = make([]byte, len(sequence.Seq)*2)
-							copy(target[0:len(sequence.Seq)], sequence.Seq)
-							copy(target[len(sequence.Seq):], sequence.Seq)
-						} else {
-							target = sequence.Seq
-						}
-					}
-
-					if degenerate || useRegexp {
-						for h, re = range patternsR {
-							if re.Match(target) {
-								hit = true
-								if deleteMatched && !invertMatch {
-									delete(patternsR, h)
-								}
-								break
-							}
-						}
-					} else if bySeq {
-						if ignoreCase {
-							target = bytes.ToLower(target)
-						}
-						if mismatches == 0 {
-							// for k = range patternsS {
-							for _, k = range patternsS {
-								// if bytes.Contains(target, []byte(k)) {
-								if bytes.Contains(target, k) {
-									hit = true
-									// if deleteMatched && !invertMatch {
-									// 	delete(patternsS, k)
-									// }
-									break
-								}
-							}
-						} else {
-							_, err = sfmi.Transform(target)
-							if err != nil {
-								checkError(fmt.Errorf("fail to build FMIndex for sequence: %s", record.Name))
-							}
-							// for k = range patternsS {
-							for _, k = range patternsS {
-								// hit, err = sfmi.Match([]byte(k), mismatches)
-								hit, err = sfmi.Match(k, mismatches)
-								if err != nil {
-									checkError(fmt.Errorf("fail to search pattern '%s' on seq '%s': %s", k, record.Name, err))
-								}
-								if hit {
-									break
-								}
-							}
-						}
-					} else {
-						h = xxhash.Sum64(target)
-						if ignoreCase {
-							h = xxhash.Sum64(bytes.ToLower(target))
-						}
-						if _, ok = patternsN[h]; ok {
-							hit = true
-							if deleteMatched && !invertMatch {
-								delete(patternsN, h)
-							}
-						}
-					}
-
-				}
-
-				if invertMatch {
-					if hit {
-						continue
-					}
-				} else {
-					if !hit {
-						continue
-					}
+				ok, err = matcher.match(record, sfmi)
+				checkError(err)
+				if !ok {
+					continue
 				}
 
 				if justCount {
@@ -707,6 +535,8 @@ func init() {
 	grepCmd.Flags().BoolP("by-seq", "s", false, "search subseq on seq, both positive and negative strand are searched, and mismatch allowed using flag -m/--max-mismatch")
 	grepCmd.Flags().BoolP("only-positive-strand", "P", false, "only search on positive strand")
 	grepCmd.Flags().IntP("max-mismatch", "m", 0, "max mismatch when matching by seq. For large genomes like human genome, using mapping/alignment tools would be faster")
+	grepCmd.Flags().IntP("max-edits", "", 0, "max edits (mismatches, insertions and deletions) when matching by seq, much slower than -m/--max-mismatch")
+	grepCmd.Flags().StringP("fmi-index", "", "", `FM-index file built by "seqkit index-fmi" from the same input files, for searching by seq`)
 	grepCmd.Flags().BoolP("ignore-case", "i", false, "ignore case")
 	grepCmd.Flags().BoolP("degenerate", "d", false, "pattern/motif contains degenerate base")
 	grepCmd.Flags().StringP("region", "R", "", "specify sequence region for searching. "+
@@ -714,6 +544,296 @@ func init() {
 	grepCmd.Flags().BoolP("circular", "c", false, "circular genome")
 	grepCmd.Flags().BoolP("immediate-output", "I", false, "print output immediately, do not use write buffer")
 	grepCmd.Flags().BoolP("count", "C", false, "just print a count of matching records. with the -v/--invert-match flag, count non-matching records")
+
+	addPairedFlags(grepCmd, true, "any", `in paired-end mode, keep a pair if "any" or "both" of the mates are matched`)
+}
+
+// parseGrepRegion parses the region for searching sequences, e.g., 1:12, -12:-1.
+func parseGrepRegion(region string) (int, int, error) {
+	if !reRegion.MatchString(region) {
+		return 0, 0, fmt.Errorf(`invalid region: %s. type "seqkit grep -h" for more examples`, region)
+	}
+	r := strings.Split(region, ":")
+	start, err := strconv.Atoi(r[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := strconv.Atoi(r[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	if start == 0 || end == 0 {
+		return 0, 0, fmt.Errorf("both start and end should not be 0")
+	}
+	if start < 0 && end > 0 {
+		return 0, 0, fmt.Errorf("when start < 0, end should not > 0")
+	}
+	return start, end, nil
+}
+
+// grepPaired searches paired-end reads, the number of matched pairs
+// is written to outfh if justCount is true.
+func grepPaired(o *pairedOptions, matcher *grepMatcher, sfmi *fmi.FMIndex, justCount bool, outfh *xopen.Writer,
+	alphabet *seq.Alphabet, idRegexp string, lineWidth int, quiet bool) {
+	reader := o.newReader(alphabet, idRegexp)
+	var writer *pairedWriter
+	if !justCount {
+		writer = o.newWriter(lineWidth)
+	}
+
+	var count int
+	var ok1, ok2 bool
+	var err error
+	checkAlphabet := true
+	checkError(reader.Walk(func(r1, r2 *fastx.Record) bool {
+		if checkAlphabet {
+			matcher.checkAlphabet(reader.Alphabet())
+			checkAlphabet = false
+		}
+
+		ok1, err = matcher.match(r1, sfmi)
+		checkError(err)
+		ok2, err = matcher.match(r2, sfmi)
+		checkError(err)
+		if !o.test(ok1, ok2) {
+			return false
+		}
+
+		if justCount {
+			count++
+		} else {
+			writer.Write(r1, r2)
+		}
+		return false
+	}))
+
+	reader.warnUnpaired()
+	if justCount {
+		fmt.Fprintf(outfh, "%d\n", count)
+		return
+	}
+	writer.Close(quiet)
+}
+
+// grepMatcher matches records with patterns of ID, name or sequence,
+// it's shared by grep and the Grep stage of pipe.
+type grepMatcher struct {
+	byName             bool
+	bySeq              bool
+	useRegexp          bool
+	degenerate         bool
+	ignoreCase         bool
+	onlyPositiveStrand bool
+	circular           bool
+	invertMatch        bool
+	deleteMatched      bool
+	mismatches         int
+	maxEdits           int
+
+	limitRegion bool
+	start, end  int
+
+	patternsR map[uint64]*regexp.Regexp // for regular expression and degenerate bases
+	patternsN map[uint64]interface{}    // hashes of IDs or names
+	patternsS [][]byte                  // sequences
+	patternsE []*lib.Motif              // sequences searched with edits
+}
+
+// addPattern checks and adds a pattern,
+// alphabet is used to convert degenerate bases to regular expression.
+func (m *grepMatcher) addPattern(p string, alphabet *seq.Alphabet) error {
+	if m.maxEdits > 0 {
+		motif, err := lib.NewMotif(p, []byte(p), alphabet, &lib.LocateOptions{
+			Degenerate: m.degenerate,
+			IgnoreCase: m.ignoreCase,
+			MaxEdits:   m.maxEdits,
+		})
+		if err != nil {
+			return err
+		}
+		m.patternsE = append(m.patternsE, motif)
+	} else if m.degenerate || m.useRegexp {
+		if m.degenerate {
+			pattern2seq, err := seq.NewSeq(alphabet, []byte(p))
+			if err != nil {
+				return fmt.Errorf("it seems that flag -d is given, but you provide regular expression instead of available %s sequence", alphabet.String())
+			}
+			p = pattern2seq.Degenerate2Regexp()
+		}
+		if m.ignoreCase {
+			p = "(?i)" + p
+		}
+		r, err := regexp.Compile(p)
+		if err != nil {
+			return err
+		}
+		m.patternsR[xxhash.Sum64String(p)] = r
+	} else if m.bySeq {
+		pbyte := []byte(p)
+		if m.mismatches > 0 && m.mismatches > len(p) {
+			return fmt.Errorf("mismatch should be <= length of sequence: %s", p)
+		}
+		if seq.DNAredundant.IsValid(pbyte) == nil ||
+			seq.RNAredundant.IsValid(pbyte) == nil ||
+			seq.Protein.IsValid(pbyte) == nil { // legal sequence
+			if m.ignoreCase {
+				m.patternsS = append(m.patternsS, bytes.ToLower(pbyte))
+			} else {
+				m.patternsS = append(m.patternsS, pbyte)
+			}
+		} else {
+			return fmt.Errorf("illegal DNA/RNA/Protein sequence: %s", p)
+		}
+	} else {
+		if m.ignoreCase {
+			m.patternsN[xxhash.Sum64String(strings.ToLower(p))] = struct{}{}
+		} else {
+			m.patternsN[xxhash.Sum64String(p)] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// numPatterns returns the number of patterns.
+func (m *grepMatcher) numPatterns() int {
+	return len(m.patternsR) + len(m.patternsN) + len(m.patternsS) + len(m.patternsE)
+}
+
+// checkAlphabet switches on onlyPositiveStrand for sequences
+// without complement ones.
+func (m *grepMatcher) checkAlphabet(alphabet *seq.Alphabet) {
+	if alphabet == seq.Unlimit || alphabet == seq.Protein {
+		m.onlyPositiveStrand = true
+	}
+}
+
+// match tells whether the record should be kept, i.e., it's matched by
+// any pattern, or not matched when invertMatch is true.
+// sfmi is used for searching sequences with mismatches, it's not safe
+// for concurrent use, so does deleteMatched.
+func (m *grepMatcher) match(record *fastx.Record, sfmi *fmi.FMIndex) (bool, error) {
+	return m.matchSeq(record, sfmi, nil)
+}
+
+// matchWithFMIndex is similar to match, but searches the sequence with
+// mismatches via its prebuilt FM-index, which is safe for concurrent use
+// except for deleteMatched.
+func (m *grepMatcher) matchWithFMIndex(record *fastx.Record, idx *lib.SeqFMIndex) (bool, error) {
+	fwd, rev, err := idx.FMIndexes(record, !m.onlyPositiveStrand)
+	if err != nil {
+		return false, err
+	}
+	return m.matchSeq(record, nil, []*fmi.FMIndex{fwd, rev})
+}
+
+// matchSeq is the implementation of match and matchWithFMIndex, prebuilt
+// contains FM-indexes of the positive and negative strands.
+func (m *grepMatcher) matchSeq(record *fastx.Record, sfmi *fmi.FMIndex, prebuilt []*fmi.FMIndex) (bool, error) {
+	var sequence *seq.Seq
+	var target []byte
+	var hit bool
+	var err error
+
+	if m.byName {
+		target = record.Name
+	} else if !m.bySeq {
+		target = record.ID
+	}
+
+	for _, strand := range []byte{'+', '-'} {
+		if hit {
+			break
+		}
+
+		if strand == '-' && (!m.bySeq || m.onlyPositiveStrand) {
+			break
+		}
+
+		if m.bySeq && prebuilt == nil {
+			sequence = record.Seq
+			if strand == '-' {
+				sequence = record.Seq.RevCom()
+			}
+			if m.limitRegion {
+				target = sequence.SubSeq(m.start, m.end).Seq
+			} else if m.circular {
+				// concat two copies of sequence, and do not change orginal sequence
+				target = make([]byte, len(sequence.Seq)*2)
+				copy(target[0:len(sequence.Seq)], sequence.Seq)
+				copy(target[len(sequence.Seq):], sequence.Seq)
+			} else {
+				target = sequence.Seq
+			}
+		}
+
+		if m.maxEdits > 0 {
+			if m.ignoreCase {
+				target = bytes.ToLower(target)
+			}
+			for _, k := range m.patternsE {
+				if k.HasMatchWithEdits(target, m.maxEdits) {
+					hit = true
+					break
+				}
+			}
+		} else if m.degenerate || m.useRegexp {
+			for h, re := range m.patternsR {
+				if re.Match(target) {
+					hit = true
+					if m.deleteMatched && !m.invertMatch {
+						delete(m.patternsR, h)
+					}
+					break
+				}
+			}
+		} else if m.bySeq {
+			if m.ignoreCase && prebuilt == nil {
+				target = bytes.ToLower(target)
+			}
+			if m.mismatches == 0 && prebuilt == nil {
+				for _, k := range m.patternsS {
+					if bytes.Contains(target, k) {
+						hit = true
+						break
+					}
+				}
+			} else {
+				if prebuilt != nil {
+					sfmi = prebuilt[0]
+					if strand == '-' {
+						sfmi = prebuilt[1]
+					}
+				} else {
+					_, err = sfmi.Transform(target)
+					if err != nil {
+						return false, fmt.Errorf("fail to build FMIndex for sequence: %s", record.Name)
+					}
+				}
+				for _, k := range m.patternsS {
+					hit, err = sfmi.Match(k, m.mismatches)
+					if err != nil {
+						return false, fmt.Errorf("fail to search pattern '%s' on seq '%s': %s", k, record.Name, err)
+					}
+					if hit {
+						break
+					}
+				}
+			}
+		} else {
+			h := xxhash.Sum64(target)
+			if m.ignoreCase {
+				h = xxhash.Sum64(bytes.ToLower(target))
+			}
+			if _, ok := m.patternsN[h]; ok {
+				hit = true
+				if m.deleteMatched && !m.invertMatch {
+					delete(m.patternsN, h)
+				}
+			}
+		}
+	}
+
+	return hit != m.invertMatch, nil
 }
 
 var reUnquotedComma = regexp.MustCompile(`\{[^\}]*$|^[^\{]*\}`)
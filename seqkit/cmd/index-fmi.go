@@ -0,0 +1,175 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/bwt"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
+)
+
+// indexFMICmd represents the index-fmi command
+var indexFMICmd = &cobra.Command{
+	Use:   "index-fmi",
+	Short: "build FM-indexes of sequences for locate and grep",
+	Long: `build FM-indexes of sequences for locate and grep
+
+Building the FM-index of a long sequence, e.g., a genome, is time-consuming,
+so "seqkit locate -F/--use-fmi" and "seqkit grep -s -m" spend most of the time
+indexing the same sequences again and again. This command builds FM-indexes
+once and saves them to a file, which could be loaded by "seqkit locate" and
+"seqkit grep -s" with the flag --fmi-index.
+
+Attentions:
+
+  1. Only suffix arrays are saved, which takes about 4 (-P) or 8 bytes per
+     base, and the rest of the index is recovered from sequences when
+     searching. So the input files are still needed in searching, and they
+     must be the same ones (and in the same order) used in building.
+  2. The flags -i/--ignore-case, -c/--circular and -P/--only-positive-strand
+     should be the same as the ones used in searching. For protein
+     sequences, only the positive strand is indexed.
+  3. Empty sequences are skipped.
+  4. The index file is named with a suffix ".fmi" by default, i.e.,
+     "seqs.fa.fmi" for a single input file "seqs.fa". The flag -o/--out-file
+     is needed for multiple input files or stdin.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		alphabet := config.Alphabet
+		idRegexp := config.IDRegexp
+		outFile := config.OutFile
+		quiet := config.Quiet
+		seq.AlphabetGuessSeqLengthThreshold = config.AlphabetGuessSeqLength
+		seq.ValidateSeq = false
+		runtime.GOMAXPROCS(config.Threads)
+
+		bwt.CheckEndSymbol = false
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+
+		opt := &lib.FMIndexOptions{
+			IgnoreCase:         getFlagBool(cmd, "ignore-case"),
+			Circular:           getFlagBool(cmd, "circular"),
+			OnlyPositiveStrand: getFlagBool(cmd, "only-positive-strand"),
+		}
+		if alphabet == seq.Protein {
+			opt.OnlyPositiveStrand = true
+		}
+
+		if outFile == "-" {
+			if len(files) > 1 || isStdin(files[0]) {
+				checkError(fmt.Errorf("flag -o/--out-file needed for multiple input files or stdin"))
+			}
+			outFile = files[0] + ".fmi"
+		}
+
+		// indexes are built concurrently, and written in order
+		chs := make(chan chan *lib.SeqFMIndex, config.Threads)
+		done := make(chan int)
+		var n int
+		go func() {
+			outfh, err := xopen.Wopen(outFile)
+			checkError(err)
+			defer outfh.Close()
+
+			var writer *lib.FMIndexWriter
+			for ch := range chs {
+				idx := <-ch
+				if writer == nil { // options are decided after reading the first sequence
+					writer, err = lib.NewFMIndexWriter(outfh, opt)
+					checkError(err)
+				}
+				checkError(writer.Write(idx))
+				n++
+			}
+			if writer == nil {
+				writer, err = lib.NewFMIndexWriter(outfh, opt)
+				checkError(err)
+			}
+			checkError(writer.Flush())
+			done <- 1
+		}()
+
+		var record *fastx.Record
+		var fastxReader *fastx.Reader
+		var err error
+		checkAlphabet := true
+		for _, file := range files {
+			fastxReader, err = fastx.NewReader(alphabet, file, idRegexp)
+			checkError(err)
+
+			for {
+				record, err = fastxReader.Read()
+				if err != nil {
+					if err == io.EOF {
+						break
+					}
+					checkError(err)
+					break
+				}
+
+				if len(record.Seq.Seq) == 0 {
+					continue
+				}
+
+				if _alphabet := fastxReader.Alphabet(); _alphabet == seq.Unlimit || _alphabet == seq.Protein {
+					if checkAlphabet {
+						opt.OnlyPositiveStrand = true
+					} else if !opt.OnlyPositiveStrand {
+						checkError(fmt.Errorf("protein sequences found in %s, please use the flag -P/--only-positive-strand", file))
+					}
+				}
+				checkAlphabet = false
+
+				ch := make(chan *lib.SeqFMIndex, 1)
+				chs <- ch
+				go func(record *fastx.Record) {
+					idx, err := lib.NewSeqFMIndex(record, opt)
+					checkError(err)
+					ch <- idx
+				}(record.Clone())
+			}
+		}
+		close(chs)
+		<-done
+
+		if !quiet {
+			log.Infof("%d sequences indexed, saved to %s", n, outFile)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(indexFMICmd)
+
+	indexFMICmd.Flags().BoolP("ignore-case", "i", false, "index sequences in lower case, for searching with -i/--ignore-case")
+	indexFMICmd.Flags().BoolP("circular", "c", false, "circular genome, for searching with -c/--circular")
+	indexFMICmd.Flags().BoolP("only-positive-strand", "P", false, "only index positive strand, for searching with -P/--only-positive-strand")
+}
@@ -0,0 +1,141 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// interleaveCmd represents the interleave command
+var interleaveCmd = &cobra.Command{
+	Use:   "interleave",
+	Short: "interleave paired-end reads from two files into one file",
+	Long: `interleave paired-end reads from two files into one file
+
+Attentions:
+1. Reads are paired with the same strategy of "seqkit pair", i.e., mates are
+   matched by names (ignoring the suffixes "/1" and "/2"), and orders of reads
+   in the two files better be the same.
+2. Unpaired reads are optional outputted with the flag -u/--save-unpaired,
+   into the directory of the output file, with the suffix "unpaired",
+   e.g., read_1.unpaired.fq.gz.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		alphabet := config.Alphabet
+		idRegexp := config.IDRegexp
+		lineWidth := config.LineWidth
+		outFile := config.OutFile
+		quiet := config.Quiet
+		seq.AlphabetGuessSeqLengthThreshold = config.AlphabetGuessSeqLength
+		seq.ValidateSeq = false
+		runtime.GOMAXPROCS(config.Threads)
+
+		if len(args) > 0 {
+			checkError(errors.New("no positional arguments are allowed"))
+		}
+
+		read1 := getFlagString(cmd, "read1")
+		read2 := getFlagString(cmd, "read2")
+		if read1 == "" || read2 == "" {
+			checkError(fmt.Errorf("flag -1/--read1 and -2/--read2 needed"))
+		}
+		if read1 == read2 {
+			checkError(fmt.Errorf("values of flag -1/--read1 and -2/--read2 can not be the same"))
+		}
+		saveUnpaired := getFlagBool(cmd, "save-unpaired")
+
+		reader, err := newPairedReader(alphabet, read1, read2, idRegexp)
+		checkError(err)
+
+		outfh, err := xopen.Wopen(outFile)
+		checkError(err)
+		defer outfh.Close()
+
+		var n uint64
+		checkError(reader.Walk(func(r1, r2 *fastx.Record) bool {
+			if reader.IsFastq() {
+				lineWidth = 0
+			}
+			r1.FormatToWriter(outfh, lineWidth)
+			r2.FormatToWriter(outfh, lineWidth)
+			n++
+			return false
+		}))
+
+		if !quiet {
+			log.Infof("%d paired-end reads saved to %s", n, outFile)
+		}
+
+		if !saveUnpaired {
+			reader.warnUnpaired()
+			return
+		}
+
+		outdir := "."
+		if !isStdin(outFile) {
+			outdir = filepath.Dir(outFile)
+		}
+		unpaired1, unpaired2 := reader.Unpaired()
+		for i, unpaired := range [][]*fastx.Record{unpaired1, unpaired2} {
+			file := read1
+			if i == 1 {
+				file = read2
+			}
+			if len(unpaired) == 0 {
+				if !quiet {
+					log.Infof("no unpaired reads in %s", file)
+				}
+				continue
+			}
+
+			base, suffix := filepathTrimExtension(filepath.Base(file))
+			outFileU := filepath.Join(outdir, base+".unpaired"+suffix)
+			outfhU, err := xopen.Wopen(outFileU)
+			checkError(errors.Wrap(err, outFileU))
+			for _, record := range unpaired {
+				record.FormatToWriter(outfhU, lineWidth)
+			}
+			checkError(outfhU.Close())
+
+			if !quiet {
+				log.Infof("%d unpaired reads saved to %s", len(unpaired), outFileU)
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(interleaveCmd)
+
+	interleaveCmd.Flags().StringP("read1", "1", "", "(gzipped) read1 file")
+	interleaveCmd.Flags().StringP("read2", "2", "", "(gzipped) read2 file")
+	interleaveCmd.Flags().BoolP("save-unpaired", "u", false, "save unpaired reads if there are")
+}
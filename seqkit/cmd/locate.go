@@ -24,16 +24,16 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"regexp"
 	"runtime"
+	"strings"
 	"sync"
 
 	"github.com/shenwei356/bio/seq"
 	"github.com/shenwei356/bio/seqio/fastx"
 	"github.com/shenwei356/bwt"
-	"github.com/shenwei356/bwt/fmi"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
 	"github.com/twotwotwo/sorts/sortutil"
 )
 
@@ -59,6 +59,25 @@ Attentions:
      you can increase the value of "-j/--threads" to accelerate processing.
   5. When using flag --circular, end position of matched subsequence that 
      crossing genome sequence end would be greater than sequence length.
+  6. Insertions and deletions are allowed using flag "--max-edits", which
+     could be used along with -d/--degenerate. Two extra columns are
+     outputted: the number of edits and a CIGAR string of the alignment of
+     the motif to the matched subsequence, where "=" means a match, "X" a
+     mismatch, "I" a base only in the motif and "D" a base only in the
+     sequence. Of matches starting at the same position, the one with the
+     fewest edits is reported. It's much slower than "-m/--max-mismatch".
+  7. FM-indexes of long sequences like genomes could be built once with
+     "seqkit index-fmi", and loaded with the flag --fmi-index, which implies
+     -F/--use-fmi. The input files should be the same ones used in building
+     the index, so do the flags -i/--ignore-case, -c/--circular and
+     -P/--only-positive-strand.
+  8. DNA motifs in JASPAR or MEME format could be scanned with position
+     weight matrices (PWMs) via the flag --pwm-file, instead of -p/-f.
+     Log-odds scores (in bits) of sites are computed against the background
+     frequencies (uniform for JASPAR), and sites with a p-value <= the value
+     of --pwm-pvalue, or a score >= the value of --pwm-min-score if given,
+     are reported. Two extra columns are outputted: score and p-value.
+     The consensus sequence of a motif is shown in the column "pattern".
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -90,8 +109,15 @@ Attentions:
 		outFmtGTF := getFlagBool(cmd, "gtf")
 		outFmtBED := getFlagBool(cmd, "bed")
 		mismatches := getFlagNonNegativeInt(cmd, "max-mismatch")
+		maxEdits := getFlagNonNegativeInt(cmd, "max-edits")
 		hideMatched := getFlagBool(cmd, "hide-matched")
 		circular := getFlagBool(cmd, "circular")
+		fmiFile := getFlagString(cmd, "fmi-index")
+		pwmFile := getFlagString(cmd, "pwm-file")
+		pwmPvalue := getFlagFloat64(cmd, "pwm-pvalue")
+		pwmMinScore := getFlagFloat64(cmd, "pwm-min-score")
+		useMinScore := cmd.Flags().Changed("pwm-min-score")
+		outFormat := getFlagOutFormat(cmd)
 
 		immediateOutput := getFlagBool(cmd, "immediate-output")
 
@@ -99,7 +125,25 @@ Attentions:
 			onlyPositiveStrand = true
 		}
 
-		if len(pattern) == 0 && patternFile == "" {
+		if pwmFile != "" {
+			if cmd.Flags().Changed("pattern") || patternFile != "" {
+				checkError(fmt.Errorf("flag -p (--pattern) or -f (--pattern-file) not allowed when giving flag --pwm-file"))
+			}
+			if degenerate || useRegexp || useFMI || mismatches > 0 || maxEdits > 0 || fmiFile != "" {
+				checkError(fmt.Errorf("flag -d, -r, -F, -m, --max-edits or --fmi-index not allowed when giving flag --pwm-file"))
+			}
+			if pwmPvalue <= 0 || pwmPvalue > 1 {
+				checkError(fmt.Errorf("value of flag --pwm-pvalue should be in range of (0, 1]"))
+			}
+			if !quiet {
+				if ignoreCase {
+					log.Infof("flag -i (--ignore-case) ignored when giving flag --pwm-file, PWM scanning is case-insensitive")
+				}
+				if nonGreedy {
+					log.Infof("flag -G (--non-greedy) ignored when giving flag --pwm-file")
+				}
+			}
+		} else if len(pattern) == 0 && patternFile == "" {
 			checkError(fmt.Errorf("one of flags -p (--pattern) and -f (--pattern-file) needed"))
 		}
 
@@ -131,6 +175,42 @@ Attentions:
 			}
 
 		}
+		var fmiReader *lib.FMIndexReader
+		if fmiFile != "" {
+			useFMI = true
+
+			fh, err := xopen.Ropen(fmiFile)
+			checkError(err)
+			defer fh.Close()
+			fmiReader, err = lib.NewFMIndexReader(fh)
+			checkError(err)
+
+			iopt := fmiReader.Options()
+			if iopt.IgnoreCase != ignoreCase {
+				checkError(fmt.Errorf("flag -i (--ignore-case) should be the same as the one used in building the FM-index"))
+			}
+			if iopt.Circular != circular {
+				checkError(fmt.Errorf("flag -c (--circular) should be the same as the one used in building the FM-index"))
+			}
+			if iopt.OnlyPositiveStrand && !onlyPositiveStrand {
+				checkError(fmt.Errorf("the FM-index only contains positive strand, please add the flag -P (--only-positive-strand)"))
+			}
+		}
+
+		if maxEdits > 0 {
+			if mismatches > 0 {
+				checkError(fmt.Errorf("flag -m (--max-mismatch) not allowed when giving flag --max-edits"))
+			}
+			if useRegexp {
+				checkError(fmt.Errorf("flag -r (--use-regexp) not allowed when giving flag --max-edits"))
+			}
+			if useFMI {
+				checkError(fmt.Errorf("flag -F (--use-fmi) not allowed when giving flag --max-edits"))
+			}
+			if nonGreedy && !quiet {
+				log.Infof("flag -G (--non-greedy) ignored when giving flag --max-edits")
+			}
+		}
 		if useFMI {
 			if degenerate {
 				checkError(fmt.Errorf("flag -d (--degenerate) ignored when giving flag -F (--use-fmi)"))
@@ -140,107 +220,80 @@ Attentions:
 			}
 		}
 
+		opt := &lib.LocateOptions{
+			Degenerate:         degenerate,
+			UseRegexp:          useRegexp,
+			UseFMI:             useFMI,
+			IgnoreCase:         ignoreCase,
+			OnlyPositiveStrand: onlyPositiveStrand,
+			NonGreedy:          nonGreedy,
+			Circular:           circular,
+			MaxMismatch:        mismatches,
+			MaxEdits:           maxEdits,
+			Threads:            config.Threads,
+		}
+
 		// prepare pattern
-		regexps := make(map[string]*regexp.Regexp)
-		patterns := make(map[string][]byte)
-		var s string
-		if patternFile != "" {
-			records, err := fastx.GetSeqsMap(patternFile, seq.Unlimit, config.Threads, 10, "")
+		motifs := make([]*lib.Motif, 0, 8)
+		motifIdx := make(map[string]int)
+		addMotif := func(m *lib.Motif) { // later ones override previous ones with the same name
+			if i, ok := motifIdx[m.Name]; ok {
+				motifs[i] = m
+				return
+			}
+			motifIdx[m.Name] = len(motifs)
+			motifs = append(motifs, m)
+		}
+		var pwms []*lib.PWM
+		var pwmThresholds []float64
+		if pwmFile != "" {
+			var err error
+			pwms, err = lib.LoadPWMs(pwmFile)
+			checkError(err)
+			pwmThresholds = make([]float64, len(pwms))
+			for i, p := range pwms {
+				addMotif(&lib.Motif{Name: p.ID, Seq: p.Consensus})
+				if useMinScore {
+					pwmThresholds[i] = pwmMinScore
+				} else {
+					pwmThresholds[i] = p.ScoreThreshold(pwmPvalue)
+				}
+			}
+			if !quiet {
+				log.Infof("%d motifs loaded from file", len(pwms))
+			}
+		} else if patternFile != "" {
+			records, err := fastx.GetSeqs(patternFile, seq.Unlimit, config.Threads, 10, "")
 			checkError(err)
 			if len(records) == 0 {
 				checkError(fmt.Errorf("no FASTA sequences found in pattern file: %s", patternFile))
 			}
-			for name, record := range records {
-				patterns[name] = record.Seq.Seq
+			for _, record := range records {
+				name := string(record.ID)
 				if !quiet && bytes.Contains(record.Seq.Seq, []byte("\t ")) {
 					log.Warningf("space found in sequence: %s", name)
 				}
 
-				if degenerate {
-					s = record.Seq.Degenerate2Regexp()
-				} else if useRegexp {
-					s = string(record.Seq.Seq)
-				} else {
-					if ignoreCase {
-						patterns[name] = bytes.ToLower(record.Seq.Seq)
-					}
-				}
-
-				// check pattern
-				if mismatches > 0 {
-					if mismatches > len(record.Seq.Seq) {
-						checkError(fmt.Errorf("mismatch should be <= length of sequence: %s", record.Seq.Seq))
-					}
-					if seq.DNAredundant.IsValid(record.Seq.Seq) == nil ||
-						seq.RNAredundant.IsValid(record.Seq.Seq) == nil ||
-						seq.Protein.IsValid(record.Seq.Seq) == nil { // legal sequence
-					} else {
-						checkError(fmt.Errorf("illegal DNA/RNA/Protein sequence: %s", record.Name))
-					}
-				} else {
-					if degenerate || useRegexp {
-						if ignoreCase {
-							s = "(?i)" + s
-						}
-						re, err := regexp.Compile(s)
-						checkError(err)
-						regexps[name] = re
-					} else if bytes.Index(record.Seq.Seq, []byte(".")) >= 0 ||
-						!(seq.DNAredundant.IsValid(record.Seq.Seq) == nil ||
-							seq.RNAredundant.IsValid(record.Seq.Seq) == nil ||
-							seq.Protein.IsValid(record.Seq.Seq) == nil) {
-						checkError(fmt.Errorf("illegal DNA/RNA/Protein sequence: %s, you may switch on -d/--degenerate or -r/--use-regexp", record.Name))
-					}
-				}
+				m, err := lib.NewMotif(name, record.Seq.Seq, seq.Unlimit, opt)
+				checkError(err)
+				addMotif(m)
 			}
 		} else {
 			for _, p := range pattern {
-				patterns[p] = []byte(p)
-
-				if !quiet && bytes.IndexAny(patterns[p], " \t") >= 0 {
+				if !quiet && strings.ContainsAny(p, " \t") {
 					log.Warningf("space found in sequence: '%s'", p)
 				}
 
 				if degenerate {
-					pattern2seq, err := seq.NewSeq(alphabet, []byte(p))
+					_, err := seq.NewSeq(alphabet, []byte(p))
 					if err != nil {
 						checkError(fmt.Errorf("it seems that flag -d is given, but you provide regular expression instead of available %s sequence", alphabet.String()))
 					}
-					s = pattern2seq.Degenerate2Regexp()
-				} else if useRegexp {
-					s = p
-				} else {
-					if ignoreCase {
-						patterns[p] = bytes.ToLower(patterns[p])
-					}
 				}
 
-				// check pattern
-				if mismatches > 0 {
-					if mismatches > len(patterns[p]) {
-						checkError(fmt.Errorf("mismatch should be <= length of sequence: %s", p))
-					}
-					if seq.DNAredundant.IsValid(patterns[p]) == nil ||
-						seq.RNAredundant.IsValid(patterns[p]) == nil ||
-						seq.Protein.IsValid(patterns[p]) == nil { // legal sequence
-					} else {
-						checkError(fmt.Errorf("illegal DNA/RNA/Protein sequence: %s", p))
-					}
-				} else {
-					if degenerate || useRegexp {
-						if ignoreCase {
-							s = "(?i)" + s
-						}
-						re, err := regexp.Compile(s)
-						checkError(err)
-						regexps[p] = re
-					} else if bytes.Index(patterns[p], []byte(".")) >= 0 ||
-						!(seq.DNAredundant.IsValid(patterns[p]) == nil ||
-							seq.RNAredundant.IsValid(patterns[p]) == nil ||
-							seq.Protein.IsValid(patterns[p]) == nil) {
-						checkError(fmt.Errorf("illegal DNA/RNA/Protein sequence: %s, you may switch on -d/--degenerate or -r/--use-regexp", p))
-					}
-				}
+				m, err := lib.NewMotif(p, []byte(p), alphabet, opt)
+				checkError(err)
+				addMotif(m)
 			}
 		}
 
@@ -248,22 +301,74 @@ Attentions:
 		checkError(err)
 		defer outfh.Close()
 
-		if !(outFmtGTF || outFmtBED) {
-			if hideMatched {
-				outfh.WriteString("seqID\tpatternName\tpattern\tstrand\tstart\tend\n")
-			} else {
-				outfh.WriteString("seqID\tpatternName\tpattern\tstrand\tstart\tend\tmatched\n")
+		var jw *jsonTableWriter
+		if outFormat != outFormatTSV {
+			columns := []string{"seq_id", "pattern_name", "pattern", "strand", "start", "end"}
+			if !hideMatched {
+				columns = append(columns, "matched")
 			}
+			if maxEdits > 0 {
+				columns = append(columns, "edits", "cigar")
+			} else if pwms != nil {
+				columns = append(columns, "score", "pvalue")
+			}
+			jw, err = newJSONTableWriter(outfh, outFormat, "locate", columns)
+			checkError(err)
+			defer func() {
+				checkError(jw.Close())
+			}()
+		}
+		formatLoc := func(seqID []byte, m *lib.Motif, loc *lib.MotifLocation) string {
+			if jw == nil {
+				var extra string
+				if maxEdits > 0 {
+					extra = fmt.Sprintf("\t%d\t%s", loc.Edits, loc.CIGAR)
+				} else if pwms != nil {
+					extra = fmt.Sprintf("\t%.2f\t%.4g", loc.Score, loc.PValue)
+				}
+				return formatMotifLocation(seqID, m, loc, outFmtGTF, outFmtBED, hideMatched, extra)
+			}
+			values := []interface{}{seqID, m.Name, m.Seq, loc.Strand, loc.Begin, loc.End}
+			if !hideMatched {
+				values = append(values, loc.Matched)
+			}
+			if maxEdits > 0 {
+				values = append(values, loc.Edits, loc.CIGAR)
+			} else if pwms != nil {
+				values = append(values, loc.Score, loc.PValue)
+			}
+			row, err := jw.Row(values...)
+			checkError(err)
+			return string(row)
+		}
+		writeRow := func(row string) {
+			if jw != nil {
+				checkError(jw.WriteRaw([]byte(row)))
+				return
+			}
+			outfh.WriteString(row)
+		}
+
+		if jw == nil && !(outFmtGTF || outFmtBED) {
+			outfh.WriteString("seqID\tpatternName\tpattern\tstrand\tstart\tend")
+			if !hideMatched {
+				outfh.WriteString("\tmatched")
+			}
+			if maxEdits > 0 {
+				outfh.WriteString("\tedits\tcigar")
+			} else if pwms != nil {
+				outfh.WriteString("\tscore\tpvalue")
+			}
+			outfh.WriteString("\n")
 		}
 
 		// -------------------------------------------------------------------
-		// only for m > 0, where FMI is slow
+		// only for m > 0, where FMI is slow, and searching with edits or PWMs
 
 		var record *fastx.Record
 		var fastxReader *fastx.Reader
-		_onlyPositiveStrand := onlyPositiveStrand
 
-		if mismatches > 0 || useFMI {
+		if mismatches > 0 || useFMI || maxEdits > 0 || pwms != nil {
 			type Arecord struct {
 				id     uint64
 				ok     bool
@@ -289,7 +394,7 @@ Attentions:
 					if _id == id { // right there
 						if r.ok {
 							for _, row = range r.record {
-								outfh.WriteString(row)
+								writeRow(row)
 							}
 
 							if immediateOutput {
@@ -305,7 +410,7 @@ Attentions:
 					if _r, ok = m[id]; ok { // check buffered
 						if _r.ok {
 							for _, row = range _r.record {
-								outfh.WriteString(row)
+								writeRow(row)
 							}
 
 							if immediateOutput {
@@ -330,7 +435,7 @@ Attentions:
 
 						if _r.ok {
 							for _, row = range _r.record {
-								outfh.WriteString(row)
+								writeRow(row)
 							}
 
 							if immediateOutput {
@@ -362,9 +467,21 @@ Attentions:
 						continue
 					}
 
+					var idx *lib.SeqFMIndex
+					if fmiReader != nil {
+						idx, err = fmiReader.Read()
+						if err == io.EOF {
+							checkError(fmt.Errorf("more sequences found than those in the FM-index file: %s", fmiFile))
+						}
+						checkError(err)
+					}
+
 					if checkAlphabet {
-						if fastxReader.Alphabet() == seq.Unlimit || fastxReader.Alphabet() == seq.Protein {
-							_onlyPositiveStrand = true
+						if !opt.OnlyPositiveStrand &&
+							(fastxReader.Alphabet() == seq.Unlimit || fastxReader.Alphabet() == seq.Protein) {
+							_opt := *opt
+							_opt.OnlyPositiveStrand = true
+							opt = &_opt
 						}
 						checkAlphabet = false
 					}
@@ -372,203 +489,36 @@ Attentions:
 					tokens <- 1
 					wg.Add(1)
 					id++
-					go func(record *fastx.Record, id uint64) {
+					go func(record *fastx.Record, id uint64, opt *lib.LocateOptions, idx *lib.SeqFMIndex) {
 						defer func() {
 							wg.Done()
 							<-tokens
 						}()
 
-						var seqRP *seq.Seq
-						var l int
-						var sfmi *fmi.FMIndex
-						sfmi = fmi.NewFMIndex()
-						results := make([]string, 0, 2)
-
-						var _wg sync.WaitGroup
-						_done := make(chan int)
-						_tokens := make(chan int, config.Threads)
-						_ch := make(chan string, config.Threads)
-
-						go func() {
-							for r := range _ch {
-								results = append(results, r)
-							}
-							_done <- 1
-						}()
-
-						if !(degenerate || useRegexp) && ignoreCase {
-							record.Seq.Seq = bytes.ToLower(record.Seq.Seq)
-						}
-
-						l = len(record.Seq.Seq)
-
-						if circular { // concat two copies of sequence
-							record.Seq.Seq = append(record.Seq.Seq, record.Seq.Seq...)
-						}
-
-						_, err = sfmi.Transform(record.Seq.Seq)
-						if err != nil {
-							checkError(fmt.Errorf("fail to build FMIndex for sequence: %s", record.Name))
-						}
-
-						for pName, pSeq := range patterns {
-							_tokens <- 1
-							_wg.Add(1)
-
-							go func(pName string, pSeq []byte) {
-								loc, err := sfmi.Locate(pSeq, mismatches)
-								if err != nil {
-									checkError(fmt.Errorf("fail to search pattern '%s' on seq '%s': %s", pName, record.Name, err))
-								}
-								var begin, end int
-								for _, i := range loc {
-									if circular && i+1 > l { // 2nd clone of original part
-										continue
-									}
-
-									begin = i + 1
-
-									end = i + len(pSeq)
-									if i+len(pSeq) > len(record.Seq.Seq) {
-										continue
-									}
-									if outFmtGTF {
-										_ch <- fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\tgene_id \"%s\"; \n",
-											record.ID,
-											"SeqKit",
-											"location",
-											begin,
-											end,
-											0,
-											"+",
-											".",
-											pName)
-									} else if outFmtBED {
-										_ch <- fmt.Sprintf("%s\t%d\t%d\t%s\t%d\t%s\n",
-											record.ID,
-											begin-1,
-											end,
-											pName,
-											0,
-											"+")
-									} else {
-										if hideMatched {
-											_ch <- fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d\n",
-												record.ID,
-												pName,
-												patterns[pName],
-												"+",
-												begin,
-												end)
-										} else {
-											_ch <- fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d\t%s\n",
-												record.ID,
-												pName,
-												patterns[pName],
-												"+",
-												begin,
-												end,
-												record.Seq.Seq[i:i+len(pSeq)])
-										}
-									}
-								}
-
-								_wg.Done()
-								<-_tokens
-							}(pName, pSeq)
-						}
-
-						_wg.Wait()
-
-						if _onlyPositiveStrand {
-							close(_ch)
-							<-_done
-
-							ch <- &Arecord{record: results, id: id, ok: len(results) > 0}
-							return
-						}
-
-						var _wg2 sync.WaitGroup
-
-						seqRP = record.Seq.RevCom()
-
-						_, err = sfmi.Transform(seqRP.Seq)
-						if err != nil {
-							checkError(fmt.Errorf("fail to build FMIndex for reverse complement sequence: %s", record.Name))
+						var locs []lib.MotifLocation
+						var err error
+						if idx != nil {
+							locs, err = lib.LocateMotifsWithFMIndex(record, idx, motifs, opt)
+						} else if pwms != nil {
+							locs, err = lib.LocatePWMs(record, pwms, pwmThresholds, opt)
+						} else {
+							locs, err = lib.LocateMotifs(record, motifs, opt)
 						}
+						checkError(err)
 
-						for pName, pSeq := range patterns {
-							_tokens <- 1
-							_wg2.Add(1)
-
-							go func(pName string, pSeq []byte) {
-								loc, err := sfmi.Locate(pSeq, mismatches)
-								if err != nil {
-									checkError(fmt.Errorf("fail to search pattern '%s' on seq '%s': %s", pName, record.Name, err))
-								}
-								var begin, end int
-								for _, i := range loc {
-									if circular && i+1 > l { // 2nd clone of original part
-										continue
-									}
-
-									begin = l - i - len(pSeq) + 1
-									end = l - i
-									if i+len(pSeq) > len(record.Seq.Seq) {
-										continue
-									}
-									if outFmtGTF {
-										_ch <- fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\tgene_id \"%s\"; \n",
-											record.ID,
-											"SeqKit",
-											"location",
-											begin,
-											end,
-											0,
-											"-",
-											".",
-											pName)
-									} else if outFmtBED {
-										_ch <- fmt.Sprintf("%s\t%d\t%d\t%s\t%d\t%s\n",
-											record.ID,
-											begin-1,
-											end,
-											pName,
-											0,
-											"-")
-									} else {
-										if hideMatched {
-											_ch <- fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d\n",
-												record.ID,
-												pName,
-												patterns[pName],
-												"-",
-												begin,
-												end)
-										} else {
-											_ch <- fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d\t%s\n",
-												record.ID,
-												pName,
-												patterns[pName],
-												"-",
-												begin,
-												end,
-												seqRP.Seq[i:i+len(pSeq)])
-										}
-									}
-								}
-
-								_wg2.Done()
-								<-_tokens
-							}(pName, pSeq)
+						results := make([]string, len(locs))
+						for i := range locs {
+							results[i] = formatLoc(record.ID, motifs[motifIdx[locs[i].Motif]], &locs[i])
 						}
 
-						_wg2.Wait()
-						close(_ch)
-						<-_done
-
 						ch <- &Arecord{record: results, id: id, ok: len(results) > 0}
-					}(record.Clone(), id)
+					}(record.Clone(), id, opt, idx)
+				}
+			}
+
+			if fmiReader != nil {
+				if _, err = fmiReader.Read(); err != io.EOF {
+					checkError(fmt.Errorf("fewer sequences found than those in the FM-index file: %s", fmiFile))
 				}
 			}
 
@@ -581,25 +531,12 @@ Attentions:
 
 		// -------------------------------------------------------------------
 
-		var seqRP *seq.Seq
-		var offset, l, lpatten int
-		var loc []int
-		var locs, locsNeg [][2]int
-		var i, begin, end int
-		var flag bool
-		var pSeq, p []byte
-		var pName string
-		var re *regexp.Regexp
-		var sfmi *fmi.FMIndex
-		if mismatches > 0 || useFMI {
-			sfmi = fmi.NewFMIndex()
-		}
+		var locs []lib.MotifLocation
 
 		for _, file := range files {
 			fastxReader, err = fastx.NewReader(alphabet, file, idRegexp)
 			checkError(err)
 
-			checkAlphabet := true
 			for {
 				record, err = fastxReader.Read()
 				if err != nil {
@@ -610,357 +547,11 @@ Attentions:
 					break
 				}
 
-				if len(record.Seq.Seq) == 0 {
-					continue
-				}
-
-				if checkAlphabet {
-					if fastxReader.Alphabet() == seq.Unlimit || fastxReader.Alphabet() == seq.Protein {
-						_onlyPositiveStrand = true
-					}
-					checkAlphabet = false
-				}
-
-				if !(degenerate || useRegexp) && ignoreCase {
-					record.Seq.Seq = bytes.ToLower(record.Seq.Seq)
-				}
-
-				l = len(record.Seq.Seq)
-
-				if circular { // concat two copies of sequence
-					record.Seq.Seq = append(record.Seq.Seq, record.Seq.Seq...)
-				}
-
-				if mismatches > 0 || useFMI {
-					_, err = sfmi.Transform(record.Seq.Seq)
-					if err != nil {
-						checkError(fmt.Errorf("fail to build FMIndex for sequence: %s", record.Name))
-					}
-
-					for pName, pSeq = range patterns {
-						loc, err = sfmi.Locate(pSeq, mismatches)
-						if err != nil {
-							checkError(fmt.Errorf("fail to search pattern '%s' on seq '%s': %s", pName, record.Name, err))
-						}
-						for _, i = range loc {
-							if circular && i+1 > l { // 2nd clone of original part
-								continue
-							}
-
-							begin = i + 1
-
-							end = i + len(pSeq)
-							if i+len(pSeq) > len(record.Seq.Seq) {
-								continue
-							}
-							if outFmtGTF {
-								outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\tgene_id \"%s\"; \n",
-									record.ID,
-									"SeqKit",
-									"location",
-									begin,
-									end,
-									0,
-									"+",
-									".",
-									pName))
-							} else if outFmtBED {
-								outfh.WriteString(fmt.Sprintf("%s\t%d\t%d\t%s\t%d\t%s\n",
-									record.ID,
-									begin-1,
-									end,
-									pName,
-									0,
-									"+"))
-							} else {
-								if hideMatched {
-									outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d\n",
-										record.ID,
-										pName,
-										patterns[pName],
-										"+",
-										begin,
-										end))
-								} else {
-									outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d\t%s\n",
-										record.ID,
-										pName,
-										patterns[pName],
-										"+",
-										begin,
-										end,
-										record.Seq.Seq[i:i+len(pSeq)]))
-								}
-							}
-						}
-					}
-
-					if _onlyPositiveStrand {
-						continue
-					}
-
-					seqRP = record.Seq.RevCom()
-
-					_, err = sfmi.Transform(seqRP.Seq)
-					if err != nil {
-						checkError(fmt.Errorf("fail to build FMIndex for reverse complement sequence: %s", record.Name))
-					}
-					for pName, pSeq = range patterns {
-						loc, err = sfmi.Locate(pSeq, mismatches)
-						if err != nil {
-							checkError(fmt.Errorf("fail to search pattern '%s' on seq '%s': %s", pName, record.Name, err))
-						}
-						for _, i = range loc {
-							if circular && i+1 > l { // 2nd clone of original part
-								continue
-							}
-
-							begin = l - i - len(pSeq) + 1
-							end = l - i
-							if i+len(pSeq) > len(record.Seq.Seq) {
-								continue
-							}
-							if outFmtGTF {
-								outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\tgene_id \"%s\"; \n",
-									record.ID,
-									"SeqKit",
-									"location",
-									begin,
-									end,
-									0,
-									"-",
-									".",
-									pName))
-							} else if outFmtBED {
-								outfh.WriteString(fmt.Sprintf("%s\t%d\t%d\t%s\t%d\t%s\n",
-									record.ID,
-									begin-1,
-									end,
-									pName,
-									0,
-									"-"))
-							} else {
-								if hideMatched {
-									outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d\n",
-										record.ID,
-										pName,
-										patterns[pName],
-										"-",
-										begin,
-										end))
-								} else {
-									outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d\t%s\n",
-										record.ID,
-										pName,
-										patterns[pName],
-										"-",
-										begin,
-										end,
-										seqRP.Seq[i:i+len(pSeq)]))
-								}
-							}
-						}
-					}
-
-					if immediateOutput {
-						outfh.Flush()
-					}
-
-					continue
-				}
-
-				for pName = range patterns {
-					locs = make([][2]int, 0, 1000)
-
-					offset = 0
-					if !(useRegexp || degenerate) {
-						p = patterns[pName]
-						lpatten = len(p)
-					}
-					for {
-						if useRegexp || degenerate {
-							re = regexps[pName]
-							loc = re.FindSubmatchIndex(record.Seq.Seq[offset:])
-							if loc == nil {
-								break
-							}
-
-						} else {
-							i = bytes.Index(record.Seq.Seq[offset:], p)
-							if i < 0 {
-								break
-							}
-							loc = []int{i, i + lpatten}
-						}
-						begin = offset + loc[0] + 1
-
-						if circular && begin > l { // 2nd clone of original part
-							break
-						}
-
-						end = offset + loc[1]
-
-						flag = true // check "duplicated" region
-						if useRegexp || degenerate {
-							for i = len(locs) - 1; i >= 0; i-- {
-								if locs[i][0] <= begin && locs[i][1] >= end {
-									flag = false
-									break
-								}
-							}
-						}
-
-						if flag {
-							if outFmtGTF {
-								outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\tgene_id \"%s\"; \n",
-									record.ID,
-									"SeqKit",
-									"location",
-									begin,
-									end,
-									0,
-									"+",
-									".",
-									pName))
-							} else if outFmtBED {
-								outfh.WriteString(fmt.Sprintf("%s\t%d\t%d\t%s\t%d\t%s\n",
-									record.ID,
-									begin-1,
-									end,
-									pName,
-									0,
-									"+"))
-							} else {
-								if hideMatched {
-									outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d\n",
-										record.ID,
-										pName,
-										patterns[pName],
-										"+",
-										begin,
-										end))
-								} else {
-									outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d\t%s\n",
-										record.ID,
-										pName,
-										patterns[pName],
-										"+",
-										begin,
-										end,
-										record.Seq.Seq[begin-1:end]))
-								}
-							}
-							locs = append(locs, [2]int{begin, end})
-						}
-
-						if nonGreedy {
-							offset = offset + loc[1] + 1
-						} else {
-							offset = offset + loc[0] + 1
-						}
-						if offset >= len(record.Seq.Seq) {
-							break
-						}
-					}
-
-					if onlyPositiveStrand {
-						continue
-					}
-
-					seqRP = record.Seq.RevCom()
-
-					locsNeg = make([][2]int, 0, 1000)
-
-					offset = 0
-
-					for {
-						if useRegexp || degenerate {
-							re = regexps[pName]
-							loc = re.FindSubmatchIndex(seqRP.Seq[offset:])
-							if loc == nil {
-								break
-							}
-						} else {
-							i = bytes.Index(seqRP.Seq[offset:], p)
-							if i < 0 {
-								break
-							}
-							loc = []int{i, i + lpatten}
-						}
-
-						if circular && offset+loc[0]+1 > l { // 2nd clone of original part
-							break
-						}
-
-						begin = l - offset - loc[1] + 1
-						end = l - offset - loc[0]
-						if offset+loc[1] > l {
-							begin += l
-							end += l
-						}
-
-						flag = true
-						if useRegexp || degenerate {
-							for i = len(locsNeg) - 1; i >= 0; i-- {
-								if locsNeg[i][0] <= begin && locsNeg[i][1] >= end {
-									flag = false
-									break
-								}
-							}
-						}
-
-						if flag {
-							if outFmtGTF {
-								outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\tgene_id \"%s\"; \n",
-									record.ID,
-									"SeqKit",
-									"location",
-									begin,
-									end,
-									0,
-									"-",
-									".",
-									pName))
-							} else if outFmtBED {
-								outfh.WriteString(fmt.Sprintf("%s\t%d\t%d\t%s\t%d\t%s\n",
-									record.ID,
-									begin-1,
-									end,
-									pName,
-									0,
-									"-"))
-							} else {
-								if hideMatched {
-									outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d\n",
-										record.ID,
-										pName,
-										patterns[pName],
-										"-",
-										begin,
-										end))
-								} else {
-									outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d\t%s\n",
-										record.ID,
-										pName,
-										patterns[pName],
-										"-",
-										begin,
-										end,
-										seqRP.Seq[offset+loc[0]:offset+loc[1]]))
-								}
-							}
-							locsNeg = append(locsNeg, [2]int{begin, end})
-						}
+				locs, err = lib.LocateMotifs(record, motifs, opt)
+				checkError(err)
 
-						if nonGreedy {
-							offset = offset + loc[1] + 1
-						} else {
-							offset = offset + loc[0] + 1
-						}
-						if offset >= len(record.Seq.Seq) {
-							break
-						}
-					}
+				for i := range locs {
+					writeRow(formatLoc(record.ID, motifs[motifIdx[locs[i].Motif]], &locs[i]))
 				}
 
 				if immediateOutput {
@@ -972,6 +563,52 @@ Attentions:
 	},
 }
 
+// formatMotifLocation formats a location of motif m in a sequence
+// in GTF, BED6 or the default tabular format, extra columns (with leading
+// tabs) are appended to the tabular format.
+func formatMotifLocation(seqID []byte, m *lib.Motif, loc *lib.MotifLocation, outFmtGTF, outFmtBED, hideMatched bool, extra string) string {
+	if outFmtGTF {
+		return fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\tgene_id \"%s\"; \n",
+			seqID,
+			"SeqKit",
+			"location",
+			loc.Begin,
+			loc.End,
+			0,
+			loc.Strand,
+			".",
+			m.Name)
+	}
+	if outFmtBED {
+		return fmt.Sprintf("%s\t%d\t%d\t%s\t%d\t%s\n",
+			seqID,
+			loc.Begin-1,
+			loc.End,
+			m.Name,
+			0,
+			loc.Strand)
+	}
+	if hideMatched {
+		return fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d%s\n",
+			seqID,
+			m.Name,
+			m.Seq,
+			loc.Strand,
+			loc.Begin,
+			loc.End,
+			extra)
+	}
+	return fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d\t%s%s\n",
+		seqID,
+		m.Name,
+		m.Seq,
+		loc.Strand,
+		loc.Begin,
+		loc.End,
+		loc.Matched,
+		extra)
+}
+
 func init() {
 	RootCmd.AddCommand(locateCmd)
 
@@ -987,6 +624,11 @@ func init() {
 	locateCmd.Flags().BoolP("gtf", "", false, "output in GTF format")
 	locateCmd.Flags().BoolP("bed", "", false, "output in BED6 format")
 	locateCmd.Flags().IntP("max-mismatch", "m", 0, "max mismatch when matching by seq. For large genomes like human genome, using mapping/alignment tools would be faster")
+	locateCmd.Flags().IntP("max-edits", "", 0, "max edits (mismatches, insertions and deletions) when matching by seq, the number of edits and CIGAR are also outputted. type \"seqkit locate -h\" for details")
+	locateCmd.Flags().StringP("fmi-index", "", "", `FM-index file built by "seqkit index-fmi" from the same input files, implies -F/--use-fmi`)
+	locateCmd.Flags().StringP("pwm-file", "", "", `DNA motifs in JASPAR or MEME format, for scanning with position weight matrices. type "seqkit locate -h" for details`)
+	locateCmd.Flags().Float64P("pwm-pvalue", "", 1e-4, "p-value threshold of sites when scanning with PWMs")
+	locateCmd.Flags().Float64P("pwm-min-score", "", 0, "minimum log-odds score (in bits) of sites when scanning with PWMs, overrides --pwm-pvalue")
 	locateCmd.Flags().BoolP("hide-matched", "M", false, "do not show matched sequences")
 	locateCmd.Flags().BoolP("circular", "c", false, `circular genome. type "seqkit locate -h" for details`)
 	locateCmd.Flags().BoolP("immediate-output", "I", false, "print output immediately, do not use write buffer")
@@ -0,0 +1,203 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
+)
+
+// mergeCmd represents the merge command
+var mergeCmd = &cobra.Command{
+	Use:   "merge",
+	Short: "merge overlapping paired-end reads",
+	Long: `merge overlapping paired-end reads
+
+Read1 and the reverse complement of read2 are merged into a single read if
+they overlap by at least --min-overlap bases, with at most
+--max-mismatch-rate mismatches in the overlap. Reads are paired with the
+same strategy of "seqkit pair", from two files (-1/--read1 and -2/--read2)
+or an interleaved file (--interleaved). Unpaired reads are ignored.
+
+Attentions:
+
+  1. Overlaps are searched without gaps, and scored with the match and
+     mismatch scores of -p/--aln-params, the gap penalties are not used.
+     The overlap with the highest score is used, and the pair is
+     ambiguous if more than one overlap has the highest score, e.g.,
+     in tandem repeats.
+  2. At a mismatched position, the base with the higher quality is kept
+     with the quality of the difference of the two (at least 2), and N is
+     used for equal qualities or FASTA input. Matched bases get the higher
+     quality.
+  3. If the insert is shorter than the reads, bases beyond the insert,
+     i.e., adapters, are discarded.
+  4. Merged reads are named after read1, without the mate suffix "/1".
+     Unmerged and ambiguous pairs are saved to -O/--out-dir with the flag
+     -u/--save-unmerged.
+  5. Numbers of merged, unmerged and ambiguous pairs are reported at the end.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		alphabet := config.Alphabet
+		idRegexp := config.IDRegexp
+		outFile := config.OutFile
+		lineWidth := config.LineWidth
+		quiet := config.Quiet
+		seq.AlphabetGuessSeqLengthThreshold = config.AlphabetGuessSeqLength
+		seq.ValidateSeq = false
+		runtime.GOMAXPROCS(config.Threads)
+
+		alnParams, err := lib.ParseAlnParams(getFlagString(cmd, "aln-params"))
+		checkError(err)
+		opt := &lib.MergeOptions{
+			MinOverlap:      getFlagPositiveInt(cmd, "min-overlap"),
+			MaxMismatchRate: getFlagFloat64(cmd, "max-mismatch-rate"),
+			AlnParams:       alnParams,
+			QualBase:        getFlagPositiveInt(cmd, "qual-ascii-base"),
+		}
+		if opt.MaxMismatchRate < 0 || opt.MaxMismatchRate >= 1 {
+			checkError(fmt.Errorf("value of flag --max-mismatch-rate should be in range of [0, 1)"))
+		}
+		if alnParams.Match <= 0 || alnParams.Mismatch > 0 {
+			checkError(fmt.Errorf("the match score should be positive and the mismatch score should not be positive: %s", getFlagString(cmd, "aln-params")))
+		}
+		interleaved := getFlagBool(cmd, "interleaved")
+		saveUnmerged := getFlagBool(cmd, "save-unmerged")
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+
+		// readers
+		var reader pairWalker
+		var paired *pairedOptions
+		if interleaved {
+			if getFlagString(cmd, "read1") != "" || getFlagString(cmd, "read2") != "" {
+				checkError(fmt.Errorf("flag -1/--read1 and -2/--read2 are not allowed when using --interleaved"))
+			}
+			if len(files) > 1 {
+				checkError(errors.New("only one interleaved file is allowed"))
+			}
+			file := files[0]
+			r, err := newInterleavedReader(alphabet, file, idRegexp)
+			checkError(err)
+			reader = r
+
+			// names of read1 and read2 for the output files
+			base, suffix := filepathTrimExtension(file)
+			if isStdin(file) {
+				base, suffix = "stdin", suffixFQ
+			}
+			paired = &pairedOptions{
+				read1:     base + "_1" + suffix,
+				read2:     base + "_2" + suffix,
+				outdir:    getFlagString(cmd, "out-dir"),
+				extension: getFlagString(cmd, "extension"),
+				force:     getFlagBool(cmd, "force"),
+			}
+			if paired.outdir == "" {
+				paired.outdir = base + suffix + "." + cmd.Name()
+			}
+		} else {
+			paired = getPairedOptions(cmd, files, quiet)
+			if paired == nil {
+				checkError(fmt.Errorf("flag -1/--read1 and -2/--read2 needed, or use --interleaved for an interleaved file"))
+			}
+			reader = paired.newReader(alphabet, idRegexp)
+		}
+
+		outfh, err := xopen.Wopen(outFile)
+		checkError(err)
+		defer outfh.Close()
+
+		var writer *pairedWriter
+		if saveUnmerged {
+			writer = paired.newWriter(lineWidth)
+		}
+
+		var merged *seq.Seq
+		var r lib.MergeResult
+		var counts [3]uint64
+		var id []byte
+		checkError(reader.Walk(func(r1, r2 *fastx.Record) bool {
+			merged, r = lib.MergePair(r1.Seq, r2.Seq, opt)
+			counts[r.Status]++
+			if r.Status != lib.PairMerged {
+				if writer != nil {
+					writer.Write(r1, r2)
+				}
+				return false
+			}
+
+			id = trimMateSuffix(r1.ID)
+			record := &fastx.Record{ID: id, Name: id, Seq: merged}
+			if len(r1.Name) > len(r1.ID) {
+				record.Name = append(id[:len(id):len(id)], r1.Name[len(r1.ID):]...)
+			}
+			if len(merged.Qual) > 0 {
+				record.FormatToWriter(outfh, 0)
+			} else {
+				record.FormatToWriter(outfh, lineWidth)
+			}
+			return false
+		}))
+
+		reader.warnUnpaired()
+		if writer != nil {
+			writer.Close(quiet)
+		}
+
+		if !quiet {
+			total := counts[lib.PairMerged] + counts[lib.PairUnmerged] + counts[lib.PairAmbiguous]
+			pct := func(n uint64) float64 {
+				if total == 0 {
+					return 0
+				}
+				return float64(n) / float64(total) * 100
+			}
+			log.Infof("%d pairs processed: %d (%.2f%%) merged, %d (%.2f%%) unmerged, %d (%.2f%%) ambiguous",
+				total,
+				counts[lib.PairMerged], pct(counts[lib.PairMerged]),
+				counts[lib.PairUnmerged], pct(counts[lib.PairUnmerged]),
+				counts[lib.PairAmbiguous], pct(counts[lib.PairAmbiguous]))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(mergeCmd)
+
+	mergeCmd.Flags().IntP("min-overlap", "l", 20, "minimum overlap length")
+	mergeCmd.Flags().Float64P("max-mismatch-rate", "r", 0.1, "maximum proportion of mismatches in the overlap")
+	mergeCmd.Flags().StringP("aln-params", "p", "4,-4,-2,-1", "alignment parameters in format \"<match>,<mismatch>,<gap_open>,<gap_extend>\", gap penalties are not used")
+	mergeCmd.Flags().IntP("qual-ascii-base", "b", 33, "ASCII BASE, 33 for Phred+33")
+	mergeCmd.Flags().BoolP("interleaved", "", false, "the input is an interleaved file, given as a positional argument or from stdin")
+	mergeCmd.Flags().BoolP("save-unmerged", "u", false, "save unmerged and ambiguous pairs to -O/--out-dir")
+
+	addPairedFlags(mergeCmd, true, "", "")
+}
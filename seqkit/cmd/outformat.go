@@ -0,0 +1,189 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// output formats of tabular results, given by the global flag --out-format
+const (
+	outFormatTSV    = "tsv"
+	outFormatJSON   = "json"
+	outFormatNDJSON = "ndjson"
+)
+
+// jsonSchemaVersions are the versions of JSON/NDJSON records of commands,
+// the fields are documented in doc/docs/json.md.
+// Bump the version of a command when any field is renamed, removed,
+// or changed in meaning. Adding fields does not change the version.
+var jsonSchemaVersions = map[string]string{
+	"stats":           "1",
+	"sum":             "1",
+	"locate":          "1",
+	"amplicon":        "1",
+	"amplicon.report": "1",
+	"fish":            "1",
+	"bam.stats":       "1",
+	"bam.idxstats":    "1",
+	"bam.depth":       "1",
+	"fx2tab":          "1",
+}
+
+// getFlagOutFormat returns the value of the global flag --out-format.
+// Only commands supporting it should call this, as some commands have
+// a local flag of the same name.
+func getFlagOutFormat(cmd *cobra.Command) string {
+	format := strings.ToLower(getFlagString(cmd, "out-format"))
+	switch format {
+	case outFormatTSV, outFormatJSON, outFormatNDJSON:
+	default:
+		checkError(fmt.Errorf("invalid value of flag --out-format: %s, available values: tsv, json, ndjson", format))
+	}
+	return format
+}
+
+// jsonTableWriter writes rows of tabular result in JSON or NDJSON format.
+//
+// In JSON format, the output is a single object:
+//
+//	{"command":"stats","schema_version":"1","records":[{...},{...}]}
+//
+// In NDJSON format, each row is an object in a line, with no extra fields.
+type jsonTableWriter struct {
+	w       io.Writer
+	ndjson  bool
+	command string
+	columns []string
+
+	n   int
+	buf bytes.Buffer
+}
+
+// newJSONTableWriter creates a jsonTableWriter for a command with fixed
+// columns, the command should be a key of jsonSchemaVersions.
+func newJSONTableWriter(w io.Writer, format string, command string, columns []string) (*jsonTableWriter, error) {
+	if _, ok := jsonSchemaVersions[command]; !ok {
+		return nil, fmt.Errorf("no JSON schema version for command: %s", command)
+	}
+	return &jsonTableWriter{
+		w:       w,
+		ndjson:  format == outFormatNDJSON,
+		command: command,
+		columns: columns,
+	}, nil
+}
+
+func (t *jsonTableWriter) writeHeader() {
+	t.buf.WriteString(fmt.Sprintf(`{"command":%q,"schema_version":%q,"records":[`,
+		t.command, jsonSchemaVersions[t.command]))
+}
+
+// WriteRow writes a row, values should be in the same order of columns.
+func (t *jsonTableWriter) WriteRow(values ...interface{}) error {
+	row, err := t.Row(values...)
+	if err != nil {
+		return err
+	}
+	return t.WriteRaw(row)
+}
+
+// Row formats a row as a JSON object, which could be written later by
+// WriteRaw. It's safe for concurrent use.
+// []byte values are written as strings, NaN and Inf as null.
+func (t *jsonTableWriter) Row(values ...interface{}) ([]byte, error) {
+	if len(values) != len(t.columns) {
+		return nil, fmt.Errorf("number of values (%d) does not match that of columns (%d)", len(values), len(t.columns))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	var err error
+	var b []byte
+	for i, v := range values {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		b, _ = json.Marshal(t.columns[i])
+		buf.Write(b)
+		buf.WriteByte(':')
+
+		switch _v := v.(type) {
+		case []byte:
+			v = string(_v)
+		case float64:
+			if math.IsNaN(_v) || math.IsInf(_v, 0) {
+				v = nil
+			}
+		}
+		b, err = json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// WriteRaw writes a row formatted by Row.
+func (t *jsonTableWriter) WriteRaw(row []byte) error {
+	t.buf.Reset()
+	if !t.ndjson {
+		if t.n == 0 {
+			t.writeHeader()
+			t.buf.WriteByte('\n')
+		} else {
+			t.buf.WriteString(",\n")
+		}
+	}
+	t.buf.Write(row)
+	if t.ndjson {
+		t.buf.WriteByte('\n')
+	}
+
+	t.n++
+	_, err := t.w.Write(t.buf.Bytes())
+	return err
+}
+
+// Close finishes the JSON object, it does not close the underlying writer.
+func (t *jsonTableWriter) Close() error {
+	if t.ndjson {
+		return nil
+	}
+	t.buf.Reset()
+	if t.n == 0 {
+		t.writeHeader()
+	} else {
+		t.buf.WriteByte('\n')
+	}
+	t.buf.WriteString("]}\n")
+	_, err := t.w.Write(t.buf.Bytes())
+	return err
+}
@@ -0,0 +1,95 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestJSONTableWriter(t *testing.T) {
+	columns := []string{"file", "num_seqs", "avg_len"}
+	rows := [][]interface{}{
+		{"a.fa", 2, 1.5},
+		{[]byte("b.fa"), int64(0), math.NaN()},
+	}
+
+	tests := []struct {
+		format string
+		n      int // number of rows written
+		out    string
+	}{
+		{outFormatJSON, 2, `{"command":"stats","schema_version":"1","records":[
+{"file":"a.fa","num_seqs":2,"avg_len":1.5},
+{"file":"b.fa","num_seqs":0,"avg_len":null}
+]}
+`},
+		{outFormatJSON, 0, `{"command":"stats","schema_version":"1","records":[]}
+`},
+		{outFormatNDJSON, 2, `{"file":"a.fa","num_seqs":2,"avg_len":1.5}
+{"file":"b.fa","num_seqs":0,"avg_len":null}
+`},
+		{outFormatNDJSON, 0, ``},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		jw, err := newJSONTableWriter(&buf, test.format, "stats", columns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows[:test.n] {
+			if err = jw.WriteRow(row...); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = jw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.out {
+			t.Errorf("%s, %d rows: expected:\n%s\nreturned:\n%s", test.format, test.n, test.out, buf.String())
+		}
+		if test.format == outFormatJSON {
+			var v map[string]interface{}
+			if err = json.Unmarshal(buf.Bytes(), &v); err != nil {
+				t.Errorf("%s, %d rows: invalid JSON: %s", test.format, test.n, err)
+			}
+		}
+	}
+}
+
+func TestJSONTableWriterError(t *testing.T) {
+	if _, err := newJSONTableWriter(&bytes.Buffer{}, outFormatJSON, "unknown", []string{"a"}); err == nil {
+		t.Errorf("unknown command: error expected")
+	}
+
+	jw, err := newJSONTableWriter(&bytes.Buffer{}, outFormatJSON, "stats", []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = jw.WriteRow(1); err == nil {
+		t.Errorf("unmatched number of values: error expected")
+	}
+	if _, err = jw.Row(1, make(chan int)); err == nil {
+		t.Errorf("unsupported value: error expected")
+	}
+}
@@ -21,14 +21,11 @@
 package cmd
 
 import (
-	"bytes"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"runtime"
 
-	"github.com/cespare/xxhash/v2"
 	"github.com/pkg/errors"
 
 	"github.com/shenwei356/bio/seq"
@@ -53,6 +50,11 @@ Attentions:
    Otherwise, names are kept untouched in the given output directory.
 4. Paired gzipped files may be slightly larger than original files, because
    of using a different gzip package/library, don't worry.
+5. For an interleaved file (--interleaved), adjacent mates are paired and
+   saved to two files with the suffixes "_1" and "_2", e.g., reads_1.paired.fq.gz
+   and reads_2.paired.fq.gz for reads.fq.gz. Reads not adjacent to their mates
+   are orphans, which are saved as unpaired reads.
+6. Mate names are compared after removing the suffixes "/1" and "/2".
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		config := getConfigs(cmd)
@@ -63,17 +65,41 @@ Attentions:
 		seq.ValidateSeq = false
 		runtime.GOMAXPROCS(config.Threads)
 
-		if len(args) > 0 {
-			checkError(errors.New("no positional arguments are allowed"))
-		}
+		interleaved := getFlagBool(cmd, "interleaved")
 
 		read1 := getFlagString(cmd, "read1")
 		read2 := getFlagString(cmd, "read2")
-		if read1 == "" || read2 == "" {
-			checkError(fmt.Errorf("flag -1/--read1 and -2/--read2 needed"))
-		}
-		if read1 == read2 {
-			checkError(fmt.Errorf("values of flag -1/--read1 and -2/--read2 can not be the same"))
+
+		var file string // the interleaved file
+		if interleaved {
+			if read1 != "" || read2 != "" {
+				checkError(fmt.Errorf("flag -1/--read1 and -2/--read2 are not allowed when using --interleaved"))
+			}
+			if len(args) > 1 {
+				checkError(errors.New("only one interleaved file is allowed"))
+			}
+			file = "-"
+			if len(args) == 1 {
+				file = args[0]
+			}
+
+			// names of read1 and read2 for the output files
+			base, suffix := filepathTrimExtension(file)
+			if isStdin(file) {
+				base, suffix = "stdin", suffixFQ
+			}
+			read1, read2 = base+"_1"+suffix, base+"_2"+suffix
+		} else {
+			if len(args) > 0 {
+				checkError(errors.New("no positional arguments are allowed"))
+			}
+
+			if read1 == "" || read2 == "" {
+				checkError(fmt.Errorf("flag -1/--read1 and -2/--read2 needed"))
+			}
+			if read1 == read2 {
+				checkError(fmt.Errorf("values of flag -1/--read1 and -2/--read2 can not be the same"))
+			}
 		}
 
 		outdir := getFlagString(cmd, "out-dir")
@@ -107,15 +133,19 @@ Attentions:
 			}
 		}
 
-		var reader1, reader2 *fastx.Reader
-		var record1, record2 *fastx.Record
-
 		// readers
-		var err error
-		reader1, err = fastx.NewReader(alphabet, read1, idRegexp)
-		checkError(errors.Wrap(err, read1))
-		reader2, err = fastx.NewReader(alphabet, read2, idRegexp)
-		checkError(errors.Wrap(err, read2))
+		var reader pairWalker
+		if interleaved {
+			r, err := newInterleavedReader(alphabet, file, idRegexp)
+			checkError(err)
+			r.RequireFastq = true
+			reader = r
+		} else {
+			r, err := newPairedReader(alphabet, read1, read2, idRegexp)
+			checkError(err)
+			r.RequireFastq = true
+			reader = r
+		}
 
 		// out file 1
 		var outFile1, base1, suffix1 string
@@ -141,199 +171,46 @@ Attentions:
 		checkError(errors.Wrap(err, outFile2))
 		defer outfh2.Close()
 
-		// load first records
-		record1, err = reader1.Read()
-		checkError(errors.Wrap(err, read1))
-		record2, err = reader2.Read()
-		checkError(errors.Wrap(err, read2))
-
-		// require fastq
-		if !reader1.IsFastq || !reader2.IsFastq {
-			checkError(fmt.Errorf("fastq files needed"))
-		}
-
-		// buffer for saving unpaired reads
-		m1 := make(map[uint64]*fastx.Record, 1024)
-		m2 := make(map[uint64]*fastx.Record, 1024)
-
-		var h1, h2 uint64
-		var ok1, ok2 bool
-		var r1, r2 *fastx.Record
-		var eof1, eof2 bool
 		var n uint64
-
-		for {
-			// break when finishing reading both files.
-			if eof1 && eof2 {
-				break
-			}
-
-			// paired
-			if !eof1 && !eof2 && bytes.Equal(record1.ID, record2.ID) { // same ID
-				// output paired reads
-				record1.FormatToWriter(outfh1, lineWidth)
-				record2.FormatToWriter(outfh2, lineWidth)
-				n++
-
-				// new read1
-				if !eof1 {
-					record1, err = reader1.Read()
-					if err != nil {
-						if err == io.EOF {
-							eof1 = true
-							// break
-						} else {
-							checkError(errors.Wrap(err, read1))
-							break
-						}
-					}
-				}
-
-				// new read2
-				if !eof2 {
-					record2, err = reader2.Read()
-					if err != nil {
-						if err == io.EOF {
-							eof2 = true
-							// break
-						} else {
-							checkError(errors.Wrap(err, read2))
-							break
-						}
-					}
-				}
-
-				continue
-			}
-
-			if !eof1 {
-				h1 = xxhash.Sum64(record1.ID)
-				if r2, ok2 = m2[h1]; ok2 { // found pair of record1 in m2
-					// output paired reads
-					record1.FormatToWriter(outfh1, lineWidth)
-					r2.FormatToWriter(outfh2, lineWidth)
-					n++
-
-					delete(m2, h1)
-				} else {
-					m1[h1] = record1.Clone()
-				}
-
-				// new read1
-				record1, err = reader1.Read()
-				if err != nil {
-					if err == io.EOF {
-						eof1 = true
-						// break
-					} else {
-						checkError(errors.Wrap(err, read1))
-						break
-					}
-				}
-			}
-
-			// ---
-
-			if !eof2 {
-				h2 = xxhash.Sum64(record2.ID)
-				if r1, ok1 = m1[h2]; ok1 { // found pair of record2 in m1
-					// output paired reads
-					r1.FormatToWriter(outfh1, lineWidth)
-					record2.FormatToWriter(outfh2, lineWidth)
-					n++
-
-					delete(m1, h2)
-				} else {
-					m2[h2] = record2.Clone()
-				}
-
-				// new read2
-				record2, err = reader2.Read()
-				if err != nil {
-					if err == io.EOF {
-						eof2 = true
-						// break
-					} else {
-						checkError(errors.Wrap(err, read2))
-						break
-					}
-				}
-			}
-		}
+		checkError(reader.Walk(func(r1, r2 *fastx.Record) bool {
+			// output paired reads
+			r1.FormatToWriter(outfh1, lineWidth)
+			r2.FormatToWriter(outfh2, lineWidth)
+			n++
+			return false
+		}))
 
 		var outFile1U, outFile2U string
-		var outfh1U, outfh2U *xopen.Writer
 		var n1U, n2U uint64
 		if saveUnpaired {
 			if !addSuffix {
 				base1, suffix1 = filepathTrimExtension(filepath.Base(read1))
 				base2, suffix2 = filepathTrimExtension(filepath.Base(read2))
 			}
-		}
 
-		// left reads
-		if len(m1) > 0 && len(m2) > 0 {
-			for h1, r1 = range m1 {
-				if r2, ok2 = m2[h1]; ok2 {
-					// output paired reads
-					r1.FormatToWriter(outfh1, lineWidth)
-					r2.FormatToWriter(outfh2, lineWidth)
-					n++
+			unpaired1, unpaired2 := reader.Unpaired()
+			if len(unpaired1) > 0 {
+				outFile1U = filepath.Join(outdir, base1+".unpaired"+suffix1)
+				outfh1U, err := xopen.Wopen(outFile1U)
+				checkError(errors.Wrap(err, outFile1U))
+				defer outfh1U.Close()
 
-					if saveUnpaired { // delete paired reads in m2
-						// delete(m1, h1) // no need
-						delete(m2, h2)
-					}
-				} else if saveUnpaired { // unpaired reads in m1
-					if outfh1U == nil {
-						outFile1U = filepath.Join(outdir, base1+".unpaired"+suffix1)
-						outfh1U, err = xopen.Wopen(outFile1U)
-						checkError(errors.Wrap(err, outFile1U))
-						defer outfh1U.Close()
-					}
+				for _, r1 := range unpaired1 {
 					r1.FormatToWriter(outfh1U, lineWidth)
 					n1U++
 				}
 			}
-			if saveUnpaired {
-				for _, r2 = range m2 { // left unpaired reads in m2
-					if outfh2U == nil {
-						outFile2U = filepath.Join(outdir, base2+".unpaired"+suffix2)
-						outfh2U, err = xopen.Wopen(outFile2U)
-						checkError(errors.Wrap(err, outFile2U))
-						defer outfh2U.Close()
-					}
+			if len(unpaired2) > 0 {
+				outFile2U = filepath.Join(outdir, base2+".unpaired"+suffix2)
+				outfh2U, err := xopen.Wopen(outFile2U)
+				checkError(errors.Wrap(err, outFile2U))
+				defer outfh2U.Close()
 
+				for _, r2 := range unpaired2 {
 					r2.FormatToWriter(outfh2U, lineWidth)
 					n2U++
 				}
 			}
-		} else if len(m1) > 0 {
-			if saveUnpaired {
-				for _, r1 = range m1 { // all reads in m1 are unpaired
-					if outfh1U == nil {
-						outFile1U = filepath.Join(outdir, base1+".unpaired"+suffix1)
-						outfh1U, err = xopen.Wopen(outFile1U)
-						checkError(errors.Wrap(err, outFile1U))
-						defer outfh1U.Close()
-					}
-
-					r1.FormatToWriter(outfh1U, lineWidth)
-					n1U++
-				}
-			}
-		} else if saveUnpaired { // len(m2) > 0
-			for _, r2 = range m2 { // all reads in m2 are unpaired
-				if outfh2U == nil {
-					outFile2U = filepath.Join(outdir, base2+".unpaired"+suffix2)
-					outfh2U, err = xopen.Wopen(outFile2U)
-					checkError(errors.Wrap(err, outFile2U))
-					defer outfh2U.Close()
-				}
-
-				r2.FormatToWriter(outfh2U, lineWidth)
-				n2U++
-			}
 		}
 
 		if !config.Quiet {
@@ -364,4 +241,5 @@ func init() {
 	pairCmd.Flags().StringP("out-dir", "O", "", "output directory")
 	pairCmd.Flags().BoolP("force", "f", false, "overwrite output directory")
 	pairCmd.Flags().BoolP("save-unpaired", "u", false, "save unpaired reads if there are")
+	pairCmd.Flags().BoolP("interleaved", "", false, "the input is an interleaved file, given as a positional argument or from stdin")
 }
@@ -0,0 +1,596 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/pkg/errors"
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/util/pathutil"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// pairWalker reads pairs of mates, from two files or an interleaved file.
+type pairWalker interface {
+	// Walk calls fn for every pair of reads, and stops when fn returns true.
+	// The records may be reused, clone them if they are needed after fn returns.
+	Walk(fn func(r1, r2 *fastx.Record) bool) error
+	// Unpaired returns reads without mates, it should be called after Walk.
+	Unpaired() ([]*fastx.Record, []*fastx.Record)
+	// IsFastq tells whether the input is in FASTQ format.
+	IsFastq() bool
+	// warnUnpaired reports the number of unpaired reads ignored.
+	warnUnpaired()
+}
+
+// pairedReader reads paired-end reads from two files with the strategy of
+// "seqkit pair": mates with the same ID (ignoring the suffixes "/1" and "/2")
+// are paired, and reads in different orders are buffered in memory until
+// their mates show up.
+type pairedReader struct {
+	file1, file2     string
+	reader1, reader2 *fastx.Reader
+
+	// RequireFastq makes Walk return an error for FASTA files.
+	RequireFastq bool
+
+	// unpaired reads, available after Walk finishes
+	unpaired1, unpaired2 map[uint64]*bufferedRead
+}
+
+// bufferedRead is a read waiting for its mate, idx is the order in file
+// for outputting left reads in a stable order.
+type bufferedRead struct {
+	record *fastx.Record
+	idx    uint64
+}
+
+func newPairedReader(alphabet *seq.Alphabet, file1, file2, idRegexp string) (*pairedReader, error) {
+	reader1, err := fastx.NewReader(alphabet, file1, idRegexp)
+	if err != nil {
+		return nil, errors.Wrap(err, file1)
+	}
+	reader2, err := fastx.NewReader(alphabet, file2, idRegexp)
+	if err != nil {
+		return nil, errors.Wrap(err, file2)
+	}
+	return &pairedReader{file1: file1, file2: file2, reader1: reader1, reader2: reader2}, nil
+}
+
+// IsFastq tells whether both files are in FASTQ format,
+// it's only valid after the first pair is read.
+func (p *pairedReader) IsFastq() bool {
+	return p.reader1.IsFastq && p.reader2.IsFastq
+}
+
+// Alphabet returns the alphabet of read1.
+func (p *pairedReader) Alphabet() *seq.Alphabet {
+	return p.reader1.Alphabet()
+}
+
+// Walk calls fn for every pair of reads, and stops when fn returns true.
+// The records may be reused by the readers, clone them if they are needed
+// after fn returns.
+func (p *pairedReader) Walk(fn func(r1, r2 *fastx.Record) bool) error {
+	var record1, record2 *fastx.Record
+	var eof1, eof2 bool
+	var err error
+
+	read := func(reader *fastx.Reader, file string) (*fastx.Record, bool, error) {
+		record, err := reader.Read()
+		if err != nil {
+			if err == io.EOF {
+				return nil, true, nil
+			}
+			return nil, false, errors.Wrap(err, file)
+		}
+		return record, false, nil
+	}
+
+	// load first records
+	if record1, eof1, err = read(p.reader1, p.file1); err != nil {
+		return err
+	}
+	if record2, eof2, err = read(p.reader2, p.file2); err != nil {
+		return err
+	}
+
+	if p.RequireFastq && !p.IsFastq() {
+		return fmt.Errorf("fastq files needed")
+	}
+	if p.IsFastq() {
+		fastx.ForcelyOutputFastq = true
+	}
+
+	// buffer for saving unpaired reads
+	m1 := make(map[uint64]*bufferedRead, 1024)
+	m2 := make(map[uint64]*bufferedRead, 1024)
+	p.unpaired1, p.unpaired2 = m1, m2
+
+	var h1, h2 uint64
+	var ok bool
+	var b *bufferedRead
+	var idx1, idx2 uint64
+
+	for {
+		// break when finishing reading both files.
+		if eof1 && eof2 {
+			break
+		}
+
+		// paired
+		if !eof1 && !eof2 && bytes.Equal(trimMateSuffix(record1.ID), trimMateSuffix(record2.ID)) { // same ID
+			if fn(record1, record2) {
+				return nil
+			}
+
+			if record1, eof1, err = read(p.reader1, p.file1); err != nil {
+				return err
+			}
+			if record2, eof2, err = read(p.reader2, p.file2); err != nil {
+				return err
+			}
+			idx1++
+			idx2++
+			continue
+		}
+
+		if !eof1 {
+			h1 = xxhash.Sum64(trimMateSuffix(record1.ID))
+			if b, ok = m2[h1]; ok { // found pair of record1 in m2
+				delete(m2, h1)
+				if fn(record1, b.record) {
+					return nil
+				}
+			} else {
+				m1[h1] = &bufferedRead{record: record1.Clone(), idx: idx1}
+			}
+
+			if record1, eof1, err = read(p.reader1, p.file1); err != nil {
+				return err
+			}
+			idx1++
+		}
+
+		// ---
+
+		if !eof2 {
+			h2 = xxhash.Sum64(trimMateSuffix(record2.ID))
+			if b, ok = m1[h2]; ok { // found pair of record2 in m1
+				delete(m1, h2)
+				if fn(b.record, record2) {
+					return nil
+				}
+			} else {
+				m2[h2] = &bufferedRead{record: record2.Clone(), idx: idx2}
+			}
+
+			if record2, eof2, err = read(p.reader2, p.file2); err != nil {
+				return err
+			}
+			idx2++
+		}
+	}
+
+	// left reads
+	if len(m1) > 0 && len(m2) > 0 {
+		for _, h1 = range sortedBufferedReads(m1) {
+			if b, ok = m2[h1]; ok {
+				r1 := m1[h1].record
+				delete(m1, h1)
+				delete(m2, h1)
+				if fn(r1, b.record) {
+					return nil
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Unpaired returns reads without mates in the two files, in their orders
+// in the files. It should be called after Walk.
+func (p *pairedReader) Unpaired() ([]*fastx.Record, []*fastx.Record) {
+	list := func(m map[uint64]*bufferedRead) []*fastx.Record {
+		records := make([]*fastx.Record, 0, len(m))
+		for _, h := range sortedBufferedReads(m) {
+			records = append(records, m[h].record)
+		}
+		return records
+	}
+	return list(p.unpaired1), list(p.unpaired2)
+}
+
+// warnUnpaired reports the numbers of unpaired reads ignored in paired-end mode.
+func (p *pairedReader) warnUnpaired() {
+	u1, u2 := p.Unpaired()
+	if len(u1) > 0 {
+		log.Warningf("%d unpaired reads ignored in %s", len(u1), p.file1)
+	}
+	if len(u2) > 0 {
+		log.Warningf("%d unpaired reads ignored in %s", len(u2), p.file2)
+	}
+}
+
+// trimMateSuffix removes the mate suffix "/1" or "/2" of a read ID.
+func trimMateSuffix(id []byte) []byte {
+	if n := len(id); n > 2 && id[n-2] == '/' && (id[n-1] == '1' || id[n-1] == '2') {
+		return id[:n-2]
+	}
+	return id
+}
+
+// mateNumber returns the mate number (1 or 2) of a read, given by the ID
+// suffix "/1" or "/2", or the Illumina comment like "1:N:0:ATCACG".
+// It returns 0 if unknown.
+func mateNumber(record *fastx.Record) int {
+	id := record.ID
+	if n := len(id); n > 2 && id[n-2] == '/' && (id[n-1] == '1' || id[n-1] == '2') {
+		return int(id[n-1] - '0')
+	}
+
+	if i := bytes.IndexAny(record.Name, " \t"); i >= 0 {
+		c := bytes.TrimLeft(record.Name[i+1:], " \t")
+		if len(c) >= 4 && (c[0] == '1' || c[0] == '2') && c[1] == ':' &&
+			(c[2] == 'Y' || c[2] == 'N') && c[3] == ':' {
+			return int(c[0] - '0')
+		}
+	}
+	return 0
+}
+
+// mateProblem checks whether r1 and r2 are read1 and read2 of the same
+// fragment, and returns the problem, or an empty string if they are.
+func mateProblem(r1, r2 *fastx.Record) string {
+	if !bytes.Equal(trimMateSuffix(r1.ID), trimMateSuffix(r2.ID)) {
+		return fmt.Sprintf("names of mates do not match: %s, %s", r1.ID, r2.ID)
+	}
+	m1, m2 := mateNumber(r1), mateNumber(r2)
+	if m1 == 2 || m2 == 1 {
+		return fmt.Sprintf("unexpected mate numbers of %s: %d, %d", r1.ID, m1, m2)
+	}
+	return ""
+}
+
+// interleavedReader reads pairs of mates from an interleaved file, where
+// read2 follows read1 of the same fragment. A read not adjacent to its mate
+// is an orphan, orphans are saved for Unpaired unless Strict is true.
+type interleavedReader struct {
+	file   string
+	reader *fastx.Reader
+
+	// RequireFastq makes Walk return an error for FASTA files.
+	RequireFastq bool
+	// Strict makes Walk return an error for the first orphan.
+	Strict bool
+
+	orphans1, orphans2 []*fastx.Record
+}
+
+func newInterleavedReader(alphabet *seq.Alphabet, file, idRegexp string) (*interleavedReader, error) {
+	reader, err := fastx.NewReader(alphabet, file, idRegexp)
+	if err != nil {
+		return nil, errors.Wrap(err, file)
+	}
+	return &interleavedReader{file: file, reader: reader}, nil
+}
+
+// IsFastq tells whether the file is in FASTQ format,
+// it's only valid after the first pair is read.
+func (p *interleavedReader) IsFastq() bool {
+	return p.reader.IsFastq
+}
+
+// Alphabet returns the alphabet of the file.
+func (p *interleavedReader) Alphabet() *seq.Alphabet {
+	return p.reader.Alphabet()
+}
+
+// Walk calls fn for every pair of reads, and stops when fn returns true.
+// The records may be reused by the reader, clone them if they are needed
+// after fn returns.
+func (p *interleavedReader) Walk(fn func(r1, r2 *fastx.Record) bool) error {
+	var record, pending *fastx.Record
+	var err error
+	var n int // number of records
+	var problem string
+	first := true
+	for {
+		record, err = p.reader.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return errors.Wrap(err, p.file)
+		}
+		n++
+
+		if first {
+			if p.RequireFastq && !p.reader.IsFastq {
+				return fmt.Errorf("fastq files needed")
+			}
+			if p.reader.IsFastq {
+				fastx.ForcelyOutputFastq = true
+			}
+			first = false
+		}
+
+		if pending == nil {
+			pending = record.Clone()
+			continue
+		}
+
+		if problem = mateProblem(pending, record); problem == "" {
+			if fn(pending, record) {
+				return nil
+			}
+			pending = nil
+			continue
+		}
+
+		if p.Strict {
+			return errors.Wrap(fmt.Errorf("record #%d and #%d are not mates, %s", n-1, n, problem), p.file)
+		}
+		p.addOrphan(pending)
+		pending = record.Clone()
+	}
+
+	if pending != nil {
+		if p.Strict {
+			return errors.Wrap(fmt.Errorf("the last record #%d has no mate", n), p.file)
+		}
+		p.addOrphan(pending)
+	}
+	return nil
+}
+
+func (p *interleavedReader) addOrphan(record *fastx.Record) {
+	if mateNumber(record) == 2 {
+		p.orphans2 = append(p.orphans2, record)
+	} else {
+		p.orphans1 = append(p.orphans1, record)
+	}
+}
+
+// Unpaired returns orphan reads of read1 and read2, where reads with
+// unknown mate numbers are treated as read1. It should be called after Walk.
+func (p *interleavedReader) Unpaired() ([]*fastx.Record, []*fastx.Record) {
+	return p.orphans1, p.orphans2
+}
+
+// warnUnpaired reports the number of orphan reads ignored.
+func (p *interleavedReader) warnUnpaired() {
+	if n := len(p.orphans1) + len(p.orphans2); n > 0 {
+		log.Warningf("%d orphan reads ignored in %s", n, p.file)
+	}
+}
+
+// sortedBufferedReads returns keys of buffered reads in their orders in file.
+func sortedBufferedReads(m map[uint64]*bufferedRead) []uint64 {
+	keys := make([]uint64, 0, len(m))
+	for h := range m {
+		keys = append(keys, h)
+	}
+	sort.Slice(keys, func(i, j int) bool { return m[keys[i]].idx < m[keys[j]].idx })
+	return keys
+}
+
+// pairedOptions holds the options of the paired-end mode of filter commands,
+// including seq, grep, rmdup, sample and range.
+type pairedOptions struct {
+	read1, read2 string
+	outdir       string
+	extension    string
+	force        bool
+
+	// both means a predicate on a pair is true only if it's true on both mates,
+	// otherwise it's true if any mate satisfies it.
+	both bool
+}
+
+// addPairedFlags adds flags of the paired-end mode. Flags -1 and -2 are not
+// available if shorthand is false. The flag --pair-filter is added if
+// defaultPairFilter is not empty.
+func addPairedFlags(c *cobra.Command, shorthand bool, defaultPairFilter string, pairFilterUsage string) {
+	if shorthand {
+		c.Flags().StringP("read1", "1", "", "(gzipped) read1 file, for paired-end mode")
+		c.Flags().StringP("read2", "2", "", "(gzipped) read2 file, for paired-end mode")
+	} else {
+		c.Flags().StringP("read1", "", "", "(gzipped) read1 file, for paired-end mode")
+		c.Flags().StringP("read2", "", "", "(gzipped) read2 file, for paired-end mode")
+	}
+	c.Flags().StringP("out-dir", "O", "", "output directory of paired-end mode (default value is $read1.<command>)")
+	c.Flags().StringP("extension", "e", "", `set output file extension of paired-end mode, e.g., ".gz", ".xz", or ".zst"`)
+	c.Flags().BoolP("force", "", false, "overwrite output directory of paired-end mode")
+	if defaultPairFilter != "" {
+		c.Flags().StringP("pair-filter", "", defaultPairFilter, pairFilterUsage)
+	}
+}
+
+// getPairedOptions returns the options of paired-end mode, or nil if
+// -1/--read1 and -2/--read2 are not given.
+func getPairedOptions(cmd *cobra.Command, files []string, quiet bool) *pairedOptions {
+	read1 := getFlagString(cmd, "read1")
+	read2 := getFlagString(cmd, "read2")
+	if read1 == "" && read2 == "" {
+		return nil
+	}
+	if read1 == "" || read2 == "" {
+		checkError(fmt.Errorf("flag -1/--read1 and -2/--read2 should be both given for paired-end mode"))
+	}
+	if read1 == read2 {
+		checkError(fmt.Errorf("values of flag -1/--read1 and -2/--read2 can not be the same"))
+	}
+	if isStdin(read1) || isStdin(read2) {
+		checkError(fmt.Errorf("stdin is not supported in paired-end mode"))
+	}
+	if !quiet && !(len(files) == 1 && isStdin(files[0])) {
+		log.Infof("flag -1/--read1 and -2/--read2 given, ignore: %s", strings.Join(files, ", "))
+	}
+
+	o := &pairedOptions{
+		read1:     read1,
+		read2:     read2,
+		outdir:    getFlagString(cmd, "out-dir"),
+		extension: getFlagString(cmd, "extension"),
+		force:     getFlagBool(cmd, "force"),
+	}
+	if o.outdir == "" {
+		o.outdir = read1 + "." + cmd.Name()
+	}
+	if cmd.Flags().Lookup("pair-filter") != nil {
+		switch pairFilter := strings.ToLower(getFlagString(cmd, "pair-filter")); pairFilter {
+		case "any":
+		case "both":
+			o.both = true
+		default:
+			checkError(fmt.Errorf("invalid value of flag --pair-filter: %s, available values: any, both", pairFilter))
+		}
+	}
+	return o
+}
+
+// test applies the result of a predicate on the two mates.
+func (o *pairedOptions) test(ok1, ok2 bool) bool {
+	if o.both {
+		return ok1 && ok2
+	}
+	return ok1 || ok2
+}
+
+// outFile returns the output file of an input file, named the same
+// way as split2: the base name and extension of the input file are kept,
+// with the extension of -e/--extension replacing the compression one.
+func (o *pairedOptions) outFile(file string) string {
+	fileName, fileExt, fileExt2 := filepathTrimExtension2(file, nil)
+	if o.extension != "" {
+		fileExt += o.extension
+	} else {
+		fileExt += fileExt2
+	}
+	return filepath.Join(o.outdir, filepath.Base(fileName)+fileExt)
+}
+
+// newReader creates a pairedReader of the two input files.
+func (o *pairedOptions) newReader(alphabet *seq.Alphabet, idRegexp string) *pairedReader {
+	reader, err := newPairedReader(alphabet, o.read1, o.read2, idRegexp)
+	checkError(err)
+	return reader
+}
+
+// newWriter creates the output directory and a pairedWriter.
+func (o *pairedOptions) newWriter(lineWidth int) *pairedWriter {
+	outFile1, outFile2 := o.outFile(o.read1), o.outFile(o.read2)
+	if outFile1 == outFile2 {
+		checkError(fmt.Errorf("read1 and read2 files have the same output file: %s, please rename them", outFile1))
+	}
+	for _, pair := range [][2]string{{o.read1, outFile1}, {o.read2, outFile2}} {
+		if sameFile(pair[0], pair[1]) {
+			checkError(fmt.Errorf("output file would overwrite the input file: %s, please change -O/--out-dir", pair[0]))
+		}
+	}
+
+	pwd, _ := os.Getwd()
+	if o.outdir != "./" && o.outdir != "." && pwd != filepath.Clean(o.outdir) {
+		existed, err := pathutil.DirExists(o.outdir)
+		checkError(err)
+		if existed {
+			empty, err := pathutil.IsEmpty(o.outdir)
+			checkError(err)
+			if !empty {
+				if o.force {
+					checkError(os.RemoveAll(o.outdir))
+					checkError(os.MkdirAll(o.outdir, 0755))
+				} else {
+					log.Warningf("outdir not empty: %s, you can use --force to overwrite", o.outdir)
+				}
+			}
+		} else {
+			checkError(os.MkdirAll(o.outdir, 0755))
+		}
+	}
+
+	outfh1, err := xopen.Wopen(outFile1)
+	checkError(errors.Wrap(err, outFile1))
+	outfh2, err := xopen.Wopen(outFile2)
+	checkError(errors.Wrap(err, outFile2))
+
+	return &pairedWriter{
+		file1:     outFile1,
+		file2:     outFile2,
+		outfh1:    outfh1,
+		outfh2:    outfh2,
+		lineWidth: lineWidth,
+	}
+}
+
+// sameFile tells whether the two paths point to the same existing file.
+func sameFile(a, b string) bool {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	fb, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fa, fb)
+}
+
+// pairedWriter writes paired-end reads into two synchronized files.
+type pairedWriter struct {
+	file1, file2   string
+	outfh1, outfh2 *xopen.Writer
+	lineWidth      int
+
+	N uint64 // number of pairs written
+}
+
+// Write writes a pair of reads.
+func (w *pairedWriter) Write(r1, r2 *fastx.Record) {
+	lineWidth := w.lineWidth
+	if len(r1.Seq.Qual) > 0 || len(r2.Seq.Qual) > 0 {
+		lineWidth = 0
+	}
+	r1.FormatToWriter(w.outfh1, lineWidth)
+	r2.FormatToWriter(w.outfh2, lineWidth)
+	w.N++
+}
+
+// Close closes the two files and reports the result.
+func (w *pairedWriter) Close(quiet bool) {
+	checkError(w.outfh1.Close())
+	checkError(w.outfh2.Close())
+	if !quiet {
+		log.Infof("%d paired-end reads saved to %s and %s", w.N, w.file1, w.file2)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/spf13/cobra"
+)
+
+// writeTestFile writes a file in dir and returns its path.
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestPairedReader(t *testing.T) {
+	dir := t.TempDir()
+	// r2 and r3 are in different orders, r4 has no mate in read2,
+	// and r5 has no mate in read1.
+	file1 := writeTestFile(t, dir, "r_1.fq", "@r1/1\nA\n+\nI\n@r2/1\nC\n+\nI\n@r3/1\nG\n+\nI\n@r4/1\nT\n+\nI\n")
+	file2 := writeTestFile(t, dir, "r_2.fq", "@r1/2\nAA\n+\nII\n@r3/2\nGG\n+\nII\n@r5/2\nTT\n+\nII\n@r2/2\nCC\n+\nII\n")
+
+	reader, err := newPairedReader(seq.DNAredundant, file1, file2, fastx.DefaultIDRegexp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pairs []string
+	err = reader.Walk(func(r1, r2 *fastx.Record) bool {
+		pairs = append(pairs, string(r1.ID)+","+string(r2.ID))
+		return false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "r1/1,r1/2 r3/1,r3/2 r2/1,r2/2"
+	if s := strings.Join(pairs, " "); s != expected {
+		t.Errorf("pairs: expected %s, returned %s", expected, s)
+	}
+	if !reader.IsFastq() {
+		t.Errorf("FASTQ files expected")
+	}
+
+	u1, u2 := reader.Unpaired()
+	if ids := strings.Join(recordIDs(u1), ","); ids != "r4/1" {
+		t.Errorf("unpaired reads of read1: expected r4/1, returned %s", ids)
+	}
+	if ids := strings.Join(recordIDs(u2), ","); ids != "r5/2" {
+		t.Errorf("unpaired reads of read2: expected r5/2, returned %s", ids)
+	}
+
+	// stop early
+	reader, err = newPairedReader(seq.DNAredundant, file1, file2, fastx.DefaultIDRegexp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	err = reader.Walk(func(r1, r2 *fastx.Record) bool {
+		n++
+		return true
+	})
+	if err != nil || n != 1 {
+		t.Errorf("stop early: expected 1 pair, returned %d (%v)", n, err)
+	}
+
+	// FASTQ required
+	fa1 := writeTestFile(t, dir, "a_1.fa", ">r1/1\nA\n")
+	fa2 := writeTestFile(t, dir, "a_2.fa", ">r1/2\nA\n")
+	reader, err = newPairedReader(seq.DNAredundant, fa1, fa2, fastx.DefaultIDRegexp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.RequireFastq = true
+	if err = reader.Walk(func(r1, r2 *fastx.Record) bool { return false }); err == nil {
+		t.Errorf("FASTA files: error expected")
+	}
+}
+
+func TestPairedOptions(t *testing.T) {
+	tests := []struct {
+		both     bool
+		ok1, ok2 bool
+		ok       bool
+	}{
+		{false, true, false, true},
+		{false, false, false, false},
+		{true, true, false, false},
+		{true, true, true, true},
+	}
+	for _, test := range tests {
+		o := &pairedOptions{both: test.both}
+		if ok := o.test(test.ok1, test.ok2); ok != test.ok {
+			t.Errorf("both: %v, mates: %v, %v: expected %v, returned %v", test.both, test.ok1, test.ok2, test.ok, ok)
+		}
+	}
+
+	files := []struct {
+		extension string
+		file, out string
+	}{
+		{"", "data/reads_1.fq.gz", filepath.Join("out", "reads_1.fq.gz")},
+		{".xz", "data/reads_1.fq.gz", filepath.Join("out", "reads_1.fq.xz")},
+		{".gz", "reads_2.fastq", filepath.Join("out", "reads_2.fastq.gz")},
+	}
+	for _, f := range files {
+		o := &pairedOptions{outdir: "out", extension: f.extension}
+		if out := o.outFile(f.file); out != f.out {
+			t.Errorf("output file of %s with extension %q: expected %s, returned %s", f.file, f.extension, f.out, out)
+		}
+	}
+}
+
+func TestAddPairedFlags(t *testing.T) {
+	c := &cobra.Command{Use: "test"}
+	addPairedFlags(c, true, "any", "")
+	if f := c.Flags().ShorthandLookup("2"); f == nil || f.Name != "read2" {
+		t.Errorf("shorthand -2 of --read2 expected")
+	}
+	if c.Flags().Lookup("pair-filter") == nil {
+		t.Errorf("flag --pair-filter expected")
+	}
+
+	// like sample, where -2 is used by --two-pass
+	c = &cobra.Command{Use: "test"}
+	c.Flags().BoolP("two-pass", "2", false, "")
+	addPairedFlags(c, false, "", "")
+	if c.Flags().Lookup("read2") == nil {
+		t.Errorf("flag --read2 expected")
+	}
+	if f := c.Flags().ShorthandLookup("2"); f == nil || f.Name != "two-pass" {
+		t.Errorf("shorthand -2 should be kept for --two-pass")
+	}
+	if c.Flags().Lookup("pair-filter") != nil {
+		t.Errorf("unexpected flag --pair-filter")
+	}
+}
+
+func TestDupRemoverPair(t *testing.T) {
+	tests := []struct {
+		name   string
+		revcom bool
+		pairs  [][2]string // sequences of mates
+		dups   []bool
+	}{
+		{"same pairs", false, [][2]string{{"AAC", "GGT"}, {"AAC", "GGT"}, {"AAC", "GGA"}}, []bool{false, true, false}},
+		{"only one mate duplicated", false, [][2]string{{"AAC", "GGT"}, {"AAC", "TTT"}}, []bool{false, false}},
+		{"swapped mates, positive strand", false, [][2]string{{"AAC", "GGT"}, {"GGT", "AAC"}}, []bool{false, false}},
+		{"swapped mates, both strands", true, [][2]string{{"AAC", "GGT"}, {"GGT", "AAC"}}, []bool{false, true}},
+	}
+	for _, test := range tests {
+		d := newDupRemover(true, false, false, test.revcom, false)
+		for i, p := range test.pairs {
+			dup := d.isDupPair(testRecord("r", p[0], ""), testRecord("r", p[1], ""))
+			if dup != test.dups[i] {
+				t.Errorf("%s: pair #%d: expected %v, returned %v", test.name, i+1, test.dups[i], dup)
+			}
+		}
+	}
+}
@@ -0,0 +1,783 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/breader"
+	"github.com/shenwei356/bwt"
+	"github.com/shenwei356/bwt/fmi"
+	"github.com/shenwei356/xopen"
+	syaml "github.com/smallfish/simpleyaml"
+	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
+)
+
+// pipeCmd represents the pipe command
+var pipeCmd = &cobra.Command{
+	Use:   "pipe",
+	Short: "chain seq/grep/replace/rmdup/sample/range/translate/stats in one process",
+	Long: `chain seq/grep/replace/rmdup/sample/range/translate/stats in one process
+
+Records are passed between stages in memory, which saves the cost of
+parsing and formatting FASTA/Q between commands in a shell pipeline.
+
+The recipe is a YAML list of stages, which are executed in order.
+Parameters of a stage are named after the flags of the corresponding
+command in CamelCase, e.g., "--min-len" of seq is "MinLen".
+Use "-r help" to list all stages.
+
+A recipe could also be stored in a file, and given by "-r 'Yaml: recipe.yaml'".
+
+Example:
+
+    seqkit pipe reads.fq.gz -o clean.fq.gz -r '
+    - Seq:
+        MinLen: 100
+        MinQual: 20
+    - Grep:
+        Patterns: [ACGTACGT]
+        BySeq: true
+        InvertMatch: true
+    - Rmdup:
+        BySeq: true
+    - Stats:
+        Tsv: stats.tsv
+    '
+
+Parameters of stages:
+
+    Seq:       RemoveGaps, GapLetters, MinLen, MaxLen, QualAsciiBase,
+               MinQual, MaxQual, Reverse, Complement, Dna2Rna, Rna2Dna,
+               LowerCase, UpperCase
+    Grep:      Patterns, PatternFile, UseRegexp, ByName, BySeq,
+               OnlyPositiveStrand, MaxMismatch, IgnoreCase, Degenerate,
+               Region, Circular, InvertMatch, DeleteMatched
+    Replace:   Pattern, Replacement, BySeq, IgnoreCase, NrWidth, KvFile,
+               KeepUntouch, KeepKey, KeyCaptIdx, KeyMissRepl
+    Rmdup:     ByName, BySeq, IgnoreCase, OnlyPositiveStrand, DupSeqsFile,
+               DupNumFile
+    Sample:    Proportion, Number, RandSeed
+    Range:     Range
+    Translate: TranslTable, Frames, Trim, Clean, AllowUnknownCodon,
+               InitCodonAsM, AppendFrame
+    Stats:     All, GapLetters, FqEncoding, Label, Tsv ("-" for stderr)
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		seq.AlphabetGuessSeqLengthThreshold = config.AlphabetGuessSeqLength
+		seq.ValidateSeq = false
+		runtime.GOMAXPROCS(config.Threads)
+
+		recipe := getFlagString(cmd, "recipe")
+		if recipe == "" {
+			checkError(fmt.Errorf("flag -r (--recipe) needed"))
+		}
+
+		var files []string
+		if recipe != "help" {
+			files = getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		}
+
+		Pipe(recipe, files, config)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(pipeCmd)
+
+	pipeCmd.Flags().StringP("recipe", "r", "", `stages in YAML format, type "seqkit pipe -h" for details, "help" for listing stages`)
+}
+
+// PipeStage is a record-level stage of pipe.
+type PipeStage struct {
+	Name string
+	Desc string
+	Use  func(params *PipeStageParams)
+}
+
+// PipeStageParams contains the parameters and channels of a stage.
+// A stage should close OutChan after all records from InChan are processed.
+type PipeStageParams struct {
+	Yaml    *syaml.Yaml
+	InChan  chan *fastx.Record
+	OutChan chan *fastx.Record
+	Config  Config
+	Rank    int
+	Stages  PipeStages
+}
+
+// PipeStages maps stage names to stages.
+type PipeStages map[string]PipeStage
+
+func (s PipeStages) String() string {
+	stages := make([]string, 0, len(s))
+	for t := range s {
+		stages = append(stages, t)
+	}
+	sort.Strings(stages)
+	res := "Stage\tDescription\n"
+	res += "-----\t-----------\n"
+	for _, t := range stages {
+		res += fmt.Sprintf("%s\t%s\n", s[t].Name, s[t].Desc)
+	}
+	return res
+}
+
+// NewPipeStages returns all available stages.
+func NewPipeStages() PipeStages {
+	return map[string]PipeStage{
+		"Seq":       PipeStage{Name: "Seq", Desc: "filter by length/quality and transform sequences like 'seqkit seq'", Use: PipeStageSeq},
+		"Grep":      PipeStage{Name: "Grep", Desc: "search by ID/name/sequence like 'seqkit grep'", Use: PipeStageGrep},
+		"Replace":   PipeStage{Name: "Replace", Desc: "replace name/sequence by regular expression like 'seqkit replace'", Use: PipeStageReplace},
+		"Rmdup":     PipeStage{Name: "Rmdup", Desc: "remove duplicated records like 'seqkit rmdup'", Use: PipeStageRmdup},
+		"Sample":    PipeStage{Name: "Sample", Desc: "sample records by number or proportion like 'seqkit sample'", Use: PipeStageSample},
+		"Range":     PipeStage{Name: "Range", Desc: "keep records in a range like 'seqkit range'", Use: PipeStageRange},
+		"Translate": PipeStage{Name: "Translate", Desc: "translate DNA/RNA to protein like 'seqkit translate'", Use: PipeStageTranslate},
+		"Stats":     PipeStage{Name: "Stats", Desc: "compute statistics of passing records like 'seqkit stats -T'", Use: PipeStageStats},
+		"help":      PipeStage{Name: "help", Desc: "list all stages with description", Use: ListPipeStages},
+	}
+}
+
+// NewFastxReaderChan reads records from files into a channel,
+// the channel is closed after all files are read.
+func NewFastxReaderChan(files []string, alphabet *seq.Alphabet, idRegexp string, cp int) chan *fastx.Record {
+	outChan := make(chan *fastx.Record, cp)
+	go func() {
+		var record *fastx.Record
+		for _, file := range files {
+			fastxReader, err := fastx.NewReader(alphabet, file, idRegexp)
+			checkError(err)
+			for {
+				record, err = fastxReader.Read()
+				if err != nil {
+					if err == io.EOF {
+						break
+					}
+					checkError(err)
+					break
+				}
+				outChan <- record.Clone()
+			}
+		}
+		close(outChan)
+	}()
+	return outChan
+}
+
+// NewFastxWriterChan writes records from the returned channel to outFile,
+// FASTQ records are not wrapped.
+func NewFastxWriterChan(outFile string, lineWidth int, cp int) (chan *fastx.Record, chan bool) {
+	outChan := make(chan *fastx.Record, cp)
+	doneChan := make(chan bool)
+	outfh, err := xopen.Wopen(outFile)
+	checkError(err)
+	go func() {
+		for record := range outChan {
+			record.FormatToWriter(outfh, pipeLineWidth(record, lineWidth))
+		}
+		checkError(outfh.Close())
+		doneChan <- true
+	}()
+	return outChan, doneChan
+}
+
+func pipeLineWidth(record *fastx.Record, lineWidth int) int {
+	if len(record.Seq.Qual) > 0 {
+		return 0
+	}
+	return lineWidth
+}
+
+// Pipe runs the stages in recipe on records of files.
+func Pipe(recipe string, files []string, config Config) {
+	if recipe == "help" {
+		recipe = "- help"
+	}
+	y, err := syaml.NewYaml([]byte(recipe))
+	checkError(err)
+	if y.IsMap() {
+		conf, err := y.Get("Yaml").String()
+		if err != nil {
+			checkError(fmt.Errorf("pipe: the recipe should be a list of stages, or a map with the key 'Yaml'"))
+		}
+		cb, err := ioutil.ReadFile(conf)
+		checkError(err)
+		y, err = syaml.NewYaml(cb)
+		checkError(err)
+	}
+
+	n, err := y.GetArraySize()
+	if err != nil {
+		checkError(fmt.Errorf("pipe: the recipe should be a list of stages"))
+	}
+	if n == 0 {
+		checkError(fmt.Errorf("pipe: no stages specified"))
+	}
+
+	chanCap := 5000
+
+	shed := NewPipeStages()
+	stages := make([]PipeStage, n)
+	params := make([]*syaml.Yaml, n)
+	for i := 0; i < n; i++ {
+		item := y.GetIndex(i)
+		var name string
+		if name, err = item.String(); err != nil { // stage with parameters
+			keys, err := item.GetMapKeys()
+			if err != nil || len(keys) != 1 {
+				checkError(fmt.Errorf("pipe: stage #%d should be a stage name or a map with a single stage name as key", i+1))
+			}
+			name = keys[0]
+		}
+		stage, ok := shed[name]
+		if !ok {
+			checkError(fmt.Errorf("pipe: unknown stage: %s", name))
+		}
+		stages[i] = stage
+		params[i] = item.Get(name)
+	}
+
+	var inChan, lastOut chan *fastx.Record
+	var doneChan chan bool
+	if stages[0].Name != "help" {
+		inChan = NewFastxReaderChan(files, config.Alphabet, config.IDRegexp, chanCap)
+		lastOut, doneChan = NewFastxWriterChan(config.OutFile, config.LineWidth, chanCap)
+	}
+
+	nextIn, nextOut := inChan, make(chan *fastx.Record, chanCap)
+	for rank, stage := range stages {
+		if rank == n-1 {
+			nextOut = lastOut
+		}
+		p := &PipeStageParams{
+			Yaml:    params[rank],
+			InChan:  nextIn,
+			OutChan: nextOut,
+			Config:  config,
+			Rank:    rank,
+			Stages:  shed,
+		}
+		if stage.Name == "help" {
+			stage.Use(p)
+		}
+		nextIn = nextOut
+		nextOut = make(chan *fastx.Record, chanCap)
+		go stage.Use(p)
+	}
+	<-doneChan
+}
+
+// ListPipeStages prints all stages and exits.
+func ListPipeStages(p *PipeStageParams) {
+	os.Stderr.WriteString(p.Stages.String())
+	os.Exit(0)
+}
+
+// pipeParams reads parameters of a stage, missing ones take the default values.
+type pipeParams struct {
+	stage string
+	y     *syaml.Yaml
+}
+
+func newPipeParams(stage string, p *PipeStageParams) pipeParams {
+	return pipeParams{stage: stage, y: p.Yaml}
+}
+
+func (p pipeParams) invalid(key string, t string) {
+	checkError(fmt.Errorf("pipe: %s: value of %s should be %s", p.stage, key, t))
+}
+
+func (p pipeParams) Bool(key string, def bool) bool {
+	v := p.y.Get(key)
+	if !v.IsFound() {
+		return def
+	}
+	b, err := v.Bool()
+	if err != nil {
+		p.invalid(key, "a boolean")
+	}
+	return b
+}
+
+func (p pipeParams) Int(key string, def int) int {
+	v := p.y.Get(key)
+	if !v.IsFound() {
+		return def
+	}
+	i, err := v.Int()
+	if err != nil {
+		p.invalid(key, "an integer")
+	}
+	return i
+}
+
+func (p pipeParams) Float(key string, def float64) float64 {
+	v := p.y.Get(key)
+	if !v.IsFound() {
+		return def
+	}
+	if i, err := v.Int(); err == nil {
+		return float64(i)
+	}
+	f, err := v.Float()
+	if err != nil {
+		p.invalid(key, "a number")
+	}
+	return f
+}
+
+func (p pipeParams) String(key string, def string) string {
+	v := p.y.Get(key)
+	if !v.IsFound() {
+		return def
+	}
+	s, err := v.String()
+	if err != nil {
+		p.invalid(key, "a string")
+	}
+	return s
+}
+
+// Strings accepts a single value or a list.
+func (p pipeParams) Strings(key string) []string {
+	v := p.y.Get(key)
+	if !v.IsFound() {
+		return nil
+	}
+	arr, err := v.Array()
+	if err != nil {
+		if s, err := v.String(); err == nil {
+			return []string{s}
+		}
+		if i, err := v.Int(); err == nil {
+			return []string{fmt.Sprintf("%d", i)}
+		}
+		p.invalid(key, "a string or a list")
+	}
+	list := make([]string, len(arr))
+	for i, a := range arr {
+		list[i] = fmt.Sprintf("%v", a)
+	}
+	return list
+}
+
+// PipeStageSeq filters and transforms records like seq.
+func PipeStageSeq(p *PipeStageParams) {
+	pp := newPipeParams("Seq", p)
+	t := &seqTransformer{
+		removeGaps: pp.Bool("RemoveGaps", false),
+		gapLetters: pp.String("GapLetters", "- \t."),
+		minLen:     pp.Int("MinLen", -1),
+		maxLen:     pp.Int("MaxLen", -1),
+		qBase:      pp.Int("QualAsciiBase", 33),
+		minQual:    pp.Float("MinQual", -1),
+		maxQual:    pp.Float("MaxQual", -1),
+		reverse:    pp.Bool("Reverse", false),
+		complement: pp.Bool("Complement", false),
+		dna2rna:    pp.Bool("Dna2Rna", false),
+		rna2dna:    pp.Bool("Rna2Dna", false),
+		lowerCase:  pp.Bool("LowerCase", false),
+		upperCase:  pp.Bool("UpperCase", false),
+	}
+	if t.minLen >= 0 && t.maxLen >= 0 && t.minLen > t.maxLen {
+		checkError(fmt.Errorf("pipe: Seq: value of MinLen should be <= value of MaxLen"))
+	}
+	if t.minQual >= 0 && t.maxQual >= 0 && t.minQual > t.maxQual {
+		checkError(fmt.Errorf("pipe: Seq: value of MinQual should be <= value of MaxQual"))
+	}
+	if t.lowerCase && t.upperCase {
+		checkError(fmt.Errorf("pipe: Seq: could not give both LowerCase and UpperCase"))
+	}
+
+	for record := range p.InChan {
+		if !t.keep(record) {
+			continue
+		}
+		record.Seq = t.revcom(record.Seq)
+		t.convert(record.Seq, record.Seq.Alphabet)
+		p.OutChan <- record
+	}
+	close(p.OutChan)
+}
+
+// PipeStageGrep keeps records matched by patterns like grep.
+func PipeStageGrep(p *PipeStageParams) {
+	pp := newPipeParams("Grep", p)
+	m := &grepMatcher{
+		byName:             pp.Bool("ByName", false),
+		bySeq:              pp.Bool("BySeq", false),
+		useRegexp:          pp.Bool("UseRegexp", false),
+		degenerate:         pp.Bool("Degenerate", false),
+		ignoreCase:         pp.Bool("IgnoreCase", false),
+		onlyPositiveStrand: pp.Bool("OnlyPositiveStrand", false),
+		circular:           pp.Bool("Circular", false),
+		invertMatch:        pp.Bool("InvertMatch", false),
+		deleteMatched:      pp.Bool("DeleteMatched", false),
+		mismatches:         pp.Int("MaxMismatch", 0),
+
+		patternsR: make(map[uint64]*regexp.Regexp, 1<<10),
+		patternsN: make(map[uint64]interface{}, 1<<10),
+		patternsS: make([][]byte, 0, 16),
+	}
+	if m.mismatches < 0 {
+		checkError(fmt.Errorf("pipe: Grep: value of MaxMismatch should not be negative"))
+	}
+	if m.useRegexp && m.degenerate {
+		checkError(fmt.Errorf("pipe: Grep: could not give both Degenerate and UseRegexp"))
+	}
+	if m.mismatches > 0 && (m.useRegexp || m.degenerate) {
+		checkError(fmt.Errorf("pipe: Grep: UseRegexp or Degenerate not allowed when giving MaxMismatch"))
+	}
+	if m.degenerate || m.mismatches > 0 {
+		m.bySeq = true
+	}
+	if region := pp.String("Region", ""); region != "" {
+		var err error
+		m.start, m.end, err = parseGrepRegion(region)
+		checkError(err)
+		m.limitRegion = true
+		m.bySeq = true
+	}
+
+	patterns := pp.Strings("Patterns")
+	if patternFile := pp.String("PatternFile", ""); patternFile != "" {
+		reader, err := breader.NewDefaultBufferedReader(patternFile)
+		checkError(err)
+		for chunk := range reader.Ch {
+			checkError(chunk.Err)
+			for _, data := range chunk.Data {
+				patterns = append(patterns, data.(string))
+			}
+		}
+	}
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		checkError(m.addPattern(pattern, p.Config.Alphabet))
+	}
+	if m.numPatterns() == 0 {
+		checkError(fmt.Errorf("pipe: Grep: no patterns given by Patterns or PatternFile"))
+	}
+
+	var sfmi *fmi.FMIndex
+	if m.mismatches > 0 {
+		bwt.CheckEndSymbol = false
+		sfmi = fmi.NewFMIndex()
+	}
+
+	checkAlphabet := true
+	for record := range p.InChan {
+		if len(record.Seq.Seq) == 0 {
+			continue
+		}
+		if checkAlphabet {
+			m.checkAlphabet(record.Seq.Alphabet)
+			checkAlphabet = false
+		}
+		ok, err := m.match(record, sfmi)
+		checkError(err)
+		if ok {
+			p.OutChan <- record
+		}
+	}
+	close(p.OutChan)
+}
+
+// PipeStageReplace replaces names or sequences like replace.
+func PipeStageReplace(p *PipeStageParams) {
+	pp := newPipeParams("Replace", p)
+	pattern := pp.String("Pattern", "")
+	if pattern == "" {
+		checkError(fmt.Errorf("pipe: Replace: Pattern needed"))
+	}
+	r := &nameReplacer{
+		replacement: []byte(pp.String("Replacement", "")),
+		bySeq:       pp.Bool("BySeq", false),
+		ignoreCase:  pp.Bool("IgnoreCase", false),
+		nrFormat:    fmt.Sprintf("%%0%dd", pp.Int("NrWidth", 1)),
+		keyCaptIdx:  pp.Int("KeyCaptIdx", 1),
+		keepKey:     pp.Bool("KeepKey", false),
+		keepUntouch: pp.Bool("KeepUntouch", false),
+		keyMissRepl: pp.String("KeyMissRepl", ""),
+	}
+	if r.ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	var err error
+	r.pattern, err = regexp.Compile(pattern)
+	checkError(err)
+
+	r.replaceWithNR = reNR.Match(r.replacement)
+	if reKV.Match(r.replacement) {
+		if r.bySeq {
+			checkError(fmt.Errorf("pipe: Replace: replaceing with key-value pairs was not supported for sequence"))
+		}
+		kvFile := pp.String("KvFile", "")
+		if kvFile == "" {
+			checkError(fmt.Errorf(`pipe: Replace: KvFile needed for replacement symbol "{kv}"`))
+		}
+		r.kvs, err = readKVs(kvFile, r.ignoreCase)
+		checkError(err)
+		r.replaceWithKV = true
+	}
+
+	var nr int
+	for record := range p.InChan {
+		if r.bySeq && len(record.Seq.Qual) > 0 {
+			checkError(fmt.Errorf("pipe: Replace: editing FASTQ is not supported"))
+		}
+		nr++
+		checkError(r.replace(record, nr))
+		p.OutChan <- record
+	}
+	close(p.OutChan)
+}
+
+// PipeStageRmdup removes duplicated records like rmdup.
+func PipeStageRmdup(p *PipeStageParams) {
+	pp := newPipeParams("Rmdup", p)
+	bySeq := pp.Bool("BySeq", false)
+	byName := pp.Bool("ByName", false)
+	revcom := !pp.Bool("OnlyPositiveStrand", false)
+	dupFile := pp.String("DupSeqsFile", "")
+	numFile := pp.String("DupNumFile", "")
+	if bySeq && byName {
+		checkError(fmt.Errorf("pipe: Rmdup: only one/none of BySeq and ByName is allowed"))
+	}
+	if !revcom && !bySeq {
+		checkError(fmt.Errorf("pipe: Rmdup: BySeq needed when using OnlyPositiveStrand"))
+	}
+
+	d := newDupRemover(bySeq, byName, pp.Bool("IgnoreCase", false), revcom, numFile != "")
+
+	var outfhDup *xopen.Writer
+	var err error
+	if dupFile != "" {
+		outfhDup, err = xopen.Wopen(dupFile)
+		checkError(err)
+	}
+
+	for record := range p.InChan {
+		if d.isDup(record) {
+			if outfhDup != nil {
+				record.FormatToWriter(outfhDup, pipeLineWidth(record, p.Config.LineWidth))
+			}
+			continue
+		}
+		p.OutChan <- record
+	}
+
+	if outfhDup != nil {
+		checkError(outfhDup.Close())
+	}
+	if d.removed > 0 && numFile != "" {
+		outfhNum, err := xopen.Wopen(numFile)
+		checkError(err)
+		d.writeDupNum(outfhNum)
+		checkError(outfhNum.Close())
+	}
+	if !p.Config.Quiet {
+		log.Infof("pipe: Rmdup: %d duplicated records removed", d.removed)
+	}
+	close(p.OutChan)
+}
+
+// PipeStageSample samples records like sample.
+// Sampling by number keeps all records in memory.
+func PipeStageSample(p *PipeStageParams) {
+	pp := newPipeParams("Sample", p)
+	number := pp.Int("Number", 0)
+	proportion := pp.Float("Proportion", 0)
+	if number == 0 && proportion == 0 {
+		checkError(fmt.Errorf("pipe: Sample: one of Number and Proportion needed"))
+	}
+	if number < 0 {
+		checkError(fmt.Errorf("pipe: Sample: value of Number should be greater than 0"))
+	}
+	if proportion < 0 || proportion > 1 {
+		checkError(fmt.Errorf("pipe: Sample: value of Proportion (%f) should be in range of (0, 1]", proportion))
+	}
+
+	s := newRecordSampler(int64(pp.Int("RandSeed", 11)), proportion)
+
+	if number == 0 {
+		for record := range p.InChan {
+			if s.keep() {
+				p.OutChan <- record
+			}
+		}
+		close(p.OutChan)
+		return
+	}
+
+	records := make([]*fastx.Record, 0, 1024)
+	for record := range p.InChan {
+		records = append(records, record)
+	}
+	s.proportion = float64(number) / float64(len(records))
+	var n int
+	for _, record := range records {
+		if s.keep() {
+			p.OutChan <- record
+			n++
+			if n == number {
+				break
+			}
+		}
+	}
+	close(p.OutChan)
+}
+
+// PipeStageRange keeps records in a range like range.
+func PipeStageRange(p *PipeStageParams) {
+	pp := newPipeParams("Range", p)
+	rangeStr := pp.String("Range", "")
+	if rangeStr == "" {
+		checkError(fmt.Errorf("pipe: Range: Range needed"))
+	}
+	start, end, err := parseRecordRange(rangeStr)
+	checkError(err)
+
+	r := newRecordRange(start, end)
+	var stopped bool
+	for record := range p.InChan {
+		if stopped { // drain the channel
+			continue
+		}
+		ok, stop := r.push(record)
+		if stop {
+			stopped = true
+			continue
+		}
+		if ok {
+			p.OutChan <- record
+		}
+	}
+	for _, record := range r.tail() {
+		p.OutChan <- record
+	}
+	close(p.OutChan)
+}
+
+// PipeStageTranslate translates records like translate.
+func PipeStageTranslate(p *PipeStageParams) {
+	pp := newPipeParams("Translate", p)
+	t := &translator{
+		table:             pp.Int("TranslTable", 1),
+		trim:              pp.Bool("Trim", false),
+		clean:             pp.Bool("Clean", false),
+		allowUnknownCodon: pp.Bool("AllowUnknownCodon", false),
+		markInitCodonAsM:  pp.Bool("InitCodonAsM", false),
+		appendFrame:       pp.Bool("AppendFrame", false),
+	}
+	if _, ok := seq.CodonTables[t.table]; !ok {
+		checkError(fmt.Errorf("pipe: Translate: invalid translate table: %d", t.table))
+	}
+	frames := pp.Strings("Frames")
+	if len(frames) == 0 {
+		frames = []string{"1"}
+	}
+	var err error
+	t.frames, err = parseTranslateFrames(frames)
+	checkError(err)
+
+	var proteins []*fastx.Record
+	for record := range p.InChan {
+		proteins, err = t.translate(record)
+		if err == seq.ErrUnknownCodon {
+			checkError(fmt.Errorf("pipe: Translate: unknown codon detected in %s, you can set AllowUnknownCodon to translate it to 'X'", record.ID))
+		}
+		checkError(err)
+		for _, protein := range proteins {
+			p.OutChan <- protein
+		}
+	}
+	close(p.OutChan)
+}
+
+// statsTeeReader passes records to the next stage while reading them.
+type statsTeeReader struct {
+	in, out  chan *fastx.Record
+	alphabet *seq.Alphabet
+}
+
+func (r *statsTeeReader) Read() (*fastx.Record, error) {
+	record, ok := <-r.in
+	if !ok {
+		return nil, io.EOF
+	}
+	if r.alphabet == nil {
+		r.alphabet = record.Seq.Alphabet
+	}
+	r.out <- record
+	return record, nil
+}
+
+func (r *statsTeeReader) Alphabet() *seq.Alphabet {
+	if r.alphabet == nil {
+		return seq.Unlimit
+	}
+	return r.alphabet
+}
+
+// PipeStageStats computes statistics of records passing through it
+// like "stats -T", the result is written after all records are passed.
+func PipeStageStats(p *PipeStageParams) {
+	pp := newPipeParams("Stats", p)
+	all := pp.Bool("All", false)
+	opt := &lib.StatsOptions{
+		All:        all,
+		GapLetters: []byte(pp.String("GapLetters", "- .")),
+		FqEncoding: parseQualityEncoding(pp.String("FqEncoding", "sanger")),
+	}
+	label := pp.String("Label", fmt.Sprintf("stage%d", p.Rank+1))
+
+	var tsvFh io.WriteCloser = os.Stderr
+	if tsvFile := pp.String("Tsv", "-"); tsvFile != "-" {
+		fh, err := xopen.Wopen(tsvFile)
+		checkError(err)
+		tsvFh = fh
+	}
+
+	stats, err := lib.ComputeStats(&statsTeeReader{in: p.InChan, out: p.OutChan}, opt)
+	checkError(err)
+
+	// the result is written before closing the output channel, as Pipe only
+	// waits for the writer, which exits once all channels are closed.
+	io.WriteString(tsvFh, statTabularHeader(all))
+	io.WriteString(tsvFh, statTabularRow(newStatInfo(label, stats, 0), all))
+	if tsvFh != os.Stderr {
+		checkError(tsvFh.Close())
+	}
+	close(p.OutChan)
+}
@@ -0,0 +1,207 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	syaml "github.com/smallfish/simpleyaml"
+)
+
+// testRecord creates a record, with qualities if qual is not empty.
+func testRecord(id, s, qual string) *fastx.Record {
+	if qual == "" {
+		r, _ := fastx.NewRecordWithoutValidation(seq.DNAredundant, []byte(id), []byte(id), []byte{}, []byte(s))
+		return r
+	}
+	r, _ := fastx.NewRecordWithQualWithoutValidation(seq.DNAredundant, []byte(id), []byte(id), []byte{}, []byte(s), []byte(qual))
+	return r
+}
+
+// recordIDs returns IDs of records.
+func recordIDs(records []*fastx.Record) []string {
+	ids := make([]string, len(records))
+	for i, r := range records {
+		ids[i] = string(r.ID)
+	}
+	return ids
+}
+
+func TestPipeParams(t *testing.T) {
+	y, err := syaml.NewYaml([]byte(`
+Bool: true
+Int: 5
+Float: 0.5
+FloatInt: 2
+String: "ACGT"
+List: [1, "a"]
+Single: abc
+SingleInt: 3
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newPipeParams("Test", &PipeStageParams{Yaml: y})
+
+	if !p.Bool("Bool", false) || !p.Bool("Missing", true) {
+		t.Errorf("Bool: unexpected value")
+	}
+	if v := p.Int("Int", 0); v != 5 {
+		t.Errorf("Int: expected 5, returned %d", v)
+	}
+	if v := p.Int("Missing", -1); v != -1 {
+		t.Errorf("Int: expected default value -1, returned %d", v)
+	}
+	if v := p.Float("Float", 0); v != 0.5 {
+		t.Errorf("Float: expected 0.5, returned %f", v)
+	}
+	if v := p.Float("FloatInt", 0); v != 2 {
+		t.Errorf("Float of integer: expected 2, returned %f", v)
+	}
+	if v := p.String("String", ""); v != "ACGT" {
+		t.Errorf("String: expected ACGT, returned %s", v)
+	}
+
+	tests := []struct {
+		key    string
+		values []string
+	}{
+		{"List", []string{"1", "a"}},
+		{"Single", []string{"abc"}},
+		{"SingleInt", []string{"3"}},
+		{"Missing", nil},
+	}
+	for _, test := range tests {
+		if v := p.Strings(test.key); !reflect.DeepEqual(v, test.values) {
+			t.Errorf("Strings: %s: expected %v, returned %v", test.key, test.values, v)
+		}
+	}
+}
+
+// runPipeStages chains stages given in YAML like Pipe, and returns
+// the output records.
+func runPipeStages(t *testing.T, recipe string, records []*fastx.Record) []*fastx.Record {
+	y, err := syaml.NewYaml([]byte(recipe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages := NewPipeStages()
+
+	in := make(chan *fastx.Record, len(records))
+	for _, r := range records {
+		in <- r
+	}
+	close(in)
+
+	n, _ := y.GetArraySize()
+	for i := 0; i < n; i++ {
+		names, err := y.GetIndex(i).GetMapKeys()
+		if err != nil || len(names) != 1 {
+			t.Fatalf("invalid stage: %d", i+1)
+		}
+		out := make(chan *fastx.Record, len(records))
+		go stages[names[0]].Use(&PipeStageParams{
+			Yaml:    y.GetIndex(i).Get(names[0]),
+			InChan:  in,
+			OutChan: out,
+			Config:  Config{Quiet: true, LineWidth: 60},
+			Rank:    i,
+			Stages:  stages,
+		})
+		in = out
+	}
+
+	var result []*fastx.Record
+	for r := range in {
+		result = append(result, r)
+	}
+	return result
+}
+
+func TestPipeStages(t *testing.T) {
+	records := func() []*fastx.Record {
+		return []*fastx.Record{
+			testRecord("r1", "ACGTACGT", ""),
+			testRecord("r2", "ACG", ""),
+			testRecord("r3", "ACGTACGTAA", ""),
+			testRecord("r4", "TTGCA", ""),
+			testRecord("r1", "ACGTAAAA", ""),
+			testRecord("r5", "GGGGGGGG", ""),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		recipe string
+		ids    []string
+	}{
+		{"Seq", "- Seq: {MinLen: 5}", []string{"r1", "r3", "r4", "r1", "r5"}},
+		{"Seq, Rmdup", "- Seq: {MinLen: 5}\n- Rmdup: {}", []string{"r1", "r3", "r4", "r5"}},
+		{"Rmdup, Range", "- Rmdup: {}\n- Range: {Range: \"2:3\"}", []string{"r2", "r3"}},
+		{"Range of last records", "- Range: {Range: \"-2:-1\"}", []string{"r1", "r5"}},
+		{"Grep by sequence", "- Grep: {BySeq: true, Patterns: ACGTA, OnlyPositiveStrand: true}", []string{"r1", "r3", "r1"}},
+		{"Seq, Grep, Range", "- Seq: {MaxLen: 8}\n- Grep: {Patterns: [r1, r5]}\n- Range: {Range: \"1:2\"}", []string{"r1", "r1"}},
+		{"Sample", "- Sample: {Proportion: 1}", []string{"r1", "r2", "r3", "r4", "r1", "r5"}},
+	}
+	for _, test := range tests {
+		ids := recordIDs(runPipeStages(t, test.recipe, records()))
+		if strings.Join(ids, ",") != strings.Join(test.ids, ",") {
+			t.Errorf("%s: expected %v, returned %v", test.name, test.ids, ids)
+		}
+	}
+
+	// sequences are transformed
+	result := runPipeStages(t, "- Seq: {Reverse: true, Complement: true, LowerCase: true}", []*fastx.Record{testRecord("r", "AACGT", "")})
+	if len(result) != 1 || string(result[0].Seq.Seq) != "acgtt" {
+		t.Errorf("Seq: unexpected sequence: %v", result)
+	}
+}
+
+func TestParseRecordRange(t *testing.T) {
+	tests := []struct {
+		s          string
+		start, end int
+		ok         bool
+	}{
+		{"1:10", 1, 10, true},
+		{"-10:-1", -10, -1, true},
+		{"5:-1", 5, -1, true},
+		{"0:10", 0, 0, false},
+		{"-1:10", 0, 0, false},
+		{"-1:-10", 0, 0, false},
+		{"5:-2", 0, 0, false},
+		{"a:b", 0, 0, false},
+	}
+	for _, test := range tests {
+		start, end, err := parseRecordRange(test.s)
+		if test.ok != (err == nil) {
+			t.Errorf("%s: unexpected error: %v", test.s, err)
+			continue
+		}
+		if test.ok && (start != test.start || end != test.end) {
+			t.Errorf("%s: expected %d:%d, returned %d:%d", test.s, test.start, test.end, start, end)
+		}
+	}
+}
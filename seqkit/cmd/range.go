@@ -49,6 +49,10 @@ Examples:
   4. other ranges:
       seqkit range -r 10:100
       seqkit range -r -100:-10
+  5. paired-end reads, saved to two synchronized files in -O/--out-dir.
+     reads are paired with the same strategy of "seqkit pair",
+     and unpaired reads are ignored.
+      seqkit range -r 1:100 -1 read_1.fq.gz -2 read_2.fq.gz
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -66,66 +70,27 @@ Examples:
 		if rangeStr == "" {
 			checkError(fmt.Errorf("flag -r (--range) needed"))
 		}
-		if !reRegion.MatchString(rangeStr) {
-			checkError(fmt.Errorf(`invalid range: %s. type "seqkit range -h" for more examples`, rangeStr))
-		}
-		var start, end int
-		var err error
-		r := strings.Split(rangeStr, ":")
-		start, err = strconv.Atoi(r[0])
-		checkError(err)
-		end, err = strconv.Atoi(r[1])
+		start, end, err := parseRecordRange(rangeStr)
 		checkError(err)
-		if start == 0 || end == 0 {
-			checkError(fmt.Errorf("either start and end should not be 0"))
-		}
-		if start < 0 && end > 0 {
-			checkError(fmt.Errorf("when start < 0, end should not > 0"))
-		}
-		if start < 0 && end < 0 && start > end {
-			checkError(fmt.Errorf("when start < 0 and end < 0, start should be < end"))
-		}
-		if start > 0 && end < 0 && end != -1 {
-			checkError(fmt.Errorf("not supported range: %d:%d, the end needs to be -1 when start > 0 and end < 0", start, end))
-		}
 		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
 
+		if paired := getPairedOptions(cmd, files, config.Quiet); paired != nil {
+			rangePaired(paired, start, end, alphabet, idRegexp, lineWidth, config.Quiet)
+			return
+		}
+
 		outfh, err := xopen.Wopen(outFile)
 		checkError(err)
 		defer outfh.Close()
 
-		var n int
-		var bufSize int
-		var buf *RecordLoopBuffer
-		if start < 0 && end < 0 {
-			bufSize = -start
-		}
-
-		var rangePP bool
-		if start > 0 && end > 0 {
-			rangePP = true
-		}
-		var rangePN bool
-		if start > 0 && end == -1 {
-			rangePN = true
-		}
-		var rangeNN bool
-		if start < 0 && end < 0 {
-			rangeNN = true
-		}
-
+		var rr *recordRange
 		var record *fastx.Record
 		var fastxReader *fastx.Reader
 		for _, file := range files {
 			fastxReader, err = fastx.NewReader(alphabet, file, idRegexp)
 			checkError(err)
 
-			if start < 0 && end < 0 {
-				buf, err = NewRecordLoopBuffer(bufSize)
-				checkError(err)
-			}
-
-			n = 0
+			rr = newRecordRange(start, end)
 			for {
 				record, err = fastxReader.Read()
 				if err != nil {
@@ -141,51 +106,17 @@ Examples:
 					fastx.ForcelyOutputFastq = true
 				}
 
-				n++
-
-				if rangePP {
-					if n < start {
-						continue
-					}
-					if n > end {
-						break
-					}
-					record.FormatToWriter(outfh, config.LineWidth)
-					continue
+				ok, stop := rr.push(record)
+				if stop {
+					break
 				}
-
-				if rangePN {
-					if n < start {
-						continue
-					}
+				if ok {
 					record.FormatToWriter(outfh, config.LineWidth)
-					continue
-				}
-
-				if rangeNN {
-					buf.Add(record.Clone())
 				}
 			}
 
-			if rangeNN {
-				current0 := buf.Current
-				buf.Backward(-end - 1)
-				tail := buf.Current
-				// fmt.Println(current0, tail, buf.Size, buf.Capacity)
-				buf.Current = current0
-				var nextNode *RecordNode
-				for {
-					nextNode = buf.Next()
-					if nextNode == nil {
-						break
-					}
-
-					nextNode.Value.FormatToWriter(outfh, config.LineWidth)
-
-					if nextNode == tail {
-						break
-					}
-				}
+			for _, record = range rr.tail() {
+				record.FormatToWriter(outfh, config.LineWidth)
 			}
 
 			config.LineWidth = lineWidth
@@ -197,6 +128,130 @@ func init() {
 	RootCmd.AddCommand(rangeCmd)
 
 	rangeCmd.Flags().StringP("range", "r", "", `range. e.g., 1:12 for first 12 records (head -n 12), -12:-1 for last 12 records (tail -n 12)`)
+
+	addPairedFlags(rangeCmd, true, "", "")
+}
+
+// rangePaired selects paired-end reads in a range of pairs.
+func rangePaired(o *pairedOptions, start, end int, alphabet *seq.Alphabet, idRegexp string, lineWidth int, quiet bool) {
+	reader := o.newReader(alphabet, idRegexp)
+	writer := o.newWriter(lineWidth)
+
+	rr1, rr2 := newRecordRange(start, end), newRecordRange(start, end)
+	var stopped bool
+	checkError(reader.Walk(func(r1, r2 *fastx.Record) bool {
+		ok, stop := rr1.push(r1)
+		rr2.push(r2)
+		if stop {
+			stopped = true
+			return true
+		}
+		if ok {
+			writer.Write(r1, r2)
+		}
+		return false
+	}))
+
+	tail2 := rr2.tail()
+	for i, r1 := range rr1.tail() {
+		writer.Write(r1, tail2[i])
+	}
+
+	if !stopped {
+		reader.warnUnpaired()
+	}
+	writer.Close(quiet)
+}
+
+// parseRecordRange parses and checks a range of records, e.g., 1:12, -12:-1.
+func parseRecordRange(rangeStr string) (int, int, error) {
+	if !reRegion.MatchString(rangeStr) {
+		return 0, 0, fmt.Errorf(`invalid range: %s. type "seqkit range -h" for more examples`, rangeStr)
+	}
+	r := strings.Split(rangeStr, ":")
+	start, err := strconv.Atoi(r[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := strconv.Atoi(r[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	if start == 0 || end == 0 {
+		return 0, 0, fmt.Errorf("either start and end should not be 0")
+	}
+	if start < 0 && end > 0 {
+		return 0, 0, fmt.Errorf("when start < 0, end should not > 0")
+	}
+	if start < 0 && end < 0 && start > end {
+		return 0, 0, fmt.Errorf("when start < 0 and end < 0, start should be < end")
+	}
+	if start > 0 && end < 0 && end != -1 {
+		return 0, 0, fmt.Errorf("not supported range: %d:%d, the end needs to be -1 when start > 0 and end < 0", start, end)
+	}
+	return start, end, nil
+}
+
+// recordRange selects records in a range checked by parseRecordRange,
+// it's shared by range and the Range stage of pipe.
+type recordRange struct {
+	start, end int
+	n          int
+	buf        *RecordLoopBuffer // for ranges with negative start and end
+}
+
+func newRecordRange(start, end int) *recordRange {
+	r := &recordRange{start: start, end: end}
+	if start < 0 && end < 0 {
+		r.buf, _ = NewRecordLoopBuffer(-start)
+	}
+	return r
+}
+
+// push tells whether the record is in the range, and whether the following
+// records could be skipped. Records of ranges with negative start and end
+// are buffered and returned by tail.
+func (r *recordRange) push(record *fastx.Record) (ok bool, stop bool) {
+	r.n++
+
+	if r.buf != nil {
+		r.buf.Add(record.Clone())
+		return false, false
+	}
+	if r.n < r.start {
+		return false, false
+	}
+	if r.end > 0 && r.n > r.end {
+		return false, true
+	}
+	return true, false
+}
+
+// tail returns the buffered records in range after all records are pushed.
+func (r *recordRange) tail() []*fastx.Record {
+	if r.buf == nil || r.buf.Size == 0 {
+		return nil
+	}
+
+	records := make([]*fastx.Record, 0, r.buf.Size)
+	current0 := r.buf.Current
+	r.buf.Backward(-r.end - 1)
+	tail := r.buf.Current
+	r.buf.Current = current0
+	var nextNode *RecordNode
+	for {
+		nextNode = r.buf.Next()
+		if nextNode == nil {
+			break
+		}
+
+		records = append(records, nextNode.Value)
+
+		if nextNode == tail {
+			break
+		}
+	}
+	return records
 }
 
 // RecordNode is the node for double-linked loop list
@@ -148,15 +148,23 @@ Special cases:
 		checkError(err)
 		defer outfh.Close()
 
-		var r []byte
-		var founds [][][]byte
-		var found [][]byte
-		var k, v string
-		var ok bool
-		var doNotChange bool
+		replacer := &nameReplacer{
+			pattern:       patternRegexp,
+			replacement:   replacement,
+			bySeq:         bySeq,
+			ignoreCase:    ignoreCase,
+			nrFormat:      fmt.Sprintf("%%0%dd", nrWidth),
+			replaceWithNR: replaceWithNR,
+			replaceWithKV: replaceWithKV,
+			kvs:           kvs,
+			keyCaptIdx:    keyCaptIdx,
+			keepKey:       keepKey,
+			keepUntouch:   keepUntouch,
+			keyMissRepl:   keyMissRepl,
+		}
+
 		var record *fastx.Record
 		var fastxReader *fastx.Reader
-		nrFormat := fmt.Sprintf("%%0%dd", nrWidth)
 		for _, file := range files {
 			fastxReader, err = fastx.NewReader(alphabet, file, idRegexp)
 			checkError(err)
@@ -176,53 +184,10 @@ Special cases:
 				}
 
 				nr++
-				if bySeq {
-					if fastxReader.IsFastq {
-						checkError(fmt.Errorf("editing FASTQ is not supported"))
-					}
-					record.Seq.Seq = patternRegexp.ReplaceAll(record.Seq.Seq, replacement)
-				} else {
-					doNotChange = false
-
-					r = replacement
-
-					if replaceWithNR {
-						r = reNR.ReplaceAll(r, []byte(fmt.Sprintf(nrFormat, nr)))
-					}
-
-					if replaceWithKV {
-						founds = patternRegexp.FindAllSubmatch(record.Name, -1)
-						if len(founds) > 1 {
-							checkError(fmt.Errorf(`pattern "%s" matches multiple targets in "%s", this will cause chaos`, p, record.Name))
-						}
-
-						if len(founds) > 0 {
-							found = founds[0]
-							if keyCaptIdx > len(found)-1 {
-								checkError(fmt.Errorf("value of flag -I (--key-capt-idx) overflows"))
-							}
-							k = string(found[keyCaptIdx])
-							if ignoreCase {
-								k = strings.ToLower(k)
-							}
-							if v, ok = kvs[k]; ok {
-								r = reKV.ReplaceAll(r, []byte(v))
-							} else if keepUntouch {
-								doNotChange = true
-							} else if keepKey {
-								r = reKV.ReplaceAll(r, found[keyCaptIdx])
-							} else {
-								r = reKV.ReplaceAll(r, []byte(keyMissRepl))
-							}
-						} else {
-							doNotChange = true
-						}
-					}
-
-					if !doNotChange {
-						record.Name = patternRegexp.ReplaceAll(record.Name, r)
-					}
+				if bySeq && fastxReader.IsFastq {
+					checkError(fmt.Errorf("editing FASTQ is not supported"))
 				}
+				checkError(replacer.replace(record, nr))
 
 				record.FormatToWriter(outfh, config.LineWidth)
 			}
@@ -253,5 +218,70 @@ func init() {
 	replaceCmd.Flags().StringP("key-miss-repl", "m", "", "replacement for key with no corresponding value")
 }
 
+// nameReplacer replaces record name or sequence by regular expression,
+// it's shared by replace and the Replace stage of pipe.
+type nameReplacer struct {
+	pattern     *regexp.Regexp
+	replacement []byte
+	bySeq       bool
+	ignoreCase  bool
+
+	nrFormat      string
+	replaceWithNR bool
+
+	replaceWithKV bool
+	kvs           map[string]string
+	keyCaptIdx    int
+	keepKey       bool
+	keepUntouch   bool
+	keyMissRepl   string
+}
+
+// replace edits the record in place, nr is the record number starting from 1.
+func (r *nameReplacer) replace(record *fastx.Record, nr int) error {
+	if r.bySeq {
+		record.Seq.Seq = r.pattern.ReplaceAll(record.Seq.Seq, r.replacement)
+		return nil
+	}
+
+	repl := r.replacement
+
+	if r.replaceWithNR {
+		repl = reNR.ReplaceAll(repl, []byte(fmt.Sprintf(r.nrFormat, nr)))
+	}
+
+	if r.replaceWithKV {
+		founds := r.pattern.FindAllSubmatch(record.Name, -1)
+		if len(founds) > 1 {
+			return fmt.Errorf(`pattern "%s" matches multiple targets in "%s", this will cause chaos`, r.pattern, record.Name)
+		}
+
+		if len(founds) == 0 {
+			return nil
+		}
+
+		found := founds[0]
+		if r.keyCaptIdx > len(found)-1 {
+			return fmt.Errorf("value of flag -I (--key-capt-idx) overflows")
+		}
+		k := string(found[r.keyCaptIdx])
+		if r.ignoreCase {
+			k = strings.ToLower(k)
+		}
+		if v, ok := r.kvs[k]; ok {
+			repl = reKV.ReplaceAll(repl, []byte(v))
+		} else if r.keepUntouch {
+			return nil
+		} else if r.keepKey {
+			repl = reKV.ReplaceAll(repl, found[r.keyCaptIdx])
+		} else {
+			repl = reKV.ReplaceAll(repl, []byte(r.keyMissRepl))
+		}
+	}
+
+	record.Name = r.pattern.ReplaceAll(record.Name, repl)
+	return nil
+}
+
 var reNR = regexp.MustCompile(`\{(NR|nr)\}`)
 var reKV = regexp.MustCompile(`\{(KV|kv)\}`)
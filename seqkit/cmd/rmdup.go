@@ -22,30 +22,55 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
+	"os"
 	"runtime"
 	"sort"
 	"strings"
 
 	"github.com/cespare/xxhash/v2"
+	"github.com/dustin/go-humanize"
 	"github.com/shenwei356/bio/seq"
 	"github.com/shenwei356/bio/seqio/fastx"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
 )
 
 // rmdupCmd represents the rmdup command
 var rmdupCmd = &cobra.Command{
 	Use:   "rmdup",
-	Short: "remove duplicated sequences by ID/name/sequence",
-	Long: `remove duplicated sequences by ID/name/sequence
+	Short: "remove duplicated sequences by ID/name/sequence/UMI",
+	Long: `remove duplicated sequences by ID/name/sequence/UMI
 
 Attentions:
   1. When comparing by sequences, both positive and negative strands are
      compared. Switch on -P/--only-positive-strand for considering the
      positive strand only.
   2. Only the first record is saved for duplicates.
+  3. In paired-end mode (-1/--read1 and -2/--read2), reads are paired with
+     the same strategy of "seqkit pair". By default, a pair is removed if
+     both mates are the same as those of a previous pair (compared together,
+     and the swapped pair from the other strand is also compared when
+     comparing by sequence). With "--pair-filter any", a pair is removed if
+     any mate is the same as the mate in the same file of a previous pair.
+     Kept pairs are saved to two synchronized files in -O/--out-dir, and
+     unpaired reads are ignored.
+  4. With --by-umi, PCR duplicates are removed by UMIs in read IDs, which
+     are the parts after the last --umi-sep, e.g., added by "seqkit umi".
+     Reads with the same leading --umi-seq-prefix bases (of both mates in
+     paired-end mode) and UMIs within --umi-max-dist edits are grouped,
+     where UMIs are clustered from the most abundant ones, and the read
+     (pair) with the highest mean quality of each group is kept, in the
+     original order. All reads are kept in memory in this mode.
+  5. With --max-mem, the external-memory mode uses bounded memory for huge
+     inputs: hashes of keys are sorted with spilled temporary files in
+     --tmp-dir, and input files are read twice (stdin is saved to a
+     temporary file). The output is the same as the in-memory mode.
+     Paired-end mode and --by-umi are not supported.
      
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -67,6 +92,9 @@ Attentions:
 
 		// revcom := getFlagBool(cmd, "consider-revcom")
 		revcom := !getFlagBool(cmd, "only-positive-strand")
+		byUMI := getFlagBool(cmd, "by-umi")
+		maxMemStr := getFlagString(cmd, "max-mem")
+		tmpDir := getFlagString(cmd, "tmp-dir")
 
 		if bySeq && byName {
 			checkError(fmt.Errorf("only one/none of the flags -s (--by-seq) and -n (--by-name) is allowed"))
@@ -78,6 +106,133 @@ Attentions:
 
 		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
 
+		if maxMemStr != "" {
+			maxMem, err := humanize.ParseBytes(maxMemStr)
+			if err != nil || maxMem == 0 {
+				checkError(fmt.Errorf("invalid value of flag --max-mem: %s, e.g., 500M, 4G", maxMemStr))
+			}
+			if byUMI {
+				checkError(fmt.Errorf("flag --max-mem is not supported with --by-umi"))
+			}
+			if getPairedOptions(cmd, files, true) != nil {
+				checkError(fmt.Errorf("flag --max-mem is not supported in paired-end mode"))
+			}
+			remover := newDupRemover(bySeq, byName, ignoreCase, revcom, len(numFile) > 0)
+			rmdupExternal(files, remover, int(maxMem), tmpDir, alphabet, idRegexp, lineWidth, outFile, dupFile, numFile)
+			if !quiet {
+				log.Infof("%d duplicated records removed", remover.removed)
+			}
+			return
+		}
+
+		if byUMI {
+			if bySeq || byName {
+				checkError(fmt.Errorf("flag --by-umi can not be used with -s (--by-seq) or -n (--by-name)"))
+			}
+			d := &umiDeduper{
+				sep:       []byte(getFlagString(cmd, "umi-sep")),
+				prefixLen: getFlagNonNegativeInt(cmd, "umi-seq-prefix"),
+				maxDist:   getFlagNonNegativeInt(cmd, "umi-max-dist"),
+				qBase:     getFlagPositiveInt(cmd, "qual-ascii-base"),
+			}
+			if len(d.sep) == 0 {
+				checkError(fmt.Errorf("value of flag --umi-sep should not be empty"))
+			}
+
+			unit := "records"
+			if paired := getPairedOptions(cmd, files, quiet); paired != nil {
+				if len(dupFile) > 0 {
+					checkError(fmt.Errorf("flag -d/--dup-seqs-file is not supported in paired-end mode"))
+				}
+				unit = "pairs"
+				reader := paired.newReader(alphabet, idRegexp)
+				checkError(reader.Walk(func(r1, r2 *fastx.Record) bool {
+					d.add(r1.Clone(), r2.Clone())
+					return false
+				}))
+				reader.warnUnpaired()
+
+				writer := paired.newWriter(lineWidth)
+				d.dedup(func(records []*fastx.Record) {
+					writer.Write(records[0], records[1])
+				}, nil)
+				writer.Close(quiet)
+			} else {
+				var isFastq bool
+				for _, file := range files {
+					fastxReader, err := fastx.NewReader(alphabet, file, idRegexp)
+					checkError(err)
+					for {
+						record, err := fastxReader.Read()
+						if err != nil {
+							if err == io.EOF {
+								break
+							}
+							checkError(err)
+							break
+						}
+						if fastxReader.IsFastq {
+							isFastq = true
+						}
+						d.add(record.Clone())
+					}
+				}
+				if isFastq {
+					lineWidth = 0
+					fastx.ForcelyOutputFastq = true
+				}
+
+				outfh, err := xopen.Wopen(outFile)
+				checkError(err)
+				defer outfh.Close()
+
+				var dup func(records []*fastx.Record)
+				if len(dupFile) > 0 {
+					outfhDup, err := xopen.Wopen(dupFile)
+					checkError(err)
+					defer outfhDup.Close()
+					dup = func(records []*fastx.Record) {
+						records[0].FormatToWriter(outfhDup, lineWidth)
+					}
+				}
+				d.dedup(func(records []*fastx.Record) {
+					records[0].FormatToWriter(outfh, lineWidth)
+				}, dup)
+			}
+
+			if d.removed > 0 && len(numFile) > 0 {
+				outfhNum, err := xopen.Wopen(numFile)
+				checkError(err)
+				defer outfhNum.Close()
+
+				d.writeDupNum(outfhNum)
+			}
+			if !quiet {
+				log.Infof("%d duplicated %s removed, %d UMI groups kept", d.removed, unit, d.groups)
+			}
+			return
+		}
+
+		if paired := getPairedOptions(cmd, files, quiet); paired != nil {
+			if len(dupFile) > 0 {
+				checkError(fmt.Errorf("flag -d/--dup-seqs-file is not supported in paired-end mode"))
+			}
+			if len(numFile) > 0 && !paired.both {
+				checkError(fmt.Errorf(`flag -D/--dup-num-file is only supported with "--pair-filter both" in paired-end mode`))
+			}
+			remover := newDupRemover(bySeq, byName, ignoreCase, revcom, len(numFile) > 0)
+			rmdupPaired(paired, remover, alphabet, idRegexp, lineWidth, quiet)
+
+			if remover.removed > 0 && len(numFile) > 0 {
+				outfhNum, err := xopen.Wopen(numFile)
+				checkError(err)
+				defer outfhNum.Close()
+
+				remover.writeDupNum(outfhNum)
+			}
+			return
+		}
+
 		outfh, err := xopen.Wopen(outFile)
 		checkError(err)
 		defer outfh.Close()
@@ -89,11 +244,8 @@ Attentions:
 			defer outfhDup.Close()
 		}
 
-		counter := make(map[uint64]int)
-		names := make(map[uint64][]string)
+		remover := newDupRemover(bySeq, byName, ignoreCase, revcom, len(numFile) > 0)
 
-		var subject uint64
-		var removed int
 		var record *fastx.Record
 		var fastxReader *fastx.Reader
 		for _, file := range files {
@@ -113,88 +265,28 @@ Attentions:
 					fastx.ForcelyOutputFastq = true
 				}
 
-				if bySeq {
-					if ignoreCase {
-						subject = xxhash.Sum64(bytes.ToLower(record.Seq.Seq))
-					} else {
-						subject = xxhash.Sum64(record.Seq.Seq)
-					}
-				} else if byName {
-					if ignoreCase {
-						subject = xxhash.Sum64(bytes.ToLower(record.Name))
-					} else {
-						subject = xxhash.Sum64(record.Name)
-					}
-				} else { // byID
-					if ignoreCase {
-						subject = xxhash.Sum64(bytes.ToLower(record.ID))
-					} else {
-						subject = xxhash.Sum64(record.ID)
-					}
-				}
-
-				if _, ok := counter[subject]; ok { // duplicated
-					counter[subject]++
-					removed++
+				if remover.isDup(record) {
 					if len(dupFile) > 0 {
 						outfhDup.Write(record.Format(config.LineWidth))
 					}
-					if len(numFile) > 0 {
-						names[subject] = append(names[subject], string(record.ID))
-					}
-
 					continue
 				}
 
-				if bySeq && revcom {
-					if ignoreCase {
-						subject = xxhash.Sum64(bytes.ToLower(record.Seq.RevCom().Seq))
-					} else {
-						subject = xxhash.Sum64(record.Seq.RevCom().Seq)
-					}
-
-					if _, ok := counter[subject]; ok { // duplicated
-						counter[subject]++
-						removed++
-						if len(dupFile) > 0 {
-							outfhDup.Write(record.Format(config.LineWidth))
-						}
-						if len(numFile) > 0 {
-							names[subject] = append(names[subject], string(record.ID))
-						}
-						continue
-					}
-				}
-
 				record.FormatToWriter(outfh, config.LineWidth)
-				counter[subject]++
-
-				if len(numFile) > 0 {
-					names[subject] = []string{string(record.ID)}
-				}
 			}
 
 			config.LineWidth = lineWidth
 		}
-		if removed > 0 && len(numFile) > 0 {
+		if remover.removed > 0 && len(numFile) > 0 {
 			outfhNum, err := xopen.Wopen(numFile)
 			checkError(err)
 			defer outfhNum.Close()
 
-			list := new(listOfStringSlice)
-			for _, l := range names {
-				if len(l) > 1 {
-					list.data = append(list.data, l)
-				}
-			}
-			sort.Sort(list)
-			for _, l := range list.data {
-				outfhNum.WriteString(fmt.Sprintf("%d\t%s\n", len(l), strings.Join(l, ", ")))
-			}
+			remover.writeDupNum(outfhNum)
 		}
 
 		if !quiet {
-			log.Infof("%d duplicated records removed", removed)
+			log.Infof("%d duplicated records removed", remover.removed)
 		}
 	},
 }
@@ -209,6 +301,484 @@ func init() {
 	rmdupCmd.Flags().StringP("dup-num-file", "D", "", "file to save number and list of duplicated seqs")
 	// rmdupCmd.Flags().BoolP("consider-revcom", "r", false, "considering the reverse compelment sequence")
 	rmdupCmd.Flags().BoolP("only-positive-strand", "P", false, "only considering positive strand when comparing by sequence")
+	rmdupCmd.Flags().BoolP("by-umi", "", false, `by UMI in read IDs and sequence prefix, for removing PCR duplicates`)
+	rmdupCmd.Flags().StringP("umi-sep", "", "_", "separator between the read ID and the UMI, for --by-umi")
+	rmdupCmd.Flags().IntP("umi-seq-prefix", "", 20, "length of sequence prefix compared along with UMIs, 0 for UMIs only, for --by-umi")
+	rmdupCmd.Flags().IntP("umi-max-dist", "", 1, "max edit distance between UMIs of duplicates, for --by-umi")
+	rmdupCmd.Flags().IntP("qual-ascii-base", "b", 33, "ASCII BASE, 33 for Phred+33, for --by-umi")
+	rmdupCmd.Flags().StringP("max-mem", "", "", `memory budget of the external-memory mode for huge inputs, e.g., "4G"`)
+	rmdupCmd.Flags().StringP("tmp-dir", "", "", "directory of temporary files of the external-memory mode (default value is the system temporary directory)")
+
+	addPairedFlags(rmdupCmd, true, "both", `in paired-end mode, remove a pair if "any" or "both" of the mates are duplicated`)
+}
+
+// rmdupPaired removes duplicated paired-end reads. In the "any" mode,
+// mates are compared with another remover, and the removed of remover
+// is set to the number of removed pairs.
+func rmdupPaired(o *pairedOptions, remover *dupRemover, alphabet *seq.Alphabet, idRegexp string, lineWidth int, quiet bool) {
+	reader := o.newReader(alphabet, idRegexp)
+	writer := o.newWriter(lineWidth)
+
+	var remover2 *dupRemover
+	if !o.both {
+		remover2 = newDupRemover(remover.bySeq, remover.byName, remover.ignoreCase, remover.revcom, false)
+	}
+
+	var removed int
+	var dup1, dup2 bool
+	checkError(reader.Walk(func(r1, r2 *fastx.Record) bool {
+		if o.both {
+			if remover.isDupPair(r1, r2) {
+				removed++
+				return false
+			}
+		} else {
+			dup1, dup2 = remover.isDup(r1), remover2.isDup(r2)
+			if dup1 || dup2 {
+				removed++
+				return false
+			}
+		}
+
+		writer.Write(r1, r2)
+		return false
+	}))
+	remover.removed = removed
+
+	reader.warnUnpaired()
+	writer.Close(quiet)
+	if !quiet {
+		log.Infof("%d duplicated pairs removed", removed)
+	}
+}
+
+// dupRemover detects duplicated records by ID, name or sequence,
+// it's shared by rmdup and the Rmdup stage of pipe.
+type dupRemover struct {
+	bySeq      bool
+	byName     bool
+	ignoreCase bool
+	revcom     bool // also compare the reverse complement sequence
+	saveNames  bool // record IDs of duplicates for writeDupNum
+
+	counter map[uint64]int
+	names   map[uint64][]string
+	removed int
+}
+
+func newDupRemover(bySeq, byName, ignoreCase, revcom, saveNames bool) *dupRemover {
+	return &dupRemover{
+		bySeq:      bySeq,
+		byName:     byName,
+		ignoreCase: ignoreCase,
+		revcom:     revcom,
+		saveNames:  saveNames,
+		counter:    make(map[uint64]int),
+		names:      make(map[uint64][]string),
+	}
+}
+
+// key returns the ID, name or sequence of the record for comparison.
+func (d *dupRemover) key(record *fastx.Record, revcom bool) []byte {
+	var k []byte
+	if d.bySeq {
+		if revcom {
+			k = record.Seq.RevCom().Seq
+		} else {
+			k = record.Seq.Seq
+		}
+	} else if d.byName {
+		k = record.Name
+	} else { // byID
+		k = record.ID
+	}
+	if d.ignoreCase {
+		return bytes.ToLower(k)
+	}
+	return k
+}
+
+// hash returns the hash of the key of a record, as used by rmdupExternal.
+// When comparing by sequence on both strands, the smaller hash of the two
+// strands is returned, so a sequence and its reverse complement sequence
+// have the same hash.
+func (d *dupRemover) hash(record *fastx.Record) uint64 {
+	h := xxhash.Sum64(d.key(record, false))
+	if d.bySeq && d.revcom {
+		if h2 := xxhash.Sum64(d.key(record, true)); h2 < h {
+			return h2
+		}
+	}
+	return h
+}
+
+// isDup tells whether the record is a duplicate of a previous one.
+// Only the first record is considered not duplicated.
+func (d *dupRemover) isDup(record *fastx.Record) bool {
+	subject := xxhash.Sum64(d.key(record, false))
+
+	if d.dup(subject, record) {
+		return true
+	}
+
+	if d.bySeq && d.revcom {
+		subject = xxhash.Sum64(d.key(record, true))
+
+		if d.dup(subject, record) {
+			return true
+		}
+	}
+
+	d.counter[subject]++
+	if d.saveNames {
+		d.names[subject] = []string{string(record.ID)}
+	}
+	return false
+}
+
+// isDupPair tells whether the pair of reads is a duplicate of a previous
+// pair, where both mates are compared. When comparing by sequence on both
+// strands, the pair (r2, r1) from the other strand of the same fragment
+// is also compared.
+func (d *dupRemover) isDupPair(r1, r2 *fastx.Record) bool {
+	h := xxhash.New()
+	pairHash := func(a, b []byte) uint64 {
+		h.Reset()
+		h.Write(a)
+		h.Write(_tab)
+		h.Write(b)
+		return h.Sum64()
+	}
+	k1, k2 := d.key(r1, false), d.key(r2, false)
+
+	subject := pairHash(k1, k2)
+	if d.dup(subject, r1) {
+		return true
+	}
+
+	if d.bySeq && d.revcom {
+		subject = pairHash(k2, k1)
+		if d.dup(subject, r1) {
+			return true
+		}
+	}
+
+	d.counter[subject]++
+	if d.saveNames {
+		d.names[subject] = []string{string(r1.ID)}
+	}
+	return false
+}
+
+func (d *dupRemover) dup(subject uint64, record *fastx.Record) bool {
+	if _, ok := d.counter[subject]; !ok {
+		return false
+	}
+	d.counter[subject]++
+	d.removed++
+	if d.saveNames {
+		d.names[subject] = append(d.names[subject], string(record.ID))
+	}
+	return true
+}
+
+// writeDupNum writes the number and list of duplicated records,
+// in descending order of the number.
+func (d *dupRemover) writeDupNum(w io.Writer) {
+	list := new(listOfStringSlice)
+	for _, l := range d.names {
+		if len(l) > 1 {
+			list.data = append(list.data, l)
+		}
+	}
+	sort.Sort(list)
+	for _, l := range list.data {
+		fmt.Fprintf(w, "%d\t%s\n", len(l), strings.Join(l, ", "))
+	}
+}
+
+// rmdupExternal removes duplicated records with bounded memory, with the
+// same result as dupRemover.isDup.
+//
+//  1. Records are read and numbered. Hashes of their keys, the numbers,
+//     and IDs (for -D/--dup-num-file) are sorted with lib.ExtSorter.
+//  2. In each group of the same hash, the record with the smallest number
+//     is kept, numbers of the others are sorted again. Groups with
+//     duplicates are sorted by the size for -D/--dup-num-file.
+//  3. Records are read again and written to the output or -d/--dup-seqs-file
+//     by the sorted numbers of duplicates.
+func rmdupExternal(files []string, remover *dupRemover, maxMem int, tmpDir string,
+	alphabet *seq.Alphabet, idRegexp string, lineWidth int, outFile, dupFile, numFile string) {
+
+	byHash := func(a, b []byte) bool { return bytes.Compare(a[:8], b[:8]) < 0 }
+	keys := lib.NewExtSorter(tmpDir, maxMem/2, byHash)
+
+	// 1. hashing keys, stdin is saved for reading again
+	files = append([]string(nil), files...)
+	buf := make([]byte, 16, 64)
+	var idx uint64
+	for i, file := range files {
+		fastxReader, err := fastx.NewReader(alphabet, file, idRegexp)
+		checkError(err)
+
+		var tee *xopen.Writer
+		if isStdin(file) {
+			fh, err := os.CreateTemp(tmpDir, "seqkit-rmdup-*.fx")
+			checkError(err)
+			checkError(fh.Close())
+			files[i] = fh.Name()
+			defer os.Remove(files[i])
+
+			tee, err = xopen.Wopen(files[i])
+			checkError(err)
+		}
+
+		for {
+			record, err := fastxReader.Read()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				checkError(err)
+				break
+			}
+
+			binary.BigEndian.PutUint64(buf[:8], remover.hash(record))
+			binary.BigEndian.PutUint64(buf[8:16], idx)
+			buf = buf[:16]
+			if remover.saveNames {
+				buf = append(buf, record.ID...)
+			}
+			checkError(keys.Add(buf))
+			idx++
+
+			if tee != nil {
+				record.FormatToWriter(tee, 0)
+			}
+		}
+		if tee != nil {
+			checkError(tee.Close())
+		}
+	}
+
+	// 2. finding duplicates
+	dups := lib.NewExtSorter(tmpDir, maxMem/4, func(a, b []byte) bool { return bytes.Compare(a, b) < 0 })
+	var groups *lib.ExtSorter
+	if remover.saveNames {
+		groups = lib.NewExtSorter(tmpDir, maxMem/4, func(a, b []byte) bool { return bytes.Compare(a[:16], b[:16]) < 0 })
+	}
+	var names []string
+	var first []byte
+	addGroup := func() {
+		if len(names) < 2 {
+			return
+		}
+		// descending order of sizes, then ascending order of numbers
+		buf = buf[:16]
+		binary.BigEndian.PutUint64(buf[:8], ^uint64(len(names)))
+		copy(buf[8:16], first)
+		buf = append(buf, strings.Join(names, ", ")...)
+		checkError(groups.Add(buf))
+	}
+
+	it, err := keys.Sort()
+	checkError(err)
+	var item []byte
+	var hash, prev uint64
+	var n int
+	for {
+		item, err = it.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			checkError(err)
+		}
+		hash = binary.BigEndian.Uint64(item[:8])
+		if n == 0 || hash != prev {
+			if groups != nil {
+				addGroup()
+				first = append(first[:0], item[8:16]...)
+				names = append(names[:0], string(item[16:]))
+			}
+			prev = hash
+			n++
+			continue
+		}
+
+		checkError(dups.Add(item[8:16]))
+		remover.removed++
+		if groups != nil {
+			names = append(names, string(item[16:]))
+		}
+	}
+	if groups != nil {
+		addGroup()
+	}
+	checkError(it.Close())
+
+	// 3. writing records
+	outfh, err := xopen.Wopen(outFile)
+	checkError(err)
+	defer outfh.Close()
+
+	var outfhDup *xopen.Writer
+	if len(dupFile) > 0 {
+		outfhDup, err = xopen.Wopen(dupFile)
+		checkError(err)
+		defer outfhDup.Close()
+	}
+
+	it, err = dups.Sort()
+	checkError(err)
+	nextDup := func() uint64 {
+		item, err := it.Next()
+		if err == io.EOF {
+			return math.MaxUint64
+		}
+		checkError(err)
+		return binary.BigEndian.Uint64(item)
+	}
+	dup := nextDup()
+
+	idx = 0
+	for _, file := range files {
+		fastxReader, err := fastx.NewReader(alphabet, file, idRegexp)
+		checkError(err)
+		width := lineWidth
+		for {
+			record, err := fastxReader.Read()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				checkError(err)
+				break
+			}
+			if fastxReader.IsFastq {
+				width = 0
+				fastx.ForcelyOutputFastq = true
+			}
+
+			if idx == dup {
+				if outfhDup != nil {
+					outfhDup.Write(record.Format(width))
+				}
+				dup = nextDup()
+			} else {
+				record.FormatToWriter(outfh, width)
+			}
+			idx++
+		}
+	}
+	checkError(it.Close())
+
+	if remover.removed > 0 && len(numFile) > 0 {
+		outfhNum, err := xopen.Wopen(numFile)
+		checkError(err)
+		defer outfhNum.Close()
+
+		it, err = groups.Sort()
+		checkError(err)
+		for {
+			item, err = it.Next()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				checkError(err)
+			}
+			fmt.Fprintf(outfhNum, "%d\t%s\n", ^binary.BigEndian.Uint64(item[:8]), item[16:])
+		}
+		checkError(it.Close())
+	}
+}
+
+// umiDeduper keeps reads (or read pairs) in memory, and removes
+// duplicates by UMIs and sequence prefixes with lib.DedupUMIs.
+type umiDeduper struct {
+	sep       []byte
+	prefixLen int
+	maxDist   int
+	qBase     int
+
+	records [][]*fastx.Record
+	reads   []lib.UMIRead
+
+	removed int
+	groups  int
+	names   [][]string // IDs of duplicates, the kept one first
+}
+
+// add adds a read, or the two mates of a pair, the UMI is taken from
+// the ID of the first one.
+func (d *umiDeduper) add(records ...*fastx.Record) {
+	umi, ok := umiFromID(records[0].ID, d.sep)
+	if !ok {
+		checkError(fmt.Errorf(`no UMI found in read ID: %s, UMIs could be extracted with "seqkit umi"`, records[0].ID))
+	}
+	key := make([]byte, 0, (d.prefixLen+1)*len(records))
+	var qual float64
+	var s []byte
+	for i, r := range records {
+		if i > 0 {
+			key = append(key, '\t')
+		}
+		s = r.Seq.Seq
+		if len(s) > d.prefixLen {
+			s = s[:d.prefixLen]
+		}
+		key = append(key, bytes.ToUpper(s)...)
+		if len(r.Seq.Qual) > 0 {
+			qual += r.Seq.AvgQual(d.qBase)
+		}
+	}
+
+	d.records = append(d.records, records)
+	d.reads = append(d.reads, lib.UMIRead{UMI: bytes.ToUpper(umi), Key: key, Qual: qual / float64(len(records))})
+}
+
+// dedup passes kept reads to keep and duplicates to dup (if not nil),
+// in the original order.
+func (d *umiDeduper) dedup(keep func(records []*fastx.Record), dup func(records []*fastx.Record)) {
+	reps := lib.DedupUMIs(d.reads, d.maxDist)
+
+	members := make(map[int][]int, len(reps))
+	for i, rep := range reps {
+		if rep == i {
+			d.groups++
+			keep(d.records[i])
+			continue
+		}
+		d.removed++
+		members[rep] = append(members[rep], i)
+		if dup != nil {
+			dup(d.records[i])
+		}
+	}
+
+	d.names = d.names[:0]
+	for i, rep := range reps {
+		if rep != i || len(members[i]) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(members[i])+1)
+		names = append(names, string(d.records[i][0].ID))
+		for _, j := range members[i] {
+			names = append(names, string(d.records[j][0].ID))
+		}
+		d.names = append(d.names, names)
+	}
+}
+
+// writeDupNum writes the number and list of duplicated records,
+// in descending order of the number.
+func (d *umiDeduper) writeDupNum(w io.Writer) {
+	list := &listOfStringSlice{data: d.names}
+	sort.Stable(list)
+	for _, l := range list.data {
+		fmt.Fprintf(w, "%d\t%s\n", len(l), strings.Join(l, ", "))
+	}
 }
 
 type listOfStringSlice struct {
@@ -41,6 +41,12 @@ var sampleCmd = &cobra.Command{
 Attention:
 1. Do not use '-n' on large FASTQ files, it loads all seqs into memory!
    use 'seqkit sample -p 0.1 seqs.fq.gz | seqkit head -n N' instead!
+2. In paired-end mode (--read1 and --read2), reads are paired with the
+   same strategy of "seqkit pair", and pairs are sampled and saved to two
+   synchronized files in -O/--out-dir. Sampling by number (-n) is performed
+   in two-pass mode. Unpaired reads are ignored.
+   Unlike other commands, the two flags have no shorthands -1 and -2 here,
+   as -2 is used by -2/--two-pass.
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -65,6 +71,11 @@ Attention:
 		number := getFlagInt64(cmd, "number")
 		proportion := getFlagFloat64(cmd, "proportion")
 
+		paired := getPairedOptions(cmd, files, quiet)
+		if paired != nil {
+			files = []string{paired.read1}
+		}
+
 		file := files[0]
 
 		if twoPass && isStdin(file) {
@@ -82,11 +93,16 @@ Attention:
 			checkError(fmt.Errorf("value of -p (--proportion) (%f) should be in range of (0, 1]", proportion))
 		}
 
+		sampler := newRecordSampler(seed, proportion)
+
+		if paired != nil {
+			samplePaired(paired, sampler, number, alphabet, idRegexp, config.LineWidth, quiet)
+			return
+		}
+
 		outfh, err := xopen.Wopen(outFile)
 		checkError(err)
 		defer outfh.Close()
-
-		rand.Seed(seed)
 		// randg := randomFloat64Generator(seed)
 
 		n := int64(0)
@@ -109,7 +125,7 @@ Attention:
 					log.Infof("seq number: %d", seqNum)
 				}
 
-				proportion = float64(number) / float64(seqNum) * 1.1
+				sampler.proportion = float64(number) / float64(seqNum) * 1.1
 
 				// second pass
 				if !quiet {
@@ -133,7 +149,7 @@ Attention:
 					}
 
 					// if <-randg <= proportion {
-					if rand.Float64() <= proportion {
+					if sampler.keep() {
 						n++
 						record.FormatToWriter(outfh, config.LineWidth)
 						if n == number {
@@ -152,11 +168,11 @@ Attention:
 					config.LineWidth = 0
 				}
 
-				proportion = float64(number) / float64(len(records))
+				sampler.proportion = float64(number) / float64(len(records))
 
 				for _, record := range records {
 					// if <-randg <= proportion {
-					if rand.Float64() <= proportion {
+					if sampler.keep() {
 						n++
 						record.FormatToWriter(outfh, config.LineWidth)
 						if n == number {
@@ -187,7 +203,7 @@ Attention:
 				}
 
 				// if <-randg <= proportion {
-				if rand.Float64() <= proportion {
+				if sampler.keep() {
 					n++
 					record.FormatToWriter(outfh, config.LineWidth)
 				}
@@ -207,4 +223,61 @@ func init() {
 	sampleCmd.Flags().Int64P("number", "n", 0, "sample by number (result may not exactly match), DO NOT use on large FASTQ files.")
 	sampleCmd.Flags().Float64P("proportion", "p", 0, "sample by proportion")
 	sampleCmd.Flags().BoolP("two-pass", "2", false, "2-pass mode read files twice to lower memory usage. Not allowed when reading from stdin")
+
+	// -2 is used by --two-pass
+	addPairedFlags(sampleCmd, false, "", "")
+}
+
+// recordSampler randomly keeps records by proportion,
+// it's shared by sample and the Sample stage of pipe.
+type recordSampler struct {
+	proportion float64
+	rand       *rand.Rand
+}
+
+func newRecordSampler(seed int64, proportion float64) *recordSampler {
+	return &recordSampler{proportion: proportion, rand: rand.New(rand.NewSource(seed))}
+}
+
+// keep tells whether to keep the current record.
+func (s *recordSampler) keep() bool {
+	return s.rand.Float64() <= s.proportion
+}
+
+// samplePaired samples paired-end reads by proportion, or by number in
+// two-pass mode, where the number of pairs is estimated from read1.
+func samplePaired(o *pairedOptions, sampler *recordSampler, number int64, alphabet *seq.Alphabet, idRegexp string, lineWidth int, quiet bool) {
+	if number > 0 {
+		if !quiet {
+			log.Info("sample by number")
+			log.Info("first pass: counting seq number")
+		}
+		seqNum, err := fastx.GetSeqNumber(o.read1)
+		checkError(err)
+		if !quiet {
+			log.Infof("seq number: %d", seqNum)
+			log.Info("second pass: reading and sampling")
+		}
+		sampler.proportion = float64(number) / float64(seqNum) * 1.1
+	} else if !quiet {
+		log.Info("sample by proportion")
+	}
+
+	reader := o.newReader(alphabet, idRegexp)
+	writer := o.newWriter(lineWidth)
+
+	var n int64
+	checkError(reader.Walk(func(r1, r2 *fastx.Record) bool {
+		if !sampler.keep() {
+			return false
+		}
+		writer.Write(r1, r2)
+		n++
+		return number > 0 && n == number
+	}))
+
+	if !(number > 0 && n == number) {
+		reader.warnUnpaired()
+	}
+	writer.Close(quiet)
 }
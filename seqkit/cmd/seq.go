@@ -46,6 +46,13 @@ var seqCmd = &cobra.Command{
 	Short: "transform sequences (extract ID, filter by length, remove gaps, reverse complement...)",
 	Long: `transform sequences (extract ID, filter by length, remove gaps, reverse complement...)
 
+Paired-end mode:
+  With -1/--read1 and -2/--read2, reads are paired with the same strategy of
+  "seqkit pair", filtered by length and quality (-m/-M/-Q/-R) per pair, and
+  saved to two synchronized files in -O/--out-dir. A pair is kept if both
+  mates pass the filters by default, use --pair-filter any to keep pairs with
+  at least one mate passing. Unpaired reads are ignored.
+
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		config := getConfigs(cmd)
@@ -78,11 +85,6 @@ var seqCmd = &cobra.Command{
 		minQual := getFlagFloat64(cmd, "min-qual")
 		maxQual := getFlagFloat64(cmd, "max-qual")
 
-		filterMinLen := minLen > 0
-		filterMaxLen := maxLen > 0
-		filterMinQual := minQual > 0
-		filterMaxQual := maxQual > 0
-
 		if gapLetters == "" {
 			checkError(fmt.Errorf("value of flag -G (--gap-letters) should not be empty"))
 		}
@@ -130,8 +132,32 @@ var seqCmd = &cobra.Command{
 			checkError(fmt.Errorf("could not give both flags -l (--lower-case) and -u (--upper-case)"))
 		}
 
+		transformer := &seqTransformer{
+			removeGaps: removeGaps,
+			gapLetters: gapLetters,
+			minLen:     minLen,
+			maxLen:     maxLen,
+			qBase:      qBase,
+			minQual:    minQual,
+			maxQual:    maxQual,
+			reverse:    reverse,
+			complement: complement,
+			dna2rna:    dna2rna,
+			rna2dna:    rna2dna,
+			lowerCase:  lowerCase,
+			upperCase:  upperCase,
+		}
+
 		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
 
+		if paired := getPairedOptions(cmd, files, quiet); paired != nil {
+			if onlyName || onlySeq || onlyQual || color {
+				checkError(fmt.Errorf("flags -n/--name, -s/--seq, -q/--qual and -k/--color are not supported in paired-end mode"))
+			}
+			seqPaired(paired, transformer, onlyID, alphabet, idRegexp, lineWidth, quiet)
+			return
+		}
+
 		var seqCol *SeqColorizer
 		if color {
 			switch alphabet {
@@ -248,28 +274,10 @@ var seqCmd = &cobra.Command{
 					checkSeqType = false
 				}
 
-				if removeGaps {
-					record.Seq.RemoveGapsInplace(gapLetters)
-				}
-
-				if filterMinLen && len(record.Seq.Seq) < minLen {
+				if !transformer.keep(record) {
 					continue
 				}
 
-				if filterMaxLen && len(record.Seq.Seq) > maxLen {
-					continue
-				}
-
-				if filterMinQual || filterMaxQual {
-					avgQual := record.Seq.AvgQual(qBase)
-					if filterMinQual && avgQual < minQual {
-						continue
-					}
-					if filterMaxQual && avgQual >= maxQual {
-						continue
-					}
-				}
-
 				printName, printSeq = true, true
 				if onlyName && onlySeq {
 					printName, printSeq = true, true
@@ -306,58 +314,21 @@ var seqCmd = &cobra.Command{
 					}
 				}
 
-				sequence = record.Seq
-				if reverse {
-					sequence = sequence.ReverseInplace()
-				}
 				if complement {
 					if !config.Quiet && record.Seq.Alphabet == seq.Protein || record.Seq.Alphabet == seq.Unlimit {
 						log.Warning("complement does no take effect on protein/unlimit sequence")
 					}
-					sequence = sequence.ComplementInplace()
 				}
+				sequence = transformer.revcom(record.Seq)
 
 				if printSeq {
-					if dna2rna {
-						ab := fastxReader.Alphabet()
-						if ab == seq.RNA || ab == seq.RNAredundant {
-							if once {
-								log.Warningf("it's already RNA, no need to convert")
-								once = false
-							}
-						} else {
-							for i, b := range sequence.Seq {
-								switch b {
-								case 't':
-									sequence.Seq[i] = 'u'
-								case 'T':
-									sequence.Seq[i] = 'U'
-								}
-							}
-						}
-					}
-					if rna2dna {
-						ab := fastxReader.Alphabet()
-						if ab == seq.DNA || ab == seq.DNAredundant {
-							if once {
-								log.Warningf("it's already DNA, no need to convert")
-								once = false
-							}
+					if !transformer.convert(sequence, fastxReader.Alphabet()) && once {
+						if dna2rna {
+							log.Warningf("it's already RNA, no need to convert")
 						} else {
-							for i, b := range sequence.Seq {
-								switch b {
-								case 'u':
-									sequence.Seq[i] = 't'
-								case 'U':
-									sequence.Seq[i] = 'T'
-								}
-							}
+							log.Warningf("it's already DNA, no need to convert")
 						}
-					}
-					if lowerCase {
-						sequence.Seq = bytes.ToLower(sequence.Seq)
-					} else if upperCase {
-						sequence.Seq = bytes.ToUpper(sequence.Seq)
+						once = false
 					}
 
 					if isFastq {
@@ -410,6 +381,135 @@ var seqCmd = &cobra.Command{
 
 var bufSize = 65536
 
+// seqPaired filters and transforms paired-end reads.
+func seqPaired(o *pairedOptions, t *seqTransformer, onlyID bool, alphabet *seq.Alphabet, idRegexp string, lineWidth int, quiet bool) {
+	reader := o.newReader(alphabet, idRegexp)
+	writer := o.newWriter(lineWidth)
+
+	once := true
+	checkError(reader.Walk(func(r1, r2 *fastx.Record) bool {
+		if !o.test(t.keep(r1), t.keep(r2)) {
+			return false
+		}
+
+		for _, record := range []*fastx.Record{r1, r2} {
+			if onlyID {
+				record.Name = record.ID
+			}
+			record.Seq = t.revcom(record.Seq)
+			if !t.convert(record.Seq, reader.Alphabet()) && once {
+				if t.dna2rna {
+					log.Warningf("it's already RNA, no need to convert")
+				} else {
+					log.Warningf("it's already DNA, no need to convert")
+				}
+				once = false
+			}
+		}
+
+		writer.Write(r1, r2)
+		return false
+	}))
+
+	reader.warnUnpaired()
+	writer.Close(quiet)
+}
+
+// seqTransformer contains the record filters and sequence transformations
+// of seq, it's also used by the Seq stage of pipe.
+type seqTransformer struct {
+	removeGaps bool
+	gapLetters string
+
+	minLen, maxLen   int // -1 or 0 for no limit
+	qBase            int
+	minQual, maxQual float64 // -1 or 0 for no limit
+
+	reverse    bool
+	complement bool
+	dna2rna    bool
+	rna2dna    bool
+	lowerCase  bool
+	upperCase  bool
+}
+
+// keep removes gaps if needed, and tells whether the record passes
+// the length and quality filters.
+func (t *seqTransformer) keep(record *fastx.Record) bool {
+	if t.removeGaps {
+		record.Seq.RemoveGapsInplace(t.gapLetters)
+	}
+
+	if t.minLen > 0 && len(record.Seq.Seq) < t.minLen {
+		return false
+	}
+	if t.maxLen > 0 && len(record.Seq.Seq) > t.maxLen {
+		return false
+	}
+
+	if t.minQual > 0 || t.maxQual > 0 {
+		avgQual := record.Seq.AvgQual(t.qBase)
+		if t.minQual > 0 && avgQual < t.minQual {
+			return false
+		}
+		if t.maxQual > 0 && avgQual >= t.maxQual {
+			return false
+		}
+	}
+	return true
+}
+
+// revcom reverses and/or complements the sequence in place.
+func (t *seqTransformer) revcom(s *seq.Seq) *seq.Seq {
+	if t.reverse {
+		s = s.ReverseInplace()
+	}
+	if t.complement {
+		s = s.ComplementInplace()
+	}
+	return s
+}
+
+// convert converts between DNA and RNA and changes the case in place.
+// It returns false if the sequence of alphabet ab needs no DNA/RNA conversion.
+func (t *seqTransformer) convert(s *seq.Seq, ab *seq.Alphabet) bool {
+	ok := true
+	if t.dna2rna {
+		if ab == seq.RNA || ab == seq.RNAredundant {
+			ok = false
+		} else {
+			for i, b := range s.Seq {
+				switch b {
+				case 't':
+					s.Seq[i] = 'u'
+				case 'T':
+					s.Seq[i] = 'U'
+				}
+			}
+		}
+	}
+	if t.rna2dna {
+		if ab == seq.DNA || ab == seq.DNAredundant {
+			ok = false
+		} else {
+			for i, b := range s.Seq {
+				switch b {
+				case 'u':
+					s.Seq[i] = 't'
+				case 'U':
+					s.Seq[i] = 'T'
+				}
+			}
+		}
+	}
+	if t.lowerCase {
+		s.Seq = bytes.ToLower(s.Seq)
+	} else if t.upperCase {
+		s.Seq = bytes.ToUpper(s.Seq)
+	}
+	return ok
+}
+
 func init() {
 	RootCmd.AddCommand(seqCmd)
 
@@ -431,6 +531,8 @@ func init() {
 	seqCmd.Flags().IntP("min-len", "m", -1, "only print sequences longer than the minimum length (-1 for no limit)")
 	seqCmd.Flags().IntP("max-len", "M", -1, "only print sequences shorter than the maximum length (-1 for no limit)")
 	seqCmd.Flags().IntP("qual-ascii-base", "b", 33, "ASCII BASE, 33 for Phred+33")
+
+	addPairedFlags(seqCmd, true, "both", `in paired-end mode, keep a pair if "any" or "both" of the mates pass the filters`)
 	seqCmd.Flags().Float64P("min-qual", "Q", -1, "only print sequences with average quality qreater or equal than this limit (-1 for no limit)")
 	seqCmd.Flags().Float64P("max-qual", "R", -1, "only print sequences with average quality less than this limit (-1 for no limit)")
 }
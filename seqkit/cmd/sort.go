@@ -22,6 +22,7 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
@@ -30,12 +31,15 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/dustin/go-humanize"
 	"github.com/shenwei356/bio/seq"
 	"github.com/shenwei356/bio/seqio/fai"
 	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/natsort"
 	"github.com/shenwei356/util/stringutil"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
 )
 
 // sortCmd represents the sort command
@@ -55,6 +59,13 @@ seqkit will write the sequences to temporary files, and create FASTA index.
 Secondly, seqkit sorts sequence by head and length information
 and extracts sequences by FASTA index.
 
+External merge sort:
+  With --max-mem, records are sorted in batches within the memory budget,
+  sorted batches are spilled to temporary files in --tmp-dir, and merged
+  at last. It works for FASTA and FASTQ, compressed files and stdin, and
+  supports all sorting keys. Records with the same key are kept in the
+  input order, and duplicated IDs are allowed.
+
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		config := getConfigs(cmd)
@@ -81,6 +92,11 @@ and extracts sequences by FASTA index.
 		twoPass := getFlagBool(cmd, "two-pass")
 		seqPrefixLength := getFlagNonNegativeInt(cmd, "seq-prefix-length")
 		keepTemp := getFlagBool(cmd, "keep-temp")
+		maxMemStr := getFlagString(cmd, "max-mem")
+		tmpDir := getFlagString(cmd, "tmp-dir")
+		if maxMemStr != "" && twoPass {
+			checkError(fmt.Errorf("flag --max-mem is incompatible with -2/--two-pass"))
+		}
 		if keepTemp && !twoPass {
 			checkError(fmt.Errorf("flag -k (--keep-temp) must be used with flag -2 (--two-pass)"))
 		}
@@ -118,6 +134,74 @@ and extracts sequences by FASTA index.
 			}
 		}
 
+		if maxMemStr != "" {
+			maxMem, err := humanize.ParseBytes(maxMemStr)
+			if err != nil || maxMem == 0 {
+				checkError(fmt.Errorf("invalid value of flag --max-mem: %s, e.g., 500M, 4G", maxMemStr))
+			}
+
+			key := func(record *fastx.Record) ([]byte, int) {
+				var k []byte
+				var n int
+				if byName {
+					k = record.Name
+				} else if bySeq {
+					k = record.Seq.Seq
+				} else { // byID, byLength
+					k = record.ID
+				}
+				if ignoreCase {
+					k = bytes.ToLower(k)
+				}
+				if byLength {
+					if byBases {
+						n = record.Seq.Bases(gapLetters)
+					} else {
+						n = len(record.Seq.Seq)
+					}
+				}
+				return k, n
+			}
+
+			// the same orders as the in-memory mode
+			var less func(k1 []byte, n1 int, k2 []byte, n2 int) bool
+			if bySeq {
+				less = func(k1 []byte, n1 int, k2 []byte, n2 int) bool {
+					if reverse {
+						return bytes.Compare(k1, k2) > 0
+					}
+					return bytes.Compare(k1, k2) < 0
+				}
+			} else if byLength {
+				less = func(k1 []byte, n1 int, k2 []byte, n2 int) bool {
+					if n1 != n2 {
+						if reverse {
+							return n1 > n2
+						}
+						return n1 < n2
+					}
+					return bytes.Compare(k1, k2) < 0
+				}
+			} else if inNaturalOrder {
+				less = func(k1 []byte, n1 int, k2 []byte, n2 int) bool {
+					if reverse {
+						return natsort.Compare(string(k2), string(k1), false)
+					}
+					return natsort.Compare(string(k1), string(k2), false)
+				}
+			} else {
+				less = func(k1 []byte, n1 int, k2 []byte, n2 int) bool {
+					if reverse {
+						return bytes.Compare(k1, k2) > 0
+					}
+					return bytes.Compare(k1, k2) < 0
+				}
+			}
+
+			sortExternal(files, key, less, int(maxMem), tmpDir, alphabet, idRegexp, config.LineWidth, outFile, quiet)
+			return
+		}
+
 		name2name0 := make(map[string]string, 1000)
 		name2sequence := []stringutil.String2ByteSlice{}
 		name2length := []stringutil.StringCount{}
@@ -465,4 +549,121 @@ func init() {
 	sortCmd.Flags().BoolP("two-pass", "2", false, "two-pass mode read files twice to lower memory usage. (only for FASTA format)")
 	sortCmd.Flags().BoolP("keep-temp", "k", false, "keep temporary FASTA and .fai file when using 2-pass mode")
 	sortCmd.Flags().IntP("seq-prefix-length", "L", 10000, "length of sequence prefix on which seqkit sorts by sequences (0 for whole sequence)")
+	sortCmd.Flags().StringP("max-mem", "", "", `memory budget of external merge sort, e.g., "4G", for FASTA/Q files of any size`)
+	sortCmd.Flags().StringP("tmp-dir", "", "", "directory of temporary files of external merge sort (default value is the system temporary directory)")
+}
+
+// sortExternal sorts records by external merge sort with lib.ExtSorter.
+// Records are encoded along with their sorting keys given by key, and
+// compared by less. Sorted runs are spilled to temporary files when
+// exceeding maxMem, and merged at last.
+func sortExternal(files []string,
+	key func(record *fastx.Record) ([]byte, int),
+	less func(k1 []byte, n1 int, k2 []byte, n2 int) bool,
+	maxMem int, tmpDir string, alphabet *seq.Alphabet, idRegexp string, lineWidth int, outFile string, quiet bool) {
+
+	sorter := lib.NewExtSorter(tmpDir, maxMem, func(a, b []byte) bool {
+		k1, n1, _ := decodeSortItemKey(a)
+		k2, n2, _ := decodeSortItemKey(b)
+		return less(k1, n1, k2, n2)
+	})
+
+	if !quiet {
+		log.Infof("read and sort sequences ...")
+	}
+	var alphabet2 *seq.Alphabet
+	var isFastq bool
+	var item []byte
+	var num int
+	for _, file := range files {
+		fastxReader, err := fastx.NewReader(alphabet, file, idRegexp)
+		checkError(err)
+		for {
+			record, err := fastxReader.Read()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				checkError(err)
+				break
+			}
+			if fastxReader.IsFastq {
+				isFastq = true
+			}
+			if alphabet2 == nil {
+				alphabet2 = record.Seq.Alphabet
+			}
+
+			k, n := key(record)
+			item = encodeSortItem(item[:0], k, n, record)
+			checkError(sorter.Add(item))
+			num++
+		}
+	}
+	if isFastq {
+		lineWidth = 0
+		fastx.ForcelyOutputFastq = true
+	}
+
+	it, err := sorter.Sort()
+	checkError(err)
+	if !quiet {
+		log.Infof("%d sequences loaded, %d sorted runs saved in temporary files", num, sorter.Runs())
+		log.Infof("output ...")
+	}
+
+	outfh, err := xopen.Wopen(outFile)
+	checkError(err)
+	defer outfh.Close()
+
+	var record *fastx.Record
+	var name, s, q []byte
+	for {
+		item, err = it.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			checkError(err)
+		}
+		_, _, item = decodeSortItemKey(item)
+		name, item = decodeSortItemField(item)
+		s, q = decodeSortItemField(item)
+		if len(q) > 0 {
+			record, _ = fastx.NewRecordWithQualWithoutValidation(alphabet2, []byte{}, name, []byte{}, s, q)
+		} else {
+			record, _ = fastx.NewRecordWithoutValidation(alphabet2, []byte{}, name, []byte{}, s)
+		}
+		record.FormatToWriter(outfh, lineWidth)
+	}
+	checkError(it.Close())
+}
+
+// encodeSortItem appends a record and its sorting key to buf,
+// in the layout of: key, number, name, sequence, quality,
+// where the first three variable-length fields are prefixed with lengths.
+func encodeSortItem(buf []byte, k []byte, n int, record *fastx.Record) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(len(k)))]...)
+	buf = append(buf, k...)
+	buf = append(buf, tmp[:binary.PutVarint(tmp[:], int64(n))]...)
+	buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(len(record.Name)))]...)
+	buf = append(buf, record.Name...)
+	buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(len(record.Seq.Seq)))]...)
+	buf = append(buf, record.Seq.Seq...)
+	return append(buf, record.Seq.Qual...)
+}
+
+// decodeSortItemKey returns the key and number of an item encoded by
+// encodeSortItem, and the remaining part.
+func decodeSortItemKey(item []byte) ([]byte, int, []byte) {
+	k, item := decodeSortItemField(item)
+	n, l := binary.Varint(item)
+	return k, int(n), item[l:]
+}
+
+// decodeSortItemField returns a length-prefixed field and the remaining part.
+func decodeSortItemField(item []byte) ([]byte, []byte) {
+	n, l := binary.Uvarint(item)
+	return item[l : l+int(n)], item[l+int(n):]
 }
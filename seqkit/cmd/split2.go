@@ -46,6 +46,11 @@ var split2Cmd = &cobra.Command{
 This command supports FASTA and paired- or single-end FASTQ with low memory
 occupation and fast speed.
 
+For an interleaved file (--interleaved), where read2 follows read1 of the
+same fragment, mates are always saved into the same part, and the value of
+-s/--by-size is the number of read pairs. Mates are checked as
+"seqkit validate" does, and an error is reported for any orphan read.
+
 The prefix of output files:
   1. For stdin: stdin
   2. Others: same to the input file
@@ -83,6 +88,10 @@ The extension of output files:
 
 		read1 := getFlagString(cmd, "read1")
 		read2 := getFlagString(cmd, "read2")
+		interleaved := getFlagBool(cmd, "interleaved")
+		if interleaved && (read1 != "" || read2 != "") {
+			checkError(fmt.Errorf("flag --interleaved is not allowed with -1/--read1 or -2/--read2"))
+		}
 
 		size := getFlagNonNegativeInt(cmd, "by-size")
 		parts := getFlagNonNegativeInt(cmd, "by-part")
@@ -156,10 +165,15 @@ The extension of output files:
 			}
 		}
 
+		unit := "sequences"
+		if interleaved {
+			unit = "read pairs"
+		}
+
 		if !quiet {
 			log.Infof("split seqs from %s", source)
 			if bySize {
-				log.Infof("split into %d seqs per file", size)
+				log.Infof("split into %d %s per file", size, unit)
 			} else if byParts {
 				log.Infof("split into %d parts", parts)
 			} else {
@@ -233,6 +247,16 @@ The extension of output files:
 
 				var flag bool
 
+				// for interleaved file
+				var mate *fastx.Record // read1 of current pair
+				var nRecords int
+				write := func(outfh *xopen.Writer) {
+					if mate != nil {
+						mate.FormatToWriter(outfh, config.LineWidth)
+					}
+					record.FormatToWriter(outfh, config.LineWidth)
+				}
+
 				if bySize || byLength { // by size or by length
 				} else if byParts { // by part
 					outfhs = make([]*xopen.Writer, 0, parts)
@@ -275,13 +299,26 @@ The extension of output files:
 						once = false
 					}
 
+					if interleaved {
+						nRecords++
+						if mate == nil {
+							mate = record.Clone()
+							continue
+						}
+						if problem := mateProblem(mate, record); problem != "" {
+							checkError(fmt.Errorf(`%s: record #%d and #%d are not mates, %s. please check it with "seqkit validate"`,
+								file, nRecords-1, nRecords, problem))
+						}
+						n += int64(len(mate.Seq.Seq))
+					}
+
 					n += int64(len(record.Seq.Seq))
 
 					if bySize {
 						if j == size {
 							outfhPre.Close()
 							if !quiet {
-								log.Infof("write %d sequences to file: %s\n", j, outfilePre)
+								log.Infof("write %d %s to file: %s\n", j, unit, outfilePre)
 							}
 
 							i++
@@ -318,12 +355,12 @@ The extension of output files:
 						}
 
 						if n >= length {
-							record.FormatToWriter(outfhPre, config.LineWidth)
+							write(outfhPre)
 							j++
 
 							outfhPre.Close()
 							if !quiet {
-								log.Infof("write %d sequences to file: %s\n", j, outfilePre)
+								log.Infof("write %d %s to file: %s\n", j, unit, outfilePre)
 							}
 							i++
 
@@ -364,12 +401,12 @@ The extension of output files:
 							j = 0
 						}
 
-						record.FormatToWriter(outfhPre, config.LineWidth)
+						write(outfhPre)
 
 						j++ // increase size
 					} else if byLength {
 						if flag {
-							record.FormatToWriter(outfhPre, config.LineWidth)
+							write(outfhPre)
 
 							j++
 						}
@@ -391,7 +428,7 @@ The extension of output files:
 							outfiles = append(outfiles, outfile)
 						}
 
-						record.FormatToWriter(outfhs[i], config.LineWidth)
+						write(outfhs[i])
 						counts[i]++
 
 						i++
@@ -400,6 +437,12 @@ The extension of output files:
 						}
 					}
 
+					mate = nil
+				}
+
+				if mate != nil {
+					checkError(fmt.Errorf(`%s: the last record #%d has no mate. please check it with "seqkit validate"`,
+						file, nRecords))
 				}
 
 				if byParts {
@@ -410,7 +453,7 @@ The extension of output files:
 							if counts[i] == 0 {
 
 							} else {
-								log.Infof("write %d sequences to file: %s\n", counts[i], outfiles[i])
+								log.Infof("write %d %s to file: %s\n", counts[i], unit, outfiles[i])
 							}
 						}
 					}
@@ -420,7 +463,7 @@ The extension of output files:
 					if j == 0 {
 						os.Remove(outfilePre)
 					} else {
-						log.Infof("write %d sequences to file: %s\n", j, outfilePre)
+						log.Infof("write %d %s to file: %s\n", j, unit, outfilePre)
 					}
 				}
 
@@ -436,6 +479,7 @@ func init() {
 
 	split2Cmd.Flags().StringP("read1", "1", "", "(gzipped) read1 file")
 	split2Cmd.Flags().StringP("read2", "2", "", "(gzipped) read2 file")
+	split2Cmd.Flags().BoolP("interleaved", "", false, "the input is an interleaved file, mates are saved into the same part")
 	split2Cmd.Flags().IntP("by-size", "s", 0, "split sequences into multi parts with N sequences")
 	split2Cmd.Flags().IntP("by-part", "p", 0, "split sequences into N parts")
 	split2Cmd.Flags().StringP("by-length", "l", "", "split sequences into chunks of >=N bases, supports K/M/G suffix")
@@ -31,13 +31,12 @@ import (
 
 	"github.com/cznic/sortutil"
 	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
 	"github.com/shenwei356/bio/seq"
 	"github.com/shenwei356/bio/seqio/fastx"
-	"github.com/shenwei356/bio/util"
-	"github.com/shenwei356/util/byteutil"
-	"github.com/shenwei356/util/math"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
 	"github.com/tatsushid/go-prettytable"
 )
 
@@ -51,6 +50,10 @@ var statCmd = &cobra.Command{
 Tips:
   1. For lots of small files (especially on SDD), use big value of '-j' to
      parallelize counting.
+  2. For interleaved files (--interleaved), statistics of read1 and read2
+     are reported separately, with the labels "<file>:R1" and "<file>:R2".
+     An error is reported for any orphan read, please check the files
+     with "seqkit validate".
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -71,14 +74,19 @@ Tips:
 				checkError(fmt.Errorf("value of -G (--gap-letters) contains non-ASCII characters"))
 			}
 		}
-		gapLettersBytes := []byte(gapLetters)
-		gcLettersBytes := []byte{'g', 'c', 'G', 'C'}
 
 		all := getFlagBool(cmd, "all")
 		tabular := getFlagBool(cmd, "tabular")
+		outFormat := getFlagOutFormat(cmd)
 		skipErr := getFlagBool(cmd, "skip-err")
 		fqEncoding := parseQualityEncoding(getFlagString(cmd, "fq-encoding"))
+		opt := &lib.StatsOptions{
+			All:        all,
+			GapLetters: []byte(gapLetters),
+			FqEncoding: fqEncoding,
+		}
 		basename := getFlagBool(cmd, "basename")
+		interleaved := getFlagBool(cmd, "interleaved")
 		stdinLabel := getFlagString(cmd, "stdin-label")
 		replaceStdinLabel := stdinLabel != "-"
 
@@ -88,22 +96,23 @@ Tips:
 		checkError(err)
 		defer outfh.Close()
 
-		// tabular output
-		if tabular {
-			colnames := []string{
-				"file",
-				"format",
-				"type",
-				"num_seqs",
-				"sum_len",
-				"min_len",
-				"avg_len",
-				"max_len",
-			}
-			if all {
-				colnames = append(colnames, []string{"Q1", "Q2", "Q3", "sum_gap", "N50", "Q20(%)", "Q30(%)", "GC(%)"}...)
+		var jw *jsonTableWriter
+		if outFormat != outFormatTSV {
+			jw, err = newJSONTableWriter(outfh, outFormat, "stats", statJSONColumns(all))
+			checkError(err)
+			tabular = true
+		}
+		writeRow := func(info statInfo) {
+			if jw != nil {
+				checkError(jw.WriteRow(statJSONValues(info, all)...))
+				return
 			}
-			outfh.WriteString(strings.Join(colnames, "\t") + "\n")
+			outfh.WriteString(statTabularRow(info, all))
+		}
+
+		// tabular output
+		if tabular && jw == nil {
+			outfh.WriteString(statTabularHeader(all))
 		}
 
 		ch := make(chan statInfo, config.Threads)
@@ -132,35 +141,7 @@ Tips:
 					if !tabular {
 						statInfos = append(statInfos, info)
 					} else {
-						if !all {
-							outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%.1f\t%d\n",
-								info.file,
-								info.format,
-								info.t,
-								info.num,
-								info.lenSum,
-								info.lenMin,
-								info.lenAvg,
-								info.lenMax))
-						} else {
-							outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%.1f\t%d\t%.1f\t%.1f\t%.1f\t%d\t%d\t%.2f\t%.2f\t%.2f\n",
-								info.file,
-								info.format,
-								info.t,
-								info.num,
-								info.lenSum,
-								info.lenMin,
-								info.lenAvg,
-								info.lenMax,
-								info.Q1,
-								info.Q2,
-								info.Q3,
-								info.gapSum,
-								info.N50,
-								info.q20,
-								info.q30,
-								info.gc))
-						}
+						writeRow(info)
 					}
 					id++
 				} else { // check bufferd result
@@ -169,35 +150,7 @@ Tips:
 							if !tabular {
 								statInfos = append(statInfos, info1)
 							} else {
-								if !all {
-									outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%.1f\t%d\n",
-										info1.file,
-										info1.format,
-										info1.t,
-										info1.num,
-										info1.lenSum,
-										info1.lenMin,
-										info1.lenAvg,
-										info1.lenMax))
-								} else {
-									outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%.1f\t%d\t%.1f\t%.1f\t%.1f\t%d\t%d\t%.2f\t%.2f\t%.2f\n",
-										info1.file,
-										info1.format,
-										info1.t,
-										info1.num,
-										info1.lenSum,
-										info1.lenMin,
-										info1.lenAvg,
-										info1.lenMax,
-										info1.Q1,
-										info1.Q2,
-										info1.Q3,
-										info1.gapSum,
-										info1.N50,
-										info1.q20,
-										info1.q30,
-										info1.gc))
-								}
+								writeRow(info1)
 							}
 
 							delete(buf, info1.id)
@@ -223,35 +176,7 @@ Tips:
 					if !tabular {
 						statInfos = append(statInfos, info)
 					} else {
-						if !all {
-							outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%.1f\t%d\n",
-								info.file,
-								info.format,
-								info.t,
-								info.num,
-								info.lenSum,
-								info.lenMin,
-								info.lenAvg,
-								info.lenMax))
-						} else {
-							outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%.1f\t%d\t%.1f\t%.1f\t%.1f\t%d\t%d\t%.2f\t%.2f\t%.2f\n",
-								info.file,
-								info.format,
-								info.t,
-								info.num,
-								info.lenSum,
-								info.lenMin,
-								info.lenAvg,
-								info.lenMax,
-								info.Q1,
-								info.Q2,
-								info.Q3,
-								info.gapSum,
-								info.N50,
-								info.q20,
-								info.q30,
-								info.gc))
-						}
+						writeRow(info)
 					}
 				}
 			}
@@ -287,26 +212,22 @@ Tips:
 			token <- 1
 			wg.Add(1)
 			id++
+			if interleaved { // two rows for a file
+				id++
+			}
 			go func(file string, id uint64) {
 				defer func() {
 					wg.Done()
 					<-token
 				}()
 
-				var gapSum uint64
-				var gcSum uint64
-
-				lensStats := util.NewLengthStats()
-
-				var q20, q30 int64
-				var q byte
-				var encodeOffset int = fqEncoding.Offset()
-				var seqFormat, t string
-				var record *fastx.Record
-				var fastxReader *fastx.Reader
-				var err error
+				if interleaved {
+					statInterleaved(file, id-1, alphabet, idRegexp, opt, basename,
+						replaceStdinLabel, stdinLabel, ch, cancel)
+					return
+				}
 
-				fastxReader, err = fastx.NewReader(alphabet, file, idRegexp)
+				fastxReader, err := fastx.NewReader(alphabet, file, idRegexp)
 				if err != nil {
 					select {
 					case <-cancel:
@@ -320,108 +241,23 @@ Tips:
 					return
 				}
 
-				seqFormat = ""
-
-				for {
-					record, err = fastxReader.Read()
-					if err != nil {
-						if err == io.EOF {
-							break
-						}
-						if err != nil {
-							select {
-							case <-cancel:
-								return
-							default:
-							}
-							if replaceStdinLabel && isStdin(file) {
-								file = stdinLabel
-							}
-							ch <- statInfo{file: file, err: err, id: id}
-							return
-						}
-						break
-					}
-
-					if seqFormat == "" {
-						if len(record.Seq.Qual) > 0 {
-							seqFormat = "FASTQ"
-						} else {
-							seqFormat = "FASTA"
-						}
-					}
-
-					lensStats.Add(uint64(len(record.Seq.Seq)))
-
-					if all {
-						if fastxReader.IsFastq {
-							for _, q = range record.Seq.Qual {
-								if int(q)-encodeOffset >= 20 {
-									q20++
-									if int(q)-encodeOffset >= 30 {
-										q30++
-									}
-								}
-							}
-						}
-
-						gapSum += uint64(byteutil.CountBytes(record.Seq.Seq, gapLettersBytes))
-						gcSum += uint64(byteutil.CountBytes(record.Seq.Seq, gcLettersBytes))
-					}
-				}
-
-				if fastxReader.Alphabet() == seq.DNAredundant {
-					t = "DNA"
-				} else if fastxReader.Alphabet() == seq.RNAredundant {
-					t = "RNA"
-				} else if seqFormat == "" && fastxReader.Alphabet() == seq.Unlimit {
-					t = ""
-				} else {
-					t = fastxReader.Alphabet().String()
-				}
-
-				var n50 uint64
-				var l50 int
-				var q1, q2, q3 float64
-				if all {
-					n50 = lensStats.N50()
-					l50 = lensStats.L50()
-					q1, q2, q3 = lensStats.Q1(), lensStats.Q2(), lensStats.Q3()
-				}
-
+				stats, err := lib.ComputeStats(fastxReader, opt)
 				select {
 				case <-cancel:
 					return
 				default:
 				}
-				if lensStats.Count() == 0 {
-					if basename {
-						file = filepath.Base(file)
-					}
-					if replaceStdinLabel && isStdin(file) {
-						file = stdinLabel
-					}
-					ch <- statInfo{file, seqFormat, t,
-						0, 0, 0, 0,
-						0, 0, 0, 0,
-						0, 0, 0,
-						0, 0, 0,
-						nil, id}
-				} else {
-					if basename {
-						file = filepath.Base(file)
-					}
-					if replaceStdinLabel && isStdin(file) {
-						file = stdinLabel
-					}
-					ch <- statInfo{file, seqFormat, t,
-						lensStats.Count(), lensStats.Sum(), gapSum, lensStats.Min(),
-						math.Round(lensStats.Mean(), 1), lensStats.Max(), n50, l50,
-						q1, q2, q3,
-						math.Round(float64(q20)/float64(lensStats.Sum())*100, 2), math.Round(float64(q30)/float64(lensStats.Sum())*100, 2),
-						math.Round(float64(gcSum)/float64(lensStats.Sum())*100, 2),
-						nil, id}
+				if basename && err == nil {
+					file = filepath.Base(file)
+				}
+				if replaceStdinLabel && isStdin(file) {
+					file = stdinLabel
 				}
+				if err != nil {
+					ch <- statInfo{file: file, err: err, id: id}
+					return
+				}
+				ch <- newStatInfo(file, stats, id)
 			}(file, id)
 		}
 
@@ -437,6 +273,9 @@ Tips:
 		}
 
 		if tabular {
+			if jw != nil {
+				checkError(jw.Close())
+			}
 			return
 		}
 
@@ -535,6 +374,194 @@ type statInfo struct {
 	id  uint64
 }
 
+// statInterleaved computes statistics of read1 and read2 of an interleaved
+// file concurrently, and sends them to ch with the ids id and id+1.
+func statInterleaved(file string, id uint64, alphabet *seq.Alphabet, idRegexp string,
+	opt *lib.StatsOptions, basename bool, replaceStdinLabel bool, stdinLabel string,
+	ch chan statInfo, cancel chan struct{}) {
+	label := file
+	if basename {
+		label = filepath.Base(label)
+	}
+	if replaceStdinLabel && isStdin(file) {
+		label = stdinLabel
+	}
+
+	reader, err := newInterleavedReader(alphabet, file, idRegexp)
+	if err != nil {
+		select {
+		case <-cancel:
+			return
+		default:
+		}
+		ch <- statInfo{file: label, err: err, id: id}
+		return
+	}
+	reader.Strict = true
+
+	r1 := &mateReader{ch: make(chan *fastx.Record, 128), alphabet: reader.Alphabet}
+	r2 := &mateReader{ch: make(chan *fastx.Record, 128), alphabet: reader.Alphabet}
+	go func() {
+		err := reader.Walk(func(mate1, mate2 *fastx.Record) bool {
+			r1.ch <- mate1
+			r2.ch <- mate2.Clone()
+			return false
+		})
+		// the file name is added by the caller
+		err = errors.Cause(err)
+		r1.err, r2.err = err, err
+		close(r1.ch)
+		close(r2.ch)
+	}()
+
+	var stats1, stats2 *lib.SeqStats
+	var err1, err2 error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		stats2, err2 = lib.ComputeStats(r2, opt)
+	}()
+	stats1, err1 = lib.ComputeStats(r1, opt)
+	wg.Wait()
+
+	select {
+	case <-cancel:
+		return
+	default:
+	}
+	if err1 != nil {
+		ch <- statInfo{file: label, err: err1, id: id}
+		return
+	}
+	if err2 != nil {
+		ch <- statInfo{file: label, err: err2, id: id}
+		return
+	}
+	ch <- newStatInfo(label+":R1", stats1, id)
+	ch <- newStatInfo(label+":R2", stats2, id+1)
+}
+
+// mateReader is a lib.RecordReader of read1 or read2 of an interleaved file,
+// records are sent via the channel, and err is returned after it's closed.
+type mateReader struct {
+	ch       chan *fastx.Record
+	err      error
+	alphabet func() *seq.Alphabet
+}
+
+func (r *mateReader) Read() (*fastx.Record, error) {
+	record, ok := <-r.ch
+	if !ok {
+		if r.err != nil {
+			return nil, r.err
+		}
+		return nil, io.EOF
+	}
+	return record, nil
+}
+
+// Alphabet returns the alphabet of the interleaved file.
+func (r *mateReader) Alphabet() *seq.Alphabet {
+	return r.alphabet()
+}
+
+func newStatInfo(file string, stats *lib.SeqStats, id uint64) statInfo {
+	return statInfo{file, stats.Format, stats.Type,
+		stats.Num, stats.LenSum, stats.GapSum, stats.LenMin,
+		stats.LenAvg, stats.LenMax, stats.N50, stats.L50,
+		stats.Q1, stats.Q2, stats.Q3,
+		stats.Q20, stats.Q30,
+		stats.GC,
+		nil, id}
+}
+
+// statTabularHeader returns the header line of tabular output.
+func statTabularHeader(all bool) string {
+	colnames := []string{
+		"file",
+		"format",
+		"type",
+		"num_seqs",
+		"sum_len",
+		"min_len",
+		"avg_len",
+		"max_len",
+	}
+	if all {
+		colnames = append(colnames, []string{"Q1", "Q2", "Q3", "sum_gap", "N50", "Q20(%)", "Q30(%)", "GC(%)"}...)
+	}
+	return strings.Join(colnames, "\t") + "\n"
+}
+
+// statTabularRow returns a line of tabular output.
+func statTabularRow(info statInfo, all bool) string {
+	if !all {
+		return fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%.1f\t%d\n",
+			info.file,
+			info.format,
+			info.t,
+			info.num,
+			info.lenSum,
+			info.lenMin,
+			info.lenAvg,
+			info.lenMax)
+	}
+	return fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%.1f\t%d\t%.1f\t%.1f\t%.1f\t%d\t%d\t%.2f\t%.2f\t%.2f\n",
+		info.file,
+		info.format,
+		info.t,
+		info.num,
+		info.lenSum,
+		info.lenMin,
+		info.lenAvg,
+		info.lenMax,
+		info.Q1,
+		info.Q2,
+		info.Q3,
+		info.gapSum,
+		info.N50,
+		info.q20,
+		info.q30,
+		info.gc)
+}
+
+// statJSONColumns returns the fields of JSON/NDJSON records.
+func statJSONColumns(all bool) []string {
+	colnames := []string{
+		"file",
+		"format",
+		"type",
+		"num_seqs",
+		"sum_len",
+		"min_len",
+		"avg_len",
+		"max_len",
+	}
+	if all {
+		colnames = append(colnames, []string{"q1", "q2", "q3", "sum_gap", "n50", "q20_pct", "q30_pct", "gc_pct"}...)
+	}
+	return colnames
+}
+
+// statJSONValues returns the values of a JSON/NDJSON record.
+func statJSONValues(info statInfo, all bool) []interface{} {
+	values := []interface{}{
+		info.file,
+		info.format,
+		info.t,
+		info.num,
+		info.lenSum,
+		info.lenMin,
+		info.lenAvg,
+		info.lenMax,
+	}
+	if all {
+		values = append(values, info.Q1, info.Q2, info.Q3, info.gapSum, info.N50, info.q20, info.q30, info.gc)
+	}
+	return values
+}
+
 func init() {
 	RootCmd.AddCommand(statCmd)
 
@@ -544,6 +571,7 @@ func init() {
 	statCmd.Flags().BoolP("skip-err", "e", false, "skip error, only show warning message")
 	statCmd.Flags().StringP("fq-encoding", "E", "sanger", `fastq quality encoding. available values: 'sanger', 'solexa', 'illumina-1.3+', 'illumina-1.5+', 'illumina-1.8+'.`)
 	statCmd.Flags().BoolP("basename", "b", false, "only output basename of files")
+	statCmd.Flags().BoolP("interleaved", "", false, "input files are interleaved, report statistics of read1 and read2 separately")
 	statCmd.Flags().StringP("stdin-label", "i", "-", `label for replacing default "-" for stdin`)
 }
 
@@ -35,6 +35,7 @@ import (
 	"github.com/shenwei356/util/byteutil"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
 )
 
 // subseqCmd represents the subseq command
@@ -67,7 +68,7 @@ Examples:
 		seq.ValidateSeq = false
 		gtf.Threads = config.Threads
 		fai.MapWholeFile = false
-		Threads = config.Threads
+		lib.Threads = config.Threads
 		runtime.GOMAXPROCS(config.Threads)
 
 		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
@@ -124,7 +125,7 @@ Examples:
 		var start, end int
 
 		var gtfFeaturesMap map[string]type2gtfFeatures
-		var bedFeatureMap map[string][]BedFeature
+		var bedFeatureMap map[string][]lib.BedFeature
 
 		if region != "" {
 			if !reRegion.MatchString(region) {
@@ -178,14 +179,14 @@ Examples:
 			if len(choosedFeatures) > 0 {
 				checkError(fmt.Errorf("when given flag -b (--bed), flag -f (--feature) is not allowed"))
 			}
-			bedFeatureMap = make(map[string][]BedFeature)
-			Threads = config.Threads // threads of ReadBedFeatures
+			bedFeatureMap = make(map[string][]lib.BedFeature)
+			lib.Threads = config.Threads // threads of ReadBedFeatures
 
-			var features []BedFeature
+			var features []lib.BedFeature
 			if len(chrs) > 0 {
-				features, err = ReadBedFilteredFeatures(bedFile, chrs)
+				features, err = lib.ReadBedFilteredFeatures(bedFile, chrs)
 			} else {
-				features, err = ReadBedFeatures(bedFile)
+				features, err = lib.ReadBedFeatures(bedFile)
 			}
 			checkError(err)
 
@@ -193,7 +194,7 @@ Examples:
 			for _, feature := range features {
 				chr = strings.ToLower(feature.Chr)
 				if _, ok := bedFeatureMap[chr]; !ok {
-					bedFeatureMap[chr] = []BedFeature{}
+					bedFeatureMap[chr] = []lib.BedFeature{}
 				}
 				bedFeatureMap[chr] = append(bedFeatureMap[chr], feature)
 			}
@@ -367,10 +368,9 @@ func subseqByGTFFile(outfh *xopen.Writer, record *fastx.Record, lineWidth int,
 	onlyFlank bool, upStream int, downStream int, gtfTag string) {
 
 	seqname := strings.ToLower(string(record.ID))
+	opt := &lib.FlankOptions{UpStream: upStream, DownStream: downStream, OnlyFlank: onlyFlank}
 
-	var strand, tag, outname, flankInfo string
-	var s, e int
-	var subseq *seq.Seq
+	var tag string
 
 	featsMap := make(map[string]struct{}, len(choosedFeatures))
 	for _, chr := range choosedFeatures {
@@ -384,54 +384,6 @@ func subseqByGTFFile(outfh *xopen.Writer, record *fastx.Record, lineWidth int,
 			}
 		}
 		for _, feature := range gtfFeaturesMap[seqname][featureType] {
-			s, e = feature.Start, feature.End
-			if feature.Strand != nil && *feature.Strand == "-" {
-				if onlyFlank {
-					if upStream > 0 {
-						s = feature.End + 1
-						e = feature.End + upStream
-					} else {
-						s = feature.Start - downStream
-						e = feature.Start - 1
-					}
-				} else {
-					s = feature.Start - downStream // seq.SubSeq will check it
-					e = feature.End + upStream
-				}
-				if s < 1 {
-					s = 1
-				}
-				if e > len(record.Seq.Seq) {
-					e = len(record.Seq.Seq)
-				}
-				subseq = record.Seq.SubSeq(s, e).RevComInplace()
-			} else {
-				if onlyFlank {
-					if upStream > 0 {
-						s = feature.Start - upStream
-						e = feature.Start - 1
-					} else {
-						s = e + 1
-						e = e + downStream
-					}
-				} else {
-					s = feature.Start - upStream
-					e = feature.End + downStream
-				}
-				if s < 1 {
-					s = 1
-				}
-				if e > len(record.Seq.Seq) {
-					e = len(record.Seq.Seq)
-				}
-				subseq = record.Seq.SubSeq(s, e)
-			}
-
-			if feature.Strand == nil {
-				strand = "."
-			} else {
-				strand = *feature.Strand
-			}
 			tag = ""
 			for _, arrtribute := range feature.Attributes {
 				if arrtribute.Tag == gtfTag {
@@ -439,33 +391,7 @@ func subseqByGTFFile(outfh *xopen.Writer, record *fastx.Record, lineWidth int,
 					break
 				}
 			}
-			if upStream > 0 {
-				if onlyFlank {
-					flankInfo = fmt.Sprintf("_usf:%d", upStream)
-				} else if downStream > 0 {
-					flankInfo = fmt.Sprintf("_us:%d_ds:%d", upStream, downStream)
-				} else {
-					flankInfo = fmt.Sprintf("_us:%d", upStream)
-				}
-			} else if downStream > 0 {
-				if onlyFlank {
-					flankInfo = fmt.Sprintf("_dsf:%d", downStream)
-				} else if upStream > 0 {
-					flankInfo = fmt.Sprintf("_us:%d_ds:%d", upStream, downStream)
-				} else {
-					flankInfo = fmt.Sprintf("_ds:%d", downStream)
-				}
-			} else {
-				flankInfo = ""
-			}
-			outname = fmt.Sprintf("%s_%d-%d:%s%s %s", record.ID, feature.Start, feature.End, strand, flankInfo, tag)
-			var newRecord *fastx.Record
-			var err error
-			if len(subseq.Qual) > 0 {
-				newRecord, err = fastx.NewRecordWithQualWithoutValidation(record.Seq.Alphabet, []byte(outname), []byte(outname), []byte{}, subseq.Seq, subseq.Qual)
-			} else {
-				newRecord, err = fastx.NewRecordWithoutValidation(record.Seq.Alphabet, []byte(outname), []byte(outname), []byte{}, subseq.Seq)
-			}
+			newRecord, err := lib.SubRecordByFeature(record, feature.Start, feature.End, feature.Strand, tag, opt)
 			checkError(err)
 			outfh.Write(newRecord.Format(lineWidth))
 		}
@@ -473,93 +399,18 @@ func subseqByGTFFile(outfh *xopen.Writer, record *fastx.Record, lineWidth int,
 }
 
 func subSeqByBEDFile(outfh *xopen.Writer, record *fastx.Record, lineWidth int,
-	bedFeatureMap map[string][]BedFeature,
+	bedFeatureMap map[string][]lib.BedFeature,
 	onlyFlank bool, upStream, downStream int) {
 	seqname := strings.ToLower(string(record.ID))
+	opt := &lib.FlankOptions{UpStream: upStream, DownStream: downStream, OnlyFlank: onlyFlank}
 
-	var strand, geneID, outname, flankInfo string
-	var s, e int
-	var subseq *seq.Seq
+	var geneID string
 	for _, feature := range bedFeatureMap[seqname] {
-		s, e = feature.Start, feature.End
-		if feature.Strand != nil && *feature.Strand == "-" {
-			if onlyFlank {
-				if upStream > 0 {
-					s = feature.End + 1
-					e = feature.End + upStream
-				} else {
-					s = feature.Start - downStream
-					e = feature.Start - 1
-				}
-			} else {
-				s = feature.Start - downStream // seq.SubSeq will check it
-				e = feature.End + upStream
-			}
-			if s < 1 {
-				s = 1
-			}
-			if e > len(record.Seq.Seq) {
-				e = len(record.Seq.Seq)
-			}
-			subseq = record.Seq.SubSeq(s, e).RevComInplace()
-		} else {
-			if onlyFlank {
-				if upStream > 0 {
-					s = feature.Start - upStream
-					e = feature.Start - 1
-				} else {
-					s = e + 1
-					e = e + downStream
-				}
-			} else {
-				s = feature.Start - upStream
-				e = feature.End + downStream
-			}
-			if s < 1 {
-				s = 1
-			}
-			if e > len(record.Seq.Seq) {
-				e = len(record.Seq.Seq)
-			}
-			subseq = record.Seq.SubSeq(s, e)
-		}
-
-		if feature.Strand == nil {
-			strand = "."
-		} else {
-			strand = *feature.Strand
-		}
 		geneID = ""
 		if feature.Name != nil {
 			geneID = *feature.Name
 		}
-		if upStream > 0 {
-			if onlyFlank {
-				flankInfo = fmt.Sprintf("_usf:%d", upStream)
-			} else if downStream > 0 {
-				flankInfo = fmt.Sprintf("_us:%d_ds:%d", upStream, downStream)
-			} else {
-				flankInfo = fmt.Sprintf("_us:%d", upStream)
-			}
-		} else if downStream > 0 {
-			if onlyFlank {
-				flankInfo = fmt.Sprintf("_dsf:%d", downStream)
-			} else if upStream > 0 {
-				flankInfo = fmt.Sprintf("_us:%d_ds:%d", upStream, downStream)
-			} else {
-				flankInfo = fmt.Sprintf("_ds:%d", downStream)
-			}
-		} else {
-			flankInfo = ""
-		}
-		outname = fmt.Sprintf("%s_%d-%d:%s%s %s", record.ID, feature.Start, feature.End, strand, flankInfo, geneID)
-		var newRecord *fastx.Record
-		var err error
-		if len(subseq.Qual) > 0 {
-			newRecord, err = fastx.NewRecordWithQualWithoutValidation(record.Seq.Alphabet, []byte(outname), []byte(outname), []byte{}, subseq.Seq, subseq.Qual)
-		} else {
-			newRecord, err = fastx.NewRecordWithoutValidation(record.Seq.Alphabet, []byte(outname), []byte(outname), []byte{}, subseq.Seq)
-		}
+		newRecord, err := lib.SubRecordByFeature(record, feature.Start, feature.End, feature.Strand, geneID, opt)
 		checkError(err)
 		outfh.Write(newRecord.Format(lineWidth))
 	}
@@ -21,22 +21,17 @@
 package cmd
 
 import (
-	"bytes"
-	"crypto/md5"
-	"encoding/binary"
-	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
 	"path/filepath"
 	"runtime"
-	"strings"
 	"sync"
 
-	"github.com/cespare/xxhash/v2"
 	"github.com/shenwei356/bio/seq"
 	"github.com/shenwei356/bio/seqio/fastx"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
 	"github.com/twotwotwo/sorts/sortutil"
 )
 
@@ -103,6 +98,16 @@ Examples:
 		all := getFlagBool(cmd, "all")
 		rna2dna := getFlagBool(cmd, "rna2dna")
 		singleStrand := getFlagBool(cmd, "single-strand")
+		outFormat := getFlagOutFormat(cmd)
+
+		opt := &lib.DigestOptions{
+			Circular:     circular,
+			K:            k,
+			SingleStrand: singleStrand,
+			RemoveGaps:   removeGaps,
+			GapLetters:   gapLetters,
+			RNA2DNA:      rna2dna,
+		}
 
 		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
 
@@ -110,6 +115,31 @@ Examples:
 		checkError(err)
 		defer outfh.Close()
 
+		var jw *jsonTableWriter
+		if outFormat != outFormatTSV {
+			columns := []string{"digest", "file"}
+			if all {
+				columns = append(columns, "num_seqs", "sum_len")
+			}
+			jw, err = newJSONTableWriter(outfh, outFormat, "sum", columns)
+			checkError(err)
+		}
+		writeResult := func(r *SumResult) {
+			if jw != nil {
+				if all {
+					checkError(jw.WriteRow(r.Digest, r.File, r.SeqNum, r.SeqLen))
+				} else {
+					checkError(jw.WriteRow(r.Digest, r.File))
+				}
+				return
+			}
+			if all {
+				fmt.Fprintf(outfh, "%s\t%s\t%d\t%d\n", r.Digest, r.File, r.SeqNum, r.SeqLen)
+			} else {
+				fmt.Fprintf(outfh, "%s\t%s\n", r.Digest, r.File)
+			}
+		}
+
 		tokens := make(chan int, config.Threads)
 		done := make(chan int)
 		var wg sync.WaitGroup
@@ -133,12 +163,7 @@ Examples:
 
 				if _id == id { // right there
 					if r.ok {
-						if all {
-							fmt.Fprintf(outfh, "%s\t%s\t%d\t%d\n", r.result.Digest, r.result.File, r.result.SeqNum, r.result.SeqLen)
-						} else {
-							fmt.Fprintf(outfh, "%s\t%s\n", r.result.Digest, r.result.File)
-						}
-
+						writeResult(r.result)
 						outfh.Flush()
 					}
 					id++
@@ -149,11 +174,7 @@ Examples:
 
 				if _r, ok = m[id]; ok { // check buffered
 					if _r.ok {
-						if all {
-							fmt.Fprintf(outfh, "%s\t%s\t%d\t%d\n", _r.result.Digest, _r.result.File, _r.result.SeqNum, _r.result.SeqLen)
-						} else {
-							fmt.Fprintf(outfh, "%s\t%s\n", _r.result.Digest, _r.result.File)
-						}
+						writeResult(_r.result)
 						outfh.Flush()
 					}
 					delete(m, id)
@@ -173,11 +194,7 @@ Examples:
 					_r = m[_id]
 
 					if _r.ok {
-						if all {
-							fmt.Fprintf(outfh, "%s\t%s\t%d\t%d\n", _r.result.Digest, _r.result.File, _r.result.SeqNum, _r.result.SeqLen)
-						} else {
-							fmt.Fprintf(outfh, "%s\t%s\n", _r.result.Digest, _r.result.File)
-						}
+						writeResult(_r.result)
 						outfh.Flush()
 					}
 				}
@@ -197,315 +214,56 @@ Examples:
 					wg.Done()
 				}()
 
-				var n int    // number of sequences
-				var lens int // lengths of all seqs
-				var h uint64
-				hashes := make([]uint64, 0, 1024)
-
-				var record *fastx.Record
-				var fastxReader *fastx.Reader
-				var _seq *seq.Seq
-				var ab *seq.Alphabet
-				var ii int
-				var bb byte
-
-				// add tag to the hash
-				// ref: https://github.com/TimothyStiles/poly/blob/prime/seqhash/seqhash.go
-				var seqType string      // "D" for DNA, "R" for RNA, "P" for protein
-				var seqStructure string // "L" for linear, "C" for circular
-				var strand string       // "D" for double strands, "S" for single strand
-
-				fastxReader, err = fastx.NewReader(alphabet, file, idRegexp)
-				// checkError(err)
+				fastxReader, err := fastx.NewReader(alphabet, file, idRegexp)
 				if err != nil {
 					ch <- &Aresult{
 						id:     id,
 						ok:     false,
 						result: nil,
 					}
-					log.Warningf(fmt.Sprintf("skip file: %s: %s", file, err))
+					log.Warningf("skip file: %s: %s", file, err)
 					return
 				}
 
-				checkAlphabet := true
-
-				if circular {
-					seqStructure = "C"
-					if singleStrand {
-						strand = "S"
-					} else {
-						strand = "D"
-					}
-					// var ok bool
-
-					// var iter *sketches.Iterator
-					var rc *seq.Seq
-					var s, src []byte
-					var h2 uint64
-					var i, j, e, l, end, originalLen int
-					for {
-						record, err = fastxReader.Read()
-						if err != nil {
-							if err == io.EOF {
-								break
-							}
-							// checkError(err)
-							// break
-							ch <- &Aresult{
-								id:     id,
-								ok:     false,
-								result: nil,
-							}
-							log.Warningf(fmt.Sprintf("skip file: %s: %s", file, err))
-							return
-						}
-
-						if n >= 1 {
-							// checkError(fmt.Errorf("only one sequence is allowed for circular genome"))
-							ch <- &Aresult{
-								id:     id,
-								ok:     false,
-								result: nil,
-							}
-							log.Warningf(fmt.Sprintf("skip file with more than 1 sequences: %s", file))
-							return
-						}
-
-						_seq = record.Seq
-
-						if k > len(_seq.Seq) {
-							// checkError(fmt.Errorf("k is too big for sequence of %d bp: %s", len(record.Seq.Seq), file))
-							ch <- &Aresult{
-								id:     id,
-								ok:     false,
-								result: nil,
-							}
-							log.Errorf(fmt.Sprintf("k (%d) is too big for sequence of %d bp: %s", k, len(record.Seq.Seq), file))
-							return
-						}
-
-						if removeGaps {
-							_seq.RemoveGapsInplace(gapLetters)
-						}
-
-						_seq.Seq = bytes.ToLower(_seq.Seq)
-
-						if checkAlphabet {
-							ab = fastxReader.Alphabet()
-							if ab == seq.Protein {
-								seqType = "P"
-
-								ch <- &Aresult{
-									id:     id,
-									ok:     false,
-									result: nil,
-								}
-								log.Errorf(fmt.Sprintf("the flag -c/--circular does not support protein sequences: %s", file))
-								return
-
-							} else if ab == seq.RNA || ab == seq.RNAredundant {
-								seqType = "R"
-							} else if ab == seq.DNA || ab == seq.DNAredundant {
-								seqType = "D"
-							} else {
-								seqType = "N"
-							}
-
-							checkAlphabet = false
-						}
-
-						if rna2dna {
-							if !(ab == seq.RNA || ab == seq.RNAredundant) {
-								for ii, bb = range _seq.Seq {
-									if bb == 'u' {
-										_seq.Seq[ii] = 't'
-									}
-								}
-							}
-						}
-
-						// // ntHash shoud be simpler and faster, but some thing wrong I didn't fingure out.
-						// iter, err = sketches.NewHashIterator(_seq, k, true, true)
-						// for {
-						// 	h, ok = iter.NextHash()
-						// 	if !ok {
-						// 		break
-						// 	}
-
-						// 	hashes = append(hashes, h)
-						// }
-
-						if !singleStrand {
-							rc = _seq.RevCom()
-						}
-
-						l = len(_seq.Seq)
-						originalLen = l
-						end = l - 1
-
-						i = 0
-						for {
-							if i > end {
-								break
-							}
-							e = i + k
-
-							if e > originalLen {
-								e = e - originalLen
-								s = _seq.Seq[i:]
-								s = append(s, _seq.Seq[0:e]...)
-
-								if !singleStrand {
-									j = l - i
-									src = rc.Seq[l-e:]
-									src = append(src, rc.Seq[0:j]...)
-								}
-							} else {
-								s = _seq.Seq[i : i+k]
-
-								if !singleStrand {
-									j = l - i
-									src = rc.Seq[j-k : j]
-								}
-							}
-							// fmt.Println(i, string(s), string(src))
-
-							h = xxhash.Sum64(s)
-							if singleStrand {
-								hashes = append(hashes, h)
-							} else {
-								h2 = xxhash.Sum64(src)
-								if h < h2 {
-									hashes = append(hashes, h)
-								} else {
-									hashes = append(hashes, h2)
-								}
-							}
-
-							i++
-						}
-
-						n++
-						lens += len(record.Seq.Seq)
+				r, err := lib.SeqDigest(fastxReader, opt)
+				if err != nil {
+					ch <- &Aresult{
+						id:     id,
+						ok:     false,
+						result: nil,
 					}
-				} else {
-					seqStructure = "L"
-					strand = "S"
-
-					for {
-						record, err = fastxReader.Read()
-						if err != nil {
-							if err == io.EOF {
-								break
-							}
-							// checkError(err)
-							// break
-							ch <- &Aresult{
-								id:     id,
-								ok:     false,
-								result: nil,
-							}
-							log.Warningf(fmt.Sprintf("%s: %s", file, err))
-							return
-						}
-
-						_seq = record.Seq
-
-						if removeGaps {
-							_seq.RemoveGapsInplace(gapLetters)
-						}
-
-						_seq.Seq = bytes.ToLower(_seq.Seq)
-
-						if checkAlphabet {
-							ab = fastxReader.Alphabet()
-							if ab == seq.Protein {
-								seqType = "P"
-								if !removeGaps {
-									if !strings.Contains(gapLetters, "*") {
-										gapLetters += "*"
-									}
-									log.Infof(`the flag -g/--remove-gaps is switched on for removing the stop condon '*' character for protein sequences`)
-								}
-							} else if ab == seq.RNA || ab == seq.RNAredundant {
-								seqType = "R"
-							} else if ab == seq.DNA || ab == seq.DNAredundant {
-								seqType = "D"
-							} else {
-								seqType = "N"
-							}
-
-							checkAlphabet = false
-						}
-
-						if rna2dna {
-							if !(ab == seq.RNA || ab == seq.RNAredundant) {
-								for ii, bb = range _seq.Seq {
-									if bb == 'u' {
-										_seq.Seq[ii] = 't'
-									}
-								}
-							}
-						}
-
-						h = xxhash.Sum64(_seq.Seq)
-
-						hashes = append(hashes, h)
-
-						n++
-						lens += len(_seq.Seq)
+					var kErr *lib.KmerSizeError
+					switch {
+					case err == lib.ErrCircularMultiSeqs:
+						log.Warningf("skip file with more than 1 sequences: %s", file)
+					case err == lib.ErrCircularProtein:
+						log.Errorf("the flag -c/--circular does not support protein sequences: %s", file)
+					case errors.As(err, &kErr):
+						log.Errorf("%s: %s", err, file)
+					case circular:
+						log.Warningf("skip file: %s: %s", file, err)
+					default:
+						log.Warningf("%s: %s", file, err)
 					}
+					return
 				}
-
-				// sequences
-				sortutil.Uint64s(hashes)
-
-				var le = binary.LittleEndian
-				buf := make([]byte, 8)
-				di := xxhash.New()
-
-				for _, h = range hashes {
-					// fmt.Println(h)
-					le.PutUint64(buf, h)
-					di.Write(buf)
+				if r.SeqType == "P" && !removeGaps {
+					log.Infof(`the flag -g/--remove-gaps is switched on for removing the stop condon '*' character for protein sequences`)
 				}
 
-				// sequence length
-				le.PutUint64(buf, uint64(lens))
-				di.Write(buf)
-
-				// sequence number
-				le.PutUint64(buf, uint64(n))
-				di.Write(buf)
-
-				// sum up
-				le.PutUint64(buf, di.Sum64())
-				digest := md5.Sum(buf)
-
 				// return result
 				if basename {
 					file = filepath.Base(file)
 				}
 
-				if !circular {
-					k = 0
-				}
-				sum := fmt.Sprintf("seqkit.v%s_%s%s%s_k%d_%s",
-					sumVersion,
-					seqType,
-					seqStructure,
-					strand,
-					k,
-					hex.EncodeToString(digest[:]))
-
 				ch <- &Aresult{
 					id: id,
 					ok: true,
 					result: &SumResult{
 						File:   file,
-						SeqNum: n,
-						SeqLen: lens,
-						Digest: sum,
+						SeqNum: r.SeqNum,
+						SeqLen: r.SeqLen,
+						Digest: r.Digest,
 					},
 				}
 			}(file, id)
@@ -514,6 +272,10 @@ Examples:
 		wg.Wait()
 		close(ch)
 		<-done
+
+		if jw != nil {
+			checkError(jw.Close())
+		}
 	},
 }
 
@@ -536,5 +298,3 @@ type SumResult struct {
 	SeqLen int
 	Digest string
 }
-
-const sumVersion = "0.1"
@@ -101,22 +101,8 @@ Translate Tables/Genetic Codes:
 		if _, ok := seq.CodonTables[translTable]; !ok {
 			checkError(fmt.Errorf("invalid translate table: %d", translTable))
 		}
-		_frames := getFlagStringSlice(cmd, "frame")
-		frames := make([]int, 0, len(_frames))
-		for _, _frame := range _frames {
-			frame, err := strconv.Atoi(_frame)
-			if err != nil {
-				checkError(fmt.Errorf("invalid frame(s): %s. available: 1, 2, 3, -1, -2, -3, and 6 for all. multiple frames should be separated by comma", _frame))
-			}
-			if !(frame == 1 || frame == 2 || frame == 3 || frame == -1 || frame == -2 || frame == -3 || frame == 6) {
-				checkError(fmt.Errorf("invalid frame: %d. available: 1, 2, 3, -1, -2, -3, and 6 for all", frame))
-			}
-			if frame == 6 {
-				frames = []int{1, 2, 3, -1, -2, -3}
-				break
-			}
-			frames = append(frames, frame)
-		}
+		frames, err := parseTranslateFrames(getFlagStringSlice(cmd, "frame"))
+		checkError(err)
 		trim := getFlagBool(cmd, "trim")
 		clean := getFlagBool(cmd, "clean")
 		allowUnknownCodon := getFlagBool(cmd, "allow-unknown-codon")
@@ -125,6 +111,16 @@ Translate Tables/Genetic Codes:
 		listTableAmb := getFlagInt(cmd, "list-transl-table-with-amb-codons")
 		appendFrame := getFlagBool(cmd, "append-frame")
 
+		tr := &translator{
+			table:             translTable,
+			frames:            frames,
+			trim:              trim,
+			clean:             clean,
+			allowUnknownCodon: allowUnknownCodon,
+			markInitCodonAsM:  markInitCodonAsM,
+			appendFrame:       appendFrame,
+		}
+
 		outfh, err := xopen.Wopen(outFile)
 		checkError(err)
 		defer outfh.Close()
@@ -157,8 +153,7 @@ Translate Tables/Genetic Codes:
 
 		var record *fastx.Record
 		var fastxReader *fastx.Reader
-		var _seq *seq.Seq
-		var frame int
+		var proteins []*fastx.Record
 		once := true
 		for _, file := range files {
 			fastxReader, err = fastx.NewReader(alphabet, file, idRegexp)
@@ -182,23 +177,18 @@ Translate Tables/Genetic Codes:
 					once = false
 				}
 
-				for _, frame = range frames {
-					_seq, err = record.Seq.Translate(translTable, frame, trim, clean, allowUnknownCodon, markInitCodonAsM)
-					if err != nil {
-						if err == seq.ErrUnknownCodon {
-							log.Error("unknown codon detected, you can use flag -x/--allow-unknown-codon to translate it to 'X'.")
-							os.Exit(-1)
-						}
-						checkError(err)
+				proteins, err = tr.translate(record)
+				if err != nil {
+					if err == seq.ErrUnknownCodon {
+						log.Error("unknown codon detected, you can use flag -x/--allow-unknown-codon to translate it to 'X'.")
+						os.Exit(-1)
 					}
 					checkError(err)
+				}
 
-					if appendFrame {
-						outfh.WriteString(fmt.Sprintf(">%s_frame=%d %s\n", record.ID, frame, record.Desc))
-					} else {
-						outfh.WriteString(">" + string(record.Name) + "\n")
-					}
-					outfh.Write(byteutil.WrapByteSlice(_seq.Seq, config.LineWidth))
+				for _, record = range proteins {
+					outfh.WriteString(">" + string(record.Name) + "\n")
+					outfh.Write(byteutil.WrapByteSlice(record.Seq.Seq, config.LineWidth))
 					outfh.WriteString("\n")
 				}
 
@@ -220,3 +210,55 @@ func init() {
 	translateCmd.Flags().IntP("list-transl-table-with-amb-codons", "L", -1, "show details of translate table N (including ambigugous codons), 0 for all. ")
 	translateCmd.Flags().BoolP("append-frame", "F", false, "append frame information to sequence ID")
 }
+
+// parseTranslateFrames parses frames to translate, 6 is for all six frames.
+func parseTranslateFrames(_frames []string) ([]int, error) {
+	frames := make([]int, 0, len(_frames))
+	for _, _frame := range _frames {
+		frame, err := strconv.Atoi(_frame)
+		if err != nil {
+			return nil, fmt.Errorf("invalid frame(s): %s. available: 1, 2, 3, -1, -2, -3, and 6 for all. multiple frames should be separated by comma", _frame)
+		}
+		if !(frame == 1 || frame == 2 || frame == 3 || frame == -1 || frame == -2 || frame == -3 || frame == 6) {
+			return nil, fmt.Errorf("invalid frame: %d. available: 1, 2, 3, -1, -2, -3, and 6 for all", frame)
+		}
+		if frame == 6 {
+			return []int{1, 2, 3, -1, -2, -3}, nil
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// translator translates DNA/RNA records to protein ones,
+// it's shared by translate and the Translate stage of pipe.
+type translator struct {
+	table             int
+	frames            []int
+	trim              bool
+	clean             bool
+	allowUnknownCodon bool
+	markInitCodonAsM  bool
+	appendFrame       bool
+}
+
+// translate returns one protein record for each frame,
+// frame information is appended to the ID if appendFrame is true.
+func (t *translator) translate(record *fastx.Record) ([]*fastx.Record, error) {
+	proteins := make([]*fastx.Record, 0, len(t.frames))
+	for _, frame := range t.frames {
+		_seq, err := record.Seq.Translate(t.table, frame, t.trim, t.clean, t.allowUnknownCodon, t.markInitCodonAsM)
+		if err != nil {
+			return nil, err
+		}
+
+		name := record.Name
+		id := record.ID
+		if t.appendFrame {
+			id = []byte(fmt.Sprintf("%s_frame=%d", record.ID, frame))
+			name = []byte(fmt.Sprintf("%s %s", id, record.Desc))
+		}
+		proteins = append(proteins, &fastx.Record{ID: id, Name: name, Desc: record.Desc, Seq: _seq})
+	}
+	return proteins, nil
+}
@@ -0,0 +1,244 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
+)
+
+// trimCmd represents the trim command
+var trimCmd = &cobra.Command{
+	Use:   "trim",
+	Short: "trim reads by quality, adapters, poly-G/poly-A tails and fixed lengths",
+	Long: `trim reads by quality, adapters, poly-G/poly-A tails and fixed lengths
+
+Steps are applied in this order, and disabled by default:
+
+  1. Cropping fixed numbers of bases from the 5' end (--head-crop)
+     and the 3' end (--tail-crop).
+  2. Removing bases with quality below thresholds from the 5' end
+     (--qual-5p) and the 3' end (--qual-3p).
+  3. Sliding-window quality trimming: scanning from the 5' end, the read is
+     cut at the first window (-W/--window-size) with mean quality below
+     -Q/--window-qual, while leading bases of the window with quality
+     >= -Q/--window-qual are kept.
+  4. Removing 3' adapters in the FASTA file (-a/--adapter-file), and
+     everything after them. Adapters are searched with at most
+     -m/--max-mismatch mismatches, in the same way of "seqkit locate -m".
+     Adapters partly overlapping the 3' end of reads by at least
+     --min-overlap bases are also removed, with mismatches allowed in
+     proportion to the overlap length.
+  5. Removing poly-G (-G/--poly-g) and poly-A (-A/--poly-a) tails of at least
+     the given lengths, one mismatch is tolerated every 8 bases.
+
+Reads shorter than -l/--min-len after trimming are discarded.
+Quality trimming is skipped for FASTA files.
+
+Paired-end mode:
+  With -1/--read1 and -2/--read2, reads are paired with the same strategy of
+  "seqkit pair", trimmed separately, and saved to two synchronized files in
+  -O/--out-dir. A pair is kept if both mates pass -l/--min-len by default,
+  use --pair-filter any to keep pairs with at least one mate passing.
+  Unpaired reads are ignored.
+
+Report:
+  With -r/--report, a tab-delimited report of every read is written, with
+  columns: seqID, mate (1 or 2 in paired-end mode, 0 otherwise), length,
+  cropped, qual_trimmed, adapter, adapter_trimmed, poly_trimmed,
+  trimmed_len, kept.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		alphabet := config.Alphabet
+		idRegexp := config.IDRegexp
+		outFile := config.OutFile
+		lineWidth := config.LineWidth
+		quiet := config.Quiet
+		seq.AlphabetGuessSeqLengthThreshold = config.AlphabetGuessSeqLength
+		seq.ValidateSeq = false
+		runtime.GOMAXPROCS(config.Threads)
+
+		opt := &lib.TrimOptions{
+			HeadCrop:    getFlagNonNegativeInt(cmd, "head-crop"),
+			TailCrop:    getFlagNonNegativeInt(cmd, "tail-crop"),
+			QualBase:    getFlagPositiveInt(cmd, "qual-ascii-base"),
+			Qual5:       getFlagNonNegativeInt(cmd, "qual-5p"),
+			Qual3:       getFlagNonNegativeInt(cmd, "qual-3p"),
+			Window:      getFlagPositiveInt(cmd, "window-size"),
+			WindowQual:  getFlagNonNegativeInt(cmd, "window-qual"),
+			MaxMismatch: getFlagNonNegativeInt(cmd, "max-mismatch"),
+			MinOverlap:  getFlagPositiveInt(cmd, "min-overlap"),
+			PolyG:       getFlagNonNegativeInt(cmd, "poly-g"),
+			PolyA:       getFlagNonNegativeInt(cmd, "poly-a"),
+		}
+		if opt.WindowQual == 0 {
+			opt.Window = 0
+		}
+		adapterFile := getFlagString(cmd, "adapter-file")
+		minLen := getFlagNonNegativeInt(cmd, "min-len")
+		reportFile := getFlagString(cmd, "report")
+
+		var adapters []*fastx.Record
+		var err error
+		if adapterFile != "" {
+			adapters, err = fastx.GetSeqs(adapterFile, seq.Unlimit, config.Threads, 10, "")
+			checkError(err)
+			if len(adapters) == 0 {
+				checkError(fmt.Errorf("no FASTA sequences found in adapter file: %s", adapterFile))
+			}
+		}
+		trimmer, err := lib.NewTrimmer(adapters, opt)
+		checkError(err)
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+
+		var report *xopen.Writer
+		if reportFile != "" {
+			report, err = xopen.Wopen(reportFile)
+			checkError(err)
+			defer report.Close()
+			report.WriteString("seqID\tmate\tlength\tcropped\tqual_trimmed\tadapter\tadapter_trimmed\tpoly_trimmed\ttrimmed_len\tkept\n")
+		}
+		var stats trimStats
+		trim := func(record *fastx.Record) lib.TrimResult {
+			r, err := trimmer.Trim(record)
+			checkError(err)
+			stats.reads++
+			stats.bases += r.Length - (r.End - r.Begin)
+			return r
+		}
+		writeReport := func(record *fastx.Record, mate int, r lib.TrimResult, kept bool) {
+			if report == nil {
+				return
+			}
+			fmt.Fprintf(report, "%s\t%d\t%d\t%d\t%d\t%s\t%d\t%d\t%d\t%v\n", record.ID, mate,
+				r.Length, r.Cropped, r.QualTrimmed, r.Adapter, r.AdapterTrimmed, r.PolyTrimmed,
+				r.End-r.Begin, kept)
+		}
+
+		if paired := getPairedOptions(cmd, files, quiet); paired != nil {
+			reader := paired.newReader(alphabet, idRegexp)
+			writer := paired.newWriter(lineWidth)
+
+			checkError(reader.Walk(func(r1, r2 *fastx.Record) bool {
+				t1, t2 := trim(r1), trim(r2)
+				kept := paired.test(len(r1.Seq.Seq) >= minLen, len(r2.Seq.Seq) >= minLen)
+				writeReport(r1, 1, t1, kept)
+				writeReport(r2, 2, t2, kept)
+				if !kept {
+					stats.discarded += 2
+					return false
+				}
+				writer.Write(r1, r2)
+				return false
+			}))
+
+			reader.warnUnpaired()
+			writer.Close(quiet)
+			stats.log(quiet)
+			return
+		}
+
+		outfh, err := xopen.Wopen(outFile)
+		checkError(err)
+		defer outfh.Close()
+
+		var record *fastx.Record
+		var fastxReader *fastx.Reader
+		var r lib.TrimResult
+		var kept bool
+		for _, file := range files {
+			fastxReader, err = fastx.NewReader(alphabet, file, idRegexp)
+			checkError(err)
+
+			for {
+				record, err = fastxReader.Read()
+				if err != nil {
+					if err == io.EOF {
+						break
+					}
+					checkError(err)
+					break
+				}
+				if fastxReader.IsFastq {
+					config.LineWidth = 0
+					fastx.ForcelyOutputFastq = true
+				}
+
+				r = trim(record)
+				kept = len(record.Seq.Seq) >= minLen
+				writeReport(record, 0, r, kept)
+				if !kept {
+					stats.discarded++
+					continue
+				}
+				record.FormatToWriter(outfh, config.LineWidth)
+			}
+
+			config.LineWidth = lineWidth
+		}
+		stats.log(quiet)
+	},
+}
+
+// trimStats summarizes the result of trim.
+type trimStats struct {
+	reads     int // reads processed
+	bases     int // bases trimmed
+	discarded int // reads discarded
+}
+
+func (s *trimStats) log(quiet bool) {
+	if quiet {
+		return
+	}
+	log.Infof("%d reads processed, %d bases trimmed, %d reads discarded", s.reads, s.bases, s.discarded)
+}
+
+func init() {
+	RootCmd.AddCommand(trimCmd)
+
+	trimCmd.Flags().IntP("head-crop", "", 0, "number of bases to remove from the 5' end")
+	trimCmd.Flags().IntP("tail-crop", "", 0, "number of bases to remove from the 3' end")
+	trimCmd.Flags().IntP("qual-5p", "", 0, "remove bases with quality below this from the 5' end, 0 for disabling")
+	trimCmd.Flags().IntP("qual-3p", "", 0, "remove bases with quality below this from the 3' end, 0 for disabling")
+	trimCmd.Flags().IntP("window-size", "W", 4, "window size of sliding-window quality trimming")
+	trimCmd.Flags().IntP("window-qual", "Q", 0, "cut reads at the first window with mean quality below this, 0 for disabling")
+	trimCmd.Flags().StringP("adapter-file", "a", "", "FASTA file of 3' adapters to remove")
+	trimCmd.Flags().IntP("max-mismatch", "m", 0, "max mismatch when searching adapters")
+	trimCmd.Flags().IntP("min-overlap", "", 3, "minimum overlap of adapters partly overlapping the 3' end of reads")
+	trimCmd.Flags().IntP("poly-g", "G", 0, "remove poly-G tails of at least this length, 0 for disabling")
+	trimCmd.Flags().IntP("poly-a", "A", 0, "remove poly-A tails of at least this length, 0 for disabling")
+	trimCmd.Flags().IntP("min-len", "l", 1, "discard reads shorter than this after trimming")
+	trimCmd.Flags().IntP("qual-ascii-base", "b", 33, "ASCII BASE, 33 for Phred+33")
+	trimCmd.Flags().StringP("report", "r", "", "write a per-read trimming report to this file")
+
+	addPairedFlags(trimCmd, true, "both", `in paired-end mode, keep a pair if "any" or "both" of the mates pass -l/--min-len`)
+}
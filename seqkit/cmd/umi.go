@@ -0,0 +1,221 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
+)
+
+// umiCmd represents the umi command
+var umiCmd = &cobra.Command{
+	Use:   "umi",
+	Short: "extract UMIs from read sequences into read IDs",
+	Long: `extract UMIs from read sequences into read IDs
+
+UMIs at the 5' end of reads are described with a pattern (-p/--pattern),
+where "N" stands for a UMI base and "X" for a base kept in the read, e.g.,
+"NNNNNNNNXXXX" for an 8-bp UMI followed by 4 bases to keep. Bases after
+the pattern are always kept.
+
+UMI bases are removed from the sequence (and quality), and appended to the
+read ID with a separator (-s/--separator), e.g., "@r1_ACGTACGT 1:N:0:1".
+The mate suffix "/1" or "/2" stays at the end, e.g., "@r1_ACGTACGT/1".
+The UMIs are used by "seqkit rmdup --by-umi".
+
+Reads shorter than the pattern are discarded.
+
+Paired-end mode:
+  With -1/--read1 and -2/--read2, reads are paired with the same strategy of
+  "seqkit pair", UMIs are extracted from read1 with -p/--pattern and from
+  read2 with -P/--pattern2, concatenated, and appended to IDs of both mates.
+  Pairs are saved to two synchronized files in -O/--out-dir.
+  Unpaired reads are ignored.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		alphabet := config.Alphabet
+		idRegexp := config.IDRegexp
+		outFile := config.OutFile
+		lineWidth := config.LineWidth
+		quiet := config.Quiet
+		seq.AlphabetGuessSeqLengthThreshold = config.AlphabetGuessSeqLength
+		seq.ValidateSeq = false
+		runtime.GOMAXPROCS(config.Threads)
+
+		sep := []byte(getFlagString(cmd, "separator"))
+		if len(sep) == 0 {
+			checkError(fmt.Errorf("value of flag -s/--separator should not be empty"))
+		}
+		var p1, p2 *lib.UMIPattern
+		var err error
+		if pattern := getFlagString(cmd, "pattern"); pattern != "" {
+			p1, err = lib.ParseUMIPattern(pattern)
+			checkError(err)
+		}
+		if pattern := getFlagString(cmd, "pattern2"); pattern != "" {
+			p2, err = lib.ParseUMIPattern(pattern)
+			checkError(err)
+		}
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+
+		var n, discarded int
+		if paired := getPairedOptions(cmd, files, quiet); paired != nil {
+			if p1 == nil && p2 == nil {
+				checkError(fmt.Errorf("flag -p/--pattern and/or -P/--pattern2 needed"))
+			}
+			reader := paired.newReader(alphabet, idRegexp)
+			writer := paired.newWriter(lineWidth)
+
+			var umi, umi2 []byte
+			var ok bool
+			checkError(reader.Walk(func(r1, r2 *fastx.Record) bool {
+				n++
+				umi = umi[:0]
+				if p1 != nil {
+					if umi2, ok = p1.Extract(r1.Seq); !ok {
+						discarded++
+						return false
+					}
+					umi = append(umi, umi2...)
+				}
+				if p2 != nil {
+					if umi2, ok = p2.Extract(r2.Seq); !ok {
+						discarded++
+						return false
+					}
+					umi = append(umi, umi2...)
+				}
+				addUMIToID(r1, umi, sep)
+				addUMIToID(r2, umi, sep)
+				writer.Write(r1, r2)
+				return false
+			}))
+
+			reader.warnUnpaired()
+			writer.Close(quiet)
+			if !quiet {
+				log.Infof("%d pairs processed, %d pairs shorter than the patterns discarded", n, discarded)
+			}
+			return
+		}
+
+		if p1 == nil {
+			checkError(fmt.Errorf("flag -p/--pattern needed"))
+		}
+		if p2 != nil {
+			checkError(fmt.Errorf("flag -P/--pattern2 is only supported in paired-end mode"))
+		}
+
+		outfh, err := xopen.Wopen(outFile)
+		checkError(err)
+		defer outfh.Close()
+
+		var record *fastx.Record
+		var fastxReader *fastx.Reader
+		var umi []byte
+		var ok bool
+		for _, file := range files {
+			fastxReader, err = fastx.NewReader(alphabet, file, idRegexp)
+			checkError(err)
+
+			for {
+				record, err = fastxReader.Read()
+				if err != nil {
+					if err == io.EOF {
+						break
+					}
+					checkError(err)
+					break
+				}
+				if fastxReader.IsFastq {
+					config.LineWidth = 0
+					fastx.ForcelyOutputFastq = true
+				}
+
+				n++
+				if umi, ok = p1.Extract(record.Seq); !ok {
+					discarded++
+					continue
+				}
+				addUMIToID(record, umi, sep)
+				record.FormatToWriter(outfh, config.LineWidth)
+			}
+
+			config.LineWidth = lineWidth
+		}
+		if !quiet {
+			log.Infof("%d reads processed, %d reads shorter than the pattern discarded", n, discarded)
+		}
+	},
+}
+
+// addUMIToID appends the UMI to the ID of a record, before the mate
+// suffix "/1" or "/2" if present.
+func addUMIToID(record *fastx.Record, umi []byte, sep []byte) {
+	base := trimMateSuffix(record.ID)
+	id := make([]byte, 0, len(record.ID)+len(sep)+len(umi))
+	id = append(id, base...)
+	id = append(id, sep...)
+	id = append(id, umi...)
+	id = append(id, record.ID[len(base):]...)
+
+	if bytes.HasPrefix(record.Name, record.ID) {
+		name := make([]byte, 0, len(record.Name)+len(sep)+len(umi))
+		name = append(name, id...)
+		name = append(name, record.Name[len(record.ID):]...)
+		record.Name = name
+	} else {
+		record.Name = id
+	}
+	record.ID = id
+}
+
+// umiFromID returns the UMI in the ID of a record added by addUMIToID,
+// i.e., the part after the last separator, ignoring the mate suffix.
+func umiFromID(id []byte, sep []byte) ([]byte, bool) {
+	id = trimMateSuffix(id)
+	i := bytes.LastIndex(id, sep)
+	if i < 0 || i+len(sep) == len(id) {
+		return nil, false
+	}
+	return id[i+len(sep):], true
+}
+
+func init() {
+	RootCmd.AddCommand(umiCmd)
+
+	umiCmd.Flags().StringP("pattern", "p", "", `UMI pattern of reads (read1 in paired-end mode), "N" for UMI bases and "X" for kept bases, e.g., "NNNNNNNNXXXX"`)
+	umiCmd.Flags().StringP("pattern2", "P", "", "UMI pattern of read2, for paired-end mode")
+	umiCmd.Flags().StringP("separator", "s", "_", "separator between the read ID and the UMI")
+
+	addPairedFlags(umiCmd, true, "", "")
+}
@@ -397,73 +397,6 @@ func FileExists(fn string) bool {
 	return false
 }
 
-// MinInts calculates the minimum of a slice of integers.
-func MinInts(s []int) (m int) {
-	m = s[0]
-	for _, e := range s {
-		if e < m {
-			m = e
-		}
-	}
-	return
-}
-
-// MaxInts calculates the maximum of a slice of integers.
-func MaxInts(s []int) (m int) {
-	for _, e := range s {
-		if e > m {
-			m = e
-		}
-	}
-	return
-}
-
-// SumInts calculates the sum of a slice of integers.
-func SumInts(s []int) (r int) {
-	for _, e := range s {
-		r += e
-	}
-	return
-}
-
-// RevCompDNA reverse complements a DNA sequence string.
-func RevCompDNA(s string) string {
-	size := len(s)
-	s = strings.ToUpper(s)
-	tmp := make([]byte, size)
-	var inBase byte
-	var outBase byte
-	for i := 0; i < size; i++ {
-		inBase = s[i]
-		switch inBase {
-		case 'A':
-			outBase = 'T'
-		case 'a':
-			outBase = 't'
-		case 'T':
-			outBase = 'A'
-		case 't':
-			outBase = 'a'
-		case 'G':
-			outBase = 'C'
-		case 'g':
-			outBase = 'c'
-		case 'C':
-			outBase = 'G'
-		case 'c':
-			outBase = 'g'
-		case 'n':
-			outBase = 'n'
-		case 'N':
-			outBase = 'N'
-		default:
-			outBase = 'N'
-		}
-		tmp[size-1-i] = outBase
-	}
-	return string(tmp)
-}
-
 func maxStrLen(slice []string) int {
 	l := 0
 	for _, s := range slice {
@@ -0,0 +1,246 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "validate mate names of interleaved or paired-end reads",
+	Long: `validate mate names of interleaved or paired-end reads
+
+Input:
+  1. An interleaved file, given as a positional argument or from stdin,
+     where read2 follows read1 of the same fragment.
+  2. Or paired-end files via the flags -1/--read1 and -2/--read2,
+     where mates are at the same positions of the two files.
+
+Checks:
+  1. Names of mates should be the same after removing the suffixes "/1" and "/2".
+  2. Mate numbers, from the suffixes or Illumina comments like "1:N:0:ATCACG",
+     should be 1 for read1 and 2 for read2 when present.
+
+Output (TSV):
+  1. record, the 1-based index of the record (interleaved file) or
+     the pair (paired-end files)
+  2. id, the ID of the record
+  3. problem
+
+The exit status is 1 if any problem is found.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		alphabet := config.Alphabet
+		idRegexp := config.IDRegexp
+		outFile := config.OutFile
+		quiet := config.Quiet
+		seq.AlphabetGuessSeqLengthThreshold = config.AlphabetGuessSeqLength
+		seq.ValidateSeq = false
+		runtime.GOMAXPROCS(config.Threads)
+
+		read1 := getFlagString(cmd, "read1")
+		read2 := getFlagString(cmd, "read2")
+		maxProblems := getFlagNonNegativeInt(cmd, "max-problems")
+
+		paired := read1 != "" || read2 != ""
+		var file string
+		if paired {
+			if read1 == "" || read2 == "" {
+				checkError(fmt.Errorf("flag -1/--read1 and -2/--read2 should be given together"))
+			}
+			if read1 == read2 {
+				checkError(fmt.Errorf("values of flag -1/--read1 and -2/--read2 can not be the same"))
+			}
+			if len(args) > 0 {
+				checkError(fmt.Errorf("no positional arguments are allowed when using -1/--read1 and -2/--read2"))
+			}
+		} else {
+			files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+			if len(files) > 1 {
+				checkError(fmt.Errorf("no more than one file should be given"))
+			}
+			file = files[0]
+		}
+
+		outfh, err := xopen.Wopen(outFile)
+		checkError(err)
+		defer outfh.Close()
+
+		outfh.WriteString("record\tid\tproblem\n")
+
+		var nProblems int
+		report := func(i uint64, id []byte, problem string) {
+			nProblems++
+			if maxProblems > 0 && nProblems > maxProblems {
+				return
+			}
+			fmt.Fprintf(outfh, "%d\t%s\t%s\n", i, id, problem)
+		}
+
+		var n, pairs uint64
+		if paired {
+			n, pairs, err = validatePaired(alphabet, read1, read2, idRegexp, report)
+		} else {
+			n, pairs, err = validateInterleaved(alphabet, file, idRegexp, report)
+		}
+		checkError(err)
+
+		if maxProblems > 0 && nProblems > maxProblems && !quiet {
+			log.Warningf("only the first %d problems are shown, use -m/--max-problems 0 to show all", maxProblems)
+		}
+
+		if nProblems > 0 {
+			outfh.Close()
+			if paired {
+				log.Errorf("%d problems found in %d pairs of %s and %s", nProblems, n, read1, read2)
+			} else {
+				log.Errorf("%d problems found in %d records (%d valid pairs) of %s", nProblems, n, pairs, file)
+			}
+			os.Exit(1)
+		}
+		if !quiet {
+			if paired {
+				log.Infof("%d pairs of %s and %s are valid", pairs, read1, read2)
+			} else {
+				log.Infof("%d pairs in %s are valid", pairs, file)
+			}
+		}
+	},
+}
+
+// validateInterleaved checks mates of an interleaved file, where read2
+// follows read1. A record not adjacent to its mate is reported as an orphan,
+// and the next record starts a new pair.
+// It returns the number of records and valid pairs.
+func validateInterleaved(alphabet *seq.Alphabet, file, idRegexp string,
+	report func(i uint64, id []byte, problem string)) (uint64, uint64, error) {
+	fastxReader, err := fastx.NewReader(alphabet, file, idRegexp)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, file)
+	}
+	defer fastxReader.Close()
+
+	var n, pairs uint64
+	var pending *fastx.Record
+	var record *fastx.Record
+	var problem string
+	for {
+		record, err = fastxReader.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return n, pairs, errors.Wrap(err, file)
+		}
+		n++
+
+		if pending == nil {
+			pending = record.Clone()
+			continue
+		}
+
+		problem = mateProblem(pending, record)
+		if problem == "" {
+			pairs++
+			pending = nil
+			continue
+		}
+		report(n-1, pending.ID, "orphan: "+problem)
+		pending = record.Clone()
+	}
+	if pending != nil {
+		report(n, pending.ID, "orphan: the last record has no mate")
+	}
+	return n, pairs, nil
+}
+
+// validatePaired checks mates at the same positions of two files.
+// It returns the number of pairs read and valid pairs.
+func validatePaired(alphabet *seq.Alphabet, file1, file2, idRegexp string,
+	report func(i uint64, id []byte, problem string)) (uint64, uint64, error) {
+	reader1, err := fastx.NewReader(alphabet, file1, idRegexp)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, file1)
+	}
+	defer reader1.Close()
+	reader2, err := fastx.NewReader(alphabet, file2, idRegexp)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, file2)
+	}
+	defer reader2.Close()
+
+	var n, pairs uint64
+	var r1, r2 *fastx.Record
+	var err1, err2 error
+	var problem string
+	for {
+		r1, err1 = reader1.Read()
+		if err1 != nil && err1 != io.EOF {
+			return n, pairs, errors.Wrap(err1, file1)
+		}
+		r2, err2 = reader2.Read()
+		if err2 != nil && err2 != io.EOF {
+			return n, pairs, errors.Wrap(err2, file2)
+		}
+
+		if err1 == io.EOF && err2 == io.EOF {
+			break
+		}
+		n++
+		if err1 == io.EOF {
+			report(n, r2.ID, fmt.Sprintf("more reads in %s than %s", file2, file1))
+			break
+		}
+		if err2 == io.EOF {
+			report(n, r1.ID, fmt.Sprintf("more reads in %s than %s", file1, file2))
+			break
+		}
+
+		problem = mateProblem(r1, r2)
+		if problem == "" {
+			pairs++
+			continue
+		}
+		report(n, r1.ID, problem)
+	}
+	return n, pairs, nil
+}
+
+func init() {
+	RootCmd.AddCommand(validateCmd)
+
+	validateCmd.Flags().StringP("read1", "1", "", "(gzipped) read1 file")
+	validateCmd.Flags().StringP("read2", "2", "", "(gzipped) read2 file")
+	validateCmd.Flags().IntP("max-problems", "m", 20, "maximum number of problems to show, 0 for all")
+}
@@ -0,0 +1,177 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+// namedRecord creates a record with the full name, the ID is the first word.
+func namedRecord(name string) *fastx.Record {
+	id := strings.Fields(name)[0]
+	r, _ := fastx.NewRecordWithoutValidation(seq.DNAredundant, []byte(id), []byte(name), []byte{}, []byte("ACGT"))
+	return r
+}
+
+func TestMateNumber(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+	}{
+		{"r1/1", 1},
+		{"r1/2", 2},
+		{"r1/3", 0},
+		{"r1", 0},
+		{"r1 1:N:0:ATCACG", 1},
+		{"r1 2:Y:0:ATCACG", 2},
+		{"r1\t2:N:0:1", 2},
+		{"r1 3:N:0:ATCACG", 0},
+		{"r1 1:X:0:ATCACG", 0},
+		{"r1 barcode=ACGT", 0},
+		{"r1/2 1:N:0:ATCACG", 2}, // the suffix goes first
+	}
+	for _, test := range tests {
+		if n := mateNumber(namedRecord(test.name)); n != test.n {
+			t.Errorf("%s: expected %d, returned %d", test.name, test.n, n)
+		}
+	}
+}
+
+func TestMateProblem(t *testing.T) {
+	tests := []struct {
+		r1, r2 string
+		ok     bool
+	}{
+		{"r1/1", "r1/2", true},
+		{"r1", "r1", true},
+		{"r1 1:N:0:1", "r1 2:N:0:1", true},
+		{"r1/1", "r1", true},
+		{"r1/1", "r2/2", false},
+		{"r1/2", "r1/1", false},
+		{"r1 2:N:0:1", "r1 1:N:0:1", false},
+		{"r1/1", "r1/1", false},
+		{"r1/2", "r1/2", false},
+	}
+	for _, test := range tests {
+		problem := mateProblem(namedRecord(test.r1), namedRecord(test.r2))
+		if test.ok != (problem == "") {
+			t.Errorf("%s, %s: unexpected result: %q", test.r1, test.r2, problem)
+		}
+	}
+
+	for _, id := range []string{"r1/1", "r1/2", "r1/12", "r1"} {
+		expected := id
+		if id == "r1/1" || id == "r1/2" {
+			expected = "r1"
+		}
+		if s := string(trimMateSuffix([]byte(id))); s != expected {
+			t.Errorf("trimMateSuffix: %s: expected %s, returned %s", id, expected, s)
+		}
+	}
+}
+
+func TestInterleavedReader(t *testing.T) {
+	dir := t.TempDir()
+	// r2/1 is an orphan, and so is r4/2
+	file := writeTestFile(t, dir, "r.fq",
+		"@r1/1\nA\n+\nI\n@r1/2\nC\n+\nI\n@r2/1\nG\n+\nI\n@r3/1\nT\n+\nI\n@r3/2\nA\n+\nI\n@r4/2\nC\n+\nI\n")
+
+	reader, err := newInterleavedReader(seq.DNAredundant, file, fastx.DefaultIDRegexp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pairs []string
+	err = reader.Walk(func(r1, r2 *fastx.Record) bool {
+		pairs = append(pairs, string(r1.ID)+","+string(r2.ID))
+		return false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.Join(pairs, " "); s != "r1/1,r1/2 r3/1,r3/2" {
+		t.Errorf("pairs: expected r1/1,r1/2 r3/1,r3/2, returned %s", s)
+	}
+	o1, o2 := reader.Unpaired()
+	if ids := strings.Join(recordIDs(o1), ","); ids != "r2/1" {
+		t.Errorf("orphans of read1: expected r2/1, returned %s", ids)
+	}
+	if ids := strings.Join(recordIDs(o2), ","); ids != "r4/2" {
+		t.Errorf("orphans of read2: expected r4/2, returned %s", ids)
+	}
+
+	// strict mode
+	reader, err = newInterleavedReader(seq.DNAredundant, file, fastx.DefaultIDRegexp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.Strict = true
+	pairs = pairs[:0]
+	err = reader.Walk(func(r1, r2 *fastx.Record) bool {
+		pairs = append(pairs, string(r1.ID)+","+string(r2.ID))
+		return false
+	})
+	if err == nil {
+		t.Errorf("strict mode: error expected")
+	}
+	if len(pairs) != 1 {
+		t.Errorf("strict mode: expected 1 pair before the error, returned %d", len(pairs))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+
+	var problems []string
+	report := func(i uint64, id []byte, problem string) {
+		problems = append(problems, fmt.Sprintf("%d:%s", i, id))
+	}
+
+	file := writeTestFile(t, dir, "r.fa", ">r1/1\nA\n>r1/2\nA\n>r2/1\nA\n>r3/1\nA\n>r3/2\nA\n>r4/1\nA\n")
+	n, pairs, err := validateInterleaved(seq.DNAredundant, file, fastx.DefaultIDRegexp, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 || pairs != 2 {
+		t.Errorf("interleaved: expected 6 records and 2 pairs, returned %d and %d", n, pairs)
+	}
+	if s := strings.Join(problems, " "); s != "3:r2/1 6:r4/1" {
+		t.Errorf("interleaved: expected problems 3:r2/1 6:r4/1, returned %s", s)
+	}
+
+	problems = problems[:0]
+	file1 := writeTestFile(t, dir, "r_1.fa", ">r1/1\nA\n>r2/1\nA\n>r3/1\nA\n")
+	file2 := writeTestFile(t, dir, "r_2.fa", ">r1/2\nA\n>r3/2\nA\n")
+	n, pairs, err = validatePaired(seq.DNAredundant, file1, file2, fastx.DefaultIDRegexp, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || pairs != 1 {
+		t.Errorf("paired: expected 3 pairs read and 1 valid, returned %d and %d", n, pairs)
+	}
+	if s := strings.Join(problems, " "); s != "2:r2/1 3:r3/1" {
+		t.Errorf("paired: expected problems 2:r2/1 3:r3/1, returned %s", s)
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/biogo/hts/sam"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// varcallCmd represents the varcall command
+var varcallCmd = &cobra.Command{
+	Use:   "varcall",
+	Short: "call SNVs and indels from pileups of coordinate-sorted SAM/BAM",
+	Long: `call SNVs and indels from pileups of coordinate-sorted SAM/BAM
+
+This is a simple frequency-based caller for checking expected mutations in
+targeted sequencing, not a replacement of model-based callers. Alleles are
+counted from the pileup of alignments like the command consensus.
+Unmapped, secondary, QC-failed and duplicate records are skipped, so do
+bases with a quality lower than -Q/--min-base-qual.
+
+An allele different from the reference is reported if:
+  1. the depth (including deletions) of the position is >= -d/--min-depth,
+  2. the allele is supported by >= -c/--min-alt-count reads,
+  3. the allele frequency is >= -f/--min-freq.
+
+Output is in VCF 4.2 format without samples, one line for each allele.
+Indels are left-anchored, i.e., POS is the base before them. INFO fields:
+
+  DP      depth of the position
+  AD      counts of reads supporting the reference and alternative alleles
+  AF      alternative allele frequency, AD[1]/DP
+  DP4     counts of reference-forward, reference-reverse,
+          alternative-forward and alternative-reverse reads
+  SB      Phred-scaled p-value of Fisher's exact test on DP4 for strand bias
+  INDEL   the allele is an indel
+
+For indels, reads without indels after the position support the reference.
+
+Attentions:
+  1. The input should be sorted by coordinate.
+  2. The reference FASTA file is indexed with the suffix .seqkit.fai.
+     All reference sequences in the SAM/BAM header should exist in it.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfigs(cmd)
+		outFile := config.OutFile
+		quiet := config.Quiet
+		runtime.GOMAXPROCS(config.Threads)
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(files) > 1 {
+			checkError(fmt.Errorf("no more than one file should be given"))
+		}
+
+		refFile := getFlagString(cmd, "ref")
+		if refFile == "" {
+			checkError(fmt.Errorf("flag -r/--ref needed"))
+		}
+		minDepth := getFlagPositiveInt(cmd, "min-depth")
+		minBaseQual := getFlagNonNegativeInt(cmd, "min-base-qual")
+		minMapQual := getFlagNonNegativeInt(cmd, "min-map-qual")
+		minAltCount := getFlagPositiveInt(cmd, "min-alt-count")
+		minFreq := getFlagFloat64(cmd, "min-freq")
+		if minFreq < 0 || minFreq > 1 {
+			checkError(fmt.Errorf("value of flag -f/--min-freq should be in range of [0, 1]"))
+		}
+
+		ref := NewRefWitdFaidx(refFile, false, quiet)
+
+		outfh, err := xopen.Wopen(outFile)
+		checkError(err)
+		defer outfh.Close()
+
+		inChan, header := NewSamReaderChan(files[0], 5000, 1024*128, config.Threads)
+
+		outfh.WriteString(vcfHeader(header, refFile))
+
+		var cur *sam.Reference
+		var refSeq []byte
+		var nVariants int
+
+		// write writes a variant line
+		write := func(pos int, refAllele, altAllele string, depth int, refCounts, altCounts [2]int, indel bool) {
+			nRef, nAlt := refCounts[0]+refCounts[1], altCounts[0]+altCounts[1]
+			if nAlt < minAltCount || float64(nAlt)/float64(depth) < minFreq {
+				return
+			}
+			info := fmt.Sprintf("DP=%d;AD=%d,%d;AF=%.4f;DP4=%d,%d,%d,%d;SB=%d",
+				depth, nRef, nAlt, float64(nAlt)/float64(depth),
+				refCounts[0], refCounts[1], altCounts[0], altCounts[1],
+				phredScore(fisherExactTest(refCounts[0], refCounts[1], altCounts[0], altCounts[1])))
+			if indel {
+				info += ";INDEL"
+			}
+			outfh.WriteString(fmt.Sprintf("%s\t%d\t.\t%s\t%s\t.\tPASS\t%s\n",
+				cur.Name(), pos+1, refAllele, altAllele, info))
+			nVariants++
+		}
+
+		var depth, refAllele int
+		var refBase byte
+		var refCounts [2]int
+		pileup := NewPileup(minBaseQual, func(r *sam.Reference, col *PileupColumn) {
+			if cur == nil || r.ID() != cur.ID() {
+				cur = r
+				refSeq = pileupRefSeq(ref, r)
+			}
+			depth = col.Depth()
+			if depth < minDepth {
+				return
+			}
+			refBase = refSeq[col.Pos]
+
+			// SNVs
+			refAllele = pileupAllele(refBase)
+			if refAllele != pileupN {
+				for a := pileupA; a <= pileupT; a++ {
+					if a == refAllele {
+						continue
+					}
+					write(col.Pos, string(refBase), string(pileupBases[a]),
+						depth, col.Counts[refAllele], col.Counts[a], false)
+				}
+			}
+
+			if col.Dels == nil && col.Ins == nil {
+				return
+			}
+
+			// indels, reads without indels after the position support the reference
+			refCounts = [2]int{col.StrandDepth(0), col.StrandDepth(1)}
+			for _, counts := range col.Dels {
+				refCounts[0] -= counts[0]
+				refCounts[1] -= counts[1]
+			}
+			for _, counts := range col.Ins {
+				refCounts[0] -= counts[0]
+				refCounts[1] -= counts[1]
+			}
+
+			lens := make([]int, 0, len(col.Dels))
+			for n := range col.Dels {
+				lens = append(lens, n)
+			}
+			sort.Ints(lens)
+			for _, n := range lens {
+				write(col.Pos, string(refSeq[col.Pos:col.Pos+n+1]), string(refBase),
+					depth, refCounts, *col.Dels[n], true)
+			}
+
+			seqs := make([]string, 0, len(col.Ins))
+			for s := range col.Ins {
+				seqs = append(seqs, s)
+			}
+			sort.Strings(seqs)
+			for _, s := range seqs {
+				write(col.Pos, string(refBase), string(refBase)+strings.ToUpper(s),
+					depth, refCounts, *col.Ins[s], true)
+			}
+		})
+
+		var nSkipped int
+		for r := range inChan {
+			if pileupSkipRecord(r, minMapQual) {
+				nSkipped++
+				continue
+			}
+			checkError(pileup.Add(r))
+		}
+		pileup.Flush()
+
+		if !quiet {
+			if nSkipped > 0 {
+				log.Infof("%d records skipped", nSkipped)
+			}
+			log.Infof("%d variants reported", nVariants)
+		}
+	},
+}
+
+// vcfHeader returns the VCF header lines of varcall.
+func vcfHeader(header *sam.Header, refFile string) string {
+	var b strings.Builder
+	b.WriteString("##fileformat=VCFv4.2\n")
+	b.WriteString(fmt.Sprintf("##source=seqkit-varcall-v%s\n", VERSION))
+	b.WriteString(fmt.Sprintf("##reference=%s\n", refFile))
+	for _, r := range header.Refs() {
+		b.WriteString(fmt.Sprintf("##contig=<ID=%s,length=%d>\n", r.Name(), r.Len()))
+	}
+	b.WriteString(`##INFO=<ID=DP,Number=1,Type=Integer,Description="Depth of the position">
+##INFO=<ID=AD,Number=R,Type=Integer,Description="Counts of reads supporting the reference and alternative alleles">
+##INFO=<ID=AF,Number=A,Type=Float,Description="Alternative allele frequency">
+##INFO=<ID=DP4,Number=4,Type=Integer,Description="Counts of reference-forward, reference-reverse, alternative-forward and alternative-reverse reads">
+##INFO=<ID=SB,Number=1,Type=Integer,Description="Phred-scaled p-value of Fisher's exact test for strand bias">
+##INFO=<ID=INDEL,Number=0,Type=Flag,Description="The allele is an indel">
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO
+`)
+	return b.String()
+}
+
+// fisherExactTest returns the two-sided p-value of Fisher's exact test
+// of the 2x2 table [[a, b], [c, d]].
+func fisherExactTest(a, b, c, d int) float64 {
+	r1, c1, n := a+b, a+c, a+b+c+d
+	if n == 0 {
+		return 1
+	}
+	lnf := func(x int) float64 {
+		v, _ := math.Lgamma(float64(x + 1))
+		return v
+	}
+	base := lnf(r1) + lnf(n-r1) + lnf(c1) + lnf(n-c1) - lnf(n)
+	prob := func(x int) float64 { // probability of a table with x in the top-left cell
+		return math.Exp(base - lnf(x) - lnf(r1-x) - lnf(c1-x) - lnf(n-r1-c1+x))
+	}
+
+	lo, hi := c1-(n-r1), r1
+	if lo < 0 {
+		lo = 0
+	}
+	if c1 < hi {
+		hi = c1
+	}
+	pObs := prob(a)
+	var p float64
+	for x := lo; x <= hi; x++ {
+		if px := prob(x); px <= pObs*(1+1e-7) {
+			p += px
+		}
+	}
+	if p > 1 {
+		p = 1
+	}
+	return p
+}
+
+// phredScore converts a p-value to a Phred-scaled score.
+func phredScore(p float64) int {
+	if p <= 0 {
+		return 255
+	}
+	s := int(math.Round(-10 * math.Log10(p)))
+	if s > 255 {
+		return 255
+	}
+	if s < 0 {
+		return 0
+	}
+	return s
+}
+
+func init() {
+	RootCmd.AddCommand(varcallCmd)
+
+	varcallCmd.Flags().StringP("ref", "r", "", "reference sequences in FASTA format")
+	varcallCmd.Flags().IntP("min-depth", "d", 10, "minimum depth of positions")
+	varcallCmd.Flags().IntP("min-base-qual", "Q", 20, "minimum base quality")
+	varcallCmd.Flags().IntP("min-map-qual", "q", 0, "minimum mapping quality")
+	varcallCmd.Flags().IntP("min-alt-count", "c", 3, "minimum number of reads supporting an alternative allele")
+	varcallCmd.Flags().Float64P("min-freq", "f", 0.05, "minimum alternative allele frequency")
+}
@@ -0,0 +1,118 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFisherExactTest(t *testing.T) {
+	tests := []struct {
+		a, b, c, d int
+		p          float64
+	}{
+		{0, 0, 0, 0, 1},
+		{2, 1, 1, 0, 1},
+		{3, 1, 1, 3, 0.4857142857},
+		{1, 9, 11, 3, 0.0027594562},
+		{10, 0, 0, 10, 1.0825088e-05},
+		{0, 10, 10, 0, 1.0825088e-05},
+	}
+	for _, test := range tests {
+		if p := fisherExactTest(test.a, test.b, test.c, test.d); math.Abs(p-test.p) > test.p*1e-6 {
+			t.Errorf("%d,%d,%d,%d: expected %g, returned %g", test.a, test.b, test.c, test.d, test.p, p)
+		}
+	}
+
+	scores := []struct {
+		p float64
+		s int
+	}{
+		{1, 0},
+		{0.05, 13},
+		{0.01, 20},
+		{0, 255},
+		{1e-30, 255},
+	}
+	for _, test := range scores {
+		if s := phredScore(test.p); s != test.s {
+			t.Errorf("phred score of %g: expected %d, returned %d", test.p, test.s, s)
+		}
+	}
+}
+
+func TestVarcall(t *testing.T) {
+	dir := t.TempDir()
+	refFile := writeTestFile(t, dir, "ref.fa", ">chr1\nACGTACGTACGTACGTACGT\n")
+	samFile := writeTestFile(t, dir, "aln.sam", `@SQ	SN:chr1	LN:20
+r1	0	chr1	1	60	10M	*	0	0	ACGTTCGTAC	*
+r2	16	chr1	1	60	10M	*	0	0	ACGTTCGTAC	*
+r3	0	chr1	1	60	10M	*	0	0	ACGTACGTAC	*
+r4	0	chr1	1	60	4M2D4M	*	0	0	ACGTGTAC	*
+r5	0	chr1	1	60	4M1I6M	*	0	0	ACGTGACGTAC	*
+r6	4	*	0	0	*	*	0	0	ACGT	*
+`)
+	outFile := filepath.Join(dir, "out.vcf")
+
+	RootCmd.SetArgs([]string{"varcall", samFile, "-r", refFile, "-o", outFile, "--quiet",
+		"--min-depth", "5", "--min-alt-count", "1", "--min-freq", "0.1"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header, variants []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if strings.HasPrefix(line, "#") {
+			header = append(header, line)
+		} else {
+			variants = append(variants, line)
+		}
+	}
+	if len(header) == 0 || header[0] != "##fileformat=VCFv4.2" || header[len(header)-1][:6] != "#CHROM" {
+		t.Errorf("unexpected VCF header: %v", header)
+	}
+	found := false
+	for _, line := range header {
+		if line == "##contig=<ID=chr1,length=20>" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("contig line expected in the VCF header")
+	}
+
+	expected := []string{
+		"chr1\t4\t.\tTAC\tT\t.\tPASS\tDP=5;AD=3,1;AF=0.2000;DP4=2,1,1,0;SB=0;INDEL",
+		"chr1\t4\t.\tT\tTG\t.\tPASS\tDP=5;AD=3,1;AF=0.2000;DP4=2,1,1,0;SB=0;INDEL",
+		"chr1\t5\t.\tA\tT\t.\tPASS\tDP=5;AD=2,2;AF=0.4000;DP4=2,0,1,1;SB=0",
+	}
+	if strings.Join(variants, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("variants: expected:\n%s\nreturned:\n%s", strings.Join(expected, "\n"), strings.Join(variants, "\n"))
+	}
+}
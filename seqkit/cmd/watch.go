@@ -35,6 +35,7 @@ import (
 	"github.com/shenwei356/bio/seqio/fastx"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
+	"github.com/syanle/seqkit-playground/v2/seqkit/lib"
 )
 
 // watchCmd represents the watch command
@@ -122,6 +123,8 @@ var watchCmd = &cobra.Command{
 			for _, f := range validFields {
 				fmt.Printf("%-10s\t%s\n", f, fmap[f].Title)
 			}
+			fmt.Printf("\nA field could also be a numeric expression of variables, e.g., \"avgqual * len\":\n\n")
+			fmt.Print(fxExprVarsHelp(""))
 			os.Exit(0)
 		}
 
@@ -132,10 +135,33 @@ var watchCmd = &cobra.Command{
 		}
 
 		for _, f := range fields {
-			if fmap[f].Generate == nil {
-				fmt.Fprintf(os.Stderr, "Invalid field: %s\n", f)
+			if fmap[f].Generate != nil {
+				continue
+			}
+			expr, err := lib.CompileExpr(f)
+			if err == nil {
+				err = checkFxExprVars(expr)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid field: %s: %s\n", f, err)
 				os.Exit(1)
 			}
+			env := newFxExprEnv(qBase)
+			fmap[f] = fieldInfo{
+				f,
+				func(r *fastx.Record) float64 {
+					env.Reset(r)
+					v, err := expr.Eval(env.Lookup)
+					if err != nil {
+						checkError(fmt.Errorf("%s: %s", r.ID, err))
+					}
+					x, ok := v.(float64)
+					if !ok {
+						checkError(fmt.Errorf("%s: value of field %s is not a number: %v", r.ID, f, v))
+					}
+					return x
+				},
+			}
 		}
 
 		transform := func(x float64) float64 { return x }
@@ -283,7 +309,7 @@ func init() {
 	watchCmd.Flags().BoolP("validate-seq", "v", false, "validate bases according to the alphabet")
 	watchCmd.Flags().BoolP("pass", "x", false, "pass through mode (write input to stdout)")
 	watchCmd.Flags().BoolP("log", "L", false, "log10(x+1) transform numeric values")
-	watchCmd.Flags().StringP("fields", "f", "ReadLen", "target fields, available values: ReadLen, MeanQual, GC, GCSkew")
+	watchCmd.Flags().StringP("fields", "f", "ReadLen", "target fields, available values: ReadLen, MeanQual, GC, GCSkew, or a numeric expression like 'avgqual * len', see -H/--list-fields")
 	watchCmd.Flags().IntP("validate-seq-length", "V", 10000, "length of sequence to validate (0 for whole seq)")
 	watchCmd.Flags().IntP("qual-ascii-base", "b", 33, "ASCII BASE, 33 for Phred+33")
 	watchCmd.Flags().IntP("bins", "B", -1, "number of histogram bins")
@@ -0,0 +1,900 @@
+// Copyright © 2016 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/bwt/fmi"
+)
+
+// Primer is a named primer pair.
+type Primer struct {
+	Name string
+	F    []byte // Forward primer
+	R    []byte // reverse complementary sequence of reverse primer
+
+	Rule *PrimerRule // mismatch rule of the primer pair, nil for using the one in options
+}
+
+// PrimerRule is a rule of matching primers with mismatches.
+// As PCR tolerates mismatches in the 5' end far better than in the 3' end,
+// mismatches could be disallowed in the 3' end of primers.
+type PrimerRule struct {
+	MaxMismatch    int // max mismatches of a primer
+	NoMismatch3End int // no mismatches allowed in the last N bases of a primer, 0 for no limit
+}
+
+// LoadPrimers reads a 2- to 5-column tabular primer file, with first column
+// as primer name, the optional 4th and 5th columns are the mismatch rule
+// (PrimerRule.MaxMismatch and PrimerRule.NoMismatch3End) of the primer pair.
+// Missing columns are returned as empty strings, and lines with other numbers
+// of columns are skipped.
+func LoadPrimers(file string) ([][5]string, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("load primers from '%s': %s", file, err)
+	}
+	defer fh.Close()
+
+	var text string
+	var items []string
+	lists := make([][5]string, 0, 100)
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		text = strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		items = strings.Split(text, "\t")
+		if len(items) < 2 || len(items) > 5 {
+			continue
+		}
+		var list [5]string
+		copy(list[:], items)
+		lists = append(lists, list)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("load primers from '%s': %s", file, err)
+	}
+
+	return lists, nil
+}
+
+// ParsePrimers checks primer sequences and computes the reverse complementary
+// sequences of reverse primers. A mismatch rule is created if the 4th or 5th
+// column is not empty, where an empty column means 0.
+func ParsePrimers(primers [][5]string) ([]Primer, error) {
+	list := make([]Primer, 0, len(primers))
+
+	for _, items := range primers {
+		forward := []byte(items[1])
+		if seq.DNAredundant.IsValid(forward) != nil {
+			return nil, fmt.Errorf("invalid primer sequence: %s", forward)
+		}
+
+		reverse := []byte(items[2])
+		if seq.DNAredundant.IsValid(reverse) != nil {
+			return nil, fmt.Errorf("invalid primer sequence: %s", reverse)
+		}
+
+		// compute revcom of reverse
+		s, _ := seq.NewSeq(seq.DNAredundant, reverse)
+		reverse = s.RevComInplace().Seq
+
+		var rule *PrimerRule
+		if items[3] != "" || items[4] != "" {
+			rule = &PrimerRule{}
+			var err error
+			if rule.MaxMismatch, err = parsePrimerRuleValue(items[3]); err != nil {
+				return nil, fmt.Errorf("invalid max mismatches of primer pair %s: %s", items[0], items[3])
+			}
+			if rule.NoMismatch3End, err = parsePrimerRuleValue(items[4]); err != nil {
+				return nil, fmt.Errorf("invalid length of 3' end without mismatches of primer pair %s: %s", items[0], items[4])
+			}
+		}
+
+		list = append(list, Primer{Name: items[0], F: forward, R: reverse, Rule: rule})
+	}
+	return list, nil
+}
+
+// parsePrimerRuleValue parses a non-negative integer, "" for 0.
+func parsePrimerRuleValue(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("non-negative integer expected: %s", s)
+	}
+	return v, nil
+}
+
+// rule returns the mismatch rule of the primer pair, or the one in options.
+func (primer *Primer) rule(opt *AmpliconOptions) PrimerRule {
+	if primer.Rule != nil {
+		return *primer.Rule
+	}
+	return PrimerRule{MaxMismatch: opt.MaxMismatch, NoMismatch3End: opt.NoMismatch3End}
+}
+
+// AmpliconOptions contains the options of FindAmplicons.
+type AmpliconOptions struct {
+	// the mismatch rule for primer pairs without one (see PrimerRule)
+	MaxMismatch    int
+	NoMismatch3End int
+
+	OnlyPositiveStrand bool
+
+	// Begin and End (1-based) specify the region to return,
+	// both 0 for the whole amplicon. See AmpliconFinder.LocateRange.
+	Begin    int
+	End      int
+	Flanking bool
+	Strict   bool
+
+	// only for FindPCRProducts, 0 for no limit
+	MaxProductSize int
+}
+
+// Amplicon is an amplicon (or a region around it) found by FindAmplicons.
+type Amplicon struct {
+	Primer string // name of the primer pair
+	Strand string // "+" or "-"
+
+	// Begin and End are 1-based locations on the searched strand,
+	// i.e., on the reverse complementary sequence for the negative strand.
+	Begin int
+	End   int
+
+	Mismatch5 int // mismatches of the forward primer
+	Mismatch3 int // mismatches of the reverse primer
+
+	Seq *seq.Seq
+}
+
+// FindAmplicons searches all primer pairs on both strands of a record,
+// the record itself is not modified.
+func FindAmplicons(record *fastx.Record, primers []Primer, opt *AmpliconOptions) ([]Amplicon, error) {
+	usingRegion := opt.Begin != 0 || opt.End != 0
+
+	var finder *AmpliconFinder
+	var loc, mis []int
+	var err error
+	var s *seq.Seq
+	amplicons := make([]Amplicon, 0, 1)
+	for _, strand := range []string{"+", "-"} {
+		if strand == "-" {
+			if opt.OnlyPositiveStrand {
+				continue
+			}
+			s = record.Seq.RevCom()
+		} else {
+			s = record.Seq
+		}
+
+		for _, primer := range primers {
+			rule := primer.rule(opt)
+			finder, err = NewAmpliconFinder(s.Seq, primer.F, primer.R, rule.MaxMismatch)
+			if err != nil {
+				return nil, err
+			}
+			finder.NoMismatch3End = rule.NoMismatch3End
+
+			if usingRegion {
+				loc, mis, err = finder.LocateRange(opt.Begin, opt.End, opt.Flanking, opt.Strict)
+			} else {
+				loc, mis, err = finder.Locate()
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if loc == nil {
+				continue
+			}
+
+			amplicons = append(amplicons, Amplicon{
+				Primer:    primer.Name,
+				Strand:    strand,
+				Begin:     loc[0],
+				End:       loc[1],
+				Mismatch5: mis[0],
+				Mismatch3: mis[1],
+				Seq:       s.SubSeq(loc[0], loc[1]),
+			})
+		}
+	}
+	return amplicons, nil
+}
+
+// mismatches counts mismatches of two sequences with the same length.
+// hasDegenerateBase checks if a primer contains bases other than A, C, G, T.
+func hasDegenerateBase(s []byte) bool {
+	for _, b := range s {
+		switch b {
+		case 'A', 'C', 'G', 'T', 'a', 'c', 'g', 't':
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+func mismatches(s1, s2 []byte) int {
+	var n int
+	for i, a := range s1 {
+		if a != s2[i] {
+			n++
+		}
+	}
+	return n
+}
+
+// PCRProduct is a product of in-silico PCR with a primer pair,
+// found by FindPCRProducts.
+type PCRProduct struct {
+	Primer string // name of the primer pair
+	Strand string // "+" or "-"
+
+	// Begin and End are 1-based locations on the searched strand,
+	// i.e., on the reverse complementary sequence for the negative strand.
+	Begin int
+	End   int
+
+	// positions of mismatches in the forward and reverse primers,
+	// counted from the 3' end of the primer, i.e., 1 for the 3'-end base.
+	MismatchesF []int
+	MismatchesR []int
+}
+
+// Size returns the size of the product.
+func (p *PCRProduct) Size() int {
+	return p.End - p.Begin + 1
+}
+
+// OffTarget tells whether any primer of the product binds with mismatches.
+func (p *PCRProduct) OffTarget() bool {
+	return len(p.MismatchesF) > 0 || len(p.MismatchesR) > 0
+}
+
+// primerSite is a binding site of a primer, with 0-based location.
+type primerSite struct {
+	pos int
+	mis []int // positions of mismatches, counted from the 3' end of the primer
+}
+
+// primerSites returns all binding sites of an upper-case primer following
+// the mismatch rule, degenerate bases are allowed. For the reverse
+// complementary sequence of reverse primer (rc), its 3' end is on the left.
+func primerSites(s, p []byte, rule PrimerRule, rc bool) []primerSite {
+	var sites []primerSite
+	var mis []int
+	var ok bool
+	var pos int
+	for i := 0; i+len(p) <= len(s); i++ {
+		mis = mis[:0]
+		ok = true
+		for j, b := range p {
+			if baseMatch(b, s[i+j], true) {
+				continue
+			}
+			if len(mis) == rule.MaxMismatch {
+				ok = false
+				break
+			}
+			if rc {
+				pos = j + 1
+			} else {
+				pos = len(p) - j
+			}
+			if pos <= rule.NoMismatch3End {
+				ok = false
+				break
+			}
+			mis = append(mis, pos)
+		}
+		if !ok {
+			continue
+		}
+
+		site := primerSite{pos: i}
+		if len(mis) > 0 {
+			site.mis = make([]int, len(mis))
+			copy(site.mis, mis)
+			sort.Ints(site.mis)
+		}
+		sites = append(sites, site)
+	}
+	return sites
+}
+
+// FindPCRProducts searches all products of primer pairs on both strands of
+// a record, unlike FindAmplicons which returns only the longest one.
+// Every pair of binding sites of forward and reverse primers, following the
+// mismatch rule of the primer pair (or the one in opt), and a product size of at most
+// opt.MaxProductSize (0 for no limit), makes a product.
+// Both primers are needed, and the region options are ignored.
+func FindPCRProducts(record *fastx.Record, primers []Primer, opt *AmpliconOptions) ([]PCRProduct, error) {
+	for _, primer := range primers {
+		if len(primer.F) == 0 || len(primer.R) == 0 {
+			return nil, fmt.Errorf("both forward and reverse primers needed for primer pair: %s", primer.Name)
+		}
+	}
+
+	var s []byte
+	var sitesF, sitesR []primerSite
+	var end int
+	products := make([]PCRProduct, 0, 1)
+	for _, strand := range []string{"+", "-"} {
+		if strand == "-" {
+			if opt.OnlyPositiveStrand {
+				continue
+			}
+			s = bytes.ToUpper(record.Seq.RevCom().Seq)
+		} else {
+			s = bytes.ToUpper(record.Seq.Seq)
+		}
+
+		for _, primer := range primers {
+			rule := primer.rule(opt)
+			sitesF = primerSites(s, bytes.ToUpper(primer.F), rule, false)
+			if len(sitesF) == 0 {
+				continue
+			}
+			sitesR = primerSites(s, bytes.ToUpper(primer.R), rule, true)
+
+			for _, f := range sitesF {
+				for _, r := range sitesR {
+					if r.pos < f.pos { // wrong location of F and R:  5' ---R-----F---- 3'
+						continue
+					}
+					end = r.pos + len(primer.R) - 1
+					if opt.MaxProductSize > 0 && end-f.pos+1 > opt.MaxProductSize {
+						break // sites are sorted
+					}
+					products = append(products, PCRProduct{
+						Primer:      primer.Name,
+						Strand:      strand,
+						Begin:       f.pos + 1,
+						End:         end + 1,
+						MismatchesF: f.mis,
+						MismatchesR: r.mis,
+					})
+				}
+			}
+		}
+	}
+	return products, nil
+}
+
+// PrimerDimer is a potential primer-dimer, where the 3' end of a primer
+// anneals to another primer, or to itself for self-complementarity.
+type PrimerDimer struct {
+	Pair1, Pair2     string // names of primer pairs
+	Primer1, Primer2 string // "F" or "R"
+
+	// length of the longest 3'-end sequence of primer 1 being
+	// exactly complementary to primer 2
+	Len int
+}
+
+// Self tells whether it is a self-complementarity of a primer.
+func (d *PrimerDimer) Self() bool {
+	return d.Pair1 == d.Pair2 && d.Primer1 == d.Primer2
+}
+
+// FindPrimerDimers checks every two primers (including a primer with
+// itself) of primer pairs, and returns the ones with a 3'-end complementary
+// sequence of at least minLen bases.
+func FindPrimerDimers(primers []Primer, minLen int) []PrimerDimer {
+	type _primer struct {
+		pair, name string
+		s, rc      []byte
+	}
+	list := make([]_primer, 0, len(primers)<<1)
+	for _, primer := range primers {
+		if len(primer.F) > 0 {
+			s, _ := seq.NewSeq(seq.DNAredundant, bytes.ToUpper(primer.F))
+			list = append(list, _primer{primer.Name, "F", s.Seq, s.RevCom().Seq})
+		}
+		if len(primer.R) > 0 { // primer.R is the reverse complementary sequence
+			s, _ := seq.NewSeq(seq.DNAredundant, bytes.ToUpper(primer.R))
+			list = append(list, _primer{primer.Name, "R", s.RevCom().Seq, s.Seq})
+		}
+	}
+
+	if minLen < 1 {
+		minLen = 1
+	}
+	var dimers []PrimerDimer
+	var l int
+	for _, a := range list {
+		for _, b := range list {
+			// the 3'-end sequence of a anneals to b,
+			// i.e., it is a substring of b's reverse complementary sequence.
+			for l = len(a.s); l >= minLen; l-- {
+				if bytes.Contains(b.rc, a.s[len(a.s)-l:]) {
+					break
+				}
+			}
+			if l < minLen {
+				continue
+			}
+			dimers = append(dimers, PrimerDimer{
+				Pair1: a.pair, Primer1: a.name,
+				Pair2: b.pair, Primer2: b.name,
+				Len: l,
+			})
+		}
+	}
+	return dimers
+}
+
+// AmpliconFinder is a struct for locating amplicon via primer(s).
+type AmpliconFinder struct {
+	Seq []byte
+	F   []byte // Forward primer
+	R   []byte // R should be reverse complementary sequence of reverse primer
+
+	MaxMismatch int
+	FMindex     *fmi.FMIndex
+
+	// no mismatches allowed in the last N bases at the 3' end of primers,
+	// 0 for no limit. It should be set before searching.
+	NoMismatch3End int
+
+	rcF bool // F is the reverse complementary sequence of reverse primer, when only R is given
+
+	searched, found bool
+	iBegin, iEnd    int // 0-based
+	mis5, mis3      int
+
+	rF, rR *regexp.Regexp
+}
+
+// NewAmpliconFinder returns a AmpliconFinder struct.
+func NewAmpliconFinder(sequence, forwardPrimer, reversePrimerRC []byte, maxMismatch int) (*AmpliconFinder, error) {
+	if len(sequence) == 0 {
+		return nil, fmt.Errorf("non-blank sequence needed")
+	}
+	if len(forwardPrimer) == 0 && len(reversePrimerRC) == 0 {
+		return nil, fmt.Errorf("at least one primer needed")
+	}
+
+	var rcF bool
+	if len(forwardPrimer) == 0 { // F = R.revcom()
+		forwardPrimer = reversePrimerRC
+		reversePrimerRC = nil
+		rcF = true
+	}
+
+	finder := &AmpliconFinder{
+		Seq: bytes.ToUpper(sequence), // to upper case
+		F:   bytes.ToUpper(forwardPrimer),
+		R:   bytes.ToUpper(reversePrimerRC),
+		rcF: rcF,
+	}
+
+	if maxMismatch > 0 { // using FM-index
+		if hasDegenerateBase(finder.F) || hasDegenerateBase(finder.R) {
+			return nil, fmt.Errorf("it does not support both degenerate base and mismatch")
+		}
+		index := fmi.NewFMIndex()
+		_, err := index.Transform(finder.Seq)
+		if err != nil {
+			return nil, err
+		}
+		finder.MaxMismatch = maxMismatch
+		finder.FMindex = index
+		return finder, nil
+	}
+
+	if hasDegenerateBase(finder.F) {
+		s, _ := seq.NewSeq(seq.Unlimit, finder.F)
+		rF, err := regexp.Compile(s.Degenerate2Regexp())
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse primer containing degenerate base: %s", finder.F)
+		}
+		finder.rF = rF
+	}
+
+	if hasDegenerateBase(finder.R) {
+		s, _ := seq.NewSeq(seq.Unlimit, finder.R)
+		rR, err := regexp.Compile(s.Degenerate2Regexp())
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse primer containing degenerate base: %s", finder.R)
+		}
+		finder.rR = rR
+	}
+	return finder, nil
+}
+
+// LocateRange returns location of the range (begin:end, 1-based).
+func (finder *AmpliconFinder) LocateRange(begin, end int, flanking bool, strictMode bool) ([]int, []int, error) {
+	if begin == 0 || end == 0 {
+		return nil, nil, fmt.Errorf("both begin and end in region should not be 0")
+	}
+	if flanking {
+		if begin > 0 && end < 0 {
+			return nil, nil, fmt.Errorf("invalid flanking region (x:-y): %d:%d", begin, end)
+		}
+	} else {
+		if begin < 0 && end > 0 {
+			return nil, nil, fmt.Errorf("invalid inner region (-x:y): %d:%d", begin, end)
+		}
+	}
+
+	if !finder.searched {
+		_, _, err := finder.Locate()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if !finder.found {
+		return nil, nil, nil
+	}
+
+	var b, e int
+	var ok bool
+	if flanking {
+		b, e, ok = SubLocationFlanking(len(finder.Seq), finder.iBegin, finder.iEnd, begin, end, strictMode)
+	} else {
+		b, e, ok = SubLocationInner(len(finder.Seq), finder.iBegin, finder.iEnd, begin, end, strictMode)
+	}
+
+	if ok {
+		return []int{b, e}, []int{finder.mis5, finder.mis3}, nil
+	}
+
+	return nil, nil, nil
+}
+
+// SubLocationInner returns location of a range (begin:end, relative to amplicon).
+// B/E: 0-based, location of amplicon.
+// begin/end: 1-based, begin: relative location to 5' end of amplicon,
+// end: relative location to 3' end of amplicon.
+// Returned locations are 1-based. Invalid ranges (-x:y) are reported as not ok.
+//
+//	            F
+//	-----===============-----
+//	     1 3 5                    x/y
+//	              -5-3-1          x/y
+//	     F             R
+//	-----=====-----=====-----     x:y
+//
+//	     ===============          1:-1
+//	     =======                  1:7
+//	       =====                  3:7
+//	          =====               6:10
+//	          =====             -10:-6
+//	             =====           -7:-3
+//	                             -x:y (invalid)
+func SubLocationInner(length, B, E, begin, end int, strictMode bool) (int, int, bool) {
+	if begin == 0 || end == 0 {
+		return 0, 0, false
+	}
+
+	if begin < 0 && end > 0 {
+		return 0, 0, false
+	}
+
+	if length == 0 || B < 0 || B > length-1 || E < 0 || E > length-1 {
+		return 0, 0, false
+	}
+
+	var b, e int
+
+	if begin > 0 {
+		b = B + begin
+	} else {
+		b = E + begin + 2
+	}
+	if b > length {
+		if strictMode {
+			return 0, 0, false
+		}
+		b = length
+	} else if b < 1 {
+		if strictMode {
+			return 0, 0, false
+		}
+		b = 1
+	}
+
+	if end > 0 {
+		e = B + end
+	} else {
+		e = E + end + 2
+	}
+	if e > length {
+		if strictMode {
+			return 0, 0, false
+		}
+		e = length
+	} else if e < 1 {
+		if strictMode {
+			return 0, 0, false
+		}
+		e = 1
+	}
+
+	if b > e {
+		return b, e, false
+	}
+
+	return b, e, true
+}
+
+// SubLocationFlanking returns location of a flanking range (begin:end, relative to amplicon).
+// B/E: 0-based, location of amplicon.
+// begin/end: 1-based, begin: relative location to 5' end of amplicon,
+// end: relative location to 3' end of amplicon.
+// Returned locations are 1-based. Invalid ranges (x:-y) are reported as not ok.
+//
+//	            F
+//	-----===============-----
+//	 -3-1                        x/y
+//	                    1 3 5    x/y
+//	     F             R
+//	-----=====-----=====-----
+//	=====                        -5:-1
+//	===                          -5:-3
+//	                    =====     1:5
+//	                      ===     3:5
+//	    =================        -1:1
+//	=========================    -5:5
+//	                              x:-y (invalid)
+func SubLocationFlanking(length, B, E, begin, end int, strictMode bool) (int, int, bool) {
+	if begin == 0 || end == 0 {
+		return 0, 0, false
+	}
+
+	if begin > 0 && end < 0 {
+		return 0, 0, false
+	}
+
+	if length == 0 || B < 0 || B > length-1 || E < 0 || E > length-1 {
+		return 0, 0, false
+	}
+
+	var b, e int
+	var flag bool // 5' flanking is shorter than -begin
+
+	if begin > 0 {
+		b = E + begin + 1
+	} else {
+		b = B + begin + 1
+	}
+	if b > length {
+		// b = length
+		return 0, 0, false
+	} else if b < 1 {
+		if strictMode {
+			return 0, 0, false
+		}
+		b = 1
+		flag = true
+		// return 0, 0, false
+	}
+
+	if end > 0 {
+		e = E + end + 1
+	} else {
+		e = B + end + 1
+	}
+	if e > length {
+		if strictMode {
+			return 0, 0, false
+		}
+		e = length
+	} else if e < 1 {
+		if strictMode {
+			return 0, 0, false
+		}
+		if flag {
+			return 0, 0, false
+		}
+		e = 1
+	}
+
+	if b > e {
+		return b, e, false
+	}
+
+	return b, e, true
+}
+
+// Locate returns location of amplicon.
+// Locations are 1-based, nil returns if not found.
+func (finder *AmpliconFinder) Locate() ([]int, []int, error) {
+	if finder.searched {
+		if finder.found {
+			return []int{finder.iBegin + 1, finder.iEnd + 1}, []int{finder.mis5, finder.mis3}, nil
+		}
+		return nil, nil, nil
+	}
+
+	if finder.MaxMismatch <= 0 { // exactly matching
+		// search F
+		var i int
+
+		if finder.rF == nil {
+			i = bytes.Index(finder.Seq, finder.F)
+			if i < 0 { // not found
+				finder.searched, finder.found = true, false
+				return nil, nil, nil
+			}
+		} else {
+			loc := finder.rF.FindSubmatchIndex(finder.Seq)
+			if len(loc) == 0 {
+				finder.searched, finder.found = true, false
+				return nil, nil, nil
+			}
+			i = loc[0]
+		}
+
+		if len(finder.R) == 0 { // only forward primer, returns location of F
+			finder.searched, finder.found = true, true
+			finder.iBegin, finder.iEnd = i, i+len(finder.F)-1
+			finder.mis5, finder.mis3 = 0, 0 // exactly (or degenerately) matched
+			return []int{i + 1, i + len(finder.F)},
+				[]int{finder.mis5, finder.mis3},
+				nil
+		}
+
+		// two primers given, need to search R
+		var j int
+		if finder.rR == nil {
+			j = bytes.Index(finder.Seq, finder.R)
+			if j < 0 {
+				finder.searched, finder.found = true, false
+				return nil, nil, nil
+			}
+
+			for {
+				if j+1 >= len(finder.Seq) {
+					break
+				}
+				k := bytes.Index(finder.Seq[j+1:], finder.R)
+				if k < 0 {
+					break
+				}
+				j += k + 1
+			}
+		} else {
+			loc := finder.rR.FindAllSubmatchIndex(finder.Seq, -1)
+			if len(loc) == 0 {
+				finder.searched, finder.found = true, false
+				return nil, nil, nil
+			}
+			j = loc[len(loc)-1][0]
+		}
+
+		if j < i { // wrong location of F and R:  5' ---R-----F---- 3'
+			finder.searched, finder.found = true, false
+			return nil, nil, nil
+		}
+		finder.searched, finder.found = true, true
+		finder.iBegin, finder.iEnd = i, j+len(finder.R)-1
+		finder.mis5, finder.mis3 = 0, 0 // exactly (or degenerately) matched
+		return []int{i + 1, j + len(finder.R)},
+			[]int{finder.mis5, finder.mis3},
+			nil
+	}
+
+	// search F
+	locsI, err := finder.FMindex.Locate(finder.F, finder.MaxMismatch)
+	if err != nil {
+		return nil, nil, err
+	}
+	locsI = finder.filter3End(locsI, finder.F, finder.rcF)
+	if len(locsI) == 0 { // F not found
+		finder.searched, finder.found = true, false
+		return nil, nil, nil
+	}
+	if len(finder.R) == 0 { // returns location of F
+		sort.Ints(locsI) // remain the first location
+		finder.searched, finder.found = true, true
+		finder.iBegin, finder.iEnd = locsI[0], locsI[0]+len(finder.F)-1
+		finder.mis5 = mismatches(finder.Seq[locsI[0]:locsI[0]+len(finder.F)], finder.F)
+		finder.mis3 = 0
+		return []int{locsI[0] + 1, locsI[0] + len(finder.F)},
+			[]int{finder.mis5, finder.mis3},
+			nil
+	}
+
+	// search R
+	locsJ, err := finder.FMindex.Locate(finder.R, finder.MaxMismatch)
+	if err != nil {
+		return nil, nil, err
+	}
+	locsJ = finder.filter3End(locsJ, finder.R, true)
+	if len(locsJ) == 0 {
+		finder.searched, finder.found = true, false
+		return nil, nil, nil
+	}
+	sort.Ints(locsI) // to remain the FIRST location
+	sort.Ints(locsJ) // to remain the LAST location
+	finder.searched, finder.found = true, true
+	finder.iBegin, finder.iEnd = locsI[0], locsJ[len(locsJ)-1]+len(finder.R)-1
+	finder.mis5 = mismatches(finder.Seq[locsI[0]:locsI[0]+len(finder.F)], finder.F)
+	finder.mis3 = mismatches(finder.Seq[locsJ[len(locsJ)-1]:locsJ[len(locsJ)-1]+len(finder.R)], finder.R)
+	return []int{locsI[0] + 1, locsJ[len(locsJ)-1] + len(finder.R)},
+		[]int{finder.mis5, finder.mis3},
+		nil
+}
+
+// filter3End removes locations of a primer with mismatches in the last
+// NoMismatch3End bases at the 3' end, which is on the left for the reverse
+// complementary sequence of reverse primer (rc).
+func (finder *AmpliconFinder) filter3End(locs []int, p []byte, rc bool) []int {
+	n := finder.NoMismatch3End
+	if n <= 0 {
+		return locs
+	}
+	if n > len(p) {
+		n = len(p)
+	}
+
+	var b, e int // region of the 3' end in the primer
+	if rc {
+		b, e = 0, n
+	} else {
+		b, e = len(p)-n, len(p)
+	}
+
+	j := 0
+	for _, i := range locs {
+		if bytes.Equal(finder.Seq[i+b:i+e], p[b:e]) {
+			locs[j] = i
+			j++
+		}
+	}
+	return locs[:j]
+}
+
+// Location returns location of amplicon.
+// Locations are 1-based, nil returns if not found.
+func (finder *AmpliconFinder) Location() ([]int, []int, error) {
+	if !finder.searched {
+		_, _, err := finder.Locate()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if !finder.found {
+		return nil, nil, nil
+	}
+
+	return []int{finder.iBegin + 1, finder.iEnd + 1}, []int{finder.mis5, finder.mis3}, nil
+}
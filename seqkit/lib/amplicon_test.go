@@ -0,0 +1,468 @@
+// Copyright © 2016 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+// ampliconSeq contains an amplicon at 6-20: -----=====-----=====-----
+var ampliconSeq = []byte("TTTTTACGGATCTCTGCATGTTTTT")
+
+func TestAmpliconFinderLocate(t *testing.T) {
+	tests := []struct {
+		name        string
+		f, r        string // r is the reverse complementary sequence of reverse primer
+		maxMismatch int
+		loc, mis    []int
+	}{
+		{"exact", "ACGGA", "GCATG", 0, []int{6, 20}, []int{0, 0}},
+		{"exact, only F", "ACGGA", "", 0, []int{6, 10}, []int{0, 0}},
+		{"exact, only R", "", "GCATG", 0, []int{16, 20}, []int{0, 0}},
+		{"exact, lower case", "acgga", "gcatg", 0, []int{6, 20}, []int{0, 0}},
+		{"exact, not found", "ACGGC", "GCATG", 0, nil, nil},
+		{"exact, R before F", "GCATG", "ACGGA", 0, nil, nil},
+		{"degenerate", "ACNGA", "GCRTG", 0, []int{6, 20}, []int{0, 0}}, // nil, nil before
+		{"degenerate, not found", "ACNGT", "GCRTG", 0, nil, nil},
+		{"mismatch", "ACGCA", "GCATG", 1, []int{6, 20}, []int{1, 0}},
+		{"mismatch, both primers", "ACGCA", "GCAAG", 1, []int{6, 20}, []int{1, 1}},
+		{"mismatch, not found", "ACCCA", "GCATG", 1, nil, nil},
+	}
+
+	for _, test := range tests {
+		finder, err := NewAmpliconFinder(ampliconSeq, []byte(test.f), []byte(test.r), test.maxMismatch)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+
+		// the second call returns the cached result
+		for i := 0; i < 2; i++ {
+			loc, mis, err := finder.Locate()
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", test.name, err)
+				continue
+			}
+			if !equalInts(loc, test.loc) || !equalInts(mis, test.mis) {
+				t.Errorf("%s (call %d): expected %v %v, returned %v %v",
+					test.name, i+1, test.loc, test.mis, loc, mis)
+			}
+		}
+
+		loc, mis, err := finder.Location()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if !equalInts(loc, test.loc) || !equalInts(mis, test.mis) {
+			t.Errorf("%s (Location): expected %v %v, returned %v %v",
+				test.name, test.loc, test.mis, loc, mis)
+		}
+	}
+}
+
+func TestAmpliconFinderNoMismatch3End(t *testing.T) {
+	tests := []struct {
+		name     string
+		f, r     string // r is the reverse complementary sequence of reverse primer
+		no3End   int
+		loc, mis []int
+	}{
+		{"mismatch in F, out of 3' end", "ACGCA", "GCATG", 1, []int{6, 20}, []int{1, 0}},
+		{"mismatch in F, in 3' end", "ACGCA", "GCATG", 2, nil, nil},
+		{"mismatch in R, out of 3' end", "ACGGA", "GCAAG", 3, []int{6, 20}, []int{0, 1}},
+		{"mismatch in R, in 3' end", "ACGGA", "GCAAG", 4, nil, nil},
+		{"only R, out of 3' end", "", "GCAAG", 3, []int{16, 20}, []int{1, 0}},
+		{"only R, in 3' end", "", "GCAAG", 4, nil, nil},
+		{"longer than primer", "ACGCA", "GCATG", 10, nil, nil},
+	}
+
+	for _, test := range tests {
+		finder, err := NewAmpliconFinder(ampliconSeq, []byte(test.f), []byte(test.r), 1)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		finder.NoMismatch3End = test.no3End
+
+		loc, mis, err := finder.Locate()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if !equalInts(loc, test.loc) || !equalInts(mis, test.mis) {
+			t.Errorf("%s: expected %v %v, returned %v %v", test.name, test.loc, test.mis, loc, mis)
+		}
+	}
+}
+
+func TestNewAmpliconFinderError(t *testing.T) {
+	tests := []struct {
+		name        string
+		s, f, r     string
+		maxMismatch int
+	}{
+		{"blank sequence", "", "ACGGA", "GCATG", 0},
+		{"no primers", string(ampliconSeq), "", "", 0},
+		// degenerate primers were searched literally with mismatches before
+		{"degenerate F with mismatch", string(ampliconSeq), "ACNGA", "GCATG", 1},
+		{"degenerate R with mismatch", string(ampliconSeq), "ACGGA", "GCRTG", 1},
+	}
+	for _, test := range tests {
+		_, err := NewAmpliconFinder([]byte(test.s), []byte(test.f), []byte(test.r), test.maxMismatch)
+		if err == nil {
+			t.Errorf("%s: error expected", test.name)
+		}
+	}
+}
+
+func TestAmpliconFinderLocateRange(t *testing.T) {
+	finder, err := NewAmpliconFinder(ampliconSeq, []byte("ACGGA"), []byte("GCATG"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loc, _, err := finder.LocateRange(1, 5, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(loc, []int{6, 10}) {
+		t.Errorf("inner region 1:5: expected [6 10], returned %v", loc)
+	}
+
+	loc, _, err = finder.LocateRange(-5, -1, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(loc, []int{1, 5}) {
+		t.Errorf("flanking region -5:-1: expected [1 5], returned %v", loc)
+	}
+
+	if _, _, err = finder.LocateRange(-1, 1, false, false); err == nil {
+		t.Errorf("inner region -1:1: error expected")
+	}
+	if _, _, err = finder.LocateRange(1, -1, true, false); err == nil {
+		t.Errorf("flanking region 1:-1: error expected")
+	}
+}
+
+// The cases are the examples in the doc comments of
+// SubLocationInner and SubLocationFlanking.
+func TestSubLocation(t *testing.T) {
+	// -----=====-----=====-----
+	length, B, E := 25, 5, 19
+
+	tests := []struct {
+		flanking   bool
+		begin, end int
+		b, e       int
+		ok         bool
+	}{
+		{false, 1, -1, 6, 20, true},
+		{false, 1, 7, 6, 12, true},
+		{false, 3, 7, 8, 12, true},
+		{false, 6, 10, 11, 15, true},
+		{false, -10, -6, 11, 15, true},
+		{false, -7, -3, 14, 18, true},
+		{false, -1, 1, 0, 0, false},
+
+		{true, -5, -1, 1, 5, true},
+		{true, -5, -3, 1, 3, true},
+		{true, 1, 5, 21, 25, true},
+		{true, 3, 5, 23, 25, true},
+		{true, -1, 1, 5, 21, true},
+		{true, -5, 5, 1, 25, true},
+		{true, 1, -1, 0, 0, false},
+	}
+
+	var b, e int
+	var ok bool
+	for _, test := range tests {
+		if test.flanking {
+			b, e, ok = SubLocationFlanking(length, B, E, test.begin, test.end, false)
+		} else {
+			b, e, ok = SubLocationInner(length, B, E, test.begin, test.end, false)
+		}
+		if ok != test.ok || (ok && (b != test.b || e != test.e)) {
+			t.Errorf("flanking: %v, region %d:%d: expected %d, %d, %v, returned %d, %d, %v",
+				test.flanking, test.begin, test.end, test.b, test.e, test.ok, b, e, ok)
+		}
+	}
+
+	// out of range
+	if _, _, ok = SubLocationInner(length, B, E, 1, 30, true); ok {
+		t.Errorf("strict mode: inner region 1:30 should be invalid")
+	}
+	if b, e, ok = SubLocationInner(length, B, E, 1, 30, false); !ok || b != 6 || e != 25 {
+		t.Errorf("inner region 1:30: expected 6, 25, true, returned %d, %d, %v", b, e, ok)
+	}
+	if _, _, ok = SubLocationFlanking(length, B, E, -10, -1, true); ok {
+		t.Errorf("strict mode: flanking region -10:-1 should be invalid")
+	}
+}
+
+func TestFindAmplicons(t *testing.T) {
+	primers := []Primer{{Name: "p1", F: []byte("ACGGA"), R: []byte("GCATG")}}
+
+	plus, err := seq.NewSeq(seq.DNAredundant, ampliconSeq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	minus := plus.RevCom()
+
+	tests := []struct {
+		name   string
+		s      *seq.Seq
+		opt    AmpliconOptions
+		strand string // "" for not found
+	}{
+		{"positive strand", plus, AmpliconOptions{}, "+"},
+		{"negative strand", minus, AmpliconOptions{}, "-"},
+		{"negative strand, only positive strand", minus, AmpliconOptions{OnlyPositiveStrand: true}, ""},
+		{"negative strand, mismatch", minus, AmpliconOptions{MaxMismatch: 1}, "-"},
+	}
+
+	for _, test := range tests {
+		record := &fastx.Record{ID: []byte("s"), Name: []byte("s"), Seq: test.s}
+		raw := string(record.Seq.Seq)
+
+		amplicons, err := FindAmplicons(record, primers, &test.opt)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if string(record.Seq.Seq) != raw {
+			t.Errorf("%s: the record should not be modified", test.name)
+		}
+
+		if test.strand == "" {
+			if len(amplicons) != 0 {
+				t.Errorf("%s: no amplicons expected, returned %d", test.name, len(amplicons))
+			}
+			continue
+		}
+		if len(amplicons) != 1 {
+			t.Errorf("%s: one amplicon expected, returned %d", test.name, len(amplicons))
+			continue
+		}
+		a := amplicons[0]
+		if a.Primer != "p1" || a.Strand != test.strand || a.Begin != 6 || a.End != 20 ||
+			string(a.Seq.Seq) != "ACGGATCTCTGCATG" {
+			t.Errorf("%s: unexpected amplicon: %s %s %d-%d %s",
+				test.name, a.Primer, a.Strand, a.Begin, a.End, a.Seq.Seq)
+		}
+	}
+
+	// the rule of the primer pair overrides the options
+	primers = []Primer{
+		{Name: "p1", F: []byte("ACGCA"), R: []byte("GCATG"), Rule: &PrimerRule{MaxMismatch: 1, NoMismatch3End: 2}},
+		{Name: "p2", F: []byte("ACGCA"), R: []byte("GCATG"), Rule: &PrimerRule{MaxMismatch: 1, NoMismatch3End: 1}},
+	}
+	record := &fastx.Record{ID: []byte("s"), Name: []byte("s"), Seq: plus}
+	amplicons, err := FindAmplicons(record, primers, &AmpliconOptions{NoMismatch3End: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(amplicons) != 1 || amplicons[0].Primer != "p2" || amplicons[0].Mismatch5 != 1 {
+		t.Errorf("rules of primer pairs: only one amplicon of primer pair p2 expected, returned %d", len(amplicons))
+	}
+}
+
+func TestLoadPrimers(t *testing.T) {
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "primers.tsv")
+	data := "# comment\np1\tACGGA\tCATGC\n\np2\tACGGA\np3\tACGGA\tCATGC\t2\t5\n"
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	list, err := LoadPrimers(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0] != [5]string{"p1", "ACGGA", "CATGC"} || list[1] != [5]string{"p2", "ACGGA", ""} ||
+		list[2] != [5]string{"p3", "ACGGA", "CATGC", "2", "5"} {
+		t.Errorf("unexpected primers: %v", list)
+	}
+
+	primers, err := ParsePrimers(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the reverse complementary sequence of reverse primer,
+	// it was the reverse sequence (CGTAC) before.
+	if string(primers[0].R) != "GCATG" {
+		t.Errorf("reverse complementary sequence of reverse primer: expected GCATG, returned %s", primers[0].R)
+	}
+
+	// mismatch rules
+	if primers[0].Rule != nil || primers[2].Rule == nil || *primers[2].Rule != (PrimerRule{MaxMismatch: 2, NoMismatch3End: 5}) {
+		t.Errorf("unexpected mismatch rules: %v, %v", primers[0].Rule, primers[2].Rule)
+	}
+	for _, bad := range [][5]string{{"p1", "ACGGA", "CATGC", "x"}, {"p1", "ACGGA", "CATGC", "1", "-1"}} {
+		if _, err = ParsePrimers([][5]string{bad}); err == nil {
+			t.Errorf("invalid mismatch rule: error expected: %v", bad)
+		}
+	}
+
+	// missing file
+	if _, err = LoadPrimers(filepath.Join(dir, "missing.tsv")); err == nil {
+		t.Errorf("missing file: error expected")
+	}
+
+	// lines with bad column numbers are skipped
+	for _, bad := range []string{"p1\tACGGA\tCATGC\np2\n", "p1\tACGGA\tCATGC\np2\tA\tC\t1\t2\t3\n"} {
+		file = filepath.Join(dir, "bad.tsv")
+		if err = os.WriteFile(file, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		list, err = LoadPrimers(file)
+		if err != nil {
+			t.Errorf("bad column number: unexpected error: %s", err)
+			continue
+		}
+		if len(list) != 1 || list[0][0] != "p1" {
+			t.Errorf("bad column number: only p1 expected, returned %v", list)
+		}
+	}
+
+	// invalid primer sequence, which was accepted before
+	if _, err = ParsePrimers([][5]string{{"p1", "ACGZA", ""}}); err == nil {
+		t.Errorf("invalid primer sequence: error expected")
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) || (a == nil) != (b == nil) {
+		return false
+	}
+	for i, v := range a {
+		if v != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFindPCRProducts(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		f, r     string // r is the reverse complementary sequence of reverse primer
+		opt      AmpliconOptions
+		products string // primer:strand:begin-end:size:mismatchesF:mismatchesR, separated by ","
+	}{
+		{"exact", string(ampliconSeq), "ACGGA", "GCATG", AmpliconOptions{}, "p:+:6-20:15:[]:[]"},
+		{"negative strand", "AAAAACATGCAGAGATCCGTAAAAA", "ACGGA", "GCATG", AmpliconOptions{}, "p:-:6-20:15:[]:[]"},
+		{"negative strand, only positive strand", "AAAAACATGCAGAGATCCGTAAAAA", "ACGGA", "GCATG",
+			AmpliconOptions{OnlyPositiveStrand: true}, ""},
+		{"not found", string(ampliconSeq), "ACGCA", "GCATG", AmpliconOptions{}, ""},
+		{"mismatch in F", string(ampliconSeq), "ACGCA", "GCATG", AmpliconOptions{MaxMismatch: 1}, "p:+:6-20:15:[2]:[]"},
+		{"mismatch in R", string(ampliconSeq), "ACGGA", "GCAAG", AmpliconOptions{MaxMismatch: 1}, "p:+:6-20:15:[]:[4]"},
+		{"degenerate", string(ampliconSeq), "ACNGA", "GCRTG", AmpliconOptions{}, "p:+:6-20:15:[]:[]"},
+		{"multiple products", "ACGGATTACGGATTTGCATG", "ACGGA", "GCATG", AmpliconOptions{},
+			"p:+:1-20:20:[]:[],p:+:8-20:13:[]:[]"},
+		{"multiple products, max size", "ACGGATTACGGATTTGCATG", "ACGGA", "GCATG", AmpliconOptions{MaxProductSize: 15},
+			"p:+:8-20:13:[]:[]"},
+		{"mismatch in F, out of 3' end", string(ampliconSeq), "ACGCA", "GCATG", AmpliconOptions{MaxMismatch: 1, NoMismatch3End: 1},
+			"p:+:6-20:15:[2]:[]"},
+		{"mismatch in F, in 3' end", string(ampliconSeq), "ACGCA", "GCATG", AmpliconOptions{MaxMismatch: 1, NoMismatch3End: 2}, ""},
+		{"mismatch in R, in 3' end", string(ampliconSeq), "ACGGA", "GCAAG", AmpliconOptions{MaxMismatch: 1, NoMismatch3End: 4}, ""},
+	}
+
+	for _, test := range tests {
+		primers := []Primer{{Name: "p", F: []byte(test.f), R: []byte(test.r)}}
+		s, err := seq.NewSeq(seq.DNAredundant, []byte(test.s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		record := &fastx.Record{ID: []byte("s"), Name: []byte("s"), Seq: s}
+
+		products, err := FindPCRProducts(record, primers, &test.opt)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if string(record.Seq.Seq) != test.s {
+			t.Errorf("%s: the record should not be modified", test.name)
+		}
+
+		list := make([]string, len(products))
+		for i, p := range products {
+			list[i] = fmt.Sprintf("%s:%s:%d-%d:%d:%v:%v", p.Primer, p.Strand, p.Begin, p.End, p.Size(),
+				p.MismatchesF, p.MismatchesR)
+			if p.OffTarget() != (len(p.MismatchesF)+len(p.MismatchesR) > 0) {
+				t.Errorf("%s: unexpected off-target status of product: %s", test.name, list[i])
+			}
+		}
+		if result := strings.Join(list, ","); result != test.products {
+			t.Errorf("%s: expected %s, returned %s", test.name, test.products, result)
+		}
+	}
+
+	// the rule of the primer pair overrides the options
+	primers := []Primer{
+		{Name: "p", F: []byte("ACGCA"), R: []byte("GCATG"), Rule: &PrimerRule{MaxMismatch: 1, NoMismatch3End: 2}},
+		{Name: "q", F: []byte("ACGCA"), R: []byte("GCATG"), Rule: &PrimerRule{MaxMismatch: 1}},
+	}
+	s, _ := seq.NewSeq(seq.DNAredundant, ampliconSeq)
+	products, err := FindPCRProducts(&fastx.Record{ID: []byte("s"), Seq: s}, primers, &AmpliconOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 1 || products[0].Primer != "q" {
+		t.Errorf("rules of primer pairs: only one product of primer pair q expected, returned %d", len(products))
+	}
+
+	// only one primer
+	primers = []Primer{{Name: "p", F: []byte("ACGGA")}}
+	if _, err := FindPCRProducts(&fastx.Record{ID: []byte("s"), Seq: s}, primers, &AmpliconOptions{}); err == nil {
+		t.Errorf("only one primer: error expected")
+	}
+}
+
+func TestFindPrimerDimers(t *testing.T) {
+	primers := []Primer{
+		{Name: "p1", F: []byte("ACGGATCGAT"), R: []byte("TTTTTTTTTT")}, // 3' end of F is self-complementary
+		{Name: "p2", F: []byte("GGGGGGATCG")},
+	}
+
+	dimers := FindPrimerDimers(primers, 4)
+	list := make([]string, len(dimers))
+	for i, d := range dimers {
+		list[i] = fmt.Sprintf("%s:%s-%s:%s:%d:%v", d.Pair1, d.Primer1, d.Pair2, d.Primer2, d.Len, d.Self())
+	}
+	expected := "p1:F-p1:F:6:true,p1:F-p2:F:4:false,p2:F-p1:F:4:false"
+	if result := strings.Join(list, ","); result != expected {
+		t.Errorf("expected %s, returned %s", expected, result)
+	}
+
+	if dimers = FindPrimerDimers(primers, 7); len(dimers) != 0 {
+		t.Errorf("no primer-dimers expected, returned %d", len(dimers))
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Special results of BarcodeMatcher.Match.
+const (
+	BarcodeUnmatched = -1 // no barcode matches
+	BarcodeAmbiguous = -2 // more than one barcode has the fewest mismatches
+)
+
+// BarcodeMatcher assigns reads to samples by barcodes, with mismatches
+// allowed. A barcode could consist of multiple segments joined by '+',
+// e.g., dual indexes like "ACGTACGT+TTGCAGTA".
+type BarcodeMatcher struct {
+	barcodes    [][][]byte // segments of barcodes, in upper case
+	maxMismatch int
+}
+
+// NewBarcodeMatcher checks barcodes and creates a BarcodeMatcher.
+// Barcodes should consist of A, C, G and T, be unique, and have the same
+// number of segments.
+func NewBarcodeMatcher(barcodes []string, maxMismatch int) (*BarcodeMatcher, error) {
+	if len(barcodes) == 0 {
+		return nil, fmt.Errorf("no barcodes given")
+	}
+	m := &BarcodeMatcher{
+		barcodes:    make([][][]byte, len(barcodes)),
+		maxMismatch: maxMismatch,
+	}
+	seen := make(map[string]bool, len(barcodes))
+	for i, barcode := range barcodes {
+		b := bytes.ToUpper([]byte(barcode))
+		if seen[string(b)] {
+			return nil, fmt.Errorf("duplicated barcode: %s", barcode)
+		}
+		seen[string(b)] = true
+
+		m.barcodes[i] = bytes.Split(b, []byte{'+'})
+		if len(m.barcodes[i]) != len(m.barcodes[0]) {
+			return nil, fmt.Errorf("barcodes should have the same number of segments: %s, %s", barcodes[0], barcode)
+		}
+		for _, seg := range m.barcodes[i] {
+			if len(seg) == 0 {
+				return nil, fmt.Errorf("empty segment in barcode: %s", barcode)
+			}
+			for _, c := range seg {
+				switch c {
+				case 'A', 'C', 'G', 'T':
+				default:
+					return nil, fmt.Errorf("invalid base '%c' in barcode: %s", c, barcode)
+				}
+			}
+		}
+	}
+	return m, nil
+}
+
+// Segments returns the number of segments of barcodes.
+func (m *BarcodeMatcher) Segments() int { return len(m.barcodes[0]) }
+
+// Match compares barcodes with the leading bases of query segments,
+// case-insensitively, and returns the index of the barcode with the fewest
+// mismatches, and the number of mismatches. A query segment shorter than
+// the barcode segment does not match, and N is a mismatch.
+// It returns BarcodeUnmatched if no barcode has <= maxMismatch mismatches,
+// or BarcodeAmbiguous if more than one barcode has the fewest mismatches.
+func (m *BarcodeMatcher) Match(query ...[]byte) (int, int) {
+	if len(query) != len(m.barcodes[0]) {
+		return BarcodeUnmatched, 0
+	}
+	best, bestMis := BarcodeUnmatched, m.maxMismatch+1
+	var mis int
+	for i, barcode := range m.barcodes {
+		mis = 0
+		for j, seg := range barcode {
+			q := query[j]
+			if len(q) < len(seg) {
+				mis = bestMis + 1
+				break
+			}
+			for k, c := range seg {
+				if q[k]&^0x20 != c {
+					mis++
+				}
+			}
+			if mis > bestMis {
+				break
+			}
+		}
+		if mis < bestMis {
+			best, bestMis = i, mis
+		} else if mis == bestMis && best != BarcodeUnmatched {
+			best = BarcodeAmbiguous
+		}
+	}
+	if best == BarcodeUnmatched {
+		return best, 0
+	}
+	return best, bestMis
+}
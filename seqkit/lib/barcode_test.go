@@ -0,0 +1,74 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import "testing"
+
+func TestBarcodeMatcher(t *testing.T) {
+	m, err := NewBarcodeMatcher([]string{"ACGTAC", "TTGCAA", "acgtcc"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		idx   int
+		mis   int
+	}{
+		{"ACGTACGGGG", 0, 0},
+		{"ttgcaaTTTT", 1, 0},
+		{"TTGCAT", 1, 1},
+		{"ACGTCCAA", 2, 0},
+		{"ACGTGC", BarcodeAmbiguous, 1}, // 1 mismatch to both ACGTAC and ACGTCC
+		{"GGGGGG", BarcodeUnmatched, 0},
+		{"TTGCA", BarcodeUnmatched, 0}, // too short
+		{"NNGCAA", BarcodeUnmatched, 0},
+	}
+	for _, test := range tests {
+		idx, mis := m.Match([]byte(test.query))
+		if idx != test.idx || mis != test.mis {
+			t.Errorf("%s: expected %d with %d mismatches, returned %d with %d", test.query, test.idx, test.mis, idx, mis)
+		}
+	}
+
+	// dual indexes
+	m, err = NewBarcodeMatcher([]string{"ACGT+GGCC", "ACGT+TTAA"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Segments() != 2 {
+		t.Errorf("expected 2 segments, returned %d", m.Segments())
+	}
+	if idx, mis := m.Match([]byte("ACGA"), []byte("TTAAC")); idx != 1 || mis != 1 {
+		t.Errorf("dual indexes: expected 1 with 1 mismatch, returned %d with %d", idx, mis)
+	}
+	if idx, _ := m.Match([]byte("ACGA"), []byte("TTAT")); idx != BarcodeUnmatched {
+		t.Errorf("dual indexes: expected no match, returned %d", idx)
+	}
+	if idx, _ := m.Match([]byte("ACGT")); idx != BarcodeUnmatched {
+		t.Errorf("dual indexes: expected no match for a single segment, returned %d", idx)
+	}
+
+	for _, barcodes := range [][]string{{}, {"ACGT", "acgt"}, {"ACGT", "AC+GT"}, {"ACNT"}, {"ACGT+"}} {
+		if _, err := NewBarcodeMatcher(barcodes, 1); err == nil {
+			t.Errorf("%v: error expected", barcodes)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/shenwei356/bio/seq"
+	"github.com/twotwotwo/sorts/sortutil"
+)
+
+// DigestVersion is the version of the digest algorithm,
+// digests of different versions are not comparable.
+const DigestVersion = "0.1"
+
+// DigestOptions contains the options of SeqDigest.
+type DigestOptions struct {
+	Circular     bool // the stream contains a single circular genome
+	K            int  // k-mer size for circular genomes
+	SingleStrand bool // only consider the positive strand of a circular genome
+	RemoveGaps   bool
+	GapLetters   string
+	RNA2DNA      bool
+}
+
+// Errors of SeqDigest for circular genomes.
+var (
+	ErrCircularMultiSeqs = errors.New("only one sequence is allowed for circular genome")
+	ErrCircularProtein   = errors.New("circular genomes of protein sequences are not supported")
+)
+
+// KmerSizeError means the k-mer size is bigger than a circular genome.
+type KmerSizeError struct {
+	K      int
+	SeqLen int
+}
+
+func (e *KmerSizeError) Error() string {
+	return fmt.Sprintf("k (%d) is too big for sequence of %d bp", e.K, e.SeqLen)
+}
+
+// DigestResult is the message digest of a stream of records.
+type DigestResult struct {
+	SeqType string // "D" for DNA, "R" for RNA, "P" for protein, "N" for others
+	SeqNum  int
+	SeqLen  int
+	Digest  string
+}
+
+// SeqDigest computes the message digest of all sequences in r.
+// Sequence headers, qualities and the order of records do not matter.
+// Circular genomes are hashed by canonical k-mers, so that different start
+// positions or the reverse complement strand yield the same digest.
+// Sequences of records read from r are modified in place.
+func SeqDigest(r RecordReader, opt *DigestOptions) (*DigestResult, error) {
+	var n int    // number of sequences
+	var lens int // lengths of all seqs
+	var h uint64
+	hashes := make([]uint64, 0, 1024)
+
+	k := opt.K
+
+	var ab *seq.Alphabet
+	var ii int
+	var bb byte
+
+	// add tag to the hash
+	// ref: https://github.com/TimothyStiles/poly/blob/prime/seqhash/seqhash.go
+	var seqType string      // "D" for DNA, "R" for RNA, "P" for protein
+	var seqStructure string // "L" for linear, "C" for circular
+	var strand string       // "D" for double strands, "S" for single strand
+
+	checkAlphabet := true
+
+	if opt.Circular {
+		seqStructure = "C"
+		if opt.SingleStrand {
+			strand = "S"
+		} else {
+			strand = "D"
+		}
+	} else {
+		seqStructure = "L"
+		strand = "S"
+		k = 0
+	}
+
+	var rc *seq.Seq
+	var s, src []byte
+	var h2 uint64
+	var i, j, e, l, end int
+	for {
+		record, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		if opt.Circular && n >= 1 {
+			return nil, ErrCircularMultiSeqs
+		}
+
+		_seq := record.Seq
+
+		if opt.Circular && k > len(_seq.Seq) {
+			return nil, &KmerSizeError{K: k, SeqLen: len(_seq.Seq)}
+		}
+
+		if checkAlphabet {
+			if ar, ok := r.(alphabetReader); ok {
+				ab = ar.Alphabet()
+			} else {
+				ab = _seq.Alphabet
+			}
+			if ab == seq.Protein {
+				seqType = "P"
+				if opt.Circular {
+					return nil, ErrCircularProtein
+				}
+			} else if ab == seq.RNA || ab == seq.RNAredundant {
+				seqType = "R"
+			} else if ab == seq.DNA || ab == seq.DNAredundant {
+				seqType = "D"
+			} else {
+				seqType = "N"
+			}
+
+			checkAlphabet = false
+		}
+
+		if opt.RemoveGaps {
+			_seq.RemoveGapsInplace(opt.GapLetters)
+		}
+
+		_seq.Seq = bytes.ToLower(_seq.Seq)
+
+		if opt.RNA2DNA {
+			if !(ab == seq.RNA || ab == seq.RNAredundant) {
+				for ii, bb = range _seq.Seq {
+					if bb == 'u' {
+						_seq.Seq[ii] = 't'
+					}
+				}
+			}
+		}
+
+		n++
+		lens += len(_seq.Seq)
+
+		if !opt.Circular {
+			hashes = append(hashes, xxhash.Sum64(_seq.Seq))
+			continue
+		}
+
+		if !opt.SingleStrand {
+			rc = _seq.RevCom()
+		}
+
+		l = len(_seq.Seq)
+		end = l - 1
+
+		for i = 0; i <= end; i++ {
+			e = i + k
+
+			if e > l {
+				e = e - l
+				s = _seq.Seq[i:]
+				s = append(s, _seq.Seq[0:e]...)
+
+				if !opt.SingleStrand {
+					j = l - i
+					src = rc.Seq[l-e:]
+					src = append(src, rc.Seq[0:j]...)
+				}
+			} else {
+				s = _seq.Seq[i : i+k]
+
+				if !opt.SingleStrand {
+					j = l - i
+					src = rc.Seq[j-k : j]
+				}
+			}
+
+			h = xxhash.Sum64(s)
+			if opt.SingleStrand {
+				hashes = append(hashes, h)
+			} else {
+				h2 = xxhash.Sum64(src)
+				if h < h2 {
+					hashes = append(hashes, h)
+				} else {
+					hashes = append(hashes, h2)
+				}
+			}
+		}
+	}
+
+	// sequences
+	sortutil.Uint64s(hashes)
+
+	var le = binary.LittleEndian
+	buf := make([]byte, 8)
+	di := xxhash.New()
+
+	for _, h = range hashes {
+		le.PutUint64(buf, h)
+		di.Write(buf)
+	}
+
+	// sequence length
+	le.PutUint64(buf, uint64(lens))
+	di.Write(buf)
+
+	// sequence number
+	le.PutUint64(buf, uint64(n))
+	di.Write(buf)
+
+	// sum up
+	le.PutUint64(buf, di.Sum64())
+	digest := md5.Sum(buf)
+
+	return &DigestResult{
+		SeqType: seqType,
+		SeqNum:  n,
+		SeqLen:  lens,
+		Digest: fmt.Sprintf("seqkit.v%s_%s%s%s_k%d_%s",
+			DigestVersion,
+			seqType,
+			seqStructure,
+			strand,
+			k,
+			hex.EncodeToString(digest[:])),
+	}, nil
+}
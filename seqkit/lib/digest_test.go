@@ -0,0 +1,95 @@
+// Copyright © 2016 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"io"
+	"testing"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+// recordSlice is a RecordReader over a list of sequences.
+type recordSlice struct {
+	seqs []string
+	i    int
+}
+
+func (r *recordSlice) Read() (*fastx.Record, error) {
+	if r.i >= len(r.seqs) {
+		return nil, io.EOF
+	}
+	s, err := seq.NewSeq(seq.DNAredundant, []byte(r.seqs[r.i]))
+	if err != nil {
+		return nil, err
+	}
+	r.i++
+	return &fastx.Record{ID: []byte("s"), Name: []byte("s"), Seq: s}, nil
+}
+
+func (r *recordSlice) Alphabet() *seq.Alphabet { return seq.DNAredundant }
+
+func TestSeqDigest(t *testing.T) {
+	digest := func(opt *DigestOptions, seqs ...string) string {
+		r, err := SeqDigest(&recordSlice{seqs: seqs}, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.Digest
+	}
+
+	linear := &DigestOptions{}
+	if digest(linear, "ACGT", "TTGCA") != digest(linear, "ttgca", "ACGT") {
+		t.Errorf("linear: digest should not depend on the order of sequences or letter case")
+	}
+	if digest(linear, "ACGT") == digest(linear, "ACGA") {
+		t.Errorf("linear: different sequences should have different digests")
+	}
+
+	circular := &DigestOptions{Circular: true, K: 3}
+	d := digest(circular, "ACGTTGCAAC")
+	if d != digest(circular, "TTGCAACACG") {
+		t.Errorf("circular: digest should not depend on the start position")
+	}
+	if d != digest(circular, "GTTGCAACGT") { // reverse complement
+		t.Errorf("circular: digest should not depend on the strand")
+	}
+
+	if _, err := SeqDigest(&recordSlice{seqs: []string{"ACGT", "ACGT"}}, circular); err == nil {
+		t.Errorf("circular: error expected for more than one sequence")
+	}
+	if _, err := SeqDigest(&recordSlice{seqs: []string{"AC"}}, circular); err == nil {
+		t.Errorf("circular: error expected for k > sequence length")
+	}
+}
+
+func TestComputeStats(t *testing.T) {
+	stats, err := ComputeStats(&recordSlice{seqs: []string{"ACGT", "AC-GGC", "A"}},
+		&StatsOptions{All: true, GapLetters: []byte("-")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Format != "FASTA" || stats.Type != "DNA" || stats.Num != 3 || stats.LenSum != 11 ||
+		stats.LenMin != 1 || stats.LenMax != 6 || stats.GapSum != 1 || stats.GC != 54.55 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package lib exposes core operations of seqkit as an importable API:
+// amplicon searching and in-silico PCR, motif locating (with mismatches or
+// edits), scanning with position weight matrices, prebuilt FM-indexes, fish
+// alignment, BED/GTF subsequence extraction, sequence statistics, message
+// digests, expressions for filtering records, read trimming, paired-end read
+// merging, barcode matching, UMI extraction and deduplication, and external
+// sorting.
+//
+// Functions work on fastx.Record values or on streams of them (anything with
+// a Read() (*fastx.Record, error) method, e.g. *fastx.Reader), and report
+// problems by returning errors instead of terminating the process.
+// The commands amplicon, locate, index-fmi, fish, subseq, stats, sum, trim,
+// merge, demux, umi, rmdup (--by-umi, --max-mem), sort (--max-mem) and
+// grep (--max-edits, --fmi-index) are built on this package; they only
+// handle flags, input/output and formatting.
+package lib
+
+import (
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+// RecordReader is a stream of FASTA/Q records, *fastx.Reader satisfies it.
+// Read returns io.EOF when the stream is exhausted.
+type RecordReader interface {
+	Read() (*fastx.Record, error)
+}
+
+// alphabetReader is implemented by readers that know the alphabet of the
+// stream, e.g. *fastx.Reader, which guesses it from the first record.
+type alphabetReader interface {
+	Alphabet() *seq.Alphabet
+}
@@ -0,0 +1,507 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Expr is a compiled expression over named variables, for filtering
+// records with conditions like:
+//
+//	len > 1000 && gc < 0.6 && id =~ "^chr"
+//
+// Values are numbers (float64), strings or booleans. Operators, from the
+// lowest precedence to the highest:
+//
+//	||
+//	&&
+//	== != < <= > >= =~ !~
+//	+ -
+//	* / %
+//	! - (unary)
+//
+// =~ and !~ match a string against a regular expression. String literals
+// are quoted by " or ', where a backslash only escapes the quote itself,
+// so regular expressions like "\d+" need no double escaping.
+// Identifiers consist of letters, digits, '_' and '.', and do not start
+// with a digit; true and false are boolean literals.
+type Expr struct {
+	src  string
+	root exprNode
+	vars []string
+}
+
+// ExprLookup returns the value of a variable, which could be a number of
+// any Go numeric type, a string, []byte or a bool. ok is false if the
+// variable is unknown.
+type ExprLookup func(name string) (value interface{}, ok bool)
+
+// CompileExpr parses an expression.
+func CompileExpr(s string) (*Expr, error) {
+	tokens, err := tokenizeExpr(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens, seen: make(map[string]bool)}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d of expression: %s", t.text, t.pos+1, s)
+	}
+	return &Expr{src: s, root: root, vars: p.vars}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string { return e.src }
+
+// Vars returns names of variables in the expression, in order of first
+// appearance. Callers could check them before evaluation.
+func (e *Expr) Vars() []string { return e.vars }
+
+// Eval evaluates the expression, the result is a float64, string or bool.
+func (e *Expr) Eval(lookup ExprLookup) (interface{}, error) {
+	return e.root.eval(lookup)
+}
+
+// EvalBool evaluates the expression, whose result should be a boolean.
+func (e *Expr) EvalBool(lookup ExprLookup) (bool, error) {
+	v, err := e.root.eval(lookup)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression does not return a boolean value: %s", e.src)
+	}
+	return b, nil
+}
+
+// ---------------------------------------------------------------------
+// tokenizer
+
+const (
+	tokEOF = iota
+	tokNum
+	tokStr
+	tokIdent
+	tokOp
+)
+
+type exprToken struct {
+	kind int
+	text string // operator, identifier or unquoted string
+	num  float64
+	pos  int
+}
+
+// exprOps are operators, two-character ones first.
+var exprOps = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~",
+	"<", ">", "+", "-", "*", "/", "%", "!", "(", ")"}
+
+func isIdentByte(c byte, first bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		!first && (c == '.' || c >= '0' && c <= '9')
+}
+
+func tokenizeExpr(s string) ([]exprToken, error) {
+	var tokens []exprToken
+	i := 0
+LOOP:
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' ||
+				s[j] == 'e' || s[j] == 'E' ||
+				(s[j] == '+' || s[j] == '-') && (s[j-1] == 'e' || s[j-1] == 'E')) {
+				j++
+			}
+			v, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d of expression: %s", s[i:j], i+1, s)
+			}
+			tokens = append(tokens, exprToken{kind: tokNum, text: s[i:j], num: v, pos: i})
+			i = j
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) && s[j+1] == c {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j == len(s) {
+				return nil, fmt.Errorf("unterminated string at position %d of expression: %s", i+1, s)
+			}
+			tokens = append(tokens, exprToken{kind: tokStr, text: b.String(), pos: i})
+			i = j + 1
+		case isIdentByte(c, true):
+			j := i + 1
+			for j < len(s) && isIdentByte(s[j], false) {
+				j++
+			}
+			tokens = append(tokens, exprToken{kind: tokIdent, text: s[i:j], pos: i})
+			i = j
+		default:
+			for _, op := range exprOps {
+				if strings.HasPrefix(s[i:], op) {
+					tokens = append(tokens, exprToken{kind: tokOp, text: op, pos: i})
+					i += len(op)
+					continue LOOP
+				}
+			}
+			return nil, fmt.Errorf("unexpected character %q at position %d of expression: %s", c, i+1, s)
+		}
+	}
+	tokens = append(tokens, exprToken{kind: tokEOF, text: "end of expression", pos: len(s)})
+	return tokens, nil
+}
+
+// ---------------------------------------------------------------------
+// parser
+
+type exprParser struct {
+	tokens []exprToken
+	i      int
+	vars   []string
+	seen   map[string]bool
+}
+
+func (p *exprParser) peek() exprToken { return p.tokens[p.i] }
+
+// accept consumes the next token if it's one of the operators.
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	t := p.tokens[p.i]
+	if t.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.i++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) parseBinary(next func() (exprNode, error), ops ...string) (exprNode, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left, err = newBinaryNode(op, left, right)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseBinary(p.parseCompare, "&&")
+}
+
+func (p *exprParser) parseCompare() (exprNode, error) {
+	return p.parseBinary(p.parseSum, "==", "!=", "<=", ">=", "<", ">", "=~", "!~")
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	return p.parseBinary(p.parseProduct, "+", "-")
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	return p.parseBinary(p.parseUnary, "*", "/", "%")
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if op, ok := p.accept("!", "-"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.tokens[p.i]
+	p.i++
+	switch t.kind {
+	case tokNum:
+		return &literalNode{v: t.num}, nil
+	case tokStr:
+		return &literalNode{v: t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{v: true}, nil
+		case "false":
+			return &literalNode{v: false}, nil
+		}
+		if !p.seen[t.text] {
+			p.seen[t.text] = true
+			p.vars = append(p.vars, t.text)
+		}
+		return &varNode{name: t.text}, nil
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.accept(")"); !ok {
+				t = p.peek()
+				return nil, fmt.Errorf("missing ')' at position %d of expression", t.pos+1)
+			}
+			return x, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d of expression", t.text, t.pos+1)
+}
+
+// ---------------------------------------------------------------------
+// nodes
+
+type exprNode interface {
+	eval(lookup ExprLookup) (interface{}, error)
+}
+
+type literalNode struct {
+	v interface{}
+}
+
+func (n *literalNode) eval(lookup ExprLookup) (interface{}, error) { return n.v, nil }
+
+type varNode struct {
+	name string
+}
+
+func (n *varNode) eval(lookup ExprLookup) (interface{}, error) {
+	v, ok := lookup(n.name)
+	if !ok {
+		return nil, fmt.Errorf("unknown variable: %s", n.name)
+	}
+	switch x := v.(type) {
+	case float64, string, bool:
+		return x, nil
+	case []byte:
+		return string(x), nil
+	case int:
+		return float64(x), nil
+	case int8:
+		return float64(x), nil
+	case int16:
+		return float64(x), nil
+	case int32:
+		return float64(x), nil
+	case int64:
+		return float64(x), nil
+	case uint:
+		return float64(x), nil
+	case uint8:
+		return float64(x), nil
+	case uint16:
+		return float64(x), nil
+	case uint32:
+		return float64(x), nil
+	case uint64:
+		return float64(x), nil
+	case float32:
+		return float64(x), nil
+	}
+	return nil, fmt.Errorf("unsupported value type of variable %s: %T", n.name, v)
+}
+
+type unaryNode struct {
+	op string
+	x  exprNode
+}
+
+func (n *unaryNode) eval(lookup ExprLookup) (interface{}, error) {
+	v, err := n.x.eval(lookup)
+	if err != nil {
+		return nil, err
+	}
+	switch x := v.(type) {
+	case bool:
+		if n.op == "!" {
+			return !x, nil
+		}
+	case float64:
+		if n.op == "-" {
+			return -x, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid operand of %s: %v", n.op, v)
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+	re          *regexp.Regexp // compiled regular expression of a literal
+}
+
+func newBinaryNode(op string, left, right exprNode) (exprNode, error) {
+	n := &binaryNode{op: op, left: left, right: right}
+	if op == "=~" || op == "!~" {
+		if l, ok := right.(*literalNode); ok {
+			s, ok := l.v.(string)
+			if !ok {
+				return nil, fmt.Errorf("the right operand of %s should be a string", op)
+			}
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, err
+			}
+			n.re = re
+		}
+	}
+	return n, nil
+}
+
+func (n *binaryNode) eval(lookup ExprLookup) (interface{}, error) {
+	a, err := n.left.eval(lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	// short-circuit evaluation
+	if n.op == "&&" || n.op == "||" {
+		x, ok := a.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operands of %s should be booleans: %v", n.op, a)
+		}
+		if n.op == "&&" && !x || n.op == "||" && x {
+			return x, nil
+		}
+		b, err := n.right.eval(lookup)
+		if err != nil {
+			return nil, err
+		}
+		y, ok := b.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operands of %s should be booleans: %v", n.op, b)
+		}
+		return y, nil
+	}
+
+	b, err := n.right.eval(lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "=~", "!~":
+		s, ok1 := a.(string)
+		pattern, ok2 := b.(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("operands of %s should be strings: %v, %v", n.op, a, b)
+		}
+		re := n.re
+		if re == nil {
+			if re, err = regexp.Compile(pattern); err != nil {
+				return nil, err
+			}
+		}
+		return re.MatchString(s) == (n.op == "=~"), nil
+	case "==", "!=":
+		switch a.(type) {
+		case float64, string, bool:
+		default:
+			return nil, fmt.Errorf("invalid operand of %s: %v", n.op, a)
+		}
+		if fmt.Sprintf("%T", a) != fmt.Sprintf("%T", b) {
+			return nil, fmt.Errorf("operands of %s should be of the same type: %v, %v", n.op, a, b)
+		}
+		return (a == b) == (n.op == "=="), nil
+	}
+
+	if x, ok := a.(string); ok {
+		y, ok := b.(string)
+		if !ok {
+			return nil, fmt.Errorf("operands of %s should be of the same type: %v, %v", n.op, a, b)
+		}
+		switch n.op {
+		case "<":
+			return x < y, nil
+		case "<=":
+			return x <= y, nil
+		case ">":
+			return x > y, nil
+		case ">=":
+			return x >= y, nil
+		case "+":
+			return x + y, nil
+		}
+		return nil, fmt.Errorf("invalid operands of %s: %v, %v", n.op, a, b)
+	}
+
+	x, ok1 := a.(float64)
+	y, ok2 := b.(float64)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("operands of %s should be numbers: %v, %v", n.op, a, b)
+	}
+	switch n.op {
+	case "<":
+		return x < y, nil
+	case "<=":
+		return x <= y, nil
+	case ">":
+		return x > y, nil
+	case ">=":
+		return x >= y, nil
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		return x / y, nil
+	case "%":
+		return math.Mod(x, y), nil
+	}
+	return nil, fmt.Errorf("unknown operator: %s", n.op)
+}
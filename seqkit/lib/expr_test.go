@@ -0,0 +1,134 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExprEval(t *testing.T) {
+	vars := map[string]interface{}{
+		"len":    1500,
+		"gc":     0.45,
+		"id":     []byte("chr1"),
+		"name":   "chr1 primary assembly",
+		"paired": true,
+		"tag.dp": int64(30),
+	}
+	lookup := func(name string) (interface{}, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		expr string
+		v    interface{}
+	}{
+		{`len > 1000 && gc < 0.6 && id =~ "^chr"`, true},
+		{`len > 1000 && gc > 0.6`, false},
+		{`len + 500 == 2000`, true},
+		{`len - 2 * 250 / 5`, 1400.0},
+		{`(len - 2 * 250) / 5`, 200.0},
+		{`len % 7`, 2.0},
+		{`-gc * 2`, -0.9},
+		{`!(gc < 0.5)`, false},
+		{`id !~ '^scaffold'`, true},
+		{`name =~ "\sprimary\b"`, true},
+		{`id == "chr1" || id == "chr2"`, true},
+		{`id + "_x"`, "chr1_x"},
+		{`id < "chr2"`, true},
+		{`paired == true`, true},
+		{`tag.dp >= 30`, true},
+		{`1e3 < len && .5 > gc`, true},
+		{`'it\'s'`, "it's"},
+		{`false && unknown > 1`, false}, // short-circuit
+	}
+	for _, test := range tests {
+		e, err := CompileExpr(test.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.expr, err)
+			continue
+		}
+		v, err := e.Eval(lookup)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.expr, err)
+			continue
+		}
+		if f, ok := v.(float64); ok {
+			if d := f - test.v.(float64); d > 1e-9 || d < -1e-9 {
+				t.Errorf("%s: expected %v, returned %v", test.expr, test.v, v)
+			}
+			continue
+		}
+		if v != test.v {
+			t.Errorf("%s: expected %v, returned %v", test.expr, test.v, v)
+		}
+	}
+
+	e, err := CompileExpr(`len > 1000 && (gc < 0.6 || len > 1000) && id =~ "^chr"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(e.Vars(), []string{"len", "gc", "id"}) {
+		t.Errorf("unexpected variables: %v", e.Vars())
+	}
+	ok, err := e.EvalBool(lookup)
+	if err != nil || !ok {
+		t.Errorf("EvalBool: expected true, returned %v, %v", ok, err)
+	}
+}
+
+func TestExprError(t *testing.T) {
+	lookup := func(name string) (interface{}, bool) {
+		switch name {
+		case "len":
+			return 100, true
+		case "id":
+			return "chr1", true
+		}
+		return nil, false
+	}
+
+	// compiling errors
+	for _, s := range []string{``, `len >`, `(len > 1`, `len > 1)`, `len @ 1`, `"abc`, `id =~ "("`, `id =~ 1`, `1.2.3 > 1`} {
+		if _, err := CompileExpr(s); err == nil {
+			t.Errorf("%s: compiling error expected", s)
+		}
+	}
+
+	// evaluation errors
+	for _, s := range []string{`len > "a"`, `id > 1`, `len == "100"`, `len && true`, `!len`, `-id`, `x > 1`, `id - "1"`, `len =~ "1"`} {
+		e, err := CompileExpr(s)
+		if err != nil {
+			t.Errorf("%s: unexpected compiling error: %s", s, err)
+			continue
+		}
+		if _, err = e.Eval(lookup); err == nil {
+			t.Errorf("%s: evaluation error expected", s)
+		}
+	}
+
+	e, _ := CompileExpr(`len + 1`)
+	if _, err := e.EvalBool(lookup); err == nil {
+		t.Errorf("EvalBool of a number: error expected")
+	}
+}
@@ -0,0 +1,353 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// ExtSorter sorts items (byte slices) with bounded memory. Added items are
+// buffered and sorted in memory, and spilled to a temporary file as a
+// sorted run when they exceed the memory budget. Runs are merged at last.
+// The sorting is stable, i.e., items comparing equal are returned in the
+// order they are added.
+type ExtSorter struct {
+	less   func(a, b []byte) bool
+	maxMem int
+	tmpDir string
+
+	items [][]byte
+	mem   int
+	runs  []string
+	done  bool
+}
+
+// extSortItemOverhead is the estimated memory of an item besides its data.
+const extSortItemOverhead = 40
+
+// NewExtSorter creates an ExtSorter with a memory budget in bytes,
+// temporary files are created in tmpDir, or the default directory for
+// temporary files if tmpDir is empty.
+func NewExtSorter(tmpDir string, maxMem int, less func(a, b []byte) bool) *ExtSorter {
+	return &ExtSorter{
+		less:   less,
+		maxMem: maxMem,
+		tmpDir: tmpDir,
+		items:  make([][]byte, 0, 1024),
+	}
+}
+
+// Add adds an item, which is copied.
+func (s *ExtSorter) Add(item []byte) error {
+	if s.done {
+		return fmt.Errorf("extsort: adding items after sorting")
+	}
+	s.items = append(s.items, append([]byte(nil), item...))
+	s.mem += len(item) + extSortItemOverhead
+	if s.mem >= s.maxMem {
+		return s.spill()
+	}
+	return nil
+}
+
+// Runs returns the number of sorted runs spilled to temporary files.
+func (s *ExtSorter) Runs() int { return len(s.runs) }
+
+func (s *ExtSorter) sortItems() {
+	sort.SliceStable(s.items, func(i, j int) bool { return s.less(s.items[i], s.items[j]) })
+}
+
+// spill writes buffered items to a temporary file as a sorted run.
+func (s *ExtSorter) spill() error {
+	if len(s.items) == 0 {
+		return nil
+	}
+	s.sortItems()
+
+	var i int
+	run, err := s.writeRun(func() ([]byte, error) {
+		if i >= len(s.items) {
+			return nil, io.EOF
+		}
+		i++
+		return s.items[i-1], nil
+	})
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, run)
+
+	s.items = s.items[:0]
+	s.mem = 0
+	return nil
+}
+
+// writeRun writes items returned by next to a temporary file,
+// until io.EOF is returned.
+func (s *ExtSorter) writeRun(next func() ([]byte, error)) (string, error) {
+	fh, err := os.CreateTemp(s.tmpDir, "seqkit-extsort-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	run := fh.Name()
+	fail := func(err error) (string, error) {
+		fh.Close()
+		os.Remove(run)
+		return "", err
+	}
+
+	w := bufio.NewWriterSize(fh, 1<<16)
+	buf := make([]byte, binary.MaxVarintLen64)
+	var item []byte
+	var n int
+	for {
+		item, err = next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(err)
+		}
+		n = binary.PutUvarint(buf, uint64(len(item)))
+		if _, err = w.Write(buf[:n]); err != nil {
+			return fail(err)
+		}
+		if _, err = w.Write(item); err != nil {
+			return fail(err)
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return fail(err)
+	}
+	if err = fh.Close(); err != nil {
+		os.Remove(run)
+		return "", err
+	}
+	return run, nil
+}
+
+// Sort finishes adding items, and returns an iterator of sorted items.
+func (s *ExtSorter) Sort() (*ExtSortIterator, error) {
+	if s.done {
+		return nil, fmt.Errorf("extsort: sorting twice")
+	}
+	s.done = true
+
+	if len(s.runs) == 0 { // all in memory
+		s.sortItems()
+		it := &ExtSortIterator{items: s.items}
+		s.items = nil
+		return it, nil
+	}
+
+	if err := s.spill(); err != nil {
+		s.removeRuns()
+		return nil, err
+	}
+	s.items = nil
+
+	// merging groups of runs into bigger ones, to limit open files
+	var runs []string
+	var it *ExtSortIterator
+	var err error
+	for len(s.runs) > extSortMaxRuns {
+		runs = make([]string, 0, (len(s.runs)+extSortMaxRuns-1)/extSortMaxRuns)
+		for i := 0; i < len(s.runs); i += extSortMaxRuns {
+			j := i + extSortMaxRuns
+			if j > len(s.runs) {
+				j = len(s.runs)
+			}
+			if it, err = s.merge(s.runs[i:j]); err == nil {
+				var run string
+				run, err = s.writeRun(it.Next)
+				if err2 := it.Close(); err == nil {
+					err = err2
+				}
+				if err == nil {
+					runs = append(runs, run)
+				}
+			}
+			if err != nil {
+				s.runs = append(runs, s.runs[j:]...)
+				s.removeRuns()
+				return nil, err
+			}
+		}
+		s.runs = runs
+	}
+
+	return s.merge(s.runs)
+}
+
+// extSortMaxRuns is the maximum number of runs merged at the same time.
+const extSortMaxRuns = 256
+
+// merge creates an iterator merging the runs, which are removed when
+// the iterator is closed.
+func (s *ExtSorter) merge(runs []string) (*ExtSortIterator, error) {
+	it := &ExtSortIterator{files: runs}
+	it.h = &extSortHeap{less: s.less}
+	for i, file := range runs {
+		fh, err := os.Open(file)
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+		r := &extSortRun{idx: i, fh: fh, r: bufio.NewReaderSize(fh, 1<<16)}
+		it.readers = append(it.readers, r)
+		ok, err := r.next()
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+		if ok {
+			it.h.runs = append(it.h.runs, r)
+		}
+	}
+	heap.Init(it.h)
+	return it, nil
+}
+
+func (s *ExtSorter) removeRuns() {
+	for _, file := range s.runs {
+		os.Remove(file)
+	}
+}
+
+// ExtSortIterator returns sorted items of an ExtSorter.
+type ExtSortIterator struct {
+	// in memory
+	items [][]byte
+	i     int
+
+	// merging runs
+	files   []string
+	readers []*extSortRun
+	h       *extSortHeap
+	last    *extSortRun // run of the last returned item
+}
+
+// Next returns the next item, or io.EOF if there's no more items.
+// The returned slice is only valid until the next call.
+func (it *ExtSortIterator) Next() ([]byte, error) {
+	if it.h == nil {
+		if it.i >= len(it.items) {
+			return nil, io.EOF
+		}
+		it.i++
+		return it.items[it.i-1], nil
+	}
+
+	if it.last != nil { // advance the run of the last item
+		ok, err := it.last.next()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			heap.Fix(it.h, 0)
+		} else {
+			heap.Pop(it.h)
+		}
+		it.last = nil
+	}
+	if it.h.Len() == 0 {
+		return nil, io.EOF
+	}
+	it.last = it.h.runs[0]
+	return it.last.item, nil
+}
+
+// Close closes and removes temporary files.
+func (it *ExtSortIterator) Close() error {
+	var err, err2 error
+	for _, r := range it.readers {
+		if err2 = r.fh.Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	for _, file := range it.files {
+		if err2 = os.Remove(file); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	it.readers, it.files = nil, nil
+	it.items = nil
+	return err
+}
+
+// extSortRun reads items of a sorted run.
+type extSortRun struct {
+	idx  int
+	fh   *os.File
+	r    *bufio.Reader
+	item []byte
+}
+
+func (r *extSortRun) next() (bool, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if cap(r.item) < int(n) {
+		r.item = make([]byte, n)
+	}
+	r.item = r.item[:n]
+	if _, err = io.ReadFull(r.r, r.item); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// extSortHeap is a min-heap of runs by their current items, ties are
+// broken by the order of runs to keep the sorting stable.
+type extSortHeap struct {
+	runs []*extSortRun
+	less func(a, b []byte) bool
+}
+
+func (h extSortHeap) Len() int { return len(h.runs) }
+func (h extSortHeap) Less(i, j int) bool {
+	a, b := h.runs[i], h.runs[j]
+	if h.less(a.item, b.item) {
+		return true
+	}
+	if h.less(b.item, a.item) {
+		return false
+	}
+	return a.idx < b.idx
+}
+func (h extSortHeap) Swap(i, j int)       { h.runs[i], h.runs[j] = h.runs[j], h.runs[i] }
+func (h *extSortHeap) Push(x interface{}) { h.runs = append(h.runs, x.(*extSortRun)) }
+func (h *extSortHeap) Pop() interface{} {
+	n := len(h.runs)
+	r := h.runs[n-1]
+	h.runs = h.runs[:n-1]
+	return r
+}
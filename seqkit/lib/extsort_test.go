@@ -0,0 +1,103 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestExtSorter(t *testing.T) {
+	// items: a 1-byte key followed by an 8-byte serial number,
+	// only keys are compared, so the stability could be checked.
+	less := func(a, b []byte) bool { return a[0] < b[0] }
+
+	r := rand.New(rand.NewSource(1))
+	items := make([][]byte, 2000)
+	for i := range items {
+		items[i] = make([]byte, 9)
+		items[i][0] = byte(r.Intn(50))
+		binary.BigEndian.PutUint64(items[i][1:], uint64(i))
+	}
+	expected := make([][]byte, len(items))
+	copy(expected, items)
+	sort.SliceStable(expected, func(i, j int) bool { return less(expected[i], expected[j]) })
+
+	tmpDir := t.TempDir()
+	for _, maxMem := range []int{1 << 30, 1000, 1} {
+		s := NewExtSorter(tmpDir, maxMem, less)
+		for _, item := range items {
+			if err := s.Add(item); err != nil {
+				t.Fatal(err)
+			}
+		}
+		it, err := s.Sort()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if maxMem == 1<<30 && s.Runs() != 0 {
+			t.Errorf("max memory %d: expected no runs, returned %d", maxMem, s.Runs())
+		} else if maxMem < 1<<30 && s.Runs() == 0 {
+			t.Errorf("max memory %d: expected spilled runs", maxMem)
+		}
+
+		sorted := make([][]byte, 0, len(items))
+		for {
+			item, err := it.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			sorted = append(sorted, append([]byte(nil), item...))
+		}
+		if err = it.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(sorted, expected) {
+			t.Errorf("max memory %d: unexpected result", maxMem)
+		}
+
+		files, _ := os.ReadDir(tmpDir)
+		if len(files) > 0 {
+			t.Errorf("max memory %d: temporary files not removed: %d", maxMem, len(files))
+		}
+
+		if err = s.Add(items[0]); err == nil {
+			t.Errorf("max memory %d: error expected when adding items after sorting", maxMem)
+		}
+	}
+
+	// empty
+	it, err := NewExtSorter(tmpDir, 1, less).Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = it.Next(); err != io.EOF {
+		t.Errorf("empty sorter: expected io.EOF, returned %v", err)
+	}
+}
@@ -1,4 +1,4 @@
-// Copyright © 2019 Oxford Nanopore Technologies.
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
 //
 // Permission is hereby granted, free of charge, to any person obtaining a copy
 // of this software and associated documentation files (the "Software"), to deal
@@ -18,7 +18,7 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-package cmd
+package lib
 
 import (
 	"fmt"
@@ -32,9 +32,90 @@ import (
 	"github.com/biogo/biogo/alphabet"
 	"github.com/biogo/biogo/feat"
 	"github.com/biogo/biogo/seq/linear"
-	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/sam"
 )
 
+// AlnParams holds the alignment parameters.
+type AlnParams struct {
+	Match     int
+	Mismatch  int
+	GapOpen   int
+	GapExtend int
+}
+
+// ParseAlnParams parses alignment parameter string
+// in format "<match>,<mismatch>,<gap_open>,<gap_extend>".
+func ParseAlnParams(s string) (*AlnParams, error) {
+	p := new(AlnParams)
+	sp := strings.Split(s, ",")
+	if len(sp) != 4 {
+		return nil, fmt.Errorf("invalid alignment parameters: %s", s)
+	}
+	for i, tok := range sp {
+		sp[i] = strings.TrimSpace(tok)
+	}
+	var err error
+	if p.Match, err = strconv.Atoi(sp[0]); err != nil {
+		return nil, fmt.Errorf("invalid alignment parameters: %s", s)
+	}
+	if p.Mismatch, err = strconv.Atoi(sp[1]); err != nil {
+		return nil, fmt.Errorf("invalid alignment parameters: %s", s)
+	}
+	if p.GapOpen, err = strconv.Atoi(sp[2]); err != nil {
+		return nil, fmt.Errorf("invalid alignment parameters: %s", s)
+	}
+	if p.GapExtend, err = strconv.Atoi(sp[3]); err != nil {
+		return nil, fmt.Errorf("invalid alignment parameters: %s", s)
+	}
+	return p, nil
+}
+
+// ParseRanges parses ranges string like ":10,30:40,-20:" into a slice of ranges.
+func ParseRanges(rf string) (Ranges, error) {
+	res := Ranges{}
+	if len(rf) == 0 {
+		return Ranges{Range{math.NaN(), math.NaN()}}, nil
+	}
+	rst := strings.Split(strings.TrimSpace(rf), ",")
+	for _, t := range rst {
+		t = strings.TrimSpace(t)
+		if len(t) == 0 {
+			continue
+		}
+		rt := strings.Split(t, ":")
+		if len(rt) != 2 {
+			return nil, fmt.Errorf("invalid range: %s", t)
+		}
+		var err error
+		var ts, te string
+		var s, e float64
+		ts = strings.TrimSpace(rt[0])
+		te = strings.TrimSpace(rt[1])
+		if len(ts) == 0 {
+			s = math.NaN()
+		} else {
+			s, err = strconv.ParseFloat(ts, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid range: %s", t)
+			}
+		}
+		if len(te) == 0 {
+			e = math.NaN()
+		} else {
+			e, err = strconv.ParseFloat(te, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid range: %s", t)
+			}
+		}
+		if e > 0 && s > 0 && e < s {
+			return nil, fmt.Errorf("invalid range: %s", t)
+		}
+		res = append(res, Range{s, e})
+	}
+	return res, nil
+}
+
 // Query holds information about a query sequence.
 type Query struct {
 	Name      string
@@ -49,7 +130,7 @@ type Range struct {
 	End   float64
 }
 
-// Range returns the length of a range.
+// Len returns the length of a range.
 func (r Range) Len() float64 {
 	return r.End - r.Start
 }
@@ -83,16 +164,21 @@ func NewSeqDetector(searchAll bool, stranded bool, nullMode string, cutoff float
 }
 
 // Detect performs an optinally recursive alignments of the queries of a given reference sequence.
-func (d *SeqDetector) Detect(r *Reference, rec bool) []*AlignedSeq {
-	var h []*AlignedSeq
+func (d *SeqDetector) Detect(r *Reference, rec bool) ([]*AlignedSeq, error) {
+	var h, hits []*AlignedSeq
+	var err error
 	for _, rr := range r.Ranges {
 		if rec {
-			h = append(h, d.detectRec(r, rr)...)
+			hits, err = d.detectRec(r, rr)
 		} else {
-			h = append(h, d.detectOnce(r, rr)...)
+			hits, err = d.detectOnce(r, rr)
 		}
+		if err != nil {
+			return nil, err
+		}
+		h = append(h, hits...)
 	}
-	return h
+	return h, nil
 }
 
 // actualRange applies a range to a sequence with a given length.
@@ -125,32 +211,38 @@ func actualRange(rr Range, l int) Range {
 }
 
 // detectOnce aligns queries to the reference sequence at specified ranges.
-func (d *SeqDetector) detectOnce(r *Reference, rr Range) []*AlignedSeq {
+func (d *SeqDetector) detectOnce(r *Reference, rr Range) ([]*AlignedSeq, error) {
 	var hits []*AlignedSeq
 	if rr.Len() == 0 {
-		return hits
+		return hits, nil
 	}
 	for _, q := range d.Queries {
 		nr := &Reference{r.Name, r.Seq, Ranges{actualRange(rr, len(r.Seq))}}
-		h := PairwiseAlignSW(nr, q, d.AlnParams)
+		h, err := PairwiseAlignSW(nr, q, d.AlnParams)
+		if err != nil {
+			return nil, err
+		}
 		h.Detector = d
 		if (h.Score / q.NullScore) > d.Cutoff {
 			hits = append(hits, h)
 		}
 	}
-	return bestHits(hits, -1)
+	return bestHits(hits, -1), nil
 }
 
 // detectRec aligns queries to the reference sequence ranges in a recursive fashion in order
 // to return all matches above the threshold.
-func (d *SeqDetector) detectRec(r *Reference, rr Range) []*AlignedSeq {
+func (d *SeqDetector) detectRec(r *Reference, rr Range) ([]*AlignedSeq, error) {
 	var hits []*AlignedSeq
 	if rr.Len() == 0 {
-		return hits
+		return hits, nil
 	}
 	for _, q := range d.Queries {
 		nr := &Reference{r.Name, r.Seq, Ranges{actualRange(rr, len(r.Seq))}}
-		h := PairwiseAlignSW(nr, q, d.AlnParams)
+		h, err := PairwiseAlignSW(nr, q, d.AlnParams)
+		if err != nil {
+			return nil, err
+		}
 		h.Detector = d
 		if (h.Score / q.NullScore) > d.Cutoff {
 			hits = append(hits, h)
@@ -158,11 +250,19 @@ func (d *SeqDetector) detectRec(r *Reference, rr Range) []*AlignedSeq {
 	}
 	if len(hits) > 0 {
 		bh := bestHits(hits, 1)
-		bh = append(bh, d.detectRec(r, Range{rr.Start, float64(bh[0].RefStart)})...)
-		bh = append(bh, d.detectRec(r, Range{float64(bh[0].RefEnd), rr.End})...)
+		left, err := d.detectRec(r, Range{rr.Start, float64(bh[0].RefStart)})
+		if err != nil {
+			return nil, err
+		}
+		right, err := d.detectRec(r, Range{float64(bh[0].RefEnd), rr.End})
+		if err != nil {
+			return nil, err
+		}
+		bh = append(bh, left...)
+		bh = append(bh, right...)
 		hits = bh
 	}
-	return bestHits(hits, -1)
+	return bestHits(hits, -1), nil
 }
 
 // byScore is a utility type for sorting []*AlignedSeq.
@@ -190,59 +290,62 @@ func bestHits(h []*AlignedSeq, n int) []*AlignedSeq {
 	return res[:i]
 }
 
-// LoadQueries loads queries from a fasta file and calculates null scores for each.
-func (d *SeqDetector) LoadQueries(fx string) {
-	var record *fastx.Record
-	var fastxReader *fastx.Reader
-	var err error
+// LoadQueries loads queries from a stream of records and calculates null scores for each.
+func (d *SeqDetector) LoadQueries(r RecordReader) error {
 	if len(d.Queries) == 0 {
 		d.Queries = make(Queries, 0, 10)
 	}
 
-	fastxReader, err = fastx.NewReader(nil, fx, "")
-	checkError(err)
-
 	for {
-		record, err = fastxReader.Read()
+		record, err := r.Read()
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			checkError(err)
-			break
+			return err
 		}
 
 		seq := string(record.Seq.Seq)
 		name := strings.Split(string(record.Name), " ")[0]
-		ns := d.nullScore(seq)
+		ns, err := d.nullScore(seq)
+		if err != nil {
+			return err
+		}
 		d.Queries = append(d.Queries, &Query{name, seq, "+", ns})
 		if !d.Stranded {
 			d.Queries = append(d.Queries, &Query{name, RevCompDNA(seq), "-", ns})
 		}
-
 	}
+	return nil
 }
 
-// AddAnonQueries adds anonymous queries from a list of comma separated strings.
-func (d *SeqDetector) AddAnonQueries(qrs []string) {
+// AddAnonQueries adds anonymous queries from a list of sequences.
+func (d *SeqDetector) AddAnonQueries(qrs []string) error {
 	for i, q := range qrs {
 		name := fmt.Sprintf("q%d", i)
-		ns := d.nullScore(q)
+		ns, err := d.nullScore(q)
+		if err != nil {
+			return err
+		}
 		d.Queries = append(d.Queries, &Query{name, q, "+", ns})
 		if !d.Stranded {
 			d.Queries = append(d.Queries, &Query{name, RevCompDNA(q), "-", ns})
 		}
 	}
-
+	return nil
 }
 
 // nullScore calculates null score for a given query. Currently uses self-alignment.
-func (d *SeqDetector) nullScore(q string) float64 {
+func (d *SeqDetector) nullScore(q string) (float64, error) {
 	switch d.NullMode {
 	case "self":
-		return PairwiseAlignSW(&Reference{Name: "Ref", Seq: q, Ranges: Ranges{Range{0, float64(len(q))}}}, &Query{Name: "Query", Seq: q}, d.AlnParams).Score
+		h, err := PairwiseAlignSW(&Reference{Name: "Ref", Seq: q, Ranges: Ranges{Range{0, float64(len(q))}}}, &Query{Name: "Query", Seq: q}, d.AlnParams)
+		if err != nil {
+			return math.NaN(), err
+		}
+		return h.Score, nil
 	}
-	return math.NaN()
+	return math.NaN(), nil
 }
 
 // Scorer is an interface for getting alignment score.
@@ -256,7 +359,7 @@ func NewAnonLinearSeq(s string) *linear.Seq {
 }
 
 // PairwiseAlignSW performs pairwise local alignment of two sequences using the biogo implementation of the Smith-Waterman algorithm.
-func PairwiseAlignSW(r *Reference, q *Query, alnParams *AlnParams) *AlignedSeq {
+func PairwiseAlignSW(r *Reference, q *Query, alnParams *AlnParams) (*AlignedSeq, error) {
 	ref := NewAnonLinearSeq(r.Seq[int(r.Ranges[0].Start):int(r.Ranges[0].End)])
 	ref.Alpha = alphabet.DNAgapped
 	query := NewAnonLinearSeq(q.Seq)
@@ -279,16 +382,14 @@ func PairwiseAlignSW(r *Reference, q *Query, alnParams *AlnParams) *AlignedSeq {
 	}
 
 	aln, err := smith.Align(ref, query)
-	var res *AlignedSeq
-	if err == nil {
-		fa := align.Format(ref, query, aln, '-')
-		res = AlignInfo(r, q, aln)
-		res.RefAln = fmt.Sprintf("%s", fa[0])
-		res.QueryAln = fmt.Sprintf("%s", fa[1])
-	} else {
-		panic(fmt.Sprintf("Could not align sequences: %s", err))
-	}
-	return res
+	if err != nil {
+		return nil, fmt.Errorf("could not align sequences: %s", err)
+	}
+	fa := align.Format(ref, query, aln, '-')
+	res := AlignInfo(r, q, aln)
+	res.RefAln = fmt.Sprintf("%s", fa[0])
+	res.QueryAln = fmt.Sprintf("%s", fa[1])
+	return res, nil
 }
 
 // AlignedSeq holds alignment results.
@@ -382,33 +483,201 @@ func (a *AlignedSeq) String() string {
 	return strings.Join(tmp, "\t")
 }
 
+// AlnString returns the alignment of the reference and query in two lines.
 func (a *AlignedSeq) AlnString() string {
 	return fmt.Sprintf("@\t%s\t+\t%d\t%d\t%s\n@\t%s\t%s\t%d\t%d\t%s", a.RefAln, a.RefStart, a.RefEnd, a.Ref.Name, a.QueryAln, a.Query.Strand, a.QueryStart, a.QueryEnd, a.Query.Name)
 }
 
 // AlignInfo constructs an *AlignedSeq structure based on raw alignment results.
 func AlignInfo(r *Reference, q *Query, f []feat.Pair) *AlignedSeq {
-	ref_starts := make([]int, 0)
-	ref_ends := make([]int, 0)
-	query_starts := make([]int, 0)
-	query_ends := make([]int, 0)
+	refStarts := make([]int, 0)
+	refEnds := make([]int, 0)
+	queryStarts := make([]int, 0)
+	queryEnds := make([]int, 0)
 	scores := make([]int, 0)
 
 	for _, fs := range f {
 		fc := fs.Features()
 		fsScorer, _ := fs.(Scorer)
 		scores = append(scores, fsScorer.Score())
-		ref_starts = append(ref_starts, fc[0].Start())
-		ref_ends = append(ref_ends, fc[0].End())
-		query_starts = append(query_starts, fc[1].Start())
-		query_ends = append(query_ends, fc[1].End())
+		refStarts = append(refStarts, fc[0].Start())
+		refEnds = append(refEnds, fc[0].End())
+		queryStarts = append(queryStarts, fc[1].Start())
+		queryEnds = append(queryEnds, fc[1].End())
 
 	}
 	res := &AlignedSeq{Ref: r, Query: q}
-	res.RefStart = MinInts(ref_starts) + int(r.Ranges[0].Start)
-	res.RefEnd = MaxInts(ref_ends) + int(r.Ranges[0].Start)
-	res.QueryStart = MinInts(query_starts)
-	res.QueryEnd = MaxInts(query_ends)
-	res.Score = float64(SumInts(scores))
+	res.RefStart = minInts(refStarts) + int(r.Ranges[0].Start)
+	res.RefEnd = maxInts(refEnds) + int(r.Ranges[0].Start)
+	res.QueryStart = minInts(queryStarts)
+	res.QueryEnd = maxInts(queryEnds)
+	res.Score = float64(sumInts(scores))
 	return res
 }
+
+// WriteBam writes alignments to a BAM stream, refMap maps
+// reference names to their indexes in refs.
+func WriteBam(w io.Writer, refs []*sam.Reference, refMap map[string]int, alns []*AlignedSeq) error {
+	h, err := sam.NewHeader([]byte{}, refs)
+	if err != nil {
+		return err
+	}
+	fish := sam.NewProgram("seqkit", "seqkit", "seqkit fish", "-", "1.0")
+	h.AddProgram(fish)
+	bamWriter, err := bam.NewWriter(w, h, 50)
+	if err != nil {
+		return err
+	}
+	for _, a := range alns {
+		mq := -10 * math.Log10(1.0-(a.Score/a.Query.NullScore))
+		if math.IsNaN(mq) || mq > 60 {
+			mq = 60
+		}
+		pg, err := sam.NewAux(sam.NewTag("PG"), 0)
+		if err != nil {
+			return err
+		}
+		record, err := NewSAMRecordFromAln(a.Query.Name, refs[refMap[a.Ref.Name]], a.RefStart, a.RefEnd, a.QueryStart, a.QueryEnd, a.RefAln, a.QueryAln, a.Query.Strand, byte(uint8(mq)), a.Query.Seq, nil, []sam.Aux{pg})
+		if err != nil {
+			return err
+		}
+		if !sam.IsValidRecord(record) {
+			return fmt.Errorf("failed to build BAM record from raw alignment: \n%s\n%s", a, record)
+		}
+		if !a.Best {
+			record.Flags |= sam.Secondary
+		}
+
+		if err = bamWriter.Write(record); err != nil {
+			return err
+		}
+	}
+	return bamWriter.Close()
+}
+
+// NewSAMRecordFromAln builds a new SAM record based on the provided local alignment and its reference/query coordinates.
+func NewSAMRecordFromAln(name string, ref *sam.Reference, refStart, refEnd, queryStart, queryEnd int, refAln, queryAln string, strand string, mapQ byte, seq string, qual []byte, aux []sam.Aux) (*sam.Record, error) {
+	if len(refAln) != len(queryAln) {
+		return nil, fmt.Errorf("alignment length mismatch")
+	}
+	if len(refAln) == 0 {
+		return nil, fmt.Errorf("empty alignment")
+	}
+	if strand != "+" && strand != "-" {
+		return nil, fmt.Errorf("invalid strand: %s", strand)
+	}
+	gap := byte('-')
+
+	rawCo := make([]sam.CigarOp, 0, len(seq))
+	co := make([]sam.CigarOp, 0, len(seq))
+	var consumed int
+	var nm int
+
+	// Building the CIGAR in two steps for clarity.
+	if queryStart > 0 {
+		rawCo = append(rawCo, sam.NewCigarOp(sam.CigarSoftClipped, queryStart))
+	}
+	for i := range refAln {
+		if queryAln[i] == gap {
+			rawCo = append(rawCo, sam.NewCigarOp(sam.CigarDeletion, 1))
+			nm++
+		} else if refAln[i] == gap {
+			rawCo = append(rawCo, sam.NewCigarOp(sam.CigarInsertion, 1))
+			consumed++
+			nm++
+		} else {
+			rawCo = append(rawCo, sam.NewCigarOp(sam.CigarMatch, 1))
+			consumed++
+			if queryAln[i] != refAln[i] {
+				nm++
+			}
+		}
+	} // refAln
+
+	leftover := len(seq) - queryStart - consumed
+	if leftover > 0 {
+		rawCo = append(rawCo, sam.NewCigarOp(sam.CigarSoftClipped, leftover))
+	}
+
+	cop := rawCo[0].Type()
+	length := rawCo[0].Len()
+	var o sam.CigarOp
+	for i := 1; i < len(rawCo); i++ {
+		o = rawCo[i]
+		if o.Type() == cop {
+			length++
+			continue
+		}
+		co = append(co, sam.NewCigarOp(cop, length))
+		length = o.Len()
+		cop = o.Type()
+	}
+	co = append(co, sam.NewCigarOp(o.Type(), length))
+
+	nmTag, _ := sam.NewAux(sam.NewTag("NM"), nm)
+	aux = append(aux, nmTag)
+	res, err := sam.NewRecord(name, ref, nil, refStart, -1, 0, mapQ, co, []byte(seq), qual, aux)
+	if err != nil {
+		return nil, err
+	}
+	if strand == "-" {
+		res.Flags |= sam.Reverse
+	}
+	return res, nil
+}
+
+// RevCompDNA reverse complements a DNA sequence string,
+// bases other than ACGTN are converted to N.
+func RevCompDNA(s string) string {
+	size := len(s)
+	s = strings.ToUpper(s)
+	tmp := make([]byte, size)
+	var inBase byte
+	var outBase byte
+	for i := 0; i < size; i++ {
+		inBase = s[i]
+		switch inBase {
+		case 'A':
+			outBase = 'T'
+		case 'T':
+			outBase = 'A'
+		case 'G':
+			outBase = 'C'
+		case 'C':
+			outBase = 'G'
+		default:
+			outBase = 'N'
+		}
+		tmp[size-1-i] = outBase
+	}
+	return string(tmp)
+}
+
+// minInts calculates the minimum of a slice of integers.
+func minInts(s []int) (m int) {
+	m = s[0]
+	for _, e := range s {
+		if e < m {
+			m = e
+		}
+	}
+	return
+}
+
+// maxInts calculates the maximum of a slice of integers.
+func maxInts(s []int) (m int) {
+	for _, e := range s {
+		if e > m {
+			m = e
+		}
+	}
+	return
+}
+
+// sumInts calculates the sum of a slice of integers.
+func sumInts(s []int) (r int) {
+	for _, e := range s {
+		r += e
+	}
+	return
+}
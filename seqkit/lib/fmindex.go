@@ -0,0 +1,344 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/bwt"
+	"github.com/shenwei356/bwt/fmi"
+)
+
+// FMIndexOptions decides how a sequence is indexed by NewSeqFMIndex,
+// searching with the index should use the same options.
+type FMIndexOptions struct {
+	IgnoreCase         bool // index the sequence in lower case
+	Circular           bool // index two copies of the sequence
+	OnlyPositiveStrand bool // do not index the reverse complement sequence
+}
+
+// SeqFMIndex is a prebuilt FM-index of a sequence. Building the suffix array
+// is the time-consuming part of an FM-index, so only suffix arrays are saved,
+// and the rest of the index is recovered from the sequence when searching.
+type SeqFMIndex struct {
+	ID   []byte
+	Len  int    // length of the sequence
+	Hash uint64 // hash value of the sequence, for checking the sequence given in searching
+
+	opt  FMIndexOptions
+	sa   []int // suffix array of the positive strand
+	rcsa []int // suffix array of the negative strand
+}
+
+// fmIndexTexts returns the sequences to be indexed.
+func fmIndexTexts(s *seq.Seq, opt *FMIndexOptions) ([]byte, []byte) {
+	text := s.Seq
+	if opt.IgnoreCase {
+		text = bytes.ToLower(text)
+	}
+	if opt.Circular {
+		l := len(text)
+		text = append(text[:l:l], text...)
+	}
+	if opt.OnlyPositiveStrand {
+		return text, nil
+	}
+	return text, (&seq.Seq{Alphabet: s.Alphabet, Seq: text}).RevCom().Seq
+}
+
+// NewSeqFMIndex builds the FM-index of a record.
+func NewSeqFMIndex(record *fastx.Record, opt *FMIndexOptions) (*SeqFMIndex, error) {
+	if len(record.Seq.Seq) == 0 {
+		return nil, fmt.Errorf("empty sequence: %s", record.ID)
+	}
+	idx := &SeqFMIndex{
+		ID:   append([]byte(nil), record.ID...),
+		Len:  len(record.Seq.Seq),
+		Hash: xxhash.Sum64(record.Seq.Seq),
+		opt:  *opt,
+	}
+	text, rc := fmIndexTexts(record.Seq, opt)
+	if len(text) >= 1<<32-1 {
+		return nil, fmt.Errorf("sequence too long to index: %s", record.ID)
+	}
+	idx.sa = bwt.SuffixArray(text)
+	if rc != nil {
+		idx.rcsa = bwt.SuffixArray(rc)
+	}
+	return idx, nil
+}
+
+// Options returns the options used in building the index.
+func (idx *SeqFMIndex) Options() FMIndexOptions { return idx.opt }
+
+// FMIndexes checks the record and returns the FM-indexes of the positive
+// and negative strands, the latter is nil if negativeStrand is false or
+// only the positive strand is indexed. The record should be the one
+// the index was built from.
+func (idx *SeqFMIndex) FMIndexes(record *fastx.Record, negativeStrand bool) (*fmi.FMIndex, *fmi.FMIndex, error) {
+	if !bytes.Equal(record.ID, idx.ID) || len(record.Seq.Seq) != idx.Len ||
+		xxhash.Sum64(record.Seq.Seq) != idx.Hash {
+		return nil, nil, fmt.Errorf("sequence '%s' does not match the FM-index of '%s'", record.ID, idx.ID)
+	}
+	text, rc := fmIndexTexts(record.Seq, &idx.opt)
+	fwd, err := fmIndexFromSuffixArray(text, idx.sa)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rc == nil || !negativeStrand {
+		return fwd, nil, nil
+	}
+	rev, err := fmIndexFromSuffixArray(rc, idx.rcsa)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fwd, rev, nil
+}
+
+// fmIndexFromSuffixArray recovers an FM-index from the sequence and its
+// suffix array, it's the same as the one returned by fmi.FMIndex.Transform.
+func fmIndexFromSuffixArray(s []byte, sa []int) (*fmi.FMIndex, error) {
+	index := fmi.NewFMIndex()
+	var err error
+	index.SuffixArray = sa
+	index.BWT, err = bwt.FromSuffixArray(s, sa, index.EndSymbol)
+	if err != nil {
+		return nil, err
+	}
+
+	F := make([]byte, len(s)+1)
+	F[0] = index.EndSymbol
+	for i := 1; i <= len(s); i++ {
+		F[i] = s[sa[i]]
+	}
+	index.F = F
+
+	count := make([]int, 128)
+	for _, b := range index.BWT {
+		if b >= 128 {
+			return nil, fmt.Errorf("invalid byte in sequence: %c", b)
+		}
+		count[b]++
+	}
+	count[index.EndSymbol] = 0
+	index.CountOfLetters = count
+
+	alphabet := make([]byte, 0, 128)
+	for b, c := range count {
+		if c > 0 {
+			alphabet = append(alphabet, byte(b))
+		}
+	}
+	index.Alphabet = alphabet
+
+	C := make([]int, 128)
+	for i, c := range F {
+		if C[c] == 0 {
+			C[c] = i
+		}
+	}
+	index.C = C
+
+	// Occ(c, k) is the number of occurrences of c in BWT[0..k]
+	occ := make([]*[]int32, 128)
+	for _, c := range alphabet {
+		t := make([]int32, len(index.BWT))
+		occ[c] = &t
+	}
+	counts := make([]int32, 128)
+	for i, b := range index.BWT {
+		counts[b]++
+		for _, c := range alphabet {
+			(*occ[c])[i] = counts[c]
+		}
+	}
+	index.Occ = occ
+
+	return index, nil
+}
+
+// fmIndexMagic is the first bytes of an FM-index file.
+var fmIndexMagic = []byte("SEQKITFMI\x01")
+
+// FMIndexWriter saves FM-indexes of sequences to a file, in which
+// the options are followed by indexes of sequences:
+//
+//	ID length, ID, sequence length, hash value, suffix array(s)
+//
+// Numbers are unsigned varints except hash values (uint64) and suffix arrays
+// (uint32, the leading item, i.e., the length of the indexed sequence,
+// is omitted), all in little endian.
+type FMIndexWriter struct {
+	w   *bufio.Writer
+	opt FMIndexOptions
+	buf []byte
+}
+
+// NewFMIndexWriter creates an FMIndexWriter, all indexes to be written
+// should be built with the same options.
+func NewFMIndexWriter(w io.Writer, opt *FMIndexOptions) (*FMIndexWriter, error) {
+	writer := &FMIndexWriter{
+		w:   bufio.NewWriterSize(w, 1<<20),
+		opt: *opt,
+		buf: make([]byte, binary.MaxVarintLen64),
+	}
+	var flags byte
+	if opt.IgnoreCase {
+		flags |= 1
+	}
+	if opt.Circular {
+		flags |= 2
+	}
+	if opt.OnlyPositiveStrand {
+		flags |= 4
+	}
+	writer.w.Write(fmIndexMagic)
+	if err := writer.w.WriteByte(flags); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (writer *FMIndexWriter) writeUvarint(v uint64) {
+	n := binary.PutUvarint(writer.buf, v)
+	writer.w.Write(writer.buf[:n])
+}
+
+func (writer *FMIndexWriter) writeSuffixArray(sa []int) error {
+	for _, v := range sa[1:] {
+		binary.LittleEndian.PutUint32(writer.buf, uint32(v))
+		if _, err := writer.w.Write(writer.buf[:4]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write writes the index of a sequence.
+func (writer *FMIndexWriter) Write(idx *SeqFMIndex) error {
+	if idx.opt != writer.opt {
+		return fmt.Errorf("the FM-index of '%s' is built with different options", idx.ID)
+	}
+	writer.writeUvarint(uint64(len(idx.ID)))
+	writer.w.Write(idx.ID)
+	writer.writeUvarint(uint64(idx.Len))
+	binary.LittleEndian.PutUint64(writer.buf, idx.Hash)
+	writer.w.Write(writer.buf[:8])
+	if err := writer.writeSuffixArray(idx.sa); err != nil {
+		return err
+	}
+	if idx.rcsa != nil {
+		return writer.writeSuffixArray(idx.rcsa)
+	}
+	return nil
+}
+
+// Flush writes buffered data to the underlying writer.
+func (writer *FMIndexWriter) Flush() error { return writer.w.Flush() }
+
+// FMIndexReader reads FM-indexes of sequences saved by FMIndexWriter.
+type FMIndexReader struct {
+	r   *bufio.Reader
+	opt FMIndexOptions
+	buf []byte
+}
+
+// NewFMIndexReader creates an FMIndexReader.
+func NewFMIndexReader(r io.Reader) (*FMIndexReader, error) {
+	reader := &FMIndexReader{
+		r:   bufio.NewReaderSize(r, 1<<20),
+		buf: make([]byte, 8),
+	}
+	magic := make([]byte, len(fmIndexMagic)+1)
+	if _, err := io.ReadFull(reader.r, magic); err != nil || !bytes.Equal(magic[:len(fmIndexMagic)], fmIndexMagic) {
+		return nil, fmt.Errorf("invalid FM-index file")
+	}
+	flags := magic[len(fmIndexMagic)]
+	reader.opt = FMIndexOptions{
+		IgnoreCase:         flags&1 > 0,
+		Circular:           flags&2 > 0,
+		OnlyPositiveStrand: flags&4 > 0,
+	}
+	return reader, nil
+}
+
+// Options returns the options used in building the indexes.
+func (reader *FMIndexReader) Options() FMIndexOptions { return reader.opt }
+
+func (reader *FMIndexReader) readSuffixArray(n int) ([]int, error) {
+	sa := make([]int, n+1)
+	sa[0] = n
+	for i := 1; i <= n; i++ {
+		if _, err := io.ReadFull(reader.r, reader.buf[:4]); err != nil {
+			return nil, err
+		}
+		sa[i] = int(binary.LittleEndian.Uint32(reader.buf))
+		if sa[i] >= n {
+			return nil, fmt.Errorf("invalid suffix array")
+		}
+	}
+	return sa, nil
+}
+
+// Read returns the index of the next sequence, or io.EOF.
+func (reader *FMIndexReader) Read() (*SeqFMIndex, error) {
+	n, err := binary.ReadUvarint(reader.r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("invalid FM-index file: %s", err)
+	}
+
+	idx := &SeqFMIndex{ID: make([]byte, n), opt: reader.opt}
+	if _, err = io.ReadFull(reader.r, idx.ID); err != nil {
+		return nil, fmt.Errorf("invalid FM-index file: %s", err)
+	}
+	if n, err = binary.ReadUvarint(reader.r); err != nil {
+		return nil, fmt.Errorf("invalid FM-index file: %s", err)
+	}
+	idx.Len = int(n)
+	if _, err = io.ReadFull(reader.r, reader.buf[:8]); err != nil {
+		return nil, fmt.Errorf("invalid FM-index file: %s", err)
+	}
+	idx.Hash = binary.LittleEndian.Uint64(reader.buf)
+
+	l := idx.Len
+	if reader.opt.Circular {
+		l <<= 1
+	}
+	if idx.sa, err = reader.readSuffixArray(l); err != nil {
+		return nil, fmt.Errorf("invalid FM-index file: %s", err)
+	}
+	if !reader.opt.OnlyPositiveStrand {
+		if idx.rcsa, err = reader.readSuffixArray(l); err != nil {
+			return nil, fmt.Errorf("invalid FM-index file: %s", err)
+		}
+	}
+	return idx, nil
+}
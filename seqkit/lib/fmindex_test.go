@@ -0,0 +1,138 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/bwt/fmi"
+)
+
+func TestSeqFMIndex(t *testing.T) {
+	var records []*fastx.Record
+	for i, s := range []string{"ACGTTTACGAAAAAACGTA", "acgtNNacGTACGTTGCA"} {
+		_s, err := seq.NewSeq(seq.DNAredundant, []byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := []byte{'s', byte('1' + i)}
+		records = append(records, &fastx.Record{ID: id, Name: id, Seq: _s})
+	}
+
+	for _, opt := range []FMIndexOptions{{}, {IgnoreCase: true, Circular: true}, {OnlyPositiveStrand: true}} {
+		var buf bytes.Buffer
+		w, err := NewFMIndexWriter(&buf, &opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range records {
+			idx, err := NewSeqFMIndex(record, &opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = w.Write(idx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := NewFMIndexReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Options() != opt {
+			t.Errorf("%+v: unexpected options: %+v", opt, r.Options())
+		}
+		for _, record := range records {
+			idx, err := r.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the same as the ones built from scratch
+			fwd, rev, err := idx.FMIndexes(record, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			text, rc := fmIndexTexts(record.Seq, &opt)
+			for i, index := range []*fmi.FMIndex{fwd, rev} {
+				s := [][]byte{text, rc}[i]
+				if s == nil {
+					if index != nil {
+						t.Errorf("%+v: unexpected FM-index of negative strand", opt)
+					}
+					continue
+				}
+				expected := fmi.NewFMIndex()
+				if _, err = expected.Transform(s); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(index, expected) {
+					t.Errorf("%+v: FM-index of %s does not match", opt, record.ID)
+				}
+			}
+
+			// the same locations
+			lopt := &LocateOptions{IgnoreCase: opt.IgnoreCase, Circular: opt.Circular,
+				OnlyPositiveStrand: opt.OnlyPositiveStrand, MaxMismatch: 1}
+			m, err := NewMotif("m", []byte("ACGTT"), seq.DNAredundant, lopt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := LocateMotifs(record, []*Motif{m}, lopt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			locs, err := LocateMotifsWithFMIndex(record, idx, []*Motif{m}, lopt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(locs, expected) {
+				t.Errorf("%+v: expected %v, returned %v", opt, expected, locs)
+			}
+
+			// different options
+			lopt.Circular = !lopt.Circular
+			if _, err = LocateMotifsWithFMIndex(record, idx, []*Motif{m}, lopt); err == nil {
+				t.Errorf("%+v: error expected for different options", opt)
+			}
+
+			// different sequence
+			if _, _, err = idx.FMIndexes(records[0], true); err == nil && record != records[0] {
+				t.Errorf("%+v: error expected for different sequence", opt)
+			}
+		}
+		if _, err = r.Read(); err != io.EOF {
+			t.Errorf("%+v: io.EOF expected, returned %v", opt, err)
+		}
+	}
+
+	if _, err := NewFMIndexReader(bytes.NewBufferString(">s1\nACGT\n")); err == nil {
+		t.Errorf("error expected for invalid FM-index file")
+	}
+}
@@ -0,0 +1,430 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/bwt/fmi"
+)
+
+// LocateOptions contains the options of NewMotif and LocateMotifs.
+type LocateOptions struct {
+	Degenerate         bool // patterns contain degenerate bases
+	UseRegexp          bool // patterns are regular expressions
+	UseFMI             bool // search with FM-index
+	IgnoreCase         bool
+	OnlyPositiveStrand bool
+	NonGreedy          bool // faster but may miss motifs overlapping with others
+	Circular           bool
+	MaxMismatch        int // > 0 implies searching with FM-index
+	MaxEdits           int // > 0 for searching with edit distance, allowing insertions and deletions
+
+	Threads int // number of patterns searched concurrently with FM-index
+}
+
+// Motif is a checked search pattern.
+type Motif struct {
+	Name string
+	Seq  []byte // the pattern, in lower case for case-insensitive plain search
+
+	re *regexp.Regexp // for degenerate bases and regular expressions
+
+	edit       []byte // the pattern for searching with edit distance
+	degenerate bool
+}
+
+// MotifLocation is a match of a motif.
+type MotifLocation struct {
+	Motif  string // name of the motif
+	Strand string // "+" or "-"
+
+	// Begin and End are 1-based locations on the positive strand,
+	// End could be greater than the sequence length for circular sequences.
+	Begin int
+	End   int
+
+	Matched []byte
+
+	// only for searching with edit distance
+	Edits int
+	CIGAR string // "=": match, "X": mismatch, "I": base only in the motif, "D": base only in the sequence
+
+	// only for scanning with PWMs
+	Score  float64 // log-odds score in bits
+	PValue float64
+}
+
+// isLegalSeq tells whether s is a legal DNA/RNA/protein sequence.
+func isLegalSeq(s []byte) bool {
+	return seq.DNAredundant.IsValid(s) == nil ||
+		seq.RNAredundant.IsValid(s) == nil ||
+		seq.Protein.IsValid(s) == nil
+}
+
+// NewMotif checks a pattern and prepares it for LocateMotifs,
+// alphabet decides how degenerate bases/residues are expanded.
+func NewMotif(name string, pattern []byte, alphabet *seq.Alphabet, opt *LocateOptions) (*Motif, error) {
+	m := &Motif{Name: name, Seq: pattern}
+
+	if opt.MaxEdits > 0 {
+		return newEditMotif(m, alphabet, opt)
+	}
+
+	var s string
+	if opt.Degenerate {
+		p, err := seq.NewSeq(alphabet, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s sequence with degenerate bases: %s", alphabet, pattern)
+		}
+		s = p.Degenerate2Regexp()
+	} else if opt.UseRegexp {
+		s = string(pattern)
+	} else if opt.IgnoreCase {
+		m.Seq = bytes.ToLower(pattern)
+	}
+
+	if opt.MaxMismatch > 0 {
+		if opt.MaxMismatch > len(pattern) {
+			return nil, fmt.Errorf("mismatch should be <= length of sequence: %s", pattern)
+		}
+		if !isLegalSeq(pattern) {
+			return nil, fmt.Errorf("illegal DNA/RNA/Protein sequence: %s", name)
+		}
+		return m, nil
+	}
+
+	if opt.Degenerate || opt.UseRegexp {
+		if opt.IgnoreCase {
+			s = "(?i)" + s
+		}
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, err
+		}
+		m.re = re
+	} else if bytes.IndexByte(pattern, '.') >= 0 || !isLegalSeq(pattern) {
+		return nil, fmt.Errorf("illegal DNA/RNA/Protein sequence: %s, degenerate bases or regular expression are not enabled", name)
+	}
+	return m, nil
+}
+
+// LocateMotifs returns all locations of motifs in a record,
+// the record itself is not modified.
+// Locations are grouped by motif, following the order of motifs.
+func LocateMotifs(record *fastx.Record, motifs []*Motif, opt *LocateOptions) ([]MotifLocation, error) {
+	if len(record.Seq.Seq) == 0 {
+		return nil, nil
+	}
+
+	s := record.Seq.Seq
+	if opt.IgnoreCase && (opt.MaxEdits > 0 || !(opt.Degenerate || opt.UseRegexp)) {
+		s = bytes.ToLower(s)
+	}
+
+	l := len(s)
+
+	if opt.Circular { // concat two copies of sequence
+		s = append(s[:l:l], s...)
+	}
+
+	sequence := &seq.Seq{Alphabet: record.Seq.Alphabet, Seq: s}
+
+	if opt.MaxEdits > 0 {
+		return locateMotifsByEdits(sequence, l, motifs, opt), nil
+	}
+	if opt.MaxMismatch > 0 || opt.UseFMI {
+		return locateMotifsByFMI(record.Name, sequence, l, motifs, opt)
+	}
+	return locateMotifs(sequence, l, motifs, opt), nil
+}
+
+// LocateMotifsWithFMIndex is similar to LocateMotifs, but searches with
+// the prebuilt FM-index of the record, which should be built with the same
+// values of IgnoreCase and Circular. Motifs are searched with mismatches
+// of opt.MaxMismatch, degenerate bases and regular expressions are not
+// supported.
+func LocateMotifsWithFMIndex(record *fastx.Record, idx *SeqFMIndex, motifs []*Motif, opt *LocateOptions) ([]MotifLocation, error) {
+	if opt.Degenerate || opt.UseRegexp || opt.MaxEdits > 0 {
+		return nil, fmt.Errorf("degenerate bases, regular expressions and edits are not supported with FM-index")
+	}
+	iopt := idx.Options()
+	if iopt.IgnoreCase != opt.IgnoreCase {
+		return nil, fmt.Errorf("the FM-index should be built with the same option of ignoring case")
+	}
+	if iopt.Circular != opt.Circular {
+		return nil, fmt.Errorf("the FM-index should be built with the same option of circular sequence")
+	}
+	if iopt.OnlyPositiveStrand && !opt.OnlyPositiveStrand {
+		return nil, fmt.Errorf("the FM-index contains only the positive strand")
+	}
+
+	fwd, rev, err := idx.FMIndexes(record, !opt.OnlyPositiveStrand)
+	if err != nil {
+		return nil, err
+	}
+	text, rc := fmIndexTexts(record.Seq, &iopt)
+	return locateMotifsInFMI(record.Name, fwd, text, rev, rc, idx.Len, motifs, opt)
+}
+
+// locateMotifsByFMI searches motifs with FM-index, l is the length of
+// the original sequence, which differs from len(s.Seq) for circular ones.
+func locateMotifsByFMI(name []byte, s *seq.Seq, l int, motifs []*Motif, opt *LocateOptions) ([]MotifLocation, error) {
+	sfmi := fmi.NewFMIndex()
+	_, err := sfmi.Transform(s.Seq)
+	if err != nil {
+		return nil, fmt.Errorf("fail to build FMIndex for sequence: %s", name)
+	}
+
+	if opt.OnlyPositiveStrand {
+		return locateMotifsInFMI(name, sfmi, s.Seq, nil, nil, l, motifs, opt)
+	}
+
+	rc := s.RevCom()
+	rcfmi := fmi.NewFMIndex()
+	_, err = rcfmi.Transform(rc.Seq)
+	if err != nil {
+		return nil, fmt.Errorf("fail to build FMIndex for reverse complement sequence: %s", name)
+	}
+	return locateMotifsInFMI(name, sfmi, s.Seq, rcfmi, rc.Seq, l, motifs, opt)
+}
+
+// locateMotifsInFMI searches motifs with FM-indexes of the sequence and
+// its reverse complement sequence, l is the length of the original sequence.
+func locateMotifsInFMI(name []byte, sfmi *fmi.FMIndex, s []byte, rcfmi *fmi.FMIndex, rc []byte,
+	l int, motifs []*Motif, opt *LocateOptions) ([]MotifLocation, error) {
+	threads := opt.Threads
+	if threads < 1 {
+		threads = 1
+	}
+
+	results := make([][]MotifLocation, len(motifs))
+	errs := make([]error, len(motifs))
+
+	search := func(sfmi *fmi.FMIndex, sequence []byte, strand string) {
+		var wg sync.WaitGroup
+		tokens := make(chan int, threads)
+		for k, m := range motifs {
+			tokens <- 1
+			wg.Add(1)
+			go func(k int, m *Motif) {
+				defer func() {
+					wg.Done()
+					<-tokens
+				}()
+
+				loc, err := sfmi.Locate(m.Seq, opt.MaxMismatch)
+				if err != nil {
+					errs[k] = fmt.Errorf("fail to search pattern '%s' on seq '%s': %s", m.Name, name, err)
+					return
+				}
+				var begin, end int
+				for _, i := range loc {
+					if opt.Circular && i+1 > l { // 2nd clone of original part
+						continue
+					}
+					if i+len(m.Seq) > len(sequence) {
+						continue
+					}
+					if strand == "+" {
+						begin, end = i+1, i+len(m.Seq)
+					} else {
+						begin, end = l-i-len(m.Seq)+1, l-i
+					}
+					results[k] = append(results[k], MotifLocation{
+						Motif:   m.Name,
+						Strand:  strand,
+						Begin:   begin,
+						End:     end,
+						Matched: sequence[i : i+len(m.Seq)],
+					})
+				}
+			}(k, m)
+		}
+		wg.Wait()
+	}
+
+	search(sfmi, s, "+")
+
+	locs := make([]MotifLocation, 0, 8)
+	for k := range motifs {
+		if errs[k] != nil {
+			return nil, errs[k]
+		}
+		locs = append(locs, results[k]...)
+		results[k] = nil
+	}
+
+	if opt.OnlyPositiveStrand {
+		return locs, nil
+	}
+
+	search(rcfmi, rc, "-")
+
+	for k := range motifs {
+		if errs[k] != nil {
+			return nil, errs[k]
+		}
+		locs = append(locs, results[k]...)
+	}
+	return locs, nil
+}
+
+// locateMotifs searches motifs by bytes.Index or regular expression,
+// l is the length of the original sequence.
+func locateMotifs(s *seq.Seq, l int, motifs []*Motif, opt *LocateOptions) []MotifLocation {
+	useRegexp := opt.UseRegexp || opt.Degenerate
+
+	locs := make([]MotifLocation, 0, 8)
+	var offset, i, begin, end int
+	var loc []int
+	var found [][2]int
+	var flag bool
+	var rc *seq.Seq
+
+	for _, m := range motifs {
+		found = found[:0]
+		offset = 0
+		for {
+			if useRegexp {
+				loc = m.re.FindSubmatchIndex(s.Seq[offset:])
+				if loc == nil {
+					break
+				}
+			} else {
+				i = bytes.Index(s.Seq[offset:], m.Seq)
+				if i < 0 {
+					break
+				}
+				loc = []int{i, i + len(m.Seq)}
+			}
+			begin = offset + loc[0] + 1
+
+			if opt.Circular && begin > l { // 2nd clone of original part
+				break
+			}
+
+			end = offset + loc[1]
+
+			flag = true // check "duplicated" region
+			if useRegexp {
+				for i = len(found) - 1; i >= 0; i-- {
+					if found[i][0] <= begin && found[i][1] >= end {
+						flag = false
+						break
+					}
+				}
+			}
+
+			if flag {
+				locs = append(locs, MotifLocation{
+					Motif:   m.Name,
+					Strand:  "+",
+					Begin:   begin,
+					End:     end,
+					Matched: s.Seq[begin-1 : end],
+				})
+				found = append(found, [2]int{begin, end})
+			}
+
+			if opt.NonGreedy {
+				offset = offset + loc[1] + 1
+			} else {
+				offset = offset + loc[0] + 1
+			}
+			if offset >= len(s.Seq) {
+				break
+			}
+		}
+
+		if opt.OnlyPositiveStrand {
+			continue
+		}
+
+		if rc == nil {
+			rc = s.RevCom()
+		}
+
+		found = found[:0]
+		offset = 0
+		for {
+			if useRegexp {
+				loc = m.re.FindSubmatchIndex(rc.Seq[offset:])
+				if loc == nil {
+					break
+				}
+			} else {
+				i = bytes.Index(rc.Seq[offset:], m.Seq)
+				if i < 0 {
+					break
+				}
+				loc = []int{i, i + len(m.Seq)}
+			}
+
+			if opt.Circular && offset+loc[0]+1 > l { // 2nd clone of original part
+				break
+			}
+
+			begin = l - offset - loc[1] + 1
+			end = l - offset - loc[0]
+			if offset+loc[1] > l {
+				begin += l
+				end += l
+			}
+
+			flag = true
+			if useRegexp {
+				for i = len(found) - 1; i >= 0; i-- {
+					if found[i][0] <= begin && found[i][1] >= end {
+						flag = false
+						break
+					}
+				}
+			}
+
+			if flag {
+				locs = append(locs, MotifLocation{
+					Motif:   m.Name,
+					Strand:  "-",
+					Begin:   begin,
+					End:     end,
+					Matched: rc.Seq[offset+loc[0] : offset+loc[1]],
+				})
+				found = append(found, [2]int{begin, end})
+			}
+
+			if opt.NonGreedy {
+				offset = offset + loc[1] + 1
+			} else {
+				offset = offset + loc[0] + 1
+			}
+			if offset >= len(s.Seq) {
+				break
+			}
+		}
+	}
+	return locs
+}
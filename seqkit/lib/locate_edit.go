@@ -0,0 +1,351 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/bio/seq"
+)
+
+// degenerateBases are the bases matched by an IUPAC code,
+// T and U are regarded as the same base.
+var degenerateBases = map[byte]string{
+	'A': "A",
+	'C': "C",
+	'G': "G",
+	'T': "TU",
+	'U': "TU",
+	'R': "AG",
+	'Y': "CTU",
+	'S': "CG",
+	'W': "ATU",
+	'K': "GTU",
+	'M': "AC",
+	'B': "CGTU",
+	'D': "AGTU",
+	'H': "ACTU",
+	'V': "ACG",
+	'N': "ACGTU",
+}
+
+// baseMatch tells whether a base of the sequence matches a base of the motif.
+// Like the regular expressions of degenerate bases, it's case-sensitive,
+// both should be in lower case for case-insensitive search.
+func baseMatch(p, b byte, degenerate bool) bool {
+	if p == b {
+		return true
+	}
+	if !degenerate {
+		return false
+	}
+	lower := p >= 'a' && p <= 'z'
+	if lower != (b >= 'a' && b <= 'z') {
+		return false
+	}
+	if lower {
+		p -= 32
+		b -= 32
+	}
+	bases, ok := degenerateBases[p]
+	return ok && strings.IndexByte(bases, b) >= 0
+}
+
+// editHit is a match of a motif with edits, in 0-based half-open
+// coordinates of the searched sequence.
+type editHit struct {
+	start, end int
+	edits      int
+	cigar      string
+}
+
+// editDistances computes the edit distances of the motif to the best
+// matched substrings of s (semi-global alignment) ending at every position,
+// fn is called with the end position (exclusive) and the distance,
+// and it returns false to stop the computation.
+func editDistances(p, s []byte, degenerate bool, fn func(end, d int) bool) {
+	m := len(p)
+	col := make([]int, m+1)
+	for i := range col {
+		col[i] = i
+	}
+
+	var diag, up, cost int
+	for j, b := range s {
+		diag, col[0] = col[0], 0
+		for i := 1; i <= m; i++ {
+			up = col[i]
+			cost = diag
+			if !baseMatch(p[i-1], b, degenerate) {
+				cost++
+			}
+			if up+1 < cost { // a base only in the sequence
+				cost = up + 1
+			}
+			if col[i-1]+1 < cost { // a base only in the motif
+				cost = col[i-1] + 1
+			}
+			col[i], diag = cost, up
+		}
+		if !fn(j+1, col[m]) {
+			return
+		}
+	}
+}
+
+// HasMatchWithEdits tells whether the motif matches s with
+// at most maxEdits substitutions, insertions and deletions.
+func (m *Motif) HasMatchWithEdits(s []byte, maxEdits int) bool {
+	var found bool
+	editDistances(m.editSeq(), s, m.degenerate, func(end, d int) bool {
+		found = d <= maxEdits
+		return !found
+	})
+	return found
+}
+
+// newEditMotif checks a motif for searching with edit distance.
+func newEditMotif(m *Motif, alphabet *seq.Alphabet, opt *LocateOptions) (*Motif, error) {
+	if opt.UseRegexp {
+		return nil, fmt.Errorf("regular expression is not supported for searching with edit distance")
+	}
+	if opt.MaxMismatch > 0 || opt.UseFMI {
+		return nil, fmt.Errorf("searching with edit distance is incompatible with mismatch and FM-index")
+	}
+	if opt.MaxEdits >= len(m.Seq) {
+		return nil, fmt.Errorf("edits should be < length of sequence: %s", m.Seq)
+	}
+	if opt.Degenerate {
+		if _, err := seq.NewSeq(alphabet, m.Seq); err != nil {
+			return nil, fmt.Errorf("invalid %s sequence with degenerate bases: %s", alphabet, m.Seq)
+		}
+	} else if bytes.IndexByte(m.Seq, '.') >= 0 || !isLegalSeq(m.Seq) {
+		return nil, fmt.Errorf("illegal DNA/RNA/Protein sequence: %s, degenerate bases are not enabled", m.Name)
+	}
+
+	m.degenerate = opt.Degenerate
+	m.edit = m.Seq
+	if opt.IgnoreCase {
+		m.edit = bytes.ToLower(m.Seq)
+		if !opt.Degenerate {
+			m.Seq = m.edit
+		}
+	}
+	return m, nil
+}
+
+// editSeq returns the pattern used in edit-distance search.
+func (m *Motif) editSeq() []byte {
+	if m.edit != nil {
+		return m.edit
+	}
+	return m.Seq
+}
+
+// findWithEdits returns matches of p in s with at most k edits.
+// For each local best end position, the alignment is traced back to
+// get the start position and CIGAR string; of matches sharing the same
+// start, the one with the fewest edits is kept.
+func findWithEdits(p, s []byte, k int, degenerate bool) []editHit {
+	m := len(p)
+	d := make([]int, len(s)+1)
+	d[0] = m
+	editDistances(p, s, degenerate, func(end, e int) bool {
+		d[end] = e
+		return true
+	})
+
+	best := make(map[int]int, 8) // start -> index of hits
+	hits := make([]editHit, 0, 8)
+
+	var ws int
+	var dp [][]int
+	for j := 1; j <= len(s); j++ {
+		if d[j] > k || d[j] > d[j-1] || (j < len(s) && d[j] > d[j+1]) {
+			continue
+		}
+
+		// a match spans at most m+k bases of the sequence
+		ws = j - m - k
+		if ws < 0 {
+			ws = 0
+		}
+		dp = alignEdits(p, s[ws:j], degenerate, dp)
+		start, cigar := traceEdits(p, s[ws:j], degenerate, dp)
+		start += ws
+
+		if i, ok := best[start]; ok {
+			if d[j] < hits[i].edits {
+				hits[i] = editHit{start: start, end: j, edits: d[j], cigar: cigar}
+			}
+			continue
+		}
+		best[start] = len(hits)
+		hits = append(hits, editHit{start: start, end: j, edits: d[j], cigar: cigar})
+	}
+
+	sort.Slice(hits, func(i, j int) bool { return hits[i].start < hits[j].start })
+	return hits
+}
+
+// alignEdits fills the semi-global alignment matrix of p against s,
+// where the alignment could start anywhere in s.
+func alignEdits(p, s []byte, degenerate bool, dp [][]int) [][]int {
+	m, n := len(p), len(s)
+	if cap(dp) < m+1 {
+		dp = make([][]int, m+1)
+	}
+	dp = dp[:m+1]
+	for i := range dp {
+		if cap(dp[i]) < n+1 {
+			dp[i] = make([]int, n+1)
+		}
+		dp[i] = dp[i][:n+1]
+		dp[i][0] = i
+	}
+	for j := 0; j <= n; j++ {
+		dp[0][j] = 0
+	}
+
+	var cost int
+	for i := 1; i <= m; i++ {
+		for j := 1; j <= n; j++ {
+			cost = dp[i-1][j-1]
+			if !baseMatch(p[i-1], s[j-1], degenerate) {
+				cost++
+			}
+			if dp[i][j-1]+1 < cost {
+				cost = dp[i][j-1] + 1
+			}
+			if dp[i-1][j]+1 < cost {
+				cost = dp[i-1][j] + 1
+			}
+			dp[i][j] = cost
+		}
+	}
+	return dp
+}
+
+// traceEdits traces back the alignment ending at the end of s, returning
+// the start position in s and the CIGAR string, in which "=" means a match,
+// "X" a mismatch, "I" a base only in the motif and "D" a base only in the
+// sequence. Matches and mismatches are preferred to indels.
+func traceEdits(p, s []byte, degenerate bool, dp [][]int) (int, string) {
+	ops := make([]byte, 0, len(p)+4)
+	i, j := len(p), len(s)
+	var match bool
+	for i > 0 {
+		if j > 0 {
+			match = baseMatch(p[i-1], s[j-1], degenerate)
+			if match && dp[i][j] == dp[i-1][j-1] {
+				ops = append(ops, '=')
+				i--
+				j--
+				continue
+			}
+			if !match && dp[i][j] == dp[i-1][j-1]+1 {
+				ops = append(ops, 'X')
+				i--
+				j--
+				continue
+			}
+		}
+		if dp[i][j] == dp[i-1][j]+1 {
+			ops = append(ops, 'I')
+			i--
+			continue
+		}
+		ops = append(ops, 'D')
+		j--
+	}
+
+	// reverse and compress
+	var buf bytes.Buffer
+	var n int
+	for k := len(ops) - 1; k >= 0; k-- {
+		n++
+		if k == 0 || ops[k-1] != ops[k] {
+			buf.WriteString(strconv.Itoa(n))
+			buf.WriteByte(ops[k])
+			n = 0
+		}
+	}
+	return j, buf.String()
+}
+
+// locateMotifsByEdits searches motifs with edit distance,
+// l is the length of the original sequence.
+func locateMotifsByEdits(s *seq.Seq, l int, motifs []*Motif, opt *LocateOptions) []MotifLocation {
+	locs := make([]MotifLocation, 0, 8)
+	var begin, end int
+	var rc *seq.Seq
+
+	for _, m := range motifs {
+		for _, h := range findWithEdits(m.editSeq(), s.Seq, opt.MaxEdits, m.degenerate) {
+			if opt.Circular && h.start+1 > l { // 2nd clone of original part
+				continue
+			}
+			locs = append(locs, MotifLocation{
+				Motif:   m.Name,
+				Strand:  "+",
+				Begin:   h.start + 1,
+				End:     h.end,
+				Matched: s.Seq[h.start:h.end],
+				Edits:   h.edits,
+				CIGAR:   h.cigar,
+			})
+		}
+
+		if opt.OnlyPositiveStrand {
+			continue
+		}
+
+		if rc == nil {
+			rc = s.RevCom()
+		}
+
+		for _, h := range findWithEdits(m.editSeq(), rc.Seq, opt.MaxEdits, m.degenerate) {
+			if opt.Circular && h.start+1 > l {
+				continue
+			}
+			begin = l - h.end + 1
+			end = l - h.start
+			if h.end > l {
+				begin += l
+				end += l
+			}
+			locs = append(locs, MotifLocation{
+				Motif:   m.Name,
+				Strand:  "-",
+				Begin:   begin,
+				End:     end,
+				Matched: rc.Seq[h.start:h.end],
+				Edits:   h.edits,
+				CIGAR:   h.cigar,
+			})
+		}
+	}
+	return locs
+}
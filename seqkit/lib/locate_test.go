@@ -0,0 +1,154 @@
+// Copyright © 2016 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+func TestLocateMotifs(t *testing.T) {
+	s, err := seq.NewSeq(seq.DNAredundant, []byte("ACGTTTACGAAAAAACGTA"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := &fastx.Record{ID: []byte("s"), Name: []byte("s"), Seq: s}
+
+	tests := []struct {
+		name    string
+		pattern string
+		opt     LocateOptions
+		locs    string // strand:begin-end:matched, joined by ","
+	}{
+		{"exact", "ACG", LocateOptions{OnlyPositiveStrand: true},
+			"+:1-3:ACG,+:7-9:ACG,+:15-17:ACG"},
+		{"exact, both strands", "AAAC", LocateOptions{},
+			"+:13-16:AAAC,-:3-6:AAAC"},
+		{"ignore case", "acgtt", LocateOptions{IgnoreCase: true, OnlyPositiveStrand: true},
+			"+:1-5:acgtt"},
+		{"degenerate", "ACGW", LocateOptions{Degenerate: true, OnlyPositiveStrand: true},
+			"+:1-4:ACGT,+:7-10:ACGA,+:15-18:ACGT"},
+		{"mismatch", "ACGAT", LocateOptions{MaxMismatch: 1, OnlyPositiveStrand: true},
+			"+:1-5:ACGTT,+:7-11:ACGAA"},
+		{"circular", "TAAC", LocateOptions{Circular: true, OnlyPositiveStrand: true},
+			"+:18-21:TAAC"},
+	}
+
+	for _, test := range tests {
+		m, err := NewMotif("m", []byte(test.pattern), seq.DNAredundant, &test.opt)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		locs, err := LocateMotifs(record, []*Motif{m}, &test.opt)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		tmp := make([]string, len(locs))
+		for i, loc := range locs {
+			tmp[i] = fmt.Sprintf("%s:%d-%d:%s", loc.Strand, loc.Begin, loc.End, loc.Matched)
+		}
+		if r := strings.Join(tmp, ","); r != test.locs {
+			t.Errorf("%s: expected %s, returned %s", test.name, test.locs, r)
+		}
+	}
+}
+
+func TestLocateMotifsWithEdits(t *testing.T) {
+	s, err := seq.NewSeq(seq.DNAredundant, []byte("ACGTTTACGAAAAAACGTA"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := &fastx.Record{ID: []byte("s"), Name: []byte("s"), Seq: s}
+
+	tests := []struct {
+		name    string
+		pattern string
+		opt     LocateOptions
+		locs    string // strand:begin-end:matched:edits:cigar, joined by ","
+	}{
+		{"base only in the sequence", "ACGTTACG", LocateOptions{MaxEdits: 1, OnlyPositiveStrand: true},
+			"+:1-9:ACGTTTACG:1:3=1D5="},
+		{"base only in the motif", "ACGTTTTACG", LocateOptions{MaxEdits: 1, OnlyPositiveStrand: true},
+			"+:1-9:ACGTTTACG:1:3=1I6="},
+		{"mismatch", "GTTTCCG", LocateOptions{MaxEdits: 1, OnlyPositiveStrand: true},
+			"+:3-9:GTTTACG:1:4=1X2="},
+		{"negative strand", "TTTTTCG", LocateOptions{MaxEdits: 1},
+			"-:8-14:TTTTTCG:0:7="},
+		{"degenerate, ignore case", "acgw", LocateOptions{MaxEdits: 1, Degenerate: true, IgnoreCase: true, OnlyPositiveStrand: true},
+			"+:1-4:acgt:0:4=,+:7-10:acga:0:4=,+:15-18:acgt:0:4="},
+		{"circular", "ACGTTACG", LocateOptions{MaxEdits: 1, Circular: true},
+			"+:1-9:ACGTTTACG:1:3=1D5=,+:15-22:ACGTAACG:1:4=1X3=,-:16-23:ACGTTACG:0:8="},
+	}
+
+	for _, test := range tests {
+		m, err := NewMotif("m", []byte(test.pattern), seq.DNAredundant, &test.opt)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		locs, err := LocateMotifs(record, []*Motif{m}, &test.opt)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		tmp := make([]string, len(locs))
+		for i, loc := range locs {
+			tmp[i] = fmt.Sprintf("%s:%d-%d:%s:%d:%s", loc.Strand, loc.Begin, loc.End, loc.Matched, loc.Edits, loc.CIGAR)
+		}
+		if r := strings.Join(tmp, ","); r != test.locs {
+			t.Errorf("%s: expected %s, returned %s", test.name, test.locs, r)
+		}
+	}
+
+	m, _ := NewMotif("m", []byte("ACGTTACG"), seq.DNAredundant, &LocateOptions{MaxEdits: 1})
+	if !m.HasMatchWithEdits(record.Seq.Seq, 1) {
+		t.Errorf("HasMatchWithEdits: expected true")
+	}
+	if m.HasMatchWithEdits(record.Seq.Seq[3:], 1) {
+		t.Errorf("HasMatchWithEdits: expected false")
+	}
+}
+
+func TestNewMotifError(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		opt     LocateOptions
+	}{
+		{"degenerate bases not enabled", "ACGN.", LocateOptions{}},
+		{"too many mismatches", "ACG", LocateOptions{MaxMismatch: 4}},
+		{"invalid regular expression", "AC(G", LocateOptions{UseRegexp: true}},
+		{"too many edits", "ACG", LocateOptions{MaxEdits: 3}},
+		{"edits with regular expression", "ACG", LocateOptions{MaxEdits: 1, UseRegexp: true}},
+		{"edits with mismatch", "ACGT", LocateOptions{MaxEdits: 1, MaxMismatch: 1}},
+	}
+	for _, test := range tests {
+		if _, err := NewMotif("m", []byte(test.pattern), seq.DNAredundant, &test.opt); err == nil {
+			t.Errorf("%s: error expected", test.name)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"fmt"
+
+	"github.com/shenwei356/bio/seq"
+)
+
+// MergeOptions contains the options of MergePair.
+type MergeOptions struct {
+	MinOverlap      int     // minimum overlap length
+	MaxMismatchRate float64 // maximum proportion of mismatches in the overlap
+
+	// Overlaps are scored with the match and mismatch scores,
+	// gap penalties are not used as overlaps are searched without gaps.
+	AlnParams *AlnParams
+
+	QualBase int // ASCII base of quality, e.g., 33
+}
+
+// MergeStatus is the result of merging a pair of reads.
+type MergeStatus int
+
+// Results of MergePair.
+const (
+	PairUnmerged  MergeStatus = iota // no overlap found
+	PairMerged                       // merged with the best overlap
+	PairAmbiguous                    // more than one overlap has the best score
+)
+
+func (s MergeStatus) String() string {
+	switch s {
+	case PairUnmerged:
+		return "unmerged"
+	case PairMerged:
+		return "merged"
+	case PairAmbiguous:
+		return "ambiguous"
+	}
+	return fmt.Sprintf("MergeStatus(%d)", int(s))
+}
+
+// MergeResult describes the overlap of a pair of reads.
+type MergeResult struct {
+	Status MergeStatus
+
+	// Offset is the 0-based location of the first base of the reverse
+	// complemented read2 on read1. It's negative if read2 extends beyond
+	// the 5' end of read1, i.e., the insert is shorter than the reads.
+	Offset     int
+	Overlap    int
+	Mismatches int
+	Score      int
+}
+
+// MergePair merges read1 and the reverse complement of read2 if they
+// overlap by at least MinOverlap bases with at most MaxMismatchRate
+// mismatches, choosing the overlap with the highest score. N bases are
+// counted as neither matches nor mismatches.
+//
+// In the overlap, the base with the higher quality is kept at a mismatched
+// position, with the quality of the difference of the two (at least 2),
+// and N is used if the qualities are equal or not available. Matched
+// bases get the higher quality. Bases of read1 beyond the 3' end of read2,
+// and those of read2 beyond the 5' end of read1, are adapters and
+// discarded.
+//
+// The merged sequence is nil unless the status is PairMerged.
+func MergePair(s1, s2 *seq.Seq, opt *MergeOptions) (*seq.Seq, MergeResult) {
+	a, qa := s1.Seq, s1.Qual
+	rc := &seq.Seq{Alphabet: seq.DNAredundant, Seq: []byte(string(s2.Seq))}
+	if len(s2.Qual) > 0 {
+		rc.Qual = []byte(string(s2.Qual))
+	}
+	rc.RevComInplace()
+	b, qb := rc.Seq, rc.Qual
+	withQual := len(qa) > 0 && len(qb) > 0
+
+	r := MergeResult{Status: PairUnmerged}
+	var found bool
+	var i0, i1, l, match, mis, maxMis, score int
+	var x, y byte
+	for d := opt.MinOverlap - len(b); d <= len(a)-opt.MinOverlap; d++ {
+		i0, i1 = d, d+len(b)
+		if i0 < 0 {
+			i0 = 0
+		}
+		if i1 > len(a) {
+			i1 = len(a)
+		}
+		l = i1 - i0
+		if l < opt.MinOverlap {
+			continue
+		}
+		maxMis = int(opt.MaxMismatchRate * float64(l))
+		match, mis = 0, 0
+		for i := i0; i < i1; i++ {
+			x, y = a[i]&^0x20, b[i-d]&^0x20
+			if x == 'N' || y == 'N' {
+				continue
+			}
+			if x == y {
+				match++
+			} else {
+				mis++
+				if mis > maxMis {
+					break
+				}
+			}
+		}
+		if mis > maxMis {
+			continue
+		}
+		score = match*opt.AlnParams.Match + mis*opt.AlnParams.Mismatch
+		if !found || score > r.Score {
+			r = MergeResult{Status: PairMerged, Offset: d, Overlap: l, Mismatches: mis, Score: score}
+			found = true
+		} else if score == r.Score {
+			r.Status = PairAmbiguous
+		}
+	}
+	if r.Status != PairMerged {
+		return nil, r
+	}
+
+	d := r.Offset
+	i0, i1 = d, d+len(b)
+	if i0 < 0 {
+		i0 = 0
+	}
+	if i1 > len(a) {
+		i1 = len(a)
+	}
+	n := i1 // read1 and the overlap
+	if d+len(b) > len(a) {
+		n = d + len(b)
+	}
+	s := make([]byte, 0, n)
+	var q []byte
+	if withQual {
+		q = make([]byte, 0, n)
+	}
+
+	// read1 only
+	s = append(s, a[:i0]...)
+	if withQual {
+		q = append(q, qa[:i0]...)
+	}
+
+	// the overlap
+	var qx, qy, base, qual byte
+	minQual := byte(opt.QualBase + 2)
+	for i := i0; i < i1; i++ {
+		x, y = a[i], b[i-d]
+		if withQual {
+			qx, qy = qa[i], qb[i-d]
+		}
+		switch {
+		case y&^0x20 == 'N':
+			base, qual = x, qx
+		case x&^0x20 == 'N' || x&^0x20 == y&^0x20:
+			base, qual = y, qy
+			if x&^0x20 == y&^0x20 {
+				base = x
+				if qx > qual {
+					qual = qx
+				}
+			}
+		case !withQual || qx == qy:
+			base, qual = 'N', minQual
+		case qx > qy:
+			base, qual = x, qx-qy+byte(opt.QualBase)
+		default:
+			base, qual = y, qy-qx+byte(opt.QualBase)
+		}
+		if qual < minQual {
+			qual = minQual
+		}
+		s = append(s, base)
+		if withQual {
+			q = append(q, qual)
+		}
+	}
+
+	// read2 only
+	if d+len(b) > len(a) {
+		s = append(s, b[len(a)-d:]...)
+		if withQual {
+			q = append(q, qb[len(a)-d:]...)
+		}
+	}
+
+	return &seq.Seq{Alphabet: s1.Alphabet, Seq: s, Qual: q}, r
+}
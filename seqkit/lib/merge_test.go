@@ -0,0 +1,100 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seq"
+)
+
+func TestMergePair(t *testing.T) {
+	opt := &MergeOptions{
+		MinOverlap:      10,
+		MaxMismatchRate: 0.1,
+		AlnParams:       &AlnParams{Match: 4, Mismatch: -4, GapOpen: -2, GapExtend: -1},
+		QualBase:        33,
+	}
+	newSeq := func(s string, q []byte) *seq.Seq {
+		return &seq.Seq{Alphabet: seq.DNAredundant, Seq: []byte(s), Qual: q}
+	}
+	reverse := func(q []byte) []byte {
+		r := make([]byte, len(q))
+		for i, b := range q {
+			r[len(q)-1-i] = b
+		}
+		return r
+	}
+
+	frag := "ACGTTGCATGTCGCATGATGCATGAGAGTTCGATCGATTGCAGTCGAGTCCGATAGCT"
+
+	// overlap of 20 bases
+	s, r := MergePair(newSeq(frag[:40], nil), newSeq(RevCompDNA(frag[20:]), nil), opt)
+	if r.Status != PairMerged || r.Offset != 20 || r.Overlap != 20 || r.Mismatches != 0 || r.Score != 80 {
+		t.Errorf("unexpected result: %+v", r)
+	} else if string(s.Seq) != frag {
+		t.Errorf("expected %s, returned %s", frag, s.Seq)
+	}
+
+	// mismatches resolved by quality
+	r1 := []byte(frag[:40])
+	r1[25], r1[30] = 'A', 'A' // T->A, T->A
+	q1 := bytes.Repeat([]byte{30 + 33}, 40)
+	q1[25] = 10 + 33
+	q2 := bytes.Repeat([]byte{20 + 33}, 40)
+	s, r = MergePair(newSeq(string(r1), q1), newSeq(RevCompDNA(frag[20:]), reverse(q2)), opt)
+	if r.Status != PairMerged || r.Offset != 20 || r.Mismatches != 2 {
+		t.Errorf("unexpected result: %+v", r)
+	} else {
+		expected := []byte(frag)
+		expected[30] = 'A'
+		if string(s.Seq) != string(expected) {
+			t.Errorf("expected %s, returned %s", expected, s.Seq)
+		}
+		for i, e := range map[int]int{0: 30, 20: 30, 25: 10, 30: 10, 45: 20} {
+			if int(s.Qual[i])-33 != e {
+				t.Errorf("quality at %d: expected %d, returned %d", i, e, int(s.Qual[i])-33)
+			}
+		}
+	}
+
+	// insert shorter than reads
+	s, r = MergePair(newSeq(frag[:30]+"AGATCGGAAG", nil), newSeq(RevCompDNA(frag[:30])+"AGATCGTCGG", nil), opt)
+	if r.Status != PairMerged || r.Offset != -10 || r.Overlap != 30 {
+		t.Errorf("unexpected result: %+v", r)
+	} else if string(s.Seq) != frag[:30] {
+		t.Errorf("expected %s, returned %s", frag[:30], s.Seq)
+	}
+
+	// no overlap
+	if s, r = MergePair(newSeq(frag[:25], nil), newSeq(RevCompDNA(frag[35:]), nil), opt); r.Status != PairUnmerged || s != nil {
+		t.Errorf("unexpected result: %+v", r)
+	}
+
+	// repeats
+	b := []byte(strings.Repeat("ACGT", 6))
+	b[20], b[21] = 'T', 'T'
+	if _, r = MergePair(newSeq(strings.Repeat("ACGT", 6), nil), newSeq(RevCompDNA(string(b)), nil), opt); r.Status != PairAmbiguous {
+		t.Errorf("unexpected result: %+v", r)
+	}
+}
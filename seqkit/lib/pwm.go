@@ -0,0 +1,494 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+// PWM is a position weight matrix of a DNA motif, with log-odds scores
+// (in bits) of A, C, G and T at each position.
+type PWM struct {
+	ID   string
+	Name string
+
+	Consensus []byte // the base with the highest score at each position
+
+	bg     [4]float64 // background frequencies
+	scores [][4]int   // scores scaled by pwmScoreScale
+	min    int        // minimum score of the matrix
+	tail   []float64  // tail[i]: probability of scores >= min+i under the background
+}
+
+// pwmScoreScale is the scale of scores to integers, i.e., scores are
+// rounded to 0.01, so that p-values could be computed exactly.
+const pwmScoreScale = 100
+
+// pwmPseudocount is the pseudocount added to each position, in proportion
+// to the background frequencies.
+const pwmPseudocount = 1
+
+// pwmDefaultSites is the number of sites of MEME motifs without nsites.
+const pwmDefaultSites = 20
+
+// pwmBase2Index maps bases to the indexes of A, C, G and T.
+var pwmBase2Index [256]int
+
+func init() {
+	for i := range pwmBase2Index {
+		pwmBase2Index[i] = -1
+	}
+	for i, bases := range []string{"Aa", "Cc", "Gg", "TtUu"} {
+		for _, b := range []byte(bases) {
+			pwmBase2Index[b] = i
+		}
+	}
+}
+
+// NewPWM creates a PWM from counts (or frequencies) of A, C, G and T at each
+// position, and background frequencies, nil for uniform background.
+func NewPWM(id, name string, counts [][4]float64, bg []float64) (*PWM, error) {
+	if len(counts) == 0 {
+		return nil, fmt.Errorf("empty matrix of motif: %s", id)
+	}
+	p := &PWM{ID: id, Name: name, bg: [4]float64{0.25, 0.25, 0.25, 0.25}}
+	if bg != nil {
+		if len(bg) != 4 {
+			return nil, fmt.Errorf("four background frequencies needed")
+		}
+		var sum float64
+		for _, f := range bg {
+			if f <= 0 {
+				return nil, fmt.Errorf("background frequencies should be positive")
+			}
+			sum += f
+		}
+		for i, f := range bg {
+			p.bg[i] = f / sum
+		}
+	}
+
+	p.Consensus = make([]byte, len(counts))
+	p.scores = make([][4]int, len(counts))
+	var n, f, best float64
+	for i, c := range counts {
+		n = 0
+		for _, v := range c {
+			if v < 0 {
+				return nil, fmt.Errorf("negative value in matrix of motif: %s", id)
+			}
+			n += v
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("empty column %d in matrix of motif: %s", i+1, id)
+		}
+		best = -1
+		for j, v := range c {
+			f = (v + pwmPseudocount*p.bg[j]) / (n + pwmPseudocount)
+			p.scores[i][j] = int(math.Round(math.Log2(f/p.bg[j]) * pwmScoreScale))
+			if v > best {
+				best = v
+				p.Consensus[i] = "ACGT"[j]
+			}
+		}
+	}
+
+	p.computeTail()
+	return p, nil
+}
+
+// computeTail computes the distribution of scores under the background.
+func (p *PWM) computeTail() {
+	// dist[i]: probability of scores == lo+i of the first positions
+	dist := []float64{1}
+	var lo int
+	for _, s := range p.scores {
+		_min, _max := s[0], s[0]
+		for _, v := range s[1:] {
+			if v < _min {
+				_min = v
+			}
+			if v > _max {
+				_max = v
+			}
+		}
+		next := make([]float64, len(dist)+_max-_min)
+		for i, pr := range dist {
+			if pr == 0 {
+				continue
+			}
+			for j, v := range s {
+				next[i+v-_min] += pr * p.bg[j]
+			}
+		}
+		dist = next
+		lo += _min
+	}
+	p.min = lo
+
+	p.tail = make([]float64, len(dist))
+	var sum float64
+	for i := len(dist) - 1; i >= 0; i-- {
+		sum += dist[i]
+		p.tail[i] = sum
+	}
+}
+
+// Len returns the length of the motif.
+func (p *PWM) Len() int { return len(p.scores) }
+
+// MaxScore returns the highest possible score.
+func (p *PWM) MaxScore() float64 {
+	return float64(p.min+len(p.tail)-1) / pwmScoreScale
+}
+
+// score returns the scaled score of a sequence of the same length as the
+// motif, and false if it contains bases other than A, C, G, T and U.
+func (p *PWM) score(s []byte) (int, bool) {
+	var sum, k int
+	for i, b := range s {
+		k = pwmBase2Index[b]
+		if k < 0 {
+			return 0, false
+		}
+		sum += p.scores[i][k]
+	}
+	return sum, true
+}
+
+// Score returns the log-odds score of a sequence of the same length as
+// the motif, and false if it contains bases other than A, C, G, T and U.
+func (p *PWM) Score(s []byte) (float64, bool) {
+	if len(s) != len(p.scores) {
+		return 0, false
+	}
+	v, ok := p.score(s)
+	return float64(v) / pwmScoreScale, ok
+}
+
+// pvalue returns the p-value of a scaled score.
+func (p *PWM) pvalue(score int) float64 {
+	i := score - p.min
+	if i < 0 {
+		return 1
+	}
+	if i >= len(p.tail) {
+		return 0
+	}
+	return p.tail[i]
+}
+
+// PValue returns the probability of a random sequence (under the background)
+// having a score >= the given one.
+func (p *PWM) PValue(score float64) float64 {
+	return p.pvalue(int(math.Ceil(score*pwmScoreScale - 1e-9)))
+}
+
+// ScoreThreshold returns the lowest possible score with a p-value <= pvalue,
+// it's greater than MaxScore if no such scores.
+func (p *PWM) ScoreThreshold(pvalue float64) float64 {
+	last := len(p.tail) - 1
+	for i, pr := range p.tail {
+		if pr <= pvalue && (i == last || pr > p.tail[i+1]) {
+			return float64(p.min+i) / pwmScoreScale
+		}
+	}
+	return float64(p.min+len(p.tail)) / pwmScoreScale
+}
+
+// revcom returns the PWM of the reverse complementary strand.
+func (p *PWM) revcom() *PWM {
+	rc := *p
+	n := len(p.scores)
+	rc.scores = make([][4]int, n)
+	for i, s := range p.scores {
+		rc.scores[n-1-i] = [4]int{s[3], s[2], s[1], s[0]}
+	}
+	return &rc
+}
+
+// LoadPWMs reads motifs from a file in JASPAR or MEME format,
+// the format is detected automatically.
+func LoadPWMs(file string) ([]*PWM, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("load motifs from '%s': %s", file, err)
+	}
+	defer fh.Close()
+
+	pwms, err := ParsePWMs(fh)
+	if err != nil {
+		return nil, fmt.Errorf("load motifs from '%s': %s", file, err)
+	}
+	return pwms, nil
+}
+
+// ParsePWMs parses motifs in JASPAR or MEME format.
+//
+// In JASPAR format, each motif has a header line starting with ">", followed
+// by four lines of counts of A, C, G and T, optionally with the base
+// and brackets, e.g., "A [ 4 19 0 ]".
+//
+// In MEME format, the background frequencies and letter-probability matrices
+// are used, probabilities are multiplied by nsites (20 if not given).
+func ParsePWMs(r io.Reader) ([]*PWM, error) {
+	lines := make([]string, 0, 1024)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 1<<16), 1<<30)
+	var meme bool
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "MEME version") {
+			meme = true
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("no motifs found")
+	}
+
+	if meme {
+		return parseMEME(lines)
+	}
+	if lines[0][0] == '>' {
+		return parseJASPAR(lines)
+	}
+	return nil, fmt.Errorf("unsupported motif format, JASPAR or MEME format expected")
+}
+
+// parseFloats parses space-separated numbers.
+func parseFloats(s string) ([]float64, error) {
+	fields := strings.Fields(s)
+	values := make([]float64, len(fields))
+	var err error
+	for i, f := range fields {
+		values[i], err = strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %s", f)
+		}
+	}
+	return values, nil
+}
+
+func parseJASPAR(lines []string) ([]*PWM, error) {
+	pwms := make([]*PWM, 0, 8)
+	for i := 0; i < len(lines); {
+		header := strings.Fields(lines[i][1:])
+		if len(header) == 0 || lines[i][0] != '>' {
+			return nil, fmt.Errorf("invalid JASPAR header: %s", lines[i])
+		}
+		if i+5 > len(lines) {
+			return nil, fmt.Errorf("four rows of counts expected for motif: %s", header[0])
+		}
+
+		var rows [4][]float64
+		for k, line := range lines[i+1 : i+5] {
+			j := k
+			if b := pwmBase2Index[line[0]]; b >= 0 && (len(line) == 1 || line[1] == ' ' || line[1] == '\t' || line[1] == '[') {
+				j = b
+				line = line[1:]
+			}
+			line = strings.NewReplacer("[", " ", "]", " ").Replace(line)
+			values, err := parseFloats(line)
+			if err != nil {
+				return nil, fmt.Errorf("motif %s: %s", header[0], err)
+			}
+			rows[j] = values
+		}
+
+		counts := make([][4]float64, len(rows[0]))
+		for j, row := range rows {
+			if len(row) != len(counts) {
+				return nil, fmt.Errorf("motif %s: rows of different lengths", header[0])
+			}
+			for k, v := range row {
+				counts[k][j] = v
+			}
+		}
+
+		p, err := NewPWM(header[0], strings.Join(header[1:], " "), counts, nil)
+		if err != nil {
+			return nil, err
+		}
+		pwms = append(pwms, p)
+		i += 5
+	}
+	return pwms, nil
+}
+
+func parseMEME(lines []string) ([]*PWM, error) {
+	pwms := make([]*PWM, 0, 8)
+	var bg []float64
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "ALPHABET"):
+			if a := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(line, "ALPHABET"), "=")); a != "ACGT" {
+				return nil, fmt.Errorf("only DNA motifs (ALPHABET= ACGT) supported")
+			}
+		case strings.HasPrefix(line, "Background letter frequencies"):
+			if i+1 >= len(lines) {
+				return nil, fmt.Errorf("background letter frequencies expected")
+			}
+			i++
+			fields := strings.Fields(lines[i])
+			if len(fields) != 8 {
+				return nil, fmt.Errorf("invalid background letter frequencies: %s", lines[i])
+			}
+			bg = make([]float64, 4)
+			for j := 0; j < 8; j += 2 {
+				b := pwmBase2Index[fields[j][0]]
+				f, err := strconv.ParseFloat(fields[j+1], 64)
+				if b < 0 || err != nil {
+					return nil, fmt.Errorf("invalid background letter frequencies: %s", lines[i])
+				}
+				bg[b] = f
+			}
+		case strings.HasPrefix(line, "MOTIF"):
+			header := strings.Fields(line)
+			if len(header) < 2 {
+				return nil, fmt.Errorf("invalid MOTIF line: %s", line)
+			}
+			id := header[1]
+			if i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], "letter-probability matrix") {
+				return nil, fmt.Errorf("letter-probability matrix expected for motif: %s", id)
+			}
+			i++
+			w, nsites := -1, float64(pwmDefaultSites)
+			parts := strings.SplitN(lines[i], ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid letter-probability matrix line: %s", lines[i])
+			}
+			fields := strings.Fields(strings.ReplaceAll(parts[1], "= ", "="))
+			for _, f := range fields {
+				kv := strings.SplitN(f, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				switch kv[0] {
+				case "w":
+					w, _ = strconv.Atoi(kv[1])
+				case "nsites":
+					if v, err := strconv.ParseFloat(kv[1], 64); err == nil && v > 0 {
+						nsites = v
+					}
+				}
+			}
+			if w <= 0 || i+w >= len(lines) {
+				return nil, fmt.Errorf("invalid width of motif: %s", id)
+			}
+			counts := make([][4]float64, w)
+			for k := 0; k < w; k++ {
+				i++
+				values, err := parseFloats(lines[i])
+				if err != nil || len(values) != 4 {
+					return nil, fmt.Errorf("motif %s: four probabilities expected: %s", id, lines[i])
+				}
+				for j, v := range values {
+					counts[k][j] = v * nsites
+				}
+			}
+			p, err := NewPWM(id, strings.Join(header[2:], " "), counts, bg)
+			if err != nil {
+				return nil, err
+			}
+			pwms = append(pwms, p)
+		}
+	}
+	if len(pwms) == 0 {
+		return nil, fmt.Errorf("no motifs found")
+	}
+	return pwms, nil
+}
+
+// LocatePWMs scans a record with PWMs, reporting sites with scores >=
+// the thresholds (one for each PWM). Only Circular and OnlyPositiveStrand
+// of opt are used. Sites containing bases other than A, C, G, T and U
+// are skipped. Locations are grouped by PWM, following the order of pwms.
+func LocatePWMs(record *fastx.Record, pwms []*PWM, thresholds []float64, opt *LocateOptions) ([]MotifLocation, error) {
+	if len(thresholds) != len(pwms) {
+		return nil, fmt.Errorf("the numbers of PWMs and thresholds do not match")
+	}
+	s := record.Seq.Seq
+	l := len(s)
+	if l == 0 {
+		return nil, nil
+	}
+	if opt.Circular {
+		s = append(s[:l:l], s...)
+	}
+
+	locs := make([]MotifLocation, 0, 8)
+	var score, min int
+	var ok bool
+	var matched []byte
+	for k, p := range pwms {
+		min = int(math.Ceil(thresholds[k]*pwmScoreScale - 1e-9))
+		w := p.Len()
+		for _, strand := range []string{"+", "-"} {
+			if strand == "-" && opt.OnlyPositiveStrand {
+				break
+			}
+			_p := p
+			if strand == "-" {
+				_p = p.revcom()
+			}
+			for i := 0; i+w <= len(s); i++ {
+				if opt.Circular && i >= l { // 2nd clone of original part
+					break
+				}
+				score, ok = _p.score(s[i : i+w])
+				if !ok || score < min {
+					continue
+				}
+				matched = s[i : i+w]
+				if strand == "-" {
+					matched = (&seq.Seq{Alphabet: seq.DNAredundant, Seq: matched}).RevCom().Seq
+				}
+				locs = append(locs, MotifLocation{
+					Motif:   p.ID,
+					Strand:  strand,
+					Begin:   i + 1,
+					End:     i + w,
+					Matched: matched,
+					Score:   float64(score) / pwmScoreScale,
+					PValue:  p.pvalue(score),
+				})
+			}
+		}
+	}
+	return locs, nil
+}
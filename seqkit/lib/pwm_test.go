@@ -0,0 +1,155 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+const testJASPAR = `>MA0001.1 test motif
+A  [ 10  0 ]
+C  [  0  0 ]
+G  [  0 10 ]
+T  [  0  0 ]
+`
+
+const testMEME = `MEME version 4
+
+ALPHABET= ACGT
+
+strands: + -
+
+Background letter frequencies
+A 0.3 C 0.2 G 0.2 T 0.3
+
+MOTIF m1 test
+letter-probability matrix: alength= 4 w= 2 nsites= 10 E= 0
+ 1.0  0.0  0.0  0.0
+ 0.0  0.0  1.0  0.0
+URL http://example.org/m1
+`
+
+func TestParsePWMs(t *testing.T) {
+	tests := []struct {
+		format string
+		text   string
+		id     string
+		name   string
+		score  float64 // of "AG"
+		pvalue float64
+	}{
+		{"JASPAR", testJASPAR, "MA0001.1", "test motif", 3.80, 0.0625},
+		{"MEME", testMEME, "m1", "test", 3.85, 0.06},
+	}
+	for _, test := range tests {
+		pwms, err := ParsePWMs(strings.NewReader(test.text))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.format, err)
+			continue
+		}
+		if len(pwms) != 1 {
+			t.Errorf("%s: expected 1 motif, returned %d", test.format, len(pwms))
+			continue
+		}
+		p := pwms[0]
+		if p.ID != test.id || p.Name != test.name || string(p.Consensus) != "AG" {
+			t.Errorf("%s: unexpected motif: %s, %s, %s", test.format, p.ID, p.Name, p.Consensus)
+		}
+		score, ok := p.Score([]byte("AG"))
+		if !ok || math.Abs(score-test.score) > 1e-9 || math.Abs(p.MaxScore()-test.score) > 1e-9 {
+			t.Errorf("%s: expected score %v, returned %v", test.format, test.score, score)
+		}
+		if pv := p.PValue(score); math.Abs(pv-test.pvalue) > 1e-9 {
+			t.Errorf("%s: expected p-value %v, returned %v", test.format, test.pvalue, pv)
+		}
+		if th := p.ScoreThreshold(test.pvalue); math.Abs(th-test.score) > 1e-9 {
+			t.Errorf("%s: expected score threshold %v, returned %v", test.format, test.score, th)
+		}
+		if th := p.ScoreThreshold(test.pvalue / 2); th <= p.MaxScore() {
+			t.Errorf("%s: score threshold should be greater than max score, returned %v", test.format, th)
+		}
+		if _, ok = p.Score([]byte("AN")); ok {
+			t.Errorf("%s: N should not be scored", test.format)
+		}
+	}
+
+	// one best base and one other: 1/16 + 2 * 3/16
+	pwms, _ := ParsePWMs(strings.NewReader(testJASPAR))
+	score, _ := pwms[0].Score([]byte("AT"))
+	if pv := pwms[0].PValue(score); math.Abs(pv-7.0/16) > 1e-9 {
+		t.Errorf("expected p-value %v, returned %v", 7.0/16, pv)
+	}
+
+	for _, text := range []string{"", "ACGT\n", ">m\nA [1 2]\nC [1 2]\nG [1]\nT [1 2]\n", ">m\nA [1 2]\n",
+		"MEME version 4\nALPHABET= ACDEFGHIKLMNPQRSTVWY\n", "MEME version 4\nMOTIF m\nletter-probability matrix: w= 2\n0.25 0.25 0.25 0.25\n",
+		"MEME version 4\nMOTIF m\nletter-probability matrix w= 1\n0.25 0.25 0.25 0.25\n"} {
+		if _, err := ParsePWMs(strings.NewReader(text)); err == nil {
+			t.Errorf("error expected for: %q", text)
+		}
+	}
+}
+
+func TestLocatePWMs(t *testing.T) {
+	pwms, err := ParsePWMs(strings.NewReader(testJASPAR))
+	if err != nil {
+		t.Fatal(err)
+	}
+	threshold := pwms[0].ScoreThreshold(0.0625)
+
+	tests := []struct {
+		name     string
+		sequence string
+		opt      LocateOptions
+		locs     string // strand:begin-end:matched:score, joined by ","
+	}{
+		{"both strands", "CCAGTTCTAGG", LocateOptions{},
+			"+:3-4:AG:3.80,+:9-10:AG:3.80,-:7-8:AG:3.80"},
+		{"only positive strand", "CCAGTTCTAGG", LocateOptions{OnlyPositiveStrand: true},
+			"+:3-4:AG:3.80,+:9-10:AG:3.80"},
+		{"circular", "GTTCCA", LocateOptions{Circular: true},
+			"+:6-7:AG:3.80"},
+	}
+	for _, test := range tests {
+		s, err := seq.NewSeq(seq.DNAredundant, []byte(test.sequence))
+		if err != nil {
+			t.Fatal(err)
+		}
+		record := &fastx.Record{ID: []byte("s"), Name: []byte("s"), Seq: s}
+		locs, err := LocatePWMs(record, pwms, []float64{threshold}, &test.opt)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		tmp := make([]string, len(locs))
+		for i, loc := range locs {
+			tmp[i] = fmt.Sprintf("%s:%d-%d:%s:%.2f", loc.Strand, loc.Begin, loc.End, loc.Matched, loc.Score)
+		}
+		if r := strings.Join(tmp, ","); r != test.locs {
+			t.Errorf("%s: expected %s, returned %s", test.name, test.locs, r)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"io"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/util"
+	"github.com/shenwei356/util/byteutil"
+	"github.com/shenwei356/util/math"
+)
+
+// StatsOptions contains the options of ComputeStats.
+type StatsOptions struct {
+	All        bool   // also compute quartiles, sum_gap, N50, Q20, Q30 and GC
+	GapLetters []byte // letters counted as gaps
+	FqEncoding seq.QualityEncoding
+}
+
+// SeqStats holds simple statistics of a stream of records.
+type SeqStats struct {
+	Format string // "FASTA", "FASTQ", or "" for empty stream
+	Type   string // "DNA", "RNA", "Protein", ...
+
+	Num    uint64
+	LenSum uint64
+	GapSum uint64
+	LenMin uint64
+	LenAvg float64
+	LenMax uint64
+	N50    uint64
+	L50    int
+
+	Q1 float64
+	Q2 float64
+	Q3 float64
+
+	Q20 float64 // percentage of bases with quality >= 20
+	Q30 float64 // percentage of bases with quality >= 30
+
+	GC float64 // GC content (%)
+}
+
+var gcLetters = []byte{'g', 'c', 'G', 'C'}
+
+// ComputeStats computes statistics of all records in r.
+// The sequence type is only available when r also reports
+// the alphabet of the stream, like *fastx.Reader.
+func ComputeStats(r RecordReader, opt *StatsOptions) (*SeqStats, error) {
+	lensStats := util.NewLengthStats()
+
+	var gapSum, gcSum uint64
+	var q20, q30 int64
+	encodeOffset := opt.FqEncoding.Offset()
+
+	stats := &SeqStats{}
+	for {
+		record, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		if stats.Format == "" {
+			if len(record.Seq.Qual) > 0 {
+				stats.Format = "FASTQ"
+			} else {
+				stats.Format = "FASTA"
+			}
+		}
+
+		lensStats.Add(uint64(len(record.Seq.Seq)))
+
+		if opt.All {
+			for _, q := range record.Seq.Qual {
+				if int(q)-encodeOffset >= 20 {
+					q20++
+					if int(q)-encodeOffset >= 30 {
+						q30++
+					}
+				}
+			}
+
+			gapSum += uint64(byteutil.CountBytes(record.Seq.Seq, opt.GapLetters))
+			gcSum += uint64(byteutil.CountBytes(record.Seq.Seq, gcLetters))
+		}
+	}
+
+	if ar, ok := r.(alphabetReader); ok {
+		alphabet := ar.Alphabet()
+		if alphabet == seq.DNAredundant {
+			stats.Type = "DNA"
+		} else if alphabet == seq.RNAredundant {
+			stats.Type = "RNA"
+		} else if stats.Format == "" && alphabet == seq.Unlimit {
+			stats.Type = ""
+		} else {
+			stats.Type = alphabet.String()
+		}
+	}
+
+	if lensStats.Count() == 0 {
+		return stats, nil
+	}
+
+	stats.Num = lensStats.Count()
+	stats.LenSum = lensStats.Sum()
+	stats.GapSum = gapSum
+	stats.LenMin = lensStats.Min()
+	stats.LenAvg = math.Round(lensStats.Mean(), 1)
+	stats.LenMax = lensStats.Max()
+	if opt.All {
+		stats.N50 = lensStats.N50()
+		stats.L50 = lensStats.L50()
+		stats.Q1, stats.Q2, stats.Q3 = lensStats.Q1(), lensStats.Q2(), lensStats.Q3()
+	}
+	stats.Q20 = math.Round(float64(q20)/float64(stats.LenSum)*100, 2)
+	stats.Q30 = math.Round(float64(q30)/float64(stats.LenSum)*100, 2)
+	stats.GC = math.Round(float64(gcSum)/float64(stats.LenSum)*100, 2)
+	return stats, nil
+}
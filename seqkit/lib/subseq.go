@@ -0,0 +1,116 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"fmt"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+// FlankOptions specifies flanking regions of features.
+type FlankOptions struct {
+	UpStream   int
+	DownStream int
+	OnlyFlank  bool // only return up/down stream sequence
+}
+
+// SubRecordByFeature returns the sequence of a feature region
+// [start, end] (1-based, end included) on the given strand ("+", "-",
+// or nil for unknown), including flanking sequences.
+// Sequences on the negative strand are reverse complemented.
+// The new record is named "<id>_<start>-<end>:<strand><flank info> <tag>".
+func SubRecordByFeature(record *fastx.Record, start, end int, strand *string, tag string, opt *FlankOptions) (*fastx.Record, error) {
+	upStream, downStream := opt.UpStream, opt.DownStream
+
+	s, e := start, end
+	var subseq *seq.Seq
+	if strand != nil && *strand == "-" {
+		if opt.OnlyFlank {
+			if upStream > 0 {
+				s = end + 1
+				e = end + upStream
+			} else {
+				s = start - downStream
+				e = start - 1
+			}
+		} else {
+			s = start - downStream // seq.SubSeq will check it
+			e = end + upStream
+		}
+		if s < 1 {
+			s = 1
+		}
+		if e > len(record.Seq.Seq) {
+			e = len(record.Seq.Seq)
+		}
+		subseq = record.Seq.SubSeq(s, e).RevComInplace()
+	} else {
+		if opt.OnlyFlank {
+			if upStream > 0 {
+				s = start - upStream
+				e = start - 1
+			} else {
+				s = e + 1
+				e = e + downStream
+			}
+		} else {
+			s = start - upStream
+			e = end + downStream
+		}
+		if s < 1 {
+			s = 1
+		}
+		if e > len(record.Seq.Seq) {
+			e = len(record.Seq.Seq)
+		}
+		subseq = record.Seq.SubSeq(s, e)
+	}
+
+	_strand := "."
+	if strand != nil {
+		_strand = *strand
+	}
+
+	var flankInfo string
+	if upStream > 0 {
+		if opt.OnlyFlank {
+			flankInfo = fmt.Sprintf("_usf:%d", upStream)
+		} else if downStream > 0 {
+			flankInfo = fmt.Sprintf("_us:%d_ds:%d", upStream, downStream)
+		} else {
+			flankInfo = fmt.Sprintf("_us:%d", upStream)
+		}
+	} else if downStream > 0 {
+		if opt.OnlyFlank {
+			flankInfo = fmt.Sprintf("_dsf:%d", downStream)
+		} else {
+			flankInfo = fmt.Sprintf("_ds:%d", downStream)
+		}
+	}
+
+	outname := []byte(fmt.Sprintf("%s_%d-%d:%s%s %s", record.ID, start, end, _strand, flankInfo, tag))
+	if len(subseq.Qual) > 0 {
+		return fastx.NewRecordWithQualWithoutValidation(record.Seq.Alphabet, outname, outname, []byte{}, subseq.Seq, subseq.Qual)
+	}
+	return fastx.NewRecordWithoutValidation(record.Seq.Alphabet, outname, outname, []byte{}, subseq.Seq)
+}
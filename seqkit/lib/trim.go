@@ -0,0 +1,293 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+// TrimOptions contains the options of Trimmer, zero values disable the
+// corresponding steps. Steps are applied in this order: head/tail cropping,
+// quality trimming of the two ends, sliding-window quality trimming,
+// adapter removal, and poly-G and poly-A tail removal.
+type TrimOptions struct {
+	HeadCrop int // number of bases removed from the 5' end
+	TailCrop int // number of bases removed from the 3' end
+
+	QualBase   int // ASCII base of quality, e.g., 33
+	Qual5      int // bases with quality below this are removed from the 5' end
+	Qual3      int // bases with quality below this are removed from the 3' end
+	Window     int // window size of sliding-window quality trimming
+	WindowQual int // the read is cut at the first window with mean quality below this
+
+	// 3' adapters are searched in reads with at most MaxMismatch mismatches,
+	// in the same way of "seqkit locate -m". An adapter partly overlapping
+	// the 3' end of a read by at least MinOverlap bases is also removed,
+	// with mismatches allowed in proportion to the overlap length.
+	MaxMismatch int
+	MinOverlap  int
+
+	PolyG int // minimum length of poly-G tails to remove
+	PolyA int // minimum length of poly-A tails to remove
+}
+
+// TrimResult records what is removed from a read by Trimmer.
+type TrimResult struct {
+	Length int // original length
+
+	Cropped        int    // bases removed by head/tail cropping
+	QualTrimmed    int    // bases removed by quality trimming
+	Adapter        string // name of the adapter found, empty for none
+	AdapterTrimmed int    // bases removed with the adapter
+	PolyTrimmed    int    // bases removed with poly-G/poly-A tails
+
+	// the 0-based and half-open region of the original read that is kept
+	Begin, End int
+}
+
+// Trimmer trims reads by quality, adapters, poly-G/poly-A tails and
+// fixed lengths.
+type Trimmer struct {
+	opt *TrimOptions
+
+	names    []string
+	adapters [][]byte // in lower case
+	motifs   []*Motif
+	locOpt   *LocateOptions
+}
+
+// NewTrimmer creates a Trimmer, adapters could be empty.
+func NewTrimmer(adapters []*fastx.Record, opt *TrimOptions) (*Trimmer, error) {
+	if opt.Window > 0 && opt.WindowQual <= 0 || opt.Window <= 0 && opt.WindowQual > 0 {
+		return nil, fmt.Errorf("both window size and quality should be positive for sliding-window quality trimming")
+	}
+	if opt.MinOverlap < 1 {
+		return nil, fmt.Errorf("minimum overlap of adapters should be positive")
+	}
+
+	t := &Trimmer{
+		opt: opt,
+		locOpt: &LocateOptions{
+			IgnoreCase:         true,
+			OnlyPositiveStrand: true,
+			MaxMismatch:        opt.MaxMismatch,
+			Threads:            1,
+		},
+	}
+	for _, a := range adapters {
+		m, err := NewMotif(string(a.ID), a.Seq.Seq, seq.Unlimit, t.locOpt)
+		if err != nil {
+			return nil, fmt.Errorf("adapter %s: %s", a.ID, err)
+		}
+		t.names = append(t.names, string(a.ID))
+		t.adapters = append(t.adapters, bytes.ToLower(a.Seq.Seq))
+		t.motifs = append(t.motifs, m)
+	}
+	return t, nil
+}
+
+// Trim trims a read in place and returns what is removed.
+func (t *Trimmer) Trim(record *fastx.Record) (TrimResult, error) {
+	opt := t.opt
+	s := record.Seq.Seq
+	q := record.Seq.Qual
+	r := TrimResult{Length: len(s), End: len(s)}
+
+	// cropping
+	begin, end := opt.HeadCrop, len(s)-opt.TailCrop
+	if begin > end {
+		begin = end
+	}
+	if begin < 0 {
+		begin, end = 0, 0
+	}
+	r.Cropped = len(s) - (end - begin)
+
+	// quality
+	if len(q) > 0 {
+		b, e := begin, end
+		b, e = TrimQualEnds(q[b:e], opt.QualBase, opt.Qual5, opt.Qual3)
+		b, e = begin+b, begin+e
+		if opt.Window > 0 {
+			e = b + TrimQualWindow(q[b:e], opt.QualBase, opt.Window, opt.WindowQual)
+		}
+		r.QualTrimmed = (end - begin) - (e - b)
+		begin, end = b, e
+	}
+
+	// adapters
+	if len(t.motifs) > 0 && end > begin {
+		i, name, err := t.findAdapter(s[begin:end])
+		if err != nil {
+			return r, fmt.Errorf("%s: %s", record.ID, err)
+		}
+		if i >= 0 {
+			r.Adapter = name
+			r.AdapterTrimmed = end - begin - i
+			end = begin + i
+		}
+	}
+
+	// poly-G and poly-A tails
+	e := end
+	if opt.PolyG > 0 {
+		e = begin + TrimPolyX(s[begin:e], 'G', opt.PolyG)
+	}
+	if opt.PolyA > 0 {
+		e = begin + TrimPolyX(s[begin:e], 'A', opt.PolyA)
+	}
+	r.PolyTrimmed = end - e
+	end = e
+
+	r.Begin, r.End = begin, end
+	record.Seq.Seq = s[begin:end]
+	if len(q) > 0 {
+		record.Seq.Qual = q[begin:end]
+	}
+	return r, nil
+}
+
+// findAdapter returns the 0-based location of the leftmost adapter in s,
+// including those partly overlapping the 3' end, or -1 if not found.
+func (t *Trimmer) findAdapter(s []byte) (int, string, error) {
+	locs, err := LocateMotifs(&fastx.Record{Name: []byte("read"), Seq: &seq.Seq{Alphabet: seq.Unlimit, Seq: s}}, t.motifs, t.locOpt)
+	if err != nil {
+		return -1, "", err
+	}
+	pos, name := -1, ""
+	for _, loc := range locs {
+		if pos < 0 || loc.Begin-1 < pos {
+			pos, name = loc.Begin-1, loc.Motif
+		}
+	}
+
+	// partial adapters at the 3' end
+	s = bytes.ToLower(s)
+	n := len(s)
+	var k, from int
+	for i, a := range t.adapters {
+		k = len(a) - 1
+		if k > n {
+			k = n
+		}
+		from = n - k
+		if pos >= 0 && from < pos {
+			from = pos
+		}
+		for j := from; j <= n-t.opt.MinOverlap; j++ {
+			k = n - j
+			if mismatches(s[j:], a[:k]) <= t.opt.MaxMismatch*k/len(a) {
+				if pos < 0 || j < pos {
+					pos, name = j, t.names[i]
+				}
+				break
+			}
+		}
+	}
+	return pos, name, nil
+}
+
+// TrimQualEnds returns the 0-based and half-open region left after
+// removing bases with quality below qual5 from the 5' end and those below
+// qual3 from the 3' end. Zero thresholds disable the trimming.
+func TrimQualEnds(qual []byte, qBase, qual5, qual3 int) (int, int) {
+	begin, end := 0, len(qual)
+	if qual5 > 0 {
+		for begin < end && int(qual[begin])-qBase < qual5 {
+			begin++
+		}
+	}
+	if qual3 > 0 {
+		for end > begin && int(qual[end-1])-qBase < qual3 {
+			end--
+		}
+	}
+	return begin, end
+}
+
+// TrimQualWindow scans the quality from the 5' end with a sliding window,
+// and cuts the read at the first window with mean quality below minQual,
+// keeping the leading bases of the window with quality >= minQual.
+// It returns the length left. Reads shorter than the window are
+// treated as a single window.
+func TrimQualWindow(qual []byte, qBase, window, minQual int) int {
+	n := len(qual)
+	if n == 0 {
+		return 0
+	}
+	if window > n {
+		window = n
+	}
+	var sum int
+	for _, b := range qual[:window] {
+		sum += int(b) - qBase
+	}
+	threshold := minQual * window
+	for i := 0; i+window <= n; i++ {
+		if i > 0 {
+			sum += int(qual[i+window-1]) - int(qual[i-1])
+		}
+		if sum < threshold {
+			end := i
+			for end < i+window && int(qual[end])-qBase >= minQual {
+				end++
+			}
+			return end
+		}
+	}
+	return n
+}
+
+// TrimPolyX returns the length left after removing a 3' tail of the base x
+// (case-insensitive) with at least minLen bases. Like fastp, one mismatch
+// is tolerated every 8 bases, at most 5 in total, mismatches should not be
+// adjacent, and the tail starts with x.
+func TrimPolyX(s []byte, x byte, minLen int) int {
+	x = x &^ 0x20 // upper case
+	n := len(s)
+	var mis, allowed int
+	cut := n
+	for i := n - 1; i >= 0; i-- {
+		if s[i]&^0x20 != x {
+			if i+1 < n && s[i+1]&^0x20 != x {
+				break
+			}
+			mis++
+			allowed = (n - i) / 8
+			if allowed > 5 {
+				allowed = 5
+			}
+			if mis > allowed {
+				break
+			}
+			continue
+		}
+		cut = i
+	}
+	if n-cut < minLen {
+		return n
+	}
+	return cut
+}
@@ -0,0 +1,163 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+// phred converts quality scores to Phred+33 characters.
+func phred(scores ...int) []byte {
+	q := make([]byte, len(scores))
+	for i, s := range scores {
+		q[i] = byte(s + 33)
+	}
+	return q
+}
+
+func TestTrimQual(t *testing.T) {
+	q := phred(2, 10, 30, 30, 30, 30, 12, 30, 8, 2, 2)
+	if b, e := TrimQualEnds(q, 33, 20, 20); b != 2 || e != 8 {
+		t.Errorf("TrimQualEnds: expected 2-8, returned %d-%d", b, e)
+	}
+	if b, e := TrimQualEnds(q, 33, 0, 5); b != 0 || e != 9 {
+		t.Errorf("TrimQualEnds: expected 0-9, returned %d-%d", b, e)
+	}
+	if b, e := TrimQualEnds(phred(2, 2), 33, 20, 20); b != e {
+		t.Errorf("TrimQualEnds: expected an empty region, returned %d-%d", b, e)
+	}
+
+	tests := []struct {
+		qual           []byte
+		window, minQua int
+		n              int
+	}{
+		{phred(30, 30, 30, 30, 30, 30), 3, 20, 6},
+		{phred(30, 30, 30, 30, 30, 10, 10, 30), 3, 20, 5},
+		{phred(30, 30, 30, 30, 25, 10, 10, 10), 4, 20, 5},
+		{phred(30, 30, 30, 30, 30, 2), 4, 20, 6}, // mean of the last window is 23
+		{phred(10, 30, 30, 30, 30, 30), 4, 20, 6},
+		{phred(10, 10), 4, 20, 0},
+		{nil, 4, 20, 0},
+	}
+	for i, test := range tests {
+		if n := TrimQualWindow(test.qual, 33, test.window, test.minQua); n != test.n {
+			t.Errorf("TrimQualWindow #%d: expected %d, returned %d", i, test.n, n)
+		}
+	}
+}
+
+func TestTrimPolyX(t *testing.T) {
+	tests := []struct {
+		s      string
+		x      byte
+		minLen int
+		n      int
+	}{
+		{"ACGTACGGGGGGGGGG", 'G', 10, 6},
+		{"ACGTACGGGGGGGGGG", 'G', 11, 16},
+		{"ACGTACGGGGGTGGGGGGGG", 'G', 10, 6},  // 1 mismatch in 14 bases
+		{"ACGTACGGGGGGGGTGGGGG", 'G', 10, 20}, // no mismatch in the last 8 bases
+		{"ACGTAAAAAAAaaaaaaaaaaaaaaaaa", 'a', 10, 4},
+		{"GGGGGGGGGGGG", 'G', 10, 0},
+		{"", 'G', 10, 0},
+	}
+	for _, test := range tests {
+		if n := TrimPolyX([]byte(test.s), test.x, test.minLen); n != test.n {
+			t.Errorf("TrimPolyX %s: expected %d, returned %d", test.s, test.n, n)
+		}
+	}
+}
+
+func TestTrimmer(t *testing.T) {
+	adapter, _ := fastx.NewRecordWithoutValidation(seq.DNA, []byte("a1"), []byte("a1"), nil, []byte("AGATCGGAAGAGC"))
+
+	tests := []struct {
+		name string
+		opt  TrimOptions
+		s    string
+		q    []byte
+		out  string
+		r    TrimResult
+	}{
+		{"crop", TrimOptions{HeadCrop: 2, TailCrop: 3, MinOverlap: 3},
+			"ACGTACGTAC", nil, "GTACG",
+			TrimResult{Length: 10, Cropped: 5, Begin: 2, End: 7}},
+		{"crop all", TrimOptions{HeadCrop: 6, TailCrop: 6, MinOverlap: 3},
+			"ACGTACGTAC", nil, "",
+			TrimResult{Length: 10, Cropped: 10, Begin: 4, End: 4}},
+		{"quality", TrimOptions{QualBase: 33, Qual5: 20, Window: 3, WindowQual: 20, MinOverlap: 3},
+			"ACGTACGTAC", phred(2, 30, 30, 30, 30, 30, 10, 10, 10, 30), "CGTAC",
+			TrimResult{Length: 10, QualTrimmed: 5, Begin: 1, End: 6}},
+		{"adapter", TrimOptions{MinOverlap: 3},
+			"ACGTACGTACAGATCGGAAGAGCACACGTCT", nil, "ACGTACGTAC",
+			TrimResult{Length: 31, Adapter: "a1", AdapterTrimmed: 21, Begin: 0, End: 10}},
+		{"adapter with a mismatch", TrimOptions{MaxMismatch: 1, MinOverlap: 3},
+			"ACGTACGTACAGATCGTAAGAGCACACGTCT", nil, "ACGTACGTAC",
+			TrimResult{Length: 31, Adapter: "a1", AdapterTrimmed: 21, Begin: 0, End: 10}},
+		{"partial adapter", TrimOptions{MaxMismatch: 1, MinOverlap: 3},
+			"ACGTACGTACAGATCGG", nil, "ACGTACGTAC",
+			TrimResult{Length: 17, Adapter: "a1", AdapterTrimmed: 7, Begin: 0, End: 10}},
+		{"read shorter than adapter", TrimOptions{MaxMismatch: 1, MinOverlap: 3},
+			"ACGTAGAT", nil, "ACGT",
+			TrimResult{Length: 8, Adapter: "a1", AdapterTrimmed: 4, Begin: 0, End: 4}},
+		{"short overlap", TrimOptions{MinOverlap: 4},
+			"ACGTACGTACAGA", nil, "ACGTACGTACAGA",
+			TrimResult{Length: 13, Begin: 0, End: 13}},
+		{"poly-G", TrimOptions{PolyG: 5, PolyA: 5, MinOverlap: 3},
+			"ACGTACGTACAAAAAGGGGGGG", nil, "ACGTACGTAC",
+			TrimResult{Length: 22, PolyTrimmed: 12, Begin: 0, End: 10}},
+	}
+	for _, test := range tests {
+		trimmer, err := NewTrimmer([]*fastx.Record{adapter}, &test.opt)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		var record *fastx.Record
+		if test.q != nil {
+			record, _ = fastx.NewRecordWithQualWithoutValidation(seq.DNA, []byte("r"), []byte("r"), nil, []byte(test.s), test.q)
+		} else {
+			record, _ = fastx.NewRecordWithoutValidation(seq.DNA, []byte("r"), []byte("r"), nil, []byte(test.s))
+		}
+		r, err := trimmer.Trim(record)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if string(record.Seq.Seq) != test.out {
+			t.Errorf("%s: expected %s, returned %s", test.name, test.out, record.Seq.Seq)
+		}
+		if test.q != nil && len(record.Seq.Qual) != len(record.Seq.Seq) {
+			t.Errorf("%s: quality not trimmed along with the sequence", test.name)
+		}
+		if r != test.r {
+			t.Errorf("%s: expected %+v, returned %+v", test.name, test.r, r)
+		}
+	}
+
+	if _, err := NewTrimmer(nil, &TrimOptions{Window: 4, MinOverlap: 3}); err == nil {
+		t.Errorf("error expected for a window without quality threshold")
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/shenwei356/bio/seq"
+)
+
+// UMIPattern describes the layout of the 5' end of reads carrying UMIs,
+// where 'N' stands for a UMI base and 'X' for a base kept in the read,
+// e.g., "NNNNNNNNXXXX" for an 8-bp UMI followed by 4 bases to keep.
+// Bases after the pattern are always kept.
+type UMIPattern struct {
+	pattern []byte // in upper case
+	umiLen  int
+}
+
+// ParseUMIPattern checks and parses a UMI pattern.
+func ParseUMIPattern(pattern string) (*UMIPattern, error) {
+	p := &UMIPattern{pattern: bytes.ToUpper([]byte(pattern))}
+	for _, c := range p.pattern {
+		switch c {
+		case 'N':
+			p.umiLen++
+		case 'X':
+		default:
+			return nil, fmt.Errorf("invalid character '%c' in UMI pattern: %s, only N and X allowed", c, pattern)
+		}
+	}
+	if p.umiLen == 0 {
+		return nil, fmt.Errorf("no UMI bases (N) in UMI pattern: %s", pattern)
+	}
+	return p, nil
+}
+
+// Len returns the length of the pattern.
+func (p *UMIPattern) Len() int { return len(p.pattern) }
+
+// UMILen returns the length of UMIs.
+func (p *UMIPattern) UMILen() int { return p.umiLen }
+
+// Extract removes UMI bases (and their qualities) from the 5' end of s
+// in place, and returns the UMI in upper case. It returns false and leaves
+// s untouched if s is shorter than the pattern.
+func (p *UMIPattern) Extract(s *seq.Seq) ([]byte, bool) {
+	if len(s.Seq) < len(p.pattern) {
+		return nil, false
+	}
+	hasQual := len(s.Qual) == len(s.Seq)
+	umi := make([]byte, 0, p.umiLen)
+	var j int // position of the next kept base
+	for i, c := range p.pattern {
+		if c == 'N' {
+			umi = append(umi, s.Seq[i])
+			continue
+		}
+		s.Seq[j] = s.Seq[i]
+		if hasQual {
+			s.Qual[j] = s.Qual[i]
+		}
+		j++
+	}
+	if j < len(p.pattern) {
+		n := copy(s.Seq[j:], s.Seq[len(p.pattern):])
+		s.Seq = s.Seq[:j+n]
+		if hasQual {
+			copy(s.Qual[j:], s.Qual[len(p.pattern):])
+			s.Qual = s.Qual[:j+n]
+		}
+	}
+	return bytes.ToUpper(umi), true
+}
+
+// EditDistance returns the Levenshtein distance between a and b.
+func EditDistance(a, b []byte) int {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	var diag, up, cost int
+	for i := 1; i <= len(a); i++ {
+		diag, row[0] = row[0], i
+		for j := 1; j <= len(b); j++ {
+			up = row[j]
+			cost = diag
+			if a[i-1] != b[j-1] {
+				cost++
+			}
+			if up+1 < cost {
+				cost = up + 1
+			}
+			if row[j-1]+1 < cost {
+				cost = row[j-1] + 1
+			}
+			row[j], diag = cost, up
+		}
+	}
+	return row[len(b)]
+}
+
+// UMIRead is a read, or a read pair, for UMI-aware deduplication.
+type UMIRead struct {
+	UMI  []byte
+	Key  []byte  // e.g., a prefix of the sequence, only reads with the same key are compared
+	Qual float64 // e.g., the mean quality, the read with the highest value is kept
+}
+
+// DedupUMIs groups reads with the same Key and similar UMIs, and returns
+// the index of the representative read of the group of each read, i.e., a
+// read is kept if the returned value equals its own index.
+//
+// In each group of reads with the same Key, distinct UMIs are visited in
+// descending order of their counts, and each UMI joins the cluster of the
+// first visited UMI within maxDist edits, or starts a new cluster. So UMIs
+// with sequencing errors are merged into more abundant ones. The read with
+// the highest Qual in a cluster is the representative, the first one is
+// chosen in case of ties.
+func DedupUMIs(reads []UMIRead, maxDist int) []int {
+	rep := make([]int, len(reads))
+
+	groups := make(map[string][]int) // key -> indexes of reads
+	keys := make([]string, 0, 1024)
+	for i, r := range reads {
+		k := string(r.Key)
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], i)
+	}
+
+	for _, k := range keys {
+		idxs := groups[k]
+
+		counts := make(map[string]int)
+		for _, i := range idxs {
+			counts[string(reads[i].UMI)]++
+		}
+		umis := make([]string, 0, len(counts))
+		for u := range counts {
+			umis = append(umis, u)
+		}
+		sort.Slice(umis, func(i, j int) bool {
+			if counts[umis[i]] != counts[umis[j]] {
+				return counts[umis[i]] > counts[umis[j]]
+			}
+			return umis[i] < umis[j]
+		})
+
+		// UMI -> UMI of the cluster center
+		centers := make([]string, 0, len(umis))
+		cluster := make(map[string]string, len(umis))
+		for _, u := range umis {
+			cluster[u] = u
+			for _, c := range centers {
+				if maxDist > 0 && EditDistance([]byte(u), []byte(c)) <= maxDist {
+					cluster[u] = c
+					break
+				}
+			}
+			if cluster[u] == u {
+				centers = append(centers, u)
+			}
+		}
+
+		best := make(map[string]int, len(centers)) // center -> index of the best read
+		for _, i := range idxs {
+			c := cluster[string(reads[i].UMI)]
+			if b, ok := best[c]; !ok || reads[i].Qual > reads[b].Qual {
+				best[c] = i
+			}
+		}
+		for _, i := range idxs {
+			rep[i] = best[cluster[string(reads[i].UMI)]]
+		}
+	}
+	return rep
+}
@@ -0,0 +1,100 @@
+// Copyright © 2016-2019 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shenwei356/bio/seq"
+)
+
+func TestUMIPattern(t *testing.T) {
+	p, err := ParseUMIPattern("NNNxxNN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Len() != 7 || p.UMILen() != 5 {
+		t.Errorf("expected length 7 and UMI length 5, returned %d and %d", p.Len(), p.UMILen())
+	}
+
+	s, _ := seq.NewSeqWithQual(seq.DNAredundant, []byte("acgTTggCCCC"), []byte("ABCDEFGHIJK"))
+	umi, ok := p.Extract(s)
+	if !ok {
+		t.Fatal("unexpected failure")
+	}
+	if string(umi) != "ACGGG" || string(s.Seq) != "TTCCCC" || string(s.Qual) != "DEHIJK" {
+		t.Errorf("unexpected result: %s, %s, %s", umi, s.Seq, s.Qual)
+	}
+
+	s, _ = seq.NewSeq(seq.DNAredundant, []byte("ACGTAC"))
+	if _, ok = p.Extract(s); ok || string(s.Seq) != "ACGTAC" {
+		t.Errorf("short sequence: expected failure, returned %v, %s", ok, s.Seq)
+	}
+
+	for _, pattern := range []string{"", "XXXX", "NNNCXX"} {
+		if _, err := ParseUMIPattern(pattern); err == nil {
+			t.Errorf("%s: error expected", pattern)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		d    int
+	}{
+		{"", "", 0},
+		{"ACGT", "", 4},
+		{"ACGT", "ACGT", 0},
+		{"ACGT", "ACCT", 1},
+		{"ACGT", "AGT", 1},
+		{"ACGT", "ACGGT", 1},
+		{"ACGTACGT", "CGTACGTA", 2},
+		{"kitten", "sitting", 3},
+	}
+	for _, test := range tests {
+		if d := EditDistance([]byte(test.a), []byte(test.b)); d != test.d {
+			t.Errorf("%s, %s: expected %d, returned %d", test.a, test.b, test.d, d)
+		}
+		if d := EditDistance([]byte(test.b), []byte(test.a)); d != test.d {
+			t.Errorf("%s, %s: expected %d, returned %d", test.b, test.a, test.d, d)
+		}
+	}
+}
+
+func TestDedupUMIs(t *testing.T) {
+	reads := []UMIRead{
+		{UMI: []byte("AAAA"), Key: []byte("k1"), Qual: 30},
+		{UMI: []byte("AAAA"), Key: []byte("k1"), Qual: 35}, // best of AAAA
+		{UMI: []byte("AAAT"), Key: []byte("k1"), Qual: 40}, // 1 edit to AAAA, best of the cluster
+		{UMI: []byte("AAAA"), Key: []byte("k2"), Qual: 20}, // another key
+		{UMI: []byte("GGGG"), Key: []byte("k1"), Qual: 10},
+		{UMI: []byte("GGGG"), Key: []byte("k1"), Qual: 10}, // tie, the first kept
+		{UMI: []byte("AAAA"), Key: []byte("k1"), Qual: 30},
+	}
+	if rep := DedupUMIs(reads, 1); !reflect.DeepEqual(rep, []int{2, 2, 2, 3, 4, 4, 2}) {
+		t.Errorf("max distance 1: unexpected result: %v", rep)
+	}
+	if rep := DedupUMIs(reads, 0); !reflect.DeepEqual(rep, []int{1, 1, 2, 3, 4, 4, 1}) {
+		t.Errorf("max distance 0: unexpected result: %v", rep)
+	}
+}